@@ -0,0 +1,249 @@
+// Package audit 会话操作审计：Set、Del、DelAllByUID、PurgeUserData 与 Reload（可选失败的 Get）逐条追加到审计输出，
+// 用于回答“会话何时由谁创建、删除”。与会话历史（journal）不同，审计记录包括失败与被拒绝的调用
+package audit
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/bus"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// 审计动作
+const (
+	Set         = "set"
+	Del         = "del"
+	DelAllByUID = "del_all"
+	Reload      = "reload"
+	Get         = "get" // 只记录失败的 Get
+	Purge       = "purge"
+)
+
+// Table 审计表名
+const Table = "session_audit"
+
+// Schema 审计表结构，由会话库结构变更创建
+const Schema = `CREATE TABLE IF NOT EXISTS session_audit (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	event_time TIMESTAMP NOT NULL,
+	action VARCHAR(16) NOT NULL,
+	uid INT NOT NULL DEFAULT 0,
+	session_prefix VARCHAR(16) NOT NULL DEFAULT '',
+	caller VARCHAR(64) NOT NULL DEFAULT '',
+	identity VARCHAR(255) NOT NULL DEFAULT '',
+	code INT NOT NULL DEFAULT 0,
+	error VARCHAR(64) NOT NULL DEFAULT '',
+	INDEX idx_event_time (event_time),
+	INDEX idx_session_prefix (session_prefix),
+	INDEX idx_uid (uid)
+)`
+
+// insertPrefix 与 insertRow 批量写入审计表的语句，见 gateway.ExecInsert
+const (
+	insertPrefix = "INSERT INTO session_audit (event_time, action, uid, session_prefix, caller, identity, code, error) VALUES "
+	insertRow    = "(FROM_UNIXTIME(?), ?, ?, ?, ?, ?, ?, ?)"
+)
+
+// maxBatch 每次写入的最大记录数
+const maxBatch = 100
+
+var logger = logging.For("audit")
+
+var (
+	metricRecords = metrics.NewCounter("stealthim_session_audit_records_total", "Audit records written to the sink")
+	metricDropped = metrics.NewCounter("stealthim_session_audit_dropped_total", "Audit records dropped because the queue was full")
+	metricErrors  = metrics.NewCounter("stealthim_session_audit_errors_total", "Audit records that could not be written to the sink")
+)
+
+// Record 一条审计记录
+type Record struct {
+	Time          time.Time `json:"time"`
+	Action        string    `json:"action"`
+	UID           int32     `json:"uid,omitempty"`            // 请求中的 uid，Del 与 Reload 没有
+	SessionPrefix string    `json:"session_prefix,omitempty"` // 会话ID前缀，不记录完整的会话ID
+	Caller        string    `json:"caller"`                   // 调用方地址
+	Identity      string    `json:"identity,omitempty"`       // 调用方客户端证书的 SAN
+	Code          int32     `json:"code"`                     // 响应的状态码，调用未返回结果时为 -1
+	Error         string    `json:"error,omitempty"`          // 调用未返回结果时的 gRPC 状态（如 Unauthenticated）
+}
+
+// sink 审计输出
+type sink interface {
+	write(ctx context.Context, records []Record) error
+	close() error
+}
+
+var (
+	mu      sync.RWMutex
+	queue   chan Record   // 等待写入的记录，Start 之前与 Stop 之后为 nil
+	stopped chan struct{} // 写入协程退出后关闭
+)
+
+// Enabled 是否记录审计
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return queue != nil
+}
+
+// Log 将记录加入写入队列，不等待写入；未启用时不做任何事
+// 队列满时丢弃记录并计入 stealthim_session_audit_dropped_total，不阻塞请求
+func Log(r Record) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if queue == nil {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	select {
+	case queue <- r:
+	default:
+		metricDropped.Inc()
+	}
+}
+
+// Start 按 [audit] 配置打开审计输出并在后台写入；未配置 sink 时不做任何事
+func Start(cfg config.AuditConfig) error {
+	s, err := openSink(cfg)
+	if err != nil || s == nil {
+		return err
+	}
+	q := make(chan Record, cfg.Buffer)
+	done := make(chan struct{})
+	mu.Lock()
+	queue, stopped = q, done
+	mu.Unlock()
+	go run(s, q, done)
+	logger.Info("audit enabled", "sink", cfg.Sink)
+	return nil
+}
+
+// Stop 停止接收记录并写完队列中剩余的记录，等待写入完成或 ctx 结束
+func Stop(ctx context.Context) error {
+	mu.Lock()
+	q, done := queue, stopped
+	queue = nil
+	mu.Unlock()
+	if q == nil {
+		return nil
+	}
+	close(q)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run 将队列中的记录分批写入 s，直到队列关闭
+func run(s sink, q <-chan Record, done chan<- struct{}) {
+	defer close(done)
+	defer s.close()
+	for r := range q {
+		batch := []Record{r}
+	fill:
+		for len(batch) < maxBatch {
+			select {
+			case r, ok := <-q:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, r)
+			default:
+				break fill
+			}
+		}
+		if err := s.write(context.Background(), batch); err != nil {
+			metricErrors.Add(uint64(len(batch)))
+			logger.Error("write audit records failed", "records", len(batch), "error", err)
+			continue
+		}
+		metricRecords.Add(uint64(len(batch)))
+	}
+}
+
+// openSink 按配置打开审计输出，未配置时返回 nil
+func openSink(cfg config.AuditConfig) (sink, error) {
+	switch cfg.Sink {
+	case "":
+		return nil, nil
+	case config.AuditFile:
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open audit file: %w", err)
+		}
+		return &fileSink{f: f}, nil
+	case config.AuditDB:
+		return dbSink{}, nil
+	case config.AuditStream:
+		return streamSink{channel: cfg.Channel}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q", cfg.Sink)
+	}
+}
+
+// fileSink 以 JSON Lines 追加到文件，每批记录一次写入
+type fileSink struct {
+	f *os.File
+}
+
+func (s *fileSink) write(_ context.Context, records []Record) error {
+	var buf []byte
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	_, err := s.f.Write(buf)
+	return err
+}
+
+func (s *fileSink) close() error {
+	return s.f.Close()
+}
+
+// dbSink 以多行 INSERT 写入 session_audit
+type dbSink struct{}
+
+func (dbSink) write(ctx context.Context, records []Record) error {
+	rows := make([][]any, len(records))
+	for i, r := range records {
+		rows[i] = []any{r.Time.Unix(), r.Action, r.UID, r.SessionPrefix, r.Caller, r.Identity, r.Code, r.Error}
+	}
+	return gateway.ExecInsert(ctx, pb.SqlDatabases_Session, true, insertPrefix, insertRow, rows)
+}
+
+func (dbSink) close() error { return nil }
+
+// streamSink 将每条记录以 JSON 发布到频道，经由失效广播的 Redis 连接
+type streamSink struct {
+	channel string
+}
+
+func (s streamSink) write(_ context.Context, records []Record) error {
+	for _, r := range records {
+		payload, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if err := bus.PublishTo(s.channel, string(payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (streamSink) close() error { return nil }
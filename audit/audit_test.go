@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"StealthIMSession/config"
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	Log(Record{Action: Set}) // 未启用时不做任何事
+	if err := Start(config.AuditConfig{Sink: config.AuditFile, File: path, Buffer: 16}); err != nil {
+		t.Fatal(err)
+	}
+	if !Enabled() {
+		t.Fatal("Enabled() = false after Start")
+	}
+	at := time.Unix(1700000000, 0).UTC()
+	Log(Record{Time: at, Action: Set, UID: 42, SessionPrefix: "abcd1234", Caller: "10.0.0.1", Identity: "spiffe://stealthim/user"})
+	Log(Record{Action: Del, Caller: "10.0.0.2", Code: -1, Error: "Unauthenticated"})
+	if err := Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if Enabled() {
+		t.Fatal("Enabled() = true after Stop")
+	}
+	Log(Record{Action: Reload}) // 停止后不再写入
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, r)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(got), got)
+	}
+	if !got[0].Time.Equal(at) || got[0].Action != Set || got[0].UID != 42 || got[0].SessionPrefix != "abcd1234" ||
+		got[0].Caller != "10.0.0.1" || got[0].Identity != "spiffe://stealthim/user" || got[0].Code != 0 {
+		t.Fatalf("record 0 = %+v", got[0])
+	}
+	if got[1].Time.IsZero() || got[1].Action != Del || got[1].Code != -1 || got[1].Error != "Unauthenticated" {
+		t.Fatalf("record 1 = %+v", got[1])
+	}
+}
+
+func TestStartWithoutSink(t *testing.T) {
+	if err := Start(config.AuditConfig{Buffer: 16}); err != nil || Enabled() {
+		t.Fatalf("Start() without sink = %v, enabled = %v", err, Enabled())
+	}
+	if err := Start(config.AuditConfig{Sink: "syslog", Buffer: 16}); err == nil {
+		t.Fatal("Start() with unknown sink succeeded")
+	}
+	if err := Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
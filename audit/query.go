@@ -0,0 +1,87 @@
+package audit
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/gateway"
+	"StealthIMSession/query"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Entry 审计表中的一条记录
+type Entry struct {
+	ID int64
+	Record
+}
+
+// querySchema 审计查询允许的过滤与排序字段
+var querySchema = query.Schema{
+	Fields: map[string]query.Field{
+		"id":             {Column: "id", Kind: query.Int, Sortable: true},
+		"event_time":     {Column: "UNIX_TIMESTAMP(event_time)", Kind: query.Time, Sortable: true},
+		"action":         {Column: "action", Kind: query.String},
+		"uid":            {Column: "uid", Kind: query.Int},
+		"session_prefix": {Column: "session_prefix", Kind: query.String},
+		"caller":         {Column: "caller", Kind: query.String},
+		"identity":       {Column: "identity", Kind: query.String},
+		"code":           {Column: "code", Kind: query.Int},
+	},
+	Key:          "id",
+	DefaultSort:  "id",
+	DefaultDesc:  true,
+	DefaultLimit: 100,
+	MaxLimit:     1000,
+}
+
+// Query 按过滤条件分页查询审计表，返回本页记录与下一页游标
+// 只有 sink = "db" 时审计记录写入审计表，其他输出方式下查询结果为空
+func Query(ctx context.Context, req query.Request) ([]Entry, string, error) {
+	plan, err := querySchema.Build(req)
+	if err != nil {
+		return nil, "", err
+	}
+	sql, args := plan.SQL(
+		"SELECT id, UNIX_TIMESTAMP(event_time), action, uid, session_prefix, caller, identity, code, error FROM "+Table, "")
+
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, sql, args...)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("database error: %v", err)
+	}
+
+	entries := make([]Entry, 0, len(sqlResp.Data))
+	for _, row := range sqlResp.Data {
+		if len(row.Result) < 9 {
+			continue
+		}
+		var e Entry
+		e.ID, _ = gateway.ScanInt64(row.Result[0])
+		if t, ok := gateway.ScanInt64(row.Result[1]); ok {
+			e.Time = time.Unix(t, 0)
+		}
+		e.Action, _ = gateway.ScanString(row.Result[2])
+		uid, _ := gateway.ScanInt64(row.Result[3])
+		e.UID = int32(uid)
+		e.SessionPrefix, _ = gateway.ScanString(row.Result[4])
+		e.Caller, _ = gateway.ScanString(row.Result[5])
+		e.Identity, _ = gateway.ScanString(row.Result[6])
+		code, _ := gateway.ScanInt64(row.Result[7])
+		e.Code = int32(code)
+		e.Error, _ = gateway.ScanString(row.Result[8])
+		entries = append(entries, e)
+	}
+
+	size, next := plan.Page(len(entries), func(i int) (string, string) {
+		e := entries[i]
+		id := strconv.FormatInt(e.ID, 10)
+		if plan.Sort == "event_time" {
+			return strconv.FormatInt(e.Time.Unix(), 10), id
+		}
+		return id, id
+	})
+	return entries[:size], next, nil
+}
@@ -0,0 +1,128 @@
+package autoclean
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// backfillWhere 缺少过期时间或活跃时间的旧会话，只处理 created_at 早于开始时间的行
+const backfillWhere = "(expires_at IS NULL OR last_active IS NULL) AND created_at < ?"
+
+// BackfillProgress 回填进度
+type BackfillProgress struct {
+	Total   int64 // 开始时待回填的行数
+	Updated int64 // 已回填的行数
+	Batches int   // 已执行的批次数
+}
+
+// Backfill 分批为旧会话补齐 expires_at 与 last_active
+// expires_at 按 created_at 加 expireHours 计算，last_active 取 created_at
+// 每批最多 batch 行，批次之间等待 pause，每批完成后调用 progress
+// 回填是 session_db 的数据迁移，直接执行 SQL，不经过 cache.SessionStore
+func Backfill(ctx context.Context, expireHours int, batch int, pause time.Duration, progress func(BackfillProgress)) (BackfillProgress, error) {
+	var p BackfillProgress
+	start := time.Now()
+
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT COUNT(*) FROM session_db WHERE "+backfillWhere, start)
+	if err != nil {
+		return p, fmt.Errorf("database error: %v", err)
+	}
+	if sqlResp != nil && len(sqlResp.Data) > 0 && len(sqlResp.Data[0].Result) > 0 {
+		p.Total, _ = gateway.ScanInt64(sqlResp.Data[0].Result[0])
+	}
+	if p.Total == 0 {
+		return p, nil
+	}
+
+	for {
+		req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+			"UPDATE session_db SET expires_at = IFNULL(expires_at, created_at + INTERVAL ? HOUR), last_active = IFNULL(last_active, created_at) WHERE "+backfillWhere+" LIMIT ?",
+			expireHours, start, batch)
+		if err != nil {
+			return p, err
+		}
+		req.GetRowCount = true
+		sqlResp, err := gateway.ExecSQL(ctx, req)
+		if err != nil {
+			return p, fmt.Errorf("database error: %v", err)
+		}
+		var affected int64
+		if sqlResp != nil {
+			affected = sqlResp.RowsAffected
+		}
+		p.Updated += affected
+		p.Batches++
+		if progress != nil {
+			progress(p)
+		}
+		if affected < int64(batch) {
+			return p, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return p, ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+}
+
+// RunBackfill 执行 backfill 子命令，返回进程退出码
+// 连接 DBGateway 后为旧会话补齐时间字段，以便启用滑动过期与按 expires_at 清理
+func RunBackfill(args []string) int {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	path := fs.String("config", "config.toml", "配置文件位置")
+	batch := fs.Int("batch", 1000, "每批更新的行数")
+	pause := fs.Duration("pause", 200*time.Millisecond, "批次之间的等待时间")
+	wait := fs.Duration("wait", 30*time.Second, "等待存储后端可用的最长时间")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *batch <= 0 {
+		fmt.Fprintf(os.Stderr, "batch must be > 0, got %d\n", *batch)
+		return 2
+	}
+
+	if err := config.UseFile(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *path, err)
+		return 1
+	}
+
+	if err := gateway.Start(config.LatestConfig.Storage); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *path, err)
+		return 1
+	}
+	defer gateway.Close(context.Background())
+	deadline := time.Now().Add(*wait)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := gateway.Ping(ctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			fmt.Fprintf(os.Stderr, "storage not available: %v\n", err)
+			return 1
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	start := time.Now()
+	p, err := Backfill(context.Background(), config.LatestConfig.Session.ExpireHours, *batch, *pause, func(p BackfillProgress) {
+		fmt.Printf("batch %d: %d/%d rows backfilled\n", p.Batches, p.Updated, p.Total)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Backfill failed after %d rows: %v\n", p.Updated, err)
+		return 1
+	}
+	fmt.Printf("Backfill finished: %d rows in %d batches, %v\n", p.Updated, p.Batches, time.Since(start).Round(time.Millisecond))
+	return 0
+}
@@ -0,0 +1,120 @@
+package autoclean
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"StealthIMSession/scheduler"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var anonymizerLogger = logging.For("anonymizer")
+
+// journalPIIColumns 会话历史中需要脱敏的字段
+var journalPIIColumns = []string{"caller", "device", "client_ip", "user_agent"}
+
+// anonymizerJob 会话历史脱敏在调度器中的任务名
+const anonymizerJob = "journal_anonymizer"
+
+// JournalAnonymizer 会话历史脱敏任务
+type JournalAnonymizer struct {
+	running  bool
+	interval int
+}
+
+// NewJournalAnonymizer 创建新的会话历史脱敏任务
+func NewJournalAnonymizer() *JournalAnonymizer {
+	return &JournalAnonymizer{
+		running:  false,
+		interval: config.LatestConfig.Journal.AnonymizeInterval,
+	}
+}
+
+// Start 开始脱敏任务
+func (ja *JournalAnonymizer) Start() {
+	if ja.running {
+		anonymizerLogger.Warn("anonymizer already running")
+		return
+	}
+	if ja.interval <= 0 {
+		anonymizerLogger.Info("anonymize interval not set, anonymizer disabled")
+		return
+	}
+
+	ja.running = true
+	anonymizerLogger.Info("journal anonymizer started")
+
+	scheduler.Add(scheduler.Job{
+		Name:  anonymizerJob,
+		Every: func() time.Duration { return time.Duration(ja.interval) * time.Minute },
+		Delay: 10 * time.Second,
+		Run:   ja.anonymizeJournal,
+	})
+}
+
+// Stop 停止脱敏任务
+func (ja *JournalAnonymizer) Stop() {
+	if !ja.running {
+		return
+	}
+
+	anonymizerLogger.Info("stopping anonymizer")
+	scheduler.Remove(anonymizerJob)
+	ja.running = false
+	anonymizerLogger.Info("journal anonymizer stopped")
+}
+
+// anonymizeExpr 生成字段脱敏表达式，返回表达式及其参数
+// 配置了盐时保留哈希值以便聚合统计，否则直接清除
+func anonymizeExpr(column string, salt string) (string, []any) {
+	if salt == "" {
+		return column + " = ''", nil
+	}
+	return fmt.Sprintf("%s = IF(%s = '', '', LEFT(SHA2(CONCAT(?, %s), 256), 16))", column, column, column), []any{salt}
+}
+
+// anonymizeJournal 脱敏超过保留期的会话历史
+// 每次运行时读取最新配置，重载后无需重建任务
+func (ja *JournalAnonymizer) anonymizeJournal(ctx context.Context) error {
+	cfg := config.LatestConfig.Journal
+	if !cfg.Enable || cfg.AnonymizeDays <= 0 {
+		return nil
+	}
+
+	anonymizerLogger.Debug("anonymizing journal")
+
+	cutoff := time.Now().Add(-time.Duration(cfg.AnonymizeDays) * 24 * time.Hour)
+
+	sets := make([]string, 0, len(journalPIIColumns)+1)
+	args := make([]any, 0, len(journalPIIColumns)+1)
+	for _, column := range journalPIIColumns {
+		expr, exprArgs := anonymizeExpr(column, cfg.AnonymizeSalt)
+		sets = append(sets, expr)
+		args = append(args, exprArgs...)
+	}
+	sets = append(sets, "anonymized = 1")
+	args = append(args, cutoff)
+
+	sqlQuery := "UPDATE session_journal_db SET " + strings.Join(sets, ", ") + " WHERE anonymized = 0 AND event_time < ?"
+
+	req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true, sqlQuery, args...)
+	if err != nil {
+		return fmt.Errorf("anonymize journal: %v", err)
+	}
+	req.GetRowCount = true
+	res, err := gateway.ExecSQL(ctx, req)
+	if err == nil {
+		err = gateway.CheckResult(res)
+	}
+	if err != nil {
+		return fmt.Errorf("anonymize journal: %v", err)
+	}
+	scheduler.ReportRows(ctx, res.RowsAffected)
+
+	anonymizerLogger.Info("anonymize finished", "rows", res.RowsAffected)
+	return nil
+}
@@ -1,106 +1,241 @@
 package autoclean
 
 import (
-	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/cache"
 	"StealthIMSession/config"
-	"StealthIMSession/gateway"
+	"StealthIMSession/counters"
+	"StealthIMSession/cron"
+	"StealthIMSession/events"
+	"StealthIMSession/logging"
+	"StealthIMSession/scheduler"
+	"context"
 	"fmt"
-	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var cleanerLogger = logging.For("cleaner")
+
+// cleanerJob 会话清理器在调度器中的任务名
+const cleanerJob = "session_cleaner"
+
 // SessionCleaner 会话清理器
+// Start、Stop 与 Reload 可以并发、重复调用；清理参数原子读写，正在执行的清理在下一批次使用新值
 type SessionCleaner struct {
-	running       bool
-	stopChan      chan struct{}
-	expireHours   int
-	cleanInterval int
+	mu      sync.Mutex // 串行化 Start、Stop 与 Reload，使 running 与调度器中的任务一致
+	running atomic.Bool
+
+	cleanInterval atomic.Int64                  // 分钟
+	schedule      atomic.Pointer[cron.Schedule] // clean_cron，未设置时为 nil，按 cleanInterval 执行
+	batchSize     atomic.Int64
+	batchPause    atomic.Int64 // time.Duration
 }
 
 // NewSessionCleaner 创建新的会话清理器
 func NewSessionCleaner() *SessionCleaner {
-	return &SessionCleaner{
-		running:       false,
-		stopChan:      make(chan struct{}),
-		expireHours:   config.LatestConfig.Session.ExpireHours,
-		cleanInterval: config.LatestConfig.Session.CleanInterval,
+	sc := &SessionCleaner{}
+	sc.load()
+	return sc
+}
+
+// load 读取当前配置中的清理参数
+func (sc *SessionCleaner) load() {
+	sc.cleanInterval.Store(int64(config.LatestConfig.Session.CleanInterval))
+	var schedule *cron.Schedule
+	if expr := config.LatestConfig.Session.CleanCron; expr != "" {
+		var err error
+		if schedule, err = cron.Parse(expr); err != nil {
+			cleanerLogger.Warn("invalid clean_cron, using clean_interval", "error", err)
+		}
 	}
+	sc.schedule.Store(schedule)
+	sc.batchSize.Store(int64(config.LatestConfig.Session.CleanBatch))
+	sc.batchPause.Store(int64(time.Duration(config.LatestConfig.Session.CleanPause) * time.Millisecond))
 }
 
 // Start 开始会话清理任务
 func (sc *SessionCleaner) Start() {
-	if sc.running {
-		log.Println("[Cleaner] Cleaner already running")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.running.Load() {
+		cleanerLogger.Warn("cleaner already running")
 		return
 	}
 
-	sc.running = true
-	log.Printf("[Cleaner] Session cleaner started.\n")
+	sc.running.Store(true)
+	cleanerLogger.Info("session cleaner started")
 
-	// 延迟10秒启动清理循环
-	go func() {
-		time.Sleep(10 * time.Second)
-		sc.cleanerLoop()
-	}()
+	// 按间隔执行时延迟10秒后首次清理；按 cron 执行时只在表达式指定的时间清理
+	delay := 10 * time.Second
+	if sc.schedule.Load() != nil {
+		delay = sc.every()
+	}
+	scheduler.Add(scheduler.Job{
+		Name:  cleanerJob,
+		Every: sc.every,
+		Delay: delay,
+		Run:   sc.cleanExpiredSessions,
+	})
+}
+
+// every 到下一次清理的等待时间：设置了 clean_cron 时为到下一个触发时间，否则为 clean_interval
+// cron 表达式在 5 年内没有触发时间时返回 0，调度器暂不执行
+func (sc *SessionCleaner) every() time.Duration {
+	schedule := sc.schedule.Load()
+	if schedule == nil {
+		return time.Duration(sc.cleanInterval.Load()) * time.Minute
+	}
+	// 留出 1 秒余量：定时器按单调时钟计时，系统时间稍慢时刚执行完的清理不会在同一分钟内再次触发
+	now := time.Now()
+	next := schedule.Next(now.Add(time.Second))
+	if next.IsZero() {
+		return 0
+	}
+	return next.Sub(now)
 }
 
-// Stop 停止会话清理任务
+// Stop 停止会话清理任务，中止正在执行的清理（在批次之间退出）并等待其结束
+// 未启动或已停止时直接返回，首次清理之前调用同样立即返回
 func (sc *SessionCleaner) Stop() {
-	if !sc.running {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if !sc.running.Load() {
 		return
 	}
 
-	log.Println("[Cleaner] Stopping cleaner...")
-	sc.stopChan <- struct{}{}
-	sc.running = false
+	cleanerLogger.Info("stopping cleaner")
+	scheduler.Remove(cleanerJob)
+	sc.running.Store(false)
+	cleanerLogger.Info("session cleaner stopped")
 }
 
-// cleanerLoop 定期清理过期会话的循环
-func (sc *SessionCleaner) cleanerLoop() {
-	// 首次启动时执行一次清理
-	sc.cleanExpiredSessions()
+// Reload 重新读取清理参数，运行中时从现在起按新的间隔安排下一次清理
+// 正在执行的清理不中止，下一批次起使用新的批大小与间隔
+func (sc *SessionCleaner) Reload() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.load()
+	if sc.running.Load() {
+		scheduler.Reschedule(cleanerJob)
+	}
+	cleanerLogger.Info("session cleaner reloaded", "interval_minutes", sc.cleanInterval.Load(), "cron", config.LatestConfig.Session.CleanCron, "batch", sc.batchSize.Load())
+}
 
-	// 创建定时器，按照配置的间隔时间定时执行
-	ticker := time.NewTicker(time.Duration(sc.cleanInterval) * time.Minute)
-	defer ticker.Stop()
+// Running 清理器是否在运行
+func (sc *SessionCleaner) Running() bool {
+	return sc.running.Load()
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			sc.cleanExpiredSessions()
-		case <-sc.stopChan:
-			log.Println("[Cleaner] Session cleaner stopped")
-			return
-		}
+// CleanerStatus 会话清理器的状态，用于判断清理是否跟得上过期会话的增长
+type CleanerStatus struct {
+	Job          scheduler.Status // 调度器中的任务状态，Rows 为累计删除的会话数
+	LastDuration time.Duration    // 最近一次执行的耗时
+	LastRows     int64            // 最近一次执行删除的会话数
+	Backlog      int64            // 已过期、尚未删除的会话数，查询失败时为 -1
+}
+
+// Status 返回会话清理器的状态，清理器未启动时返回 scheduler.ErrNotFound
+// Backlog 需扫描会话表中的过期会话，查询失败时只记录日志
+func Status(ctx context.Context) (CleanerStatus, error) {
+	job, err := scheduler.Lookup(cleanerJob)
+	if err != nil {
+		return CleanerStatus{}, err
+	}
+	st := CleanerStatus{Job: job}
+	if runs, err := scheduler.History(cleanerJob); err == nil && len(runs) > 0 {
+		st.LastDuration = runs[0].Duration
+		st.LastRows = runs[0].Rows
 	}
+	if st.Backlog, err = cache.CountExpiredSessions(ctx); err != nil {
+		cleanerLogger.Warn("count expired sessions failed", "error", err)
+		st.Backlog = -1
+	}
+	return st, nil
 }
 
 // cleanExpiredSessions 执行过期会话清理
-func (sc *SessionCleaner) cleanExpiredSessions() {
-	log.Println("[Cleaner] Starting to clean...")
+// 每批最多删除 clean_batch 行，批次之间等待 clean_pause，避免长时间锁表；清理器停止时在批次之间退出
+// 删除的会话同时从 Redis 与各实例的内存缓存中清除
+func (sc *SessionCleaner) cleanExpiredSessions(ctx context.Context) error {
+	cleanerLogger.Debug("cleaning expired sessions")
+
+	start := time.Now()
+	var total int64
+	batches := 0
+	defer func() {
+		scheduler.ReportRows(ctx, total)
+		counters.CleanerDeleted.Add(total)
+	}()
+	for {
+		batchSize := int(sc.batchSize.Load())
+		scanned, deleted, err := sc.deleteBatch(ctx, batchSize)
+		total += deleted
+		batches++
+		if err != nil {
+			return fmt.Errorf("clean expired sessions: %v", err)
+		}
+		if scanned < batchSize {
+			break
+		}
 
-	// 计算过期时间点
-	expirationTime := time.Now().Add(-time.Duration(sc.expireHours) * time.Hour)
-	formattedTime := expirationTime.Format("2006-01-02 15:04:05")
+		select {
+		case <-ctx.Done():
+			cleanerLogger.Info("clean interrupted", "rows", total, "batches", batches)
+			return ctx.Err()
+		case <-time.After(time.Duration(sc.batchPause.Load())):
+		}
+	}
 
-	// 构建SQL查询，删除所有过期的会话
-	sqlQuery := fmt.Sprintf("DELETE FROM session_db WHERE created_at < '%s'", formattedTime)
+	cleanerLogger.Info("clean finished", "rows", total, "batches", batches, "duration", time.Since(start).Round(time.Millisecond))
+	if config.LatestConfig.Refresh.Enable {
+		return sc.cleanExpiredRefreshTokens(ctx)
+	}
+	return nil
+}
 
-	// 使用 CREATE EVENT 将查询挂到后台
-	backgroundQuery := fmt.Sprintf("CREATE EVENT one_time_session_cleanup ON SCHEDULE AT CURRENT_TIMESTAMP DO %s;", sqlQuery)
+// cleanExpiredRefreshTokens 按与会话相同的批大小与间隔删除过期的刷新令牌
+func (sc *SessionCleaner) cleanExpiredRefreshTokens(ctx context.Context) error {
+	var total int64
+	for {
+		batchSize := sc.batchSize.Load()
+		deleted, err := cache.DeleteExpiredRefreshTokens(ctx, int(batchSize))
+		total += deleted
+		if err != nil {
+			return fmt.Errorf("clean expired refresh tokens: %v", err)
+		}
+		if deleted < batchSize {
+			break
+		}
 
-	sqlReq := &pb.SqlRequest{
-		Sql:    backgroundQuery,
-		Db:     pb.SqlDatabases_Session,
-		Commit: true,
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(sc.batchPause.Load())):
+		}
 	}
+	cleanerLogger.Info("refresh token clean finished", "rows", total)
+	return nil
+}
 
-	// 执行SQL
-	_, err := gateway.ExecSQL(sqlReq)
-	if err != nil {
-		log.Printf("[Cleaner] Error cleaning expired sessions: %v", err)
-		return
+// deleteBatch 删除一批（至多 batchSize 个）过期会话，返回本批找到的会话数与实际删除的行数
+// 删除后清除这些会话在 Redis 与内存中的缓存，并为实际删除的会话产生过期事件
+func (sc *SessionCleaner) deleteBatch(ctx context.Context, batchSize int) (int, int64, error) {
+	expired, deleted, err := cache.DeleteExpiredSessions(ctx, batchSize)
+	if err != nil || len(expired) == 0 {
+		return len(expired), deleted, err
 	}
 
-	log.Printf("[Cleaner] Clean started.")
+	// 被续期而未删除的会话同样被清除缓存，下次查询时从 MySQL 回填
+	sessionIDs := make([]string, 0, len(expired))
+	for _, s := range expired {
+		sessionIDs = append(sessionIDs, s.SessionID)
+	}
+	cache.PurgeExpired(ctx, sessionIDs)
+	for _, s := range expired {
+		if !s.Renewed {
+			events.Emit(events.Event{Type: events.Expired, SessionID: s.SessionID, UID: s.UID})
+		}
+	}
+	return len(expired), deleted, nil
 }
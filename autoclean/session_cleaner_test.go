@@ -0,0 +1,212 @@
+package autoclean
+
+import (
+	"StealthIMSession/cache"
+	"StealthIMSession/config"
+	"StealthIMSession/events"
+	"StealthIMSession/gateway"
+	"StealthIMSession/memstore"
+	"StealthIMSession/scheduler"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCleanExpiredSessions(t *testing.T) {
+	saved := config.LatestConfig
+	cfg := config.Default()
+	config.LatestConfig = &cfg
+	cache.ResetMemoryCache()
+	t.Cleanup(func() {
+		// 先停止缓存注册的后台任务，它们会读取配置
+		scheduler.RemoveAll()
+		config.LatestConfig = saved
+	})
+
+	store, gw := memstore.NewStore(), memstore.NewGateway()
+	ctx := gateway.WithClient(cache.WithStore(context.Background(), store), gw)
+	for i := range 5 {
+		store.Save(ctx, fmt.Sprintf("expired-%d", i), int32(i), -time.Minute, cache.SessionMeta{})
+	}
+	store.Save(ctx, "live", 100, time.Hour, cache.SessionMeta{})
+
+	// 批大小小于过期会话数，分多批删除
+	sc := &SessionCleaner{}
+	sc.batchSize.Store(2)
+	if err := sc.cleanExpiredSessions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 1 {
+		t.Fatalf("store has %d sessions after cleaning, want 1", store.Len())
+	}
+	if uid, _, err := store.Get(ctx, "live"); err != nil || uid != 100 {
+		t.Fatalf("live session = %d, %v", uid, err)
+	}
+
+	// 没有过期会话时不删除
+	if err := sc.cleanExpiredSessions(ctx); err != nil || store.Len() != 1 {
+		t.Fatalf("second run: %v, %d sessions", err, store.Len())
+	}
+}
+
+// renewingStore 将 renewed 标记为找到后被续期的会话
+type renewingStore struct {
+	*memstore.Store
+	renewed string
+}
+
+func (s renewingStore) DeleteExpired(ctx context.Context, limit int) ([]cache.ExpiredSession, int64, error) {
+	expired, deleted, err := s.Store.DeleteExpired(ctx, limit)
+	for i := range expired {
+		if expired[i].SessionID == s.renewed {
+			expired[i].Renewed = true
+			deleted--
+		}
+	}
+	return expired, deleted, err
+}
+
+func TestCleanerSkipsRenewedEvents(t *testing.T) {
+	saved := config.LatestConfig
+	cfg := config.Default()
+	cfg.Events.Enable = true
+	config.LatestConfig = &cfg
+	t.Cleanup(func() { config.LatestConfig = saved })
+
+	store := renewingStore{Store: memstore.NewStore(), renewed: "renewed"}
+	ctx := gateway.WithClient(cache.WithStore(context.Background(), store), memstore.NewGateway())
+	store.Save(ctx, "expired", 1, -time.Minute, cache.SessionMeta{})
+	store.Save(ctx, "renewed", 2, -time.Minute, cache.SessionMeta{})
+
+	sub := events.Subscribe(nil)
+	defer sub.Close()
+	sc := &SessionCleaner{}
+	if scanned, deleted, err := sc.deleteBatch(ctx, 10); err != nil || scanned != 2 || deleted != 1 {
+		t.Fatalf("deleteBatch() = %d, %d, %v", scanned, deleted, err)
+	}
+	// 只为实际删除的会话产生过期事件
+	var got []string
+	for len(sub.C) > 0 {
+		ev := <-sub.C
+		got = append(got, ev.Type+" "+ev.SessionID)
+	}
+	if len(got) != 1 || got[0] != events.Expired+" expired" {
+		t.Fatalf("events = %q, want only the deleted session", got)
+	}
+}
+
+// cleanerScheduled 调度器中是否有会话清理任务
+func cleanerScheduled() bool {
+	for _, job := range scheduler.List() {
+		if job.Name == cleanerJob {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSessionCleanerStartStop(t *testing.T) {
+	saved := config.LatestConfig
+	cfg := config.Default()
+	config.LatestConfig = &cfg
+	t.Cleanup(func() { config.LatestConfig = saved })
+
+	// 未启动时 Stop 直接返回，首次清理之前 Stop 不阻塞，重复 Stop 是安全的
+	sc := NewSessionCleaner()
+	sc.Stop()
+	sc.Start()
+	sc.Start()
+	if !sc.Running() || !cleanerScheduled() {
+		t.Fatal("cleaner not scheduled after Start")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		sc.Stop()
+		sc.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked during the initial delay")
+	}
+	if sc.Running() || cleanerScheduled() {
+		t.Fatal("cleaner still scheduled after Stop")
+	}
+
+	// 并发调用 Start、Stop 与 Reload 不死锁，最后一次 Stop 后任务已移除
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(3)
+		go func() { defer wg.Done(); sc.Start() }()
+		go func() { defer wg.Done(); sc.Stop() }()
+		go func() { defer wg.Done(); sc.Reload() }()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		sc.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("concurrent Start/Stop/Reload deadlocked")
+	}
+	if sc.Running() || cleanerScheduled() {
+		t.Fatal("cleaner still scheduled after final Stop")
+	}
+}
+
+func TestSessionCleanerReload(t *testing.T) {
+	saved := config.LatestConfig
+	cfg := config.Default()
+	config.LatestConfig = &cfg
+	t.Cleanup(func() { config.LatestConfig = saved })
+
+	sc := NewSessionCleaner()
+	cfg.Session.CleanBatch = 7
+	cfg.Session.CleanInterval = 5
+	sc.Reload()
+	if sc.batchSize.Load() != 7 || sc.cleanInterval.Load() != 5 {
+		t.Fatalf("Reload() batch = %d, interval = %d, want 7, 5", sc.batchSize.Load(), sc.cleanInterval.Load())
+	}
+	// 未启动时 Reload 不启动清理器
+	if sc.Running() || cleanerScheduled() {
+		t.Fatal("Reload started a stopped cleaner")
+	}
+}
+
+func TestSessionCleanerCron(t *testing.T) {
+	saved := config.LatestConfig
+	cfg := config.Default()
+	config.LatestConfig = &cfg
+	t.Cleanup(func() { config.LatestConfig = saved })
+
+	// 默认按 clean_interval 执行
+	sc := NewSessionCleaner()
+	if got, want := sc.every(), time.Duration(cfg.Session.CleanInterval)*time.Minute; got != want {
+		t.Fatalf("every() = %v, want %v", got, want)
+	}
+
+	// 设置 clean_cron 后等待到下一个触发时间
+	cfg.Session.CleanCron = "0 3 * * *"
+	sc.Reload()
+	wait := sc.every()
+	if wait <= 0 || wait > 24*time.Hour {
+		t.Fatalf("every() with clean_cron = %v, want (0, 24h]", wait)
+	}
+	next := time.Now().Add(wait).Round(time.Minute)
+	if next.Hour() != 3 || next.Minute() != 0 {
+		t.Fatalf("next clean at %v, want 03:00", next)
+	}
+
+	// 永不触发的表达式暂停清理
+	cfg.Session.CleanCron = "0 0 30 2 *"
+	sc.Reload()
+	if wait := sc.every(); wait != 0 {
+		t.Fatalf("every() for Feb 30 = %v, want 0", wait)
+	}
+}
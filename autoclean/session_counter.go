@@ -0,0 +1,143 @@
+package autoclean
+
+import (
+	"StealthIMSession/cache"
+	"StealthIMSession/config"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"StealthIMSession/scheduler"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var counterLogger = logging.For("counter")
+
+// maxAgeDays 按创建天数分组的上限，更早的会话计入该组
+const maxAgeDays = 30
+
+var (
+	metricSessionsTotal = metrics.NewGauge("stealthim_session_sessions", "Unexpired sessions in session_db at the last count")
+	metricSessionsByAge [maxAgeDays + 1]*metrics.Gauge
+)
+
+func init() {
+	for i := range metricSessionsByAge {
+		label := strconv.Itoa(i)
+		if i == maxAgeDays {
+			label += "+"
+		}
+		metricSessionsByAge[i] = metrics.NewGauge("stealthim_session_sessions_by_age", "Unexpired sessions at the last count by age in days", "age_days", label)
+	}
+}
+
+// counterJob 会话数统计在调度器中的任务名
+const counterJob = "session_count"
+
+// SessionCounter 会话数统计任务
+// 定期按会话存储统计未过期的会话数并导出为指标，只在配置的时段内执行
+type SessionCounter struct {
+	running  bool
+	interval int
+	lastRun  time.Time
+}
+
+// NewSessionCounter 创建新的会话数统计任务
+func NewSessionCounter() *SessionCounter {
+	return &SessionCounter{
+		running:  false,
+		interval: config.LatestConfig.Metrics.SessionCountInterval,
+	}
+}
+
+// Start 开始统计任务
+func (sc *SessionCounter) Start() {
+	if sc.running {
+		counterLogger.Warn("session counter already running")
+		return
+	}
+	if sc.interval <= 0 {
+		counterLogger.Info("session count interval not set, session counter disabled")
+		return
+	}
+
+	sc.running = true
+	counterLogger.Info("session counter started")
+
+	// 下一次执行时间按统计间隔与允许的时段计算
+	scheduler.Add(scheduler.Job{
+		Name:  counterJob,
+		Every: sc.untilDue,
+		Delay: 10 * time.Second,
+		Run:   sc.maybeCount,
+	})
+}
+
+// Stop 停止统计任务
+func (sc *SessionCounter) Stop() {
+	if !sc.running {
+		return
+	}
+
+	counterLogger.Info("stopping session counter")
+	scheduler.Remove(counterJob)
+	sc.running = false
+	counterLogger.Info("session counter stopped")
+}
+
+// inWindow 判断小时 hour 是否在 [from, to) 时段内，from 大于 to 时跨越零点
+func inWindow(hour int, from int, to int) bool {
+	if from <= to {
+		return hour >= from && hour < to
+	}
+	return hour >= from || hour < to
+}
+
+// untilDue 返回距下一次统计的时间：距上次统计满一个间隔后，推迟到允许时段内的第一个整点
+func (sc *SessionCounter) untilDue() time.Duration {
+	cfg := config.LatestConfig.Metrics
+	now := time.Now()
+	due := sc.lastRun.Add(time.Duration(sc.interval) * time.Minute)
+	if due.Before(now) {
+		due = now
+	}
+	for range 24 {
+		if inWindow(due.Hour(), cfg.SessionCountFrom, cfg.SessionCountTo) {
+			break
+		}
+		due = due.Truncate(time.Hour).Add(time.Hour)
+	}
+	return max(due.Sub(now), time.Second)
+}
+
+// maybeCount 处于允许时段时执行统计（手动触发与首次执行同样受时段限制）
+func (sc *SessionCounter) maybeCount(ctx context.Context) error {
+	cfg := config.LatestConfig.Metrics
+	now := time.Now()
+	if !inWindow(now.Hour(), cfg.SessionCountFrom, cfg.SessionCountTo) {
+		return nil
+	}
+	sc.lastRun = now
+	return sc.countSessions(ctx)
+}
+
+// countSessions 统计未过期的会话数，按创建天数分组
+func (sc *SessionCounter) countSessions(ctx context.Context) error {
+	counterLogger.Debug("counting sessions")
+
+	byAge, err := cache.CountSessionsByAge(ctx, maxAgeDays)
+	if err != nil {
+		return fmt.Errorf("count sessions: %v", err)
+	}
+
+	var total int64
+	for i, count := range byAge {
+		metricSessionsByAge[i].Set(count)
+		total += count
+	}
+	metricSessionsTotal.Set(total)
+
+	counterLogger.Info("session count finished", "sessions", total)
+	return nil
+}
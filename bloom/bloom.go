@@ -0,0 +1,65 @@
+// Package bloom 并发安全的布隆过滤器：判断字符串一定不在集合中，或可能在集合中
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+)
+
+// Filter 布隆过滤器，只能添加不能删除，Add 与 MayContain 可以并发调用
+type Filter struct {
+	bits []atomic.Uint64
+	m    uint64 // 位数
+	k    uint64 // 哈希函数个数
+	seed maphash.Seed
+}
+
+// New 创建容纳 n 个元素、误判率约为 p 的过滤器，元素超过 n 个后误判率上升
+func New(n int, p float64) *Filter {
+	n = max(n, 1)
+	p = min(max(p, 1e-9), 0.5)
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (max(m, 64) + 63) / 64 * 64
+	k := uint64(max(math.Round(float64(m)/float64(n)*math.Ln2), 1))
+	return &Filter{
+		bits: make([]atomic.Uint64, m/64),
+		m:    m,
+		k:    k,
+		seed: maphash.MakeSeed(),
+	}
+}
+
+// locations 以双重哈希生成 k 个位置
+func (f *Filter) locations(s string, fn func(pos uint64) bool) {
+	h := maphash.String(f.seed, s)
+	h1, h2 := h, h>>32|h<<32|1
+	for i := range f.k {
+		if !fn((h1 + i*h2) % f.m) {
+			return
+		}
+	}
+}
+
+// Add 添加元素
+func (f *Filter) Add(s string) {
+	f.locations(s, func(pos uint64) bool {
+		f.bits[pos/64].Or(1 << (pos % 64))
+		return true
+	})
+}
+
+// MayContain 元素可能在集合中时返回 true，返回 false 时一定不在集合中
+func (f *Filter) MayContain(s string) bool {
+	found := true
+	f.locations(s, func(pos uint64) bool {
+		found = f.bits[pos/64].Load()&(1<<(pos%64)) != 0
+		return found
+	})
+	return found
+}
+
+// Bytes 位数组占用的字节数
+func (f *Filter) Bytes() int {
+	return int(f.m / 8)
+}
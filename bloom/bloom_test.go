@@ -0,0 +1,34 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	f := New(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add("member" + strconv.Itoa(i))
+	}
+	for i := 0; i < n; i++ {
+		if !f.MayContain("member" + strconv.Itoa(i)) {
+			t.Fatalf("false negative for member%d", i)
+		}
+	}
+
+	// 误判率不超过目标的两倍
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.MayContain("other" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.02 {
+		t.Fatalf("false positive rate = %.4f, want <= 0.02", rate)
+	}
+	// 约 9.6 位每个元素
+	if b := f.Bytes(); b < 11000 || b > 13000 {
+		t.Fatalf("Bytes() = %d", b)
+	}
+}
@@ -0,0 +1,14 @@
+package buildinfo
+
+// 构建信息，由构建时 -ldflags "-X" 注入
+// 例如：-X StealthIMSession/buildinfo.Version=0.0.2
+var (
+	Version   = "0.0.1"   // 版本号
+	Commit    = "unknown" // Git 提交
+	BuildDate = "unknown" // 构建时间（UTC，RFC3339）
+)
+
+// String 返回可读的构建信息
+func String() string {
+	return Version + " (" + Commit + ", " + BuildDate + ")"
+}
@@ -0,0 +1,267 @@
+// Package bus 通过 Redis 发布订阅在实例间广播缓存失效消息
+package bus
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"StealthIMSession/resp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialTimeout 连接与单次发布的超时时间
+const dialTimeout = 3 * time.Second
+
+// maxBatch 每次发布合并的最大失效消息数
+const maxBatch = 100
+
+// instanceID 本实例标识，用于忽略自己发布的消息
+var instanceID = newInstanceID()
+
+var logger = logging.For("bus")
+
+var (
+	pubLock sync.Mutex
+	pubConn *resp.Conn
+)
+
+// message 等待发布的消息，cfg 与 channel 为加入队列时的配置
+type message struct {
+	cfg     config.InvalidationConfig
+	channel string
+	payload string
+	event   bool // 会话生命周期事件，不与其他消息合并
+}
+
+var (
+	mu      sync.RWMutex
+	queue   chan message  // 等待发布的消息，Start 之前与 Stop 之后为 nil
+	stopped chan struct{} // 发布协程退出后关闭
+)
+
+var (
+	metricPublished     = metrics.NewCounter("stealthim_session_bus_published_total", "Cache invalidation messages published")
+	metricPublishErrors = metrics.NewCounter("stealthim_session_bus_publish_errors_total", "Cache invalidation messages that failed to publish")
+	metricDropped       = metrics.NewCounter("stealthim_session_bus_dropped_total", "Invalidation and event messages dropped because the publish queue was full")
+	metricReceived      = metrics.NewCounter("stealthim_session_bus_received_total", "Cache invalidation messages received from other instances")
+)
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Enabled 是否启用实例间失效广播
+func Enabled() bool {
+	return config.LatestConfig.Invalidation.Enable
+}
+
+// Publish 将会话失效消息加入发布队列，不等待发布；未启动时不做任何事
+// 队列由一个发布协程按顺序发送，队列满时丢弃消息并计入 stealthim_session_bus_dropped_total，不阻塞请求
+// 发布失败或丢弃只记录日志与指标，其他实例的内存缓存会在 mem_timeout 后自然过期
+func Publish(sessionIDs ...string) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	cfg := config.LatestConfig.Invalidation
+	enqueue(message{cfg: cfg, channel: cfg.Channel, payload: strings.Join(sessionIDs, " ")})
+}
+
+// PublishEvent 将一条会话生命周期事件加入发布队列，转发给其他实例；未启动时不做任何事
+// 与失效消息共用队列与发布协程，队列满时同样丢弃并计数
+func PublishEvent(payload string) {
+	enqueue(message{cfg: config.LatestConfig.Invalidation, channel: config.LatestConfig.Events.Channel, payload: payload, event: true})
+}
+
+// enqueue 不阻塞地将消息加入队列，队列满时丢弃
+func enqueue(m message) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if queue == nil {
+		return
+	}
+	select {
+	case queue <- m:
+	default:
+		metricDropped.Inc()
+	}
+}
+
+// Start 启用失效广播时启动发布协程；未启用时不做任何事
+func Start(cfg config.InvalidationConfig) {
+	if !cfg.Enable {
+		return
+	}
+	q := make(chan message, cfg.Buffer)
+	done := make(chan struct{})
+	mu.Lock()
+	queue, stopped = q, done
+	mu.Unlock()
+	go run(q, done)
+}
+
+// Stop 停止接收失效消息并发布队列中剩余的消息，等待发布完成或 ctx 结束
+func Stop(ctx context.Context) error {
+	mu.Lock()
+	q, done := queue, stopped
+	queue = nil
+	mu.Unlock()
+	if q == nil {
+		return nil
+	}
+	close(q)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run 按加入顺序发布队列中的消息，直到队列关闭；连续的、配置相同的失效消息合并为一次发布
+func run(q <-chan message, done chan<- struct{}) {
+	defer close(done)
+	var next *message
+	for {
+		var m message
+		if next != nil {
+			m, next = *next, nil
+		} else {
+			var ok bool
+			if m, ok = <-q; !ok {
+				return
+			}
+		}
+		if m.event {
+			if err := publishRaw(m.cfg, m.channel, instanceID+" "+m.payload); err != nil {
+				logger.Warn("forward event failed", "error", err)
+			}
+			continue
+		}
+		payloads := []string{m.payload}
+	fill:
+		for len(payloads) < maxBatch {
+			select {
+			case other, ok := <-q:
+				if !ok {
+					break fill
+				}
+				if other.event || other.cfg != m.cfg {
+					next = &other
+					break fill
+				}
+				payloads = append(payloads, other.payload)
+			default:
+				break fill
+			}
+		}
+		if err := publishRaw(m.cfg, m.channel, instanceID+" "+strings.Join(payloads, " ")); err != nil {
+			metricPublishErrors.Add(uint64(len(payloads)))
+			logger.Warn("publish failed", "messages", len(payloads), "error", err)
+			continue
+		}
+		metricPublished.Add(uint64(len(payloads)))
+	}
+}
+
+// PublishTo 在频道上原样发布消息（不附加实例标识），供其他服务订阅；未启用时不做任何事
+func PublishTo(channel string, payload string) error {
+	if !Enabled() {
+		return nil
+	}
+	return publishRaw(config.LatestConfig.Invalidation, channel, payload)
+}
+
+// publishRaw 经由 cfg 中的 Redis 在频道上发布消息，连接断开时重连后重试一次
+func publishRaw(cfg config.InvalidationConfig, channel string, payload string) error {
+	pubLock.Lock()
+	defer pubLock.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if pubConn == nil {
+			conn, err := resp.Dial(cfg.RedisAddr, cfg.RedisPassword, dialTimeout)
+			if err != nil {
+				return fmt.Errorf("connect: %v", err)
+			}
+			pubConn = conn
+		}
+		pubConn.SetDeadline(time.Now().Add(dialTimeout))
+		if _, err = pubConn.Do("PUBLISH", channel, payload); err == nil {
+			pubConn.SetDeadline(time.Time{})
+			return nil
+		}
+		// 连接可能已断开，重连后重试一次
+		pubConn.Close()
+		pubConn = nil
+	}
+	return err
+}
+
+// Subscribe 在后台订阅失效消息，收到其他实例的消息时对每个会话ID调用 handler
+// 连接断开时自动重连
+func Subscribe(handler func(sessionID string)) {
+	listen(func() string { return config.LatestConfig.Invalidation.Channel }, func(payload string) {
+		metricReceived.Inc()
+		for _, sessionID := range strings.Fields(payload) {
+			handler(sessionID)
+		}
+	})
+}
+
+// SubscribeEvents 在后台订阅其他实例的会话生命周期事件
+func SubscribeEvents(handler func(payload string)) {
+	listen(func() string { return config.LatestConfig.Events.Channel }, handler)
+}
+
+// listen 在后台订阅频道，连接断开时自动重连，未启用时不做任何事
+func listen(channel func() string, handler func(payload string)) {
+	if !Enabled() {
+		return
+	}
+	go func() {
+		for {
+			cfg := config.LatestConfig.Invalidation
+			err := subscribe(cfg.RedisAddr, cfg.RedisPassword, channel(), handler)
+			logger.Warn("subscription lost, reconnecting", "error", err)
+			time.Sleep(time.Second)
+		}
+	}()
+}
+
+// subscribe 建立一次订阅并处理消息（去掉发送方标识，忽略本实例的消息），直到连接出错
+func subscribe(addr string, password string, channel string, handler func(string)) error {
+	conn, err := resp.Dial(addr, password, dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.Send("SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	logger.Info("subscribed", "channel", channel)
+
+	for {
+		reply, err := conn.Read()
+		if err != nil {
+			return err
+		}
+		// 消息格式：["message", channel, payload]
+		msg, ok := reply.([]any)
+		if !ok || len(msg) != 3 || msg[0] != "message" {
+			continue
+		}
+		data, _ := msg[2].(string)
+		sender, payload, ok := strings.Cut(data, " ")
+		if !ok || sender == instanceID || strings.TrimSpace(payload) == "" {
+			continue
+		}
+		handler(payload)
+	}
+}
@@ -0,0 +1,149 @@
+package bus
+
+import (
+	"StealthIMSession/config"
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis 记录收到的 PUBLISH 命令，对每条命令回复 :0
+type fakeRedis struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	payloads []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 3 && args[0] == "PUBLISH" {
+			f.mu.Lock()
+			f.payloads = append(f.payloads, args[2])
+			f.mu.Unlock()
+		}
+		fmt.Fprint(conn, ":0\r\n")
+	}
+}
+
+func (f *fakeRedis) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.payloads...)
+}
+
+// readCommand 读取一条 RESP 数组形式的命令
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil { // $<len>
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestPublishQueue(t *testing.T) {
+	redis := newFakeRedis(t)
+	saved := config.LatestConfig
+	t.Cleanup(func() {
+		config.LatestConfig = saved
+		pubLock.Lock()
+		defer pubLock.Unlock()
+		if pubConn != nil {
+			pubConn.Close()
+			pubConn = nil
+		}
+	})
+	cfg := config.InvalidationConfig{Enable: true, RedisAddr: redis.ln.Addr().String(), Channel: "test", Buffer: 16}
+	config.LatestConfig = &config.Config{Invalidation: cfg}
+
+	Publish("before") // 未启动时不做任何事
+	Start(cfg)
+	Publish("a", "b")
+	Publish("c")
+	if err := Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	Publish("after") // 停止后不再加入队列
+
+	var ids []string
+	for _, payload := range redis.received() {
+		fields := strings.Fields(payload)
+		if len(fields) == 0 || fields[0] != instanceID {
+			t.Fatalf("payload %q does not start with instance id %q", payload, instanceID)
+		}
+		ids = append(ids, fields[1:]...)
+	}
+	if got := strings.Join(ids, " "); got != "a b c" {
+		t.Fatalf("published %q, want %q", got, "a b c")
+	}
+}
+
+func TestPublishQueueFull(t *testing.T) {
+	// 不启动发布协程，使队列保持满
+	mu.Lock()
+	queue = make(chan message, 1)
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		queue = nil
+		mu.Unlock()
+	})
+	before := metricDropped.Value()
+	Publish("a")
+	Publish("b")
+	if got := metricDropped.Value() - before; got != 1 {
+		t.Fatalf("dropped %d messages, want 1", got)
+	}
+}
+
+func TestStartDisabled(t *testing.T) {
+	Start(config.InvalidationConfig{Buffer: 16})
+	Publish("a")
+	if err := Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// 准入策略
+const (
+	AdmitAll     = "none"    // 所有新项均写入
+	AdmitTinyLFU = "tinylfu" // 缓存已满时，新项的访问频率高于被淘汰项才写入
+)
+
+// sketchDepth Count-Min Sketch 的行数
+const sketchDepth = 4
+
+// sketchMaxCount 单个计数器的上限，频率只需区分冷热，饱和后不再增加
+const sketchMaxCount = 15
+
+// sketch 近似统计键访问频率的 Count-Min Sketch（TinyLFU）
+// 计数达到 10 倍宽度后所有计数减半，使频率反映最近的访问
+type sketch struct {
+	mu      sync.Mutex
+	rows    [sketchDepth][]uint8
+	mask    uint64
+	added   int
+	resetAt int
+}
+
+// newSketch 创建宽度不小于 capacity 的 sketch（宽度为 2 的幂，至少 64）
+func newSketch(capacity int) *sketch {
+	width := 64
+	if capacity > width {
+		width = 1 << bits.Len(uint(capacity-1))
+	}
+	s := &sketch{mask: uint64(width - 1), resetAt: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// keyHash 键的 64 位 FNV-1a 哈希
+func keyHash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// index 键在第 i 行中的位置（双重哈希）
+func (s *sketch) index(h uint64, i int) uint64 {
+	return (h + uint64(i)*(h>>32|1)) & s.mask
+}
+
+// increment 记录一次访问
+func (s *sketch) increment(key string) {
+	h := keyHash(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(h, i)]; *c < sketchMaxCount {
+			*c++
+		}
+	}
+	s.added++
+	if s.added >= s.resetAt {
+		s.age()
+	}
+}
+
+// estimate 返回键的估算访问次数（各行计数的最小值）
+func (s *sketch) estimate(key string) uint8 {
+	h := keyHash(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := uint8(sketchMaxCount)
+	for i := range s.rows {
+		n = min(n, s.rows[i][s.index(h, i)])
+	}
+	return n
+}
+
+// age 所有计数减半（需持有锁）
+func (s *sketch) age() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.added /= 2
+}
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/scheduler"
+	"context"
+	"fmt"
+	"time"
+)
+
+// 已删除会话的保留：journal.retain_deleted_days 大于 0 时，会话行在删除前复制到 session_history_db，
+// 保留该天数后由 session_history_purge 任务删除。与只记录事件的会话历史不同，保留的是删除时的完整会话行，
+// 可以事后追溯某段时间内存在过哪些会话及其元数据
+
+// 会话被删除的原因
+const (
+	archiveDelete = "delete" // Del、刷新与会话数上限删除单个会话
+	archiveRevoke = "revoke" // DelAllByUID 删除用户的所有会话
+	archiveExpire = "expire" // 清理任务删除过期会话
+)
+
+// archiveSchema 已删除会话表结构，见 migrations
+// 同一会话重复删除（删除失败后重试）时只保留一行，记录最后一次删除
+const archiveSchema = `CREATE TABLE IF NOT EXISTS session_history_db (
+	session_id VARCHAR(128) NOT NULL PRIMARY KEY,
+	uid INT NOT NULL,
+	namespace VARCHAR(16) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NULL DEFAULT NULL,
+	expires_at TIMESTAMP NULL DEFAULT NULL,
+	last_active TIMESTAMP NULL DEFAULT NULL,
+	device VARCHAR(128) NOT NULL DEFAULT '',
+	client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	user_agent VARCHAR(512) NOT NULL DEFAULT '',
+	platform VARCHAR(32) NOT NULL DEFAULT '',
+	gateway VARCHAR(64) NOT NULL DEFAULT '',
+	reason VARCHAR(16) NOT NULL,
+	caller VARCHAR(64) NOT NULL DEFAULT '',
+	deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_uid (uid),
+	INDEX idx_deleted_at (deleted_at)
+)`
+
+// archiveSQL 将满足条件的会话行复制到 session_history_db，后接 WHERE 条件
+// 参数：ExpireHours、删除原因、调用方，然后是条件的参数
+const archiveSQL = "INSERT INTO session_history_db (session_id, uid, namespace, created_at, expires_at, last_active, device, client_ip, user_agent, platform, gateway, reason, caller) " +
+	"SELECT session_id, uid, namespace, created_at, " + expiresAtExpr + ", last_active, device, client_ip, user_agent, platform, gateway, ?, ? FROM session_db WHERE "
+
+// archiveUpsert 重复删除时更新删除时间与原因
+const archiveUpsert = " ON DUPLICATE KEY UPDATE reason = VALUES(reason), caller = VALUES(caller), deleted_at = NOW()"
+
+// archiveJob 已删除会话过期清除在调度器中的任务名
+const archiveJob = "session_history_purge"
+
+// archiveEnabled 是否保留已删除的会话
+func archiveEnabled() bool {
+	return config.LatestConfig.Journal.RetainDeletedDays > 0
+}
+
+// archiveSessions 在删除前复制满足条件的会话行（需在删除会话行之前调用）
+// 复制失败只记录日志并计数，不阻止删除：吊销会话比保留记录更重要；复制不随调用方取消而中断
+func archiveSessions(ctx context.Context, reason string, caller string, where string, args ...any) {
+	if !archiveEnabled() {
+		return
+	}
+	params := append([]any{config.LatestConfig.Session.ExpireHours, reason, caller}, args...)
+	sqlResp, err := gateway.ExecSQLParams(context.WithoutCancel(ctx), pb.SqlDatabases_Session, true,
+		archiveSQL+where+archiveUpsert, params...)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		metricArchiveErrors.Inc()
+		logger.Error("failed to archive deleted sessions", "reason", reason, "error", err)
+	}
+}
+
+// startArchivePurge 在调度器中注册已删除会话的过期清除任务，未启用保留时不执行
+func startArchivePurge() {
+	scheduler.Add(scheduler.Job{
+		Name: archiveJob,
+		Every: func() time.Duration {
+			if !archiveEnabled() {
+				return 0
+			}
+			return time.Hour
+		},
+		Delay: time.Minute,
+		Run:   purgeArchive,
+	})
+}
+
+// purgeArchive 分批删除超过保留期的已删除会话，批次大小与间隔与清理任务相同
+// 每次运行时读取最新配置
+func purgeArchive(ctx context.Context) error {
+	days := config.LatestConfig.Journal.RetainDeletedDays
+	if days <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	batch := config.LatestConfig.Session.CleanBatch
+	pause := time.Duration(config.LatestConfig.Session.CleanPause) * time.Millisecond
+	var total int64
+	for {
+		req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+			"DELETE FROM session_history_db WHERE deleted_at < ? LIMIT ?", cutoff, batch)
+		if err != nil {
+			return err
+		}
+		req.GetRowCount = true
+		sqlResp, err := gateway.ExecSQL(ctx, req)
+		if err == nil {
+			err = gateway.CheckResult(sqlResp)
+		}
+		if err != nil {
+			return fmt.Errorf("purge session history: %v", err)
+		}
+		total += sqlResp.RowsAffected
+		scheduler.ReportRows(ctx, sqlResp.RowsAffected)
+		if sqlResp.RowsAffected < int64(batch) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+	if total > 0 {
+		logger.Info("purged archived sessions", "rows", total)
+	}
+	return nil
+}
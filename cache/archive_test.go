@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"testing"
+)
+
+func TestArchiveDeletedSessions(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := SaveSession(ctx, id, 7, 0, SessionMeta{}, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 未启用保留时直接删除
+	config.LatestConfig.Journal.RetainDeletedDays = 0
+	if _, err := DeleteSession(ctx, "a", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.archived) != 0 {
+		t.Fatalf("archived = %v, want none", f.archived)
+	}
+
+	config.LatestConfig.Journal.RetainDeletedDays = 7
+	if _, err := SaveSession(ctx, "d", 8, 0, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteSession(ctx, "d", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := DeleteSessionsByUID(ctx, 7, "test"); err != nil || n != 2 {
+		t.Fatalf("DeleteSessionsByUID() = %d, %v", n, err)
+	}
+	want := map[string]string{"d": archiveDelete, "b": archiveRevoke, "c": archiveRevoke}
+	if len(f.archived) != len(want) {
+		t.Fatalf("archived = %v, want %v", f.archived, want)
+	}
+	for id, reason := range want {
+		if f.archived[id] != reason {
+			t.Fatalf("archived = %v, want %v", f.archived, want)
+		}
+	}
+	if len(f.sessions) != 0 {
+		t.Fatalf("sessions left after delete: %v", f.sessions)
+	}
+}
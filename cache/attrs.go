@@ -0,0 +1,229 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/bus"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 会话属性：附加在会话上的少量键值对，保存在 session_db 的 JSON 列 attrs 中，随会话删除
+// 供其他服务保存与会话同生命周期的状态，不必自行在 Redis 中维护并处理会话删除
+
+// ErrTooManyAttrs 会话的属性数已达 max_attrs
+var ErrTooManyAttrs = errors.New("too many session attributes")
+
+// maxAttrKeyLen 属性名最大长度
+const maxAttrKeyLen = 64
+
+// ValidAttrKey 检查属性名：非空、不超过 64 字节，只包含字母、数字、下划线、连字符、点与冒号
+// 属性名会拼接为 JSON 路径，因此不能包含引号等字符
+func ValidAttrKey(key string) bool {
+	if key == "" || len(key) > maxAttrKeyLen {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '-' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// attrPath 属性在 attrs 列中的 JSON 路径
+func attrPath(key string) string {
+	return `$."` + key + `"`
+}
+
+// attrEntry 会话属性缓存项
+type attrEntry struct {
+	attrs      map[string]string
+	expiration int64 // 过期时的 monotonic 读数（纳秒）
+}
+
+// attrCache 按会话ID缓存属性，缓存项只读，修改属性时整项失效
+type attrCache struct {
+	mu      sync.Mutex
+	entries map[string]attrEntry
+}
+
+var sessionAttrCache = &attrCache{entries: make(map[string]attrEntry)}
+
+func (ac *attrCache) get(sessionID string) (map[string]string, bool) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	entry, ok := ac.entries[sessionID]
+	if !ok || int64(monotonic()) > entry.expiration {
+		return nil, false
+	}
+	return entry.attrs, true
+}
+
+func (ac *attrCache) set(sessionID string, attrs map[string]string, ttl time.Duration) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if _, ok := ac.entries[sessionID]; !ok && len(ac.entries) >= config.LatestConfig.Cache.MemMaxsize {
+		// 缓存已满时淘汰任意一项
+		for k := range ac.entries {
+			delete(ac.entries, k)
+			break
+		}
+	}
+	ac.entries[sessionID] = attrEntry{attrs: attrs, expiration: int64(monotonic() + ttl)}
+}
+
+func (ac *attrCache) invalidate(sessionID string) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	delete(ac.entries, sessionID)
+}
+
+func (ac *attrCache) clear() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	clear(ac.entries)
+}
+
+// GetSessionAttrs 获取会话的全部属性，会话不存在或已过期时返回 ErrSessionNotFound
+// 配置了 attr_cache_ttl 时结果在内存中缓存，返回的 map 不能修改
+func GetSessionAttrs(ctx context.Context, sessionID string) (map[string]string, error) {
+	ttl := time.Duration(config.LatestConfig.Cache.AttrCacheTTL) * time.Second
+	if ttl > 0 {
+		if attrs, ok := sessionAttrCache.get(sessionID); ok {
+			return attrs, nil
+		}
+	}
+
+	attrs, err := sessionStore(ctx).Attrs(ctx, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	if ttl > 0 {
+		sessionAttrCache.set(sessionID, attrs, ttl)
+	}
+	return attrs, nil
+}
+
+// SetSessionAttr 设置会话属性，属性数已达 max_attrs 且属性不存在时返回 ErrTooManyAttrs
+// 调用方需先检查属性名与值的长度
+func SetSessionAttr(ctx context.Context, sessionID string, key string, value string) error {
+	err := sessionStore(ctx).SetAttr(ctx, sessionID, key, value, config.LatestConfig.Session.MaxAttrs)
+	if errors.Is(err, ErrSessionNotFound) || errors.Is(err, ErrTooManyAttrs) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	invalidateAttrs(sessionID)
+	return nil
+}
+
+// DelSessionAttr 删除会话属性，属性不存在时不报错
+func DelSessionAttr(ctx context.Context, sessionID string, key string) error {
+	err := sessionStore(ctx).DelAttr(ctx, sessionID, key)
+	if errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	invalidateAttrs(sessionID)
+	return nil
+}
+
+// invalidateAttrs 失效本实例的属性缓存，并通知其他实例清除该会话的内存缓存
+func invalidateAttrs(sessionID string) {
+	sessionAttrCache.invalidate(sessionID)
+	bus.Publish(sessionID)
+}
+
+// parseAttrs 解析 attrs 列，NULL 或空字符串视为没有属性，非字符串的值忽略
+func parseAttrs(data string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	if data == "" {
+		return attrs, nil
+	}
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return nil, fmt.Errorf("invalid attrs: %v", err)
+	}
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			attrs[k] = s
+		}
+	}
+	return attrs, nil
+}
+
+// attrsQuery 查询未过期会话的属性，参数：ExpireHours、会话ID
+const attrsQuery = "SELECT IFNULL(attrs, '') FROM session_db WHERE session_id = ? AND " + expiresAtExpr + " > NOW() LIMIT 1"
+
+func (gatewayStore) Attrs(ctx context.Context, sessionID string) (map[string]string, error) {
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, attrsQuery,
+		sessionID, config.LatestConfig.Session.ExpireHours)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(sqlResp.Data) == 0 || len(sqlResp.Data[0].Result) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	data, _ := gateway.ScanString(sqlResp.Data[0].Result[0])
+	return parseAttrs(data)
+}
+
+// SetAttr 在一条 UPDATE 中检查属性数并写入，并发写入不同属性时不会超过上限
+// 没有更新行时（会话不存在、已达上限或值未变化）再查询一次以区分
+func (g gatewayStore) SetAttr(ctx context.Context, sessionID string, key string, value string, maxAttrs int) error {
+	path := attrPath(key)
+	req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+		"UPDATE session_db SET attrs = JSON_SET(IFNULL(attrs, JSON_OBJECT()), ?, ?) WHERE session_id = ? AND "+expiresAtExpr+" > NOW()"+
+			" AND (JSON_CONTAINS_PATH(IFNULL(attrs, JSON_OBJECT()), 'one', ?) OR JSON_LENGTH(IFNULL(attrs, JSON_OBJECT())) < ?)",
+		path, value, sessionID, config.LatestConfig.Session.ExpireHours, path, maxAttrs)
+	if err != nil {
+		return err
+	}
+	req.GetRowCount = true
+	sqlResp, err := gateway.ExecSQL(ctx, req)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return err
+	}
+	if sqlResp.RowsAffected > 0 {
+		return nil
+	}
+
+	attrs, err := g.Attrs(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if current, ok := attrs[key]; ok && current == value {
+		return nil
+	}
+	if _, ok := attrs[key]; !ok && len(attrs) >= maxAttrs {
+		return ErrTooManyAttrs
+	}
+	return fmt.Errorf("attribute %q not updated", key)
+}
+
+func (gatewayStore) DelAttr(ctx context.Context, sessionID string, key string) error {
+	_, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, true,
+		"UPDATE session_db SET attrs = JSON_REMOVE(attrs, ?) WHERE session_id = ? AND attrs IS NOT NULL",
+		attrPath(key), sessionID)
+	return err
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"sync/atomic"
+)
+
+// 缓存层旁路开关，用于故障排查时跳过可疑的缓存层
+// 旁路只跳过读取，写入与失效照常进行，关闭旁路后缓存内容依然正确
+var (
+	bypassMemory atomic.Bool
+	bypassRedis  atomic.Bool
+)
+
+// ApplyBypassConfig 按配置设置旁路开关（启动与重载时调用）
+func ApplyBypassConfig() {
+	SetBypass(config.LatestConfig.Cache.BypassMemory, config.LatestConfig.Cache.BypassRedis)
+}
+
+// SetBypass 设置旁路开关
+func SetBypass(memory bool, redis bool) {
+	if bypassMemory.Swap(memory) != memory {
+		logger.Warn("memory cache bypass changed", "bypass", memory)
+	}
+	if bypassRedis.Swap(redis) != redis {
+		logger.Warn("redis cache bypass changed", "bypass", redis)
+	}
+}
+
+// Bypass 返回当前旁路开关状态
+func Bypass() (memory bool, redis bool) {
+	return bypassMemory.Load(), bypassRedis.Load()
+}
+
+// memoryGet 读取内存缓存，旁路时视为未命中
+func memoryGet(sessionID string) (SessionRecord, bool) {
+	if bypassMemory.Load() {
+		return SessionRecord{}, false
+	}
+	return sessionCache.Get(sessionID)
+}
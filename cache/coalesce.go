@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"StealthIMSession/metrics"
+	"context"
+	"sync"
+	"time"
+)
+
+// coalescedCall 一次被合并的查询
+type coalescedCall[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	expired bool               // 查询因共享上下文结束（首个请求的截止时间已到）而失败，err 不是查询本身的结果
+	refs    int                // 仍在等待结果的请求数，受所在分片的 mu 保护
+	cancel  context.CancelFunc // 取消查询，所有请求都放弃等待时调用
+}
+
+// coalesceShards 合并查询表的分片数，不同会话ID的查询大多落在不同分片，互不争用锁
+const coalesceShards = 64
+
+// coalescer 在短时间窗口内合并相同会话ID的查询
+// 窗口内到达的请求共享同一次查询结果，减少热点会话的后端查询
+// 窗口为 0 时只合并同时进行中的查询（即 singleflight）
+type coalescer[V any] struct {
+	shards [coalesceShards]coalesceShard[V]
+	joined *metrics.Counter // 加入进行中查询的请求数
+}
+
+// coalesceShard 合并查询表的分片
+type coalesceShard[V any] struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall[V]
+}
+
+func newCoalescer[V any](joined *metrics.Counter) *coalescer[V] {
+	c := &coalescer[V]{joined: joined}
+	for i := range c.shards {
+		c.shards[i].calls = make(map[string]*coalescedCall[V])
+	}
+	return c
+}
+
+// shardFor 返回会话ID所在的分片
+func (c *coalescer[V]) shardFor(key string) *coalesceShard[V] {
+	return &c.shards[hashKey(key)%coalesceShards]
+}
+
+// do 执行或加入一次查询
+// 首个请求发起查询，等待 window 后执行 fn，期间到达的相同请求等待其结果；请求在窗口内取消时立即返回
+// 查询不随单个请求取消而中断，其他请求仍能拿到结果；所有请求都放弃等待时才取消 fn 的上下文
+// 查询因首个请求的截止时间到达而失败时，仍有效的请求不返回该错误，而是立即重新发起查询
+func (c *coalescer[V]) do(ctx context.Context, key string, window time.Duration, fn func(context.Context) (V, error)) (V, error) {
+	s := c.shardFor(key)
+	for {
+		s.mu.Lock()
+		call, ok := s.calls[key]
+		if ok {
+			call.refs++
+			s.mu.Unlock()
+			c.joined.Inc()
+		} else {
+			callCtx, cancel := sharedContext(ctx)
+			call = &coalescedCall[V]{done: make(chan struct{}), refs: 1, cancel: cancel}
+			s.calls[key] = call
+			s.mu.Unlock()
+			go c.run(callCtx, key, call, window, fn)
+		}
+
+		select {
+		case <-call.done:
+			if call.expired && ctx.Err() == nil {
+				window = 0
+				continue
+			}
+			return call.value, call.err
+		case <-ctx.Done():
+			c.leave(key, call)
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// run 执行查询并通知所有等待的请求
+func (c *coalescer[V]) run(ctx context.Context, key string, call *coalescedCall[V], window time.Duration, fn func(context.Context) (V, error)) {
+	defer call.cancel()
+	if window > 0 {
+		timer := time.NewTimer(window)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	if call.err = ctx.Err(); call.err == nil {
+		call.value, call.err = fn(ctx)
+	}
+	call.expired = call.err != nil && ctx.Err() != nil
+
+	s := c.shardFor(key)
+	s.mu.Lock()
+	if s.calls[key] == call {
+		delete(s.calls, key)
+	}
+	s.mu.Unlock()
+	close(call.done)
+}
+
+// leave 请求放弃等待，没有请求等待时取消查询，之后到达的请求发起新的查询
+func (c *coalescer[V]) leave(key string, call *coalescedCall[V]) {
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	call.refs--
+	if call.refs > 0 {
+		return
+	}
+	call.cancel()
+	if s.calls[key] == call {
+		delete(s.calls, key)
+	}
+}
+
+// sharedContext 合并查询使用的上下文
+// 保留首个请求的截止时间与追踪信息，但不随其取消而取消
+func sharedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	base := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(base, deadline)
+	}
+	return context.WithCancel(base)
+}
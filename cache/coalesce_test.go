@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/metrics"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescerSharesInFlightCall(t *testing.T) {
+	c := newCoalescer[int32](&metrics.Counter{})
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			uid, err := c.do(context.Background(), "hot", 0, func(context.Context) (int32, error) {
+				calls.Add(1)
+				<-release
+				return 42, nil
+			})
+			if err != nil || uid != 42 {
+				t.Errorf("do() = %d, %v, want 42, nil", uid, err)
+			}
+		}()
+	}
+	// 等待所有请求加入进行中的查询
+	for c.joined.Value() < 9 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("backend called %d times, want 1", n)
+	}
+}
+
+func TestCoalescerCancellation(t *testing.T) {
+	c := newCoalescer[int32](&metrics.Counter{})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int32, error) {
+		close(started)
+		select {
+		case <-release:
+			return 42, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	// 首个请求取消后，加入的请求仍拿到结果
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := c.do(leaderCtx, "hot", 0, fn)
+		leaderDone <- err
+	}()
+	<-started
+	waiterDone := make(chan int32, 1)
+	go func() {
+		uid, _ := c.do(context.Background(), "hot", 0, fn)
+		waiterDone <- uid
+	}()
+	for c.joined.Value() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancelLeader()
+	if err := <-leaderDone; err != context.Canceled {
+		t.Fatalf("cancelled leader got %v, want context.Canceled", err)
+	}
+	close(release)
+	if uid := <-waiterDone; uid != 42 {
+		t.Fatalf("waiter got %d, want 42", uid)
+	}
+
+	// 所有请求都放弃等待时取消查询
+	started = make(chan struct{})
+	var backendErr atomic.Value
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.do(ctx, "cold", 0, func(ctx context.Context) (int32, error) {
+			defer close(done)
+			close(started)
+			<-ctx.Done()
+			backendErr.Store(ctx.Err())
+			return 0, ctx.Err()
+		})
+	}()
+	<-started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("abandoned query was not cancelled")
+	}
+	if err := backendErr.Load(); err != context.Canceled {
+		t.Fatalf("backend context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestCoalescerLeaderDeadline(t *testing.T) {
+	c := newCoalescer[int32](&metrics.Counter{})
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (int32, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return 42, nil
+	}
+
+	// 首个请求的截止时间到达后，仍有效的请求重新发起查询，而不是拿到首个请求的超时错误
+	leaderCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := c.do(leaderCtx, "hot", 0, fn)
+		leaderDone <- err
+	}()
+	for calls.Load() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	uid, err := c.do(context.Background(), "hot", 0, fn)
+	if err != nil || uid != 42 {
+		t.Fatalf("follower got %d, %v, want 42, nil", uid, err)
+	}
+	if err := <-leaderDone; err != context.DeadlineExceeded {
+		t.Fatalf("leader got %v, want context.DeadlineExceeded", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("backend called %d times, want 2", n)
+	}
+}
+
+func TestCoalescerWindowCancellation(t *testing.T) {
+	c := newCoalescer[int32](&metrics.Counter{})
+	var called atomic.Bool
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// 窗口内取消的请求立即返回，没有请求等待时不再执行查询
+	start := time.Now()
+	_, err := c.do(ctx, "hot", time.Hour, func(context.Context) (int32, error) {
+		called.Store(true)
+		return 42, nil
+	})
+	if err != context.DeadlineExceeded || time.Since(start) > time.Second {
+		t.Fatalf("do() = %v after %v, want context.DeadlineExceeded", err, time.Since(start))
+	}
+	time.Sleep(10 * time.Millisecond)
+	if called.Load() {
+		t.Fatal("query ran after every caller left during the window")
+	}
+}
+
+func TestCoalesceWindowOnlyOnMiss(t *testing.T) {
+	withFakeGateway(t)
+	config.LatestConfig.Session.ExpireHours = 1
+	ctx := context.Background()
+	if _, err := SaveSession(ctx, "s0", 7, 0, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetUserIDBySession(ctx, "s0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 内存缓存命中不等待合并窗口
+	config.LatestConfig.Cache.CoalesceWindow = int(time.Hour / time.Microsecond)
+	start := time.Now()
+	if uid, err := GetUserIDBySession(ctx, "s0"); err != nil || uid != 7 {
+		t.Fatalf("Get(s0) = %d, %v", uid, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("memory hit took %v", d)
+	}
+
+	// 未命中时在窗口内等待后端查询
+	sessionCache.Delete("s0")
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := GetUserIDBySession(ctx, "s0"); err != context.DeadlineExceeded {
+		t.Fatalf("Get(s0) after miss = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,533 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// 缓存一致性的随机化测试
+//
+// 多个副本各有自己的内存缓存，共享同一个 Redis 与 MySQL（fakeGateway），按随机种子交错执行
+// Set、Get、Del、时间流逝与失效广播投递，每次 Get 与 Del 后按以下一致性模型检查结果：
+//   - 从未创建的会话ID总是查询失败
+//   - 查询成功时返回创建时的 uid
+//   - 未删除且未过期的会话在任何副本上都能查询成功
+//   - 会话删除后，在执行删除的副本与已收到失效广播的副本上查询失败；尚未收到广播的副本可能命中旧的内存缓存
+//   - 会话过期后查询失败；MySQL 的过期时间为秒级精度，缓存最多比过期时间多保留 1 秒
+//
+// 每个操作整体执行，操作内部的并发交错（如回填缓存与删除之间的竞争）不在模型范围内
+
+// fakeSession MySQL 中的一行会话
+type fakeSession struct {
+	uid     int32
+	created time.Time
+	expires time.Time
+	active  time.Time     // last_active，零值表示未写入
+	ttl     time.Duration // ttl_seconds
+}
+
+// fakeRedisValue Redis 中的一个键，expires 为零值时不过期
+type fakeRedisValue struct {
+	value   string
+	expires time.Time
+}
+
+// fakeRefresh 刷新令牌表中的一行
+type fakeRefresh struct {
+	uid     int32
+	session string
+	expires time.Time
+}
+
+// fakeGateway 内存实现的 DBGateway，只支持会话读写用到的语句，时间由 now 控制
+type fakeGateway struct {
+	pb.StealthIMDBGatewayClient // 未实现的方法调用时 panic
+
+	now      time.Time
+	sessions map[string]fakeSession
+	redisMu  sync.Mutex // 批量读写经由 DBGateway 时拆分为并发的单个读写
+	redis    map[string]fakeRedisValue
+	frozen   map[int32]bool
+	refresh  map[string]fakeRefresh // 按令牌哈希
+	archived map[string]string      // session_history_db 中的会话ID与删除原因
+}
+
+func newFakeGateway() *fakeGateway {
+	return &fakeGateway{
+		now:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		sessions: make(map[string]fakeSession),
+		redis:    make(map[string]fakeRedisValue),
+		frozen:   make(map[int32]bool),
+		refresh:  make(map[string]fakeRefresh),
+		archived: make(map[string]string),
+	}
+}
+
+// validUntil 启用空闲超时时会话失效的时刻（validUntilExpr）
+func (s fakeSession) validUntil(idle time.Duration) time.Time {
+	active := s.active
+	if active.IsZero() {
+		active = s.created
+	}
+	if deadline := active.Add(idle); deadline.Before(s.expires) {
+		return deadline
+	}
+	return s.expires
+}
+
+// sqlNow MySQL 的 NOW()，秒级精度
+func (f *fakeGateway) sqlNow() time.Time {
+	return f.now.Truncate(time.Second)
+}
+
+// Mysql 与 DBGateway 相同，只有请求设置 GetRowCount 时才返回影响的行数
+func (f *fakeGateway) Mysql(ctx context.Context, in *pb.SqlRequest, opts ...grpc.CallOption) (*pb.SqlResponse, error) {
+	res, err := f.mysql(in)
+	if res != nil && !in.GetRowCount {
+		res.RowsAffected = 0
+	}
+	return res, err
+}
+
+func (f *fakeGateway) mysql(in *pb.SqlRequest) (*pb.SqlResponse, error) {
+	str := func(i int) string {
+		s, _ := gateway.ScanString(in.Params[i])
+		return s
+	}
+	num := func(i int) int64 {
+		n, _ := gateway.ScanInt64(in.Params[i])
+		return n
+	}
+	ok := &pb.Result{}
+
+	switch {
+	case strings.HasPrefix(in.Sql, "INSERT INTO session_db "):
+		f.sessions[str(0)] = fakeSession{uid: int32(num(1)), created: f.sqlNow(), expires: f.sqlNow().Add(time.Duration(num(7)) * time.Second), ttl: time.Duration(num(9)) * time.Second}
+		return &pb.SqlResponse{Result: ok, RowsAffected: 1}, nil
+	case strings.HasPrefix(in.Sql, "INSERT IGNORE INTO session_db "):
+		var n int64
+		for row := 0; row+10 <= len(in.Params); row += 10 {
+			if _, found := f.sessions[str(row)]; !found {
+				f.sessions[str(row)] = fakeSession{uid: int32(num(row + 1)), created: f.sqlNow(), expires: f.sqlNow().Add(time.Duration(num(row+7)) * time.Second), ttl: time.Duration(num(row+9)) * time.Second}
+				n++
+			}
+		}
+		return &pb.SqlResponse{Result: ok, RowsAffected: n}, nil
+	case in.Sql == uidQuery:
+		s, found := f.sessions[str(1)]
+		if !found {
+			return &pb.SqlResponse{Result: ok}, nil
+		}
+		remaining := int64(s.expires.Sub(f.sqlNow()) / time.Second)
+		return &pb.SqlResponse{Result: ok, Data: []*pb.SqlLine{{Result: []*pb.InterFaceType{
+			{Response: &pb.InterFaceType_Int32{Int32: s.uid}},
+			{Response: &pb.InterFaceType_Int64{Int64: remaining}},
+		}}}}, nil
+	case in.Sql == uidIdleQuery:
+		s, found := f.sessions[str(2)]
+		if !found {
+			return &pb.SqlResponse{Result: ok}, nil
+		}
+		until := s.validUntil(time.Duration(num(1)) * time.Minute)
+		return &pb.SqlResponse{Result: ok, Data: []*pb.SqlLine{{Result: []*pb.InterFaceType{
+			{Response: &pb.InterFaceType_Int32{Int32: s.uid}},
+			{Response: &pb.InterFaceType_Int64{Int64: int64(until.Sub(f.sqlNow()) / time.Second)}},
+		}}}}, nil
+	case in.Sql == activeSQL:
+		s, found := f.sessions[str(0)]
+		if !found || !s.validUntil(time.Duration(num(2))*time.Minute).After(f.sqlNow()) {
+			return &pb.SqlResponse{Result: ok}, nil
+		}
+		s.active = f.sqlNow()
+		f.sessions[str(0)] = s
+		return &pb.SqlResponse{Result: ok, RowsAffected: 1}, nil
+	case in.Sql == "UPDATE session_db SET session_id = ? WHERE session_id = ?":
+		s, found := f.sessions[str(1)]
+		if !found {
+			return &pb.SqlResponse{Result: ok}, nil
+		}
+		delete(f.sessions, str(1))
+		f.sessions[str(0)] = s
+		return &pb.SqlResponse{Result: ok, RowsAffected: 1}, nil
+	case in.Sql == "UPDATE session_refresh_db SET session_id = ? WHERE session_id = ?":
+		var n int64
+		for hash, r := range f.refresh {
+			if r.session == str(1) {
+				r.session = str(0)
+				f.refresh[hash] = r
+				n++
+			}
+		}
+		return &pb.SqlResponse{Result: ok, RowsAffected: n}, nil
+	case in.Sql == "DELETE FROM session_db WHERE session_id = ?":
+		var n int64
+		if _, found := f.sessions[str(0)]; found {
+			delete(f.sessions, str(0))
+			n = 1
+		}
+		return &pb.SqlResponse{Result: ok, RowsAffected: n}, nil
+	case in.Sql == "SELECT session_id FROM session_db WHERE uid = ?":
+		resp := &pb.SqlResponse{Result: ok}
+		for id, s := range f.sessions {
+			if s.uid == int32(num(0)) {
+				resp.Data = append(resp.Data, &pb.SqlLine{Result: []*pb.InterFaceType{{Response: &pb.InterFaceType_Str{Str: id}}}})
+			}
+		}
+		return resp, nil
+	case strings.HasPrefix(in.Sql, "DELETE FROM session_db WHERE uid = ? AND session_id IN ("):
+		var n int64
+		for _, p := range in.Params[1:] {
+			id, _ := gateway.ScanString(p)
+			if s, found := f.sessions[id]; found && s.uid == int32(num(0)) {
+				delete(f.sessions, id)
+				n++
+			}
+		}
+		return &pb.SqlResponse{Result: ok, RowsAffected: n}, nil
+	case in.Sql == "DELETE FROM session_db WHERE uid = ?":
+		var n int64
+		for id, s := range f.sessions {
+			if s.uid == int32(num(0)) {
+				delete(f.sessions, id)
+				n++
+			}
+		}
+		return &pb.SqlResponse{Result: ok, RowsAffected: n}, nil
+	case in.Sql == "DELETE FROM session_journal_db WHERE uid = ?",
+		in.Sql == "DELETE FROM session_history_db WHERE uid = ?",
+		in.Sql == "DELETE FROM session_audit WHERE uid = ?":
+		// 会话历史、保留的已删除会话与审计记录视为空表
+		return &pb.SqlResponse{Result: ok}, nil
+	case in.Sql == oldestSessionsSQL:
+		var ids []string
+		for id, s := range f.sessions {
+			if s.uid == int32(num(0)) && s.expires.After(f.sqlNow()) {
+				ids = append(ids, id)
+			}
+		}
+		slices.SortFunc(ids, func(a, b string) int {
+			if c := f.sessions[a].created.Compare(f.sessions[b].created); c != 0 {
+				return c
+			}
+			return strings.Compare(a, b)
+		})
+		resp := &pb.SqlResponse{Result: ok}
+		for _, id := range ids {
+			resp.Data = append(resp.Data, &pb.SqlLine{Result: []*pb.InterFaceType{{Response: &pb.InterFaceType_Str{Str: id}}}})
+		}
+		return resp, nil
+	case in.Sql == warmupQuery:
+		var ids []string
+		for id, s := range f.sessions {
+			if s.expires.After(f.sqlNow()) {
+				ids = append(ids, id)
+			}
+		}
+		slices.SortFunc(ids, func(a, b string) int {
+			if c := f.sessions[b].created.Compare(f.sessions[a].created); c != 0 {
+				return c
+			}
+			return strings.Compare(a, b)
+		})
+		ids = ids[min(int(num(3)), len(ids)):]
+		ids = ids[:min(int(num(2)), len(ids))]
+		resp := &pb.SqlResponse{Result: ok}
+		for _, id := range ids {
+			resp.Data = append(resp.Data, &pb.SqlLine{Result: []*pb.InterFaceType{
+				{Response: &pb.InterFaceType_Str{Str: id}},
+				{Response: &pb.InterFaceType_Int32{Int32: f.sessions[id].uid}},
+				{Response: &pb.InterFaceType_Int64{Int64: int64(f.sessions[id].expires.Sub(f.sqlNow()) / time.Second)}},
+			}})
+		}
+		return resp, nil
+	case strings.HasPrefix(in.Sql, archiveSQL) && strings.HasSuffix(in.Sql, archiveUpsert):
+		var n int64
+		for id, s := range f.sessions {
+			switch strings.TrimSuffix(strings.TrimPrefix(in.Sql, archiveSQL), archiveUpsert) {
+			case "session_id = ?":
+				if id != str(3) {
+					continue
+				}
+			case "uid = ?":
+				if s.uid != int32(num(3)) {
+					continue
+				}
+			case "uid = ? AND session_id IN (?" + strings.Repeat(", ?", len(in.Params)-5) + ")":
+				if s.uid != int32(num(3)) || !slices.ContainsFunc(in.Params[4:], func(p *pb.InterFaceType) bool {
+					v, _ := gateway.ScanString(p)
+					return v == id
+				}) {
+					continue
+				}
+			default:
+				return nil, fmt.Errorf("fakeGateway: unsupported archive condition %q", in.Sql)
+			}
+			f.archived[id] = str(1)
+			n++
+		}
+		return &pb.SqlResponse{Result: ok, RowsAffected: n}, nil
+	case strings.HasPrefix(in.Sql, "INSERT INTO session_freeze_db "):
+		f.frozen[int32(num(0))] = true
+		return &pb.SqlResponse{Result: ok, RowsAffected: 1}, nil
+	case in.Sql == "DELETE FROM session_freeze_db WHERE uid = ?":
+		delete(f.frozen, int32(num(0)))
+		return &pb.SqlResponse{Result: ok}, nil
+	case in.Sql == "SELECT uid FROM session_freeze_db":
+		resp := &pb.SqlResponse{Result: ok}
+		for uid := range f.frozen {
+			resp.Data = append(resp.Data, &pb.SqlLine{Result: []*pb.InterFaceType{{Response: &pb.InterFaceType_Int32{Int32: uid}}}})
+		}
+		return resp, nil
+	case in.Sql == migrationQuery:
+		var ids []string
+		for id := range f.sessions {
+			if id > str(0) {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		if limit := int(num(1)); len(ids) > limit {
+			ids = ids[:limit]
+		}
+		resp := &pb.SqlResponse{Result: ok}
+		for _, id := range ids {
+			resp.Data = append(resp.Data, &pb.SqlLine{Result: []*pb.InterFaceType{{Response: &pb.InterFaceType_Str{Str: id}}}})
+		}
+		return resp, nil
+	case strings.HasPrefix(in.Sql, "INSERT INTO session_refresh_db "):
+		f.refresh[str(0)] = fakeRefresh{uid: int32(num(1)), session: str(2), expires: f.sqlNow().Add(time.Duration(num(3)) * time.Second)}
+		return &pb.SqlResponse{Result: ok, RowsAffected: 1}, nil
+	case strings.HasPrefix(in.Sql, "SELECT uid, session_id FROM session_refresh_db "):
+		r, found := f.refresh[str(0)]
+		if !found || !r.expires.After(f.sqlNow()) {
+			return &pb.SqlResponse{Result: ok}, nil
+		}
+		return &pb.SqlResponse{Result: ok, Data: []*pb.SqlLine{{Result: []*pb.InterFaceType{
+			{Response: &pb.InterFaceType_Int32{Int32: r.uid}},
+			{Response: &pb.InterFaceType_Str{Str: r.session}},
+		}}}}, nil
+	case strings.HasPrefix(in.Sql, "DELETE FROM session_refresh_db WHERE "):
+		var n int64
+		for hash, r := range f.refresh {
+			var match bool
+			switch strings.TrimPrefix(in.Sql, "DELETE FROM session_refresh_db WHERE ") {
+			case "token_hash = ?":
+				match = hash == str(0)
+			case "session_id = ?":
+				match = r.session == str(0)
+			case "uid = ?":
+				match = r.uid == int32(num(0))
+			}
+			if match {
+				delete(f.refresh, hash)
+				n++
+			}
+		}
+		return &pb.SqlResponse{Result: ok, RowsAffected: n}, nil
+	}
+	return nil, fmt.Errorf("fakeGateway: unsupported sql %q", in.Sql)
+}
+
+func (f *fakeGateway) RedisGet(ctx context.Context, in *pb.RedisGetStringRequest, opts ...grpc.CallOption) (*pb.RedisGetStringResponse, error) {
+	f.redisMu.Lock()
+	defer f.redisMu.Unlock()
+	v, found := f.redis[in.Key]
+	if !found || (!v.expires.IsZero() && !f.now.Before(v.expires)) {
+		return &pb.RedisGetStringResponse{Result: &pb.Result{}}, nil
+	}
+	return &pb.RedisGetStringResponse{Result: &pb.Result{}, Value: v.value}, nil
+}
+
+func (f *fakeGateway) RedisSet(ctx context.Context, in *pb.RedisSetStringRequest, opts ...grpc.CallOption) (*pb.RedisSetResponse, error) {
+	f.redisMu.Lock()
+	defer f.redisMu.Unlock()
+	v := fakeRedisValue{value: in.Value}
+	if in.Ttl > 0 {
+		v.expires = f.now.Add(time.Duration(in.Ttl) * time.Second)
+	}
+	f.redis[in.Key] = v
+	return &pb.RedisSetResponse{Result: &pb.Result{}}, nil
+}
+
+func (f *fakeGateway) RedisDel(ctx context.Context, in *pb.RedisDelRequest, opts ...grpc.CallOption) (*pb.RedisDelResponse, error) {
+	f.redisMu.Lock()
+	defer f.redisMu.Unlock()
+	delete(f.redis, in.Key)
+	return &pb.RedisDelResponse{Result: &pb.Result{}}, nil
+}
+
+// modelSession 一致性模型中的会话
+type modelSession struct {
+	uid     int32
+	expires time.Time
+	deleted bool
+	purged  map[int]bool // 删除后已清除内存缓存的副本
+}
+
+// replica 模拟的服务实例
+type replica struct {
+	mem     *Cache[SessionRecord]
+	pending []string // 尚未投递的失效广播
+}
+
+func TestCacheCoherence(t *testing.T) {
+	saved := *config.LatestConfig
+	savedCache, savedClock, savedMono := sessionCache, clock, monotonic
+	t.Cleanup(func() {
+		*config.LatestConfig = saved
+		sessionCache, clock, monotonic = savedCache, savedClock, savedMono
+	})
+	cfg := config.LatestConfig
+	cfg.Cache.MemTimeout = 10
+	cfg.Cache.MemMaxsize = 100000
+	cfg.Cache.RedisTTL = 20
+	cfg.Cache.NegativeTTL = 5
+	cfg.Cache.CoalesceWindow = 0
+	cfg.Session.ExpireHours = 1
+	cfg.Journal.Enable = false
+	cfg.Invalidation.Enable = false
+	cfg.DBGateway.Timeout = 1000
+	cfg.DBGateway.RetryAttempts = 1
+	cfg.DBGateway.BreakerThreshold = 0
+
+	for seed := uint64(1); seed <= 50; seed++ {
+		runCoherence(t, seed, 500)
+		if t.Failed() {
+			return
+		}
+	}
+}
+
+// runCoherence 以给定种子执行一轮随机操作，失败时输出种子与最近的操作
+func runCoherence(t *testing.T, seed uint64, steps int) {
+	rng := rand.New(rand.NewPCG(seed, 0))
+	f := newFakeGateway()
+	defer gateway.Override(f)()
+	clock = func() time.Time { return f.now }
+	start := f.now
+	monotonic = func() time.Duration { return f.now.Sub(start) }
+
+	replicas := make([]*replica, 3)
+	for i := range replicas {
+		replicas[i] = &replica{mem: newCache[SessionRecord](1, true)}
+	}
+	model := make(map[string]*modelSession)
+	var ids []string
+	var trace []string
+	ctx := context.Background()
+
+	fail := func(format string, args ...any) {
+		t.Helper()
+		if len(trace) > 20 {
+			trace = trace[len(trace)-20:]
+		}
+		t.Fatalf("seed %d: %s\nrecent operations:\n  %s", seed, fmt.Sprintf(format, args...), strings.Join(trace, "\n  "))
+	}
+	pick := func() string {
+		if len(ids) == 0 || rng.IntN(10) == 0 {
+			return fmt.Sprintf("ghost%d", rng.IntN(5))
+		}
+		return ids[rng.IntN(len(ids))]
+	}
+
+	for step := 0; step < steps; step++ {
+		ri := rng.IntN(len(replicas))
+		r := replicas[ri]
+		sessionCache = r.mem
+
+		switch op := rng.IntN(14); {
+		case op < 3: // Set
+			id := fmt.Sprintf("s%d", len(ids))
+			uid := rng.Int32N(1000) + 1
+			ttl := time.Duration(rng.IntN(30)+1) * time.Second
+			prime := rng.IntN(2) == 0
+			trace = append(trace, fmt.Sprintf("%v replica %d: Set %s uid=%d ttl=%v prime=%v", f.now.Format(time.StampMilli), ri, id, uid, ttl, prime))
+			if _, err := SaveSession(ctx, id, uid, ttl, SessionMeta{}, "test"); err != nil {
+				fail("SaveSession(%s) = %v", id, err)
+			}
+			if prime {
+				if err := PrimeSession(ctx, id, uid, ttl); err != nil {
+					fail("PrimeSession(%s) = %v", id, err)
+				}
+			}
+			ids = append(ids, id)
+			model[id] = &modelSession{uid: uid, expires: f.sqlNow().Add(ttl)}
+
+		case op < 9: // Get
+			id := pick()
+			uid, err := GetUserIDBySession(ctx, id)
+			trace = append(trace, fmt.Sprintf("%v replica %d: Get %s = %d, %v", f.now.Format(time.StampMilli), ri, id, uid, err))
+			if errors.Is(err, ErrBackendUnavailable) {
+				fail("Get(%s) on replica %d: %v", id, ri, err)
+			}
+			m := model[id]
+			switch {
+			case m == nil:
+				if err == nil {
+					fail("Get(%s) on replica %d succeeded for a session that never existed", id, ri)
+				}
+			case err == nil && uid != m.uid:
+				fail("Get(%s) on replica %d = %d, want uid %d", id, ri, uid, m.uid)
+			case m.deleted && m.purged[ri]:
+				if err == nil {
+					fail("Get(%s) on replica %d succeeded after Del and invalidation delivery", id, ri)
+				}
+			case m.deleted:
+				// 尚未收到失效广播，可能命中旧的内存缓存
+			case !f.now.Before(m.expires.Add(time.Second)):
+				if err == nil {
+					fail("Get(%s) on replica %d succeeded after expiry at %v", id, ri, m.expires.Format(time.StampMilli))
+				}
+			case f.now.Before(m.expires):
+				if err != nil {
+					fail("Get(%s) on replica %d failed for a live session: %v", id, ri, err)
+				}
+			}
+
+		case op < 10: // Del
+			id := pick()
+			existed, err := DeleteSession(ctx, id, "test")
+			trace = append(trace, fmt.Sprintf("%v replica %d: Del %s = %v, %v", f.now.Format(time.StampMilli), ri, id, existed, err))
+			if err != nil {
+				fail("DeleteSession(%s) = %v", id, err)
+			}
+			m := model[id]
+			if want := m != nil && !m.deleted; existed != want {
+				fail("DeleteSession(%s) existed = %v, want %v", id, existed, want)
+			}
+			if m == nil {
+				break
+			}
+			m.deleted = true
+			m.purged = map[int]bool{ri: true}
+			for i, other := range replicas {
+				if i != ri {
+					other.pending = append(other.pending, id)
+				}
+			}
+
+		case op < 12: // 投递失效广播
+			trace = append(trace, fmt.Sprintf("%v replica %d: deliver %v", f.now.Format(time.StampMilli), ri, r.pending))
+			for _, id := range r.pending {
+				PurgeLocal(id)
+				model[id].purged[ri] = true
+			}
+			r.pending = nil
+
+		default: // 时间流逝
+			f.now = f.now.Add(time.Duration(rng.IntN(3000)) * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/events"
+	"StealthIMSession/gateway"
+	"StealthIMSession/obfuscate"
+	"StealthIMSession/scheduler"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// freezeSchema 冻结的用户，见 migrations
+const freezeSchema = `CREATE TABLE IF NOT EXISTS session_freeze_db (
+	uid INT NOT NULL PRIMARY KEY,
+	caller VARCHAR(64) NOT NULL DEFAULT '',
+	reason VARCHAR(256) NOT NULL DEFAULT '',
+	frozen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// 冻结用户列表的本地副本，由 freeze_sync 任务定期从数据库同步，本实例冻结或解冻时立即更新
+var (
+	frozenLock sync.RWMutex
+	frozenUIDs = make(map[int32]struct{})
+)
+
+// IsFrozen 用户是否被冻结
+func IsFrozen(uid int32) bool {
+	frozenLock.RLock()
+	defer frozenLock.RUnlock()
+	_, ok := frozenUIDs[uid]
+	return ok
+}
+
+// SetFrozen 冻结或解冻用户，写入数据库并记录历史事件
+// 冻结不删除会话：冻结期间 Get 与 Set 被拒绝，解冻后原有会话恢复可用
+func SetFrozen(ctx context.Context, uid int32, frozen bool, reason string, caller string) error {
+	var sqlResp *pb.SqlResponse
+	var err error
+	if frozen {
+		sqlResp, err = gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, true,
+			"INSERT INTO session_freeze_db (uid, caller, reason) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE caller = VALUES(caller), reason = VALUES(reason)",
+			uid, caller, reason)
+	} else {
+		sqlResp, err = gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, true,
+			"DELETE FROM session_freeze_db WHERE uid = ?", uid)
+	}
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	frozenLock.Lock()
+	if frozen {
+		frozenUIDs[uid] = struct{}{}
+	} else {
+		delete(frozenUIDs, uid)
+	}
+	metricFrozenUIDs.Set(int64(len(frozenUIDs)))
+	frozenLock.Unlock()
+
+	event := journalUnfreeze
+	if frozen {
+		event = journalFreeze
+		events.Emit(events.Event{Type: events.Revoked, UID: uid})
+	}
+	journalFreezeUID(ctx, uid, event, caller)
+	logger.Warn("uid freeze changed", "uid", obfuscate.UID(uid), "frozen", frozen, "reason", reason, "caller", caller)
+	return nil
+}
+
+// syncFrozen 从数据库重新加载冻结用户列表
+func syncFrozen(ctx context.Context) error {
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT uid FROM session_freeze_db")
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	uids := make(map[int32]struct{}, len(sqlResp.Data))
+	for _, row := range sqlResp.Data {
+		if len(row.Result) == 0 {
+			continue
+		}
+		if uid, ok := gateway.ScanInt64(row.Result[0]); ok {
+			uids[int32(uid)] = struct{}{}
+		}
+	}
+
+	frozenLock.Lock()
+	frozenUIDs = uids
+	frozenLock.Unlock()
+	metricFrozenUIDs.Set(int64(len(uids)))
+	return nil
+}
+
+// startFreezeSync 在调度器中注册冻结用户列表的同步任务，启动时立即同步一次
+// 其他实例冻结的用户最多经过 freeze_sync_interval 秒后在本实例生效
+func startFreezeSync() {
+	scheduler.Add(scheduler.Job{
+		Name: "freeze_sync",
+		Every: func() time.Duration {
+			return time.Duration(config.LatestConfig.Session.FreezeSyncInterval) * time.Second
+		},
+		Run: func(ctx context.Context) error {
+			if err := syncFrozen(ctx); err != nil {
+				return err
+			}
+			frozenLock.RLock()
+			scheduler.ReportRows(ctx, int64(len(frozenUIDs)))
+			frozenLock.RUnlock()
+			return nil
+		},
+	})
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFreezeUID(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	t.Cleanup(func() { syncFrozen(ctx) })
+
+	if err := SetFrozen(ctx, 7, true, "compromised", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if !IsFrozen(7) || IsFrozen(8) || !f.frozen[7] {
+		t.Fatalf("after freeze: IsFrozen(7) = %v, IsFrozen(8) = %v, stored = %v", IsFrozen(7), IsFrozen(8), f.frozen)
+	}
+
+	// 其他实例的冻结与解冻经同步生效
+	f.frozen[8] = true
+	delete(f.frozen, 7)
+	if err := syncFrozen(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if IsFrozen(7) || !IsFrozen(8) || metricFrozenUIDs.Value() != 1 {
+		t.Fatalf("after sync: IsFrozen(7) = %v, IsFrozen(8) = %v, gauge = %d", IsFrozen(7), IsFrozen(8), metricFrozenUIDs.Value())
+	}
+
+	if err := SetFrozen(ctx, 8, false, "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if IsFrozen(8) || f.frozen[8] {
+		t.Fatal("uid 8 still frozen after unfreeze")
+	}
+}
@@ -0,0 +1,186 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/bus"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"StealthIMSession/scheduler"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 哈希存储会话ID：启用 session.hash_ids 时，session_db、会话历史、刷新令牌表与 Redis 中只保存
+// "#" 加会话ID的 SHA-256（十六进制），带命名空间的会话保留 "<命名空间>:" 前缀，数据库导出不会泄露有效的会话ID
+// 合法的会话ID不包含 '#'（见 ValidSessionID），以此区分已哈希与尚未迁移的明文会话ID
+
+// hashedIDMarker 已哈希的会话ID的前缀
+const hashedIDMarker = "#"
+
+// hashMigrationJob 明文会话ID迁移在调度器中的任务名
+const hashMigrationJob = "hash_ids_migration"
+
+// 迁移每批改写的行数与批次之间的等待时间
+const (
+	hashMigrationBatch = 1000
+	hashMigrationPause = 100 * time.Millisecond
+)
+
+// hashedColumnExpr 以 SQL 计算列中会话ID的哈希形式，与 StoredID 一致
+func hashedColumnExpr(column string) string {
+	return "IF(LOCATE(':', " + column + ") > 0, CONCAT(SUBSTRING_INDEX(" + column + ", ':', 1), ':" + hashedIDMarker + "', SHA2(SUBSTRING(" + column + ", LOCATE(':', " + column + ") + 1), 256)), CONCAT('" + hashedIDMarker + "', SHA2(" + column + ", 256)))"
+}
+
+// plainIDTables 保存会话ID的表与列，迁移时按顺序改写；会话历史中冻结等事件的会话ID为空，不改写
+var plainIDTables = []struct {
+	table string
+	where string
+}{
+	{"session_db", "session_id NOT LIKE '%" + hashedIDMarker + "%'"},
+	{"session_refresh_db", "session_id NOT LIKE '%" + hashedIDMarker + "%'"},
+	{"session_journal_db", "session_id <> '' AND session_id NOT LIKE '%" + hashedIDMarker + "%'"},
+	{"session_history_db", "session_id NOT LIKE '%" + hashedIDMarker + "%'"},
+}
+
+var (
+	// hashIDs 启动时的 session.hash_ids，重载配置不改变：切换后已有的会话全部无法查询
+	hashIDs atomic.Bool
+	// plainIDsMigrated 本实例最近一次迁移没有发现明文会话ID，不再逐个改写请求中的会话
+	plainIDsMigrated atomic.Bool
+)
+
+// HashIDs 是否以哈希形式存储会话ID
+func HashIDs() bool {
+	return hashIDs.Load()
+}
+
+// SetHashIDs 设置是否以哈希形式存储会话ID，启动时按 session.hash_ids 设置
+func SetHashIDs(enabled bool) {
+	hashIDs.Store(enabled)
+}
+
+// StoredID 会话（带命名空间的键，见 NamespacedID）在存储与缓存中的键
+// 启用 hash_ids 时会话ID部分替换为 "#" 加其 SHA-256，已是哈希形式的键原样返回
+func StoredID(key string) string {
+	if !HashIDs() {
+		return key
+	}
+	ns, id := SplitNamespace(key)
+	if strings.HasPrefix(id, hashedIDMarker) {
+		return key
+	}
+	sum := sha256.Sum256([]byte(id))
+	return NamespacedID(ns, hashedIDMarker+hex.EncodeToString(sum[:]))
+}
+
+// PlainIDsRemain 启用 hash_ids 后，存储中是否可能仍有明文会话ID（本实例的迁移尚未完成）
+func PlainIDsRemain() bool {
+	return HashIDs() && !plainIDsMigrated.Load()
+}
+
+// AdoptPlainID 将会话在 session_db 与刷新令牌表中的明文行改为哈希形式，改写了会话行时返回 true
+// 迁移完成前由请求在以哈希形式查询不到会话时调用，并清除查询时写入的无效标记，使尚未被迁移任务处理的会话
+// 重试后仍能查询与删除；失败时只记录日志，该会话在迁移任务处理前查询不到
+func AdoptPlainID(ctx context.Context, key string) bool {
+	stored := StoredID(key)
+	if stored == key {
+		return false
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, table := range []string{"session_db", "session_refresh_db"} {
+		req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+			"UPDATE "+table+" SET session_id = ? WHERE session_id = ?", stored, key)
+		if err != nil {
+			logger.Warn("hash plain session ID failed", "table", table, logging.Session(stored), "error", err)
+			return false
+		}
+		req.GetRowCount = true
+		sqlResp, err := gateway.ExecSQL(ctx, req)
+		if err == nil {
+			err = gateway.CheckResult(sqlResp)
+		}
+		if err != nil {
+			logger.Warn("hash plain session ID failed", "table", table, logging.Session(stored), "error", err)
+			return false
+		}
+		if table == "session_db" && sqlResp.RowsAffected == 0 {
+			// 没有明文会话行，刷新令牌留给迁移任务处理
+			return false
+		}
+	}
+	if _, err := gateway.ExecRedisDel(ctx, &pb.RedisDelRequest{Key: redisSessionKey(stored)}); err != nil {
+		logger.Warn("clear invalid marker of hashed session failed", logging.Session(stored), "error", err)
+	}
+	PurgeLocal(stored)
+	bus.Publish(stored)
+	return true
+}
+
+// startHashMigration 启用 hash_ids 时在调度器中注册明文会话ID的迁移任务
+// 启动后立即迁移，之后每分钟检查一次，直到某次迁移没有发现明文会话ID
+func startHashMigration() {
+	SetHashIDs(config.LatestConfig.Session.HashIDs)
+	if !HashIDs() {
+		return
+	}
+	scheduler.Add(scheduler.Job{
+		Name: hashMigrationJob,
+		Every: func() time.Duration {
+			if plainIDsMigrated.Load() {
+				return 0
+			}
+			return time.Minute
+		},
+		Run: func(ctx context.Context) error {
+			n, err := HashPlainIDs(ctx, hashMigrationBatch)
+			scheduler.ReportRows(ctx, n)
+			if err == nil && n == 0 {
+				plainIDsMigrated.Store(true)
+				logger.Info("all stored session IDs are hashed")
+			}
+			return err
+		},
+	})
+}
+
+// HashPlainIDs 分批将各表中的明文会话ID改写为哈希形式，返回改写的行数
+// 改写是幂等的，多个实例同时执行时不会重复哈希
+func HashPlainIDs(ctx context.Context, batch int) (int64, error) {
+	var total int64
+	for _, t := range plainIDTables {
+		for {
+			req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+				"UPDATE "+t.table+" SET session_id = "+hashedColumnExpr("session_id")+" WHERE "+t.where+" LIMIT ?", batch)
+			if err != nil {
+				return total, err
+			}
+			req.GetRowCount = true
+			sqlResp, err := gateway.ExecSQL(ctx, req)
+			if err == nil {
+				err = gateway.CheckResult(sqlResp)
+			}
+			if err != nil {
+				return total, fmt.Errorf("hash session IDs in %s: %v", t.table, err)
+			}
+			total += sqlResp.RowsAffected
+			if sqlResp.RowsAffected < int64(batch) {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(hashMigrationPause):
+			}
+		}
+	}
+	if total > 0 {
+		logger.Info("hashed plain session IDs", "rows", total)
+	}
+	return total, nil
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoredID(t *testing.T) {
+	t.Cleanup(func() { SetHashIDs(false) })
+
+	if got := StoredID("app:abc"); got != "app:abc" {
+		t.Fatalf("StoredID() without hash_ids = %q", got)
+	}
+
+	SetHashIDs(true)
+	// echo -n abc | sha256sum
+	const abc = "#ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := StoredID("abc"); got != abc {
+		t.Fatalf("StoredID(abc) = %q, want %q", got, abc)
+	}
+	if got := StoredID("app:abc"); got != "app:"+abc {
+		t.Fatalf("StoredID(app:abc) = %q", got)
+	}
+	// 已哈希的键原样返回
+	if got := StoredID(StoredID("app:abc")); got != "app:"+abc {
+		t.Fatalf("StoredID() is not idempotent: %q", got)
+	}
+	if ValidSessionID(abc) {
+		t.Fatal("hashed session ID accepted as a session ID")
+	}
+	if !strings.Contains(hashedColumnExpr("session_id"), "SHA2(session_id, 256)") {
+		t.Fatalf("hashedColumnExpr() = %s", hashedColumnExpr("session_id"))
+	}
+}
+
+func TestAdoptPlainID(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	SetHashIDs(true)
+	t.Cleanup(func() { SetHashIDs(false) })
+
+	// 启用 hash_ids 前保存的明文会话
+	f.sessions["app:abc"] = fakeSession{uid: 7, created: f.sqlNow(), expires: f.sqlNow().Add(time.Hour)}
+	stored := StoredID("app:abc")
+	if _, err := GetUserIDBySession(ctx, stored); err == nil {
+		t.Fatal("plain session found by its hashed ID")
+	}
+	if !AdoptPlainID(ctx, "app:abc") {
+		t.Fatal("AdoptPlainID() = false")
+	}
+	// 查询时写入的无效标记已清除
+	if uid, err := GetUserIDBySession(ctx, stored); err != nil || uid != 7 {
+		t.Fatalf("GetUserIDBySession() after adopting = %d, %v", uid, err)
+	}
+	if AdoptPlainID(ctx, "app:abc") {
+		t.Fatal("AdoptPlainID() = true without a plain row")
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"context"
+	"time"
+)
+
+// 空闲超时：last_active（未写入过时为 created_at）之后超过 idle_timeout_minutes 没有 Get 的会话失效，
+// 与 expires_at 独立判断，取两者中较早的时刻
+// last_active 由 Get 在后台写入，同一会话在 touch_interval 内只写入一次，因此实际空闲时间最多提前 touch_interval 判定为超时
+
+// idleDeadlineExpr 会话因空闲失效的时刻，参数：IdleTimeoutMinutes
+const idleDeadlineExpr = "IFNULL(last_active, created_at) + INTERVAL ? MINUTE"
+
+// validUntilExpr 启用空闲超时时会话失效的时刻
+// 参数：ExpireHours、IdleTimeoutMinutes
+const validUntilExpr = "LEAST(" + expiresAtExpr + ", " + idleDeadlineExpr + ")"
+
+// uidIdleQuery 与 uidQuery 相同，剩余有效秒数同时受空闲超时限制
+// 参数：ExpireHours、IdleTimeoutMinutes、会话ID
+const uidIdleQuery = "SELECT uid, TIMESTAMPDIFF(SECOND, NOW(), " + validUntilExpr + ") FROM session_db WHERE session_id = ? LIMIT 1"
+
+// expiredIdleWhere 启用空闲超时时过期会话的条件，参数：ExpireHours、IdleTimeoutMinutes
+const expiredIdleWhere = "(" + expiredWhere + " OR " + idleDeadlineExpr + " < NOW())"
+
+// activeSQL 记录会话活跃时间，已失效的会话不再写入
+// 参数：会话ID、ExpireHours、IdleTimeoutMinutes
+const activeSQL = "UPDATE session_db SET last_active = NOW() WHERE session_id = ? AND " + validUntilExpr + " > NOW()"
+
+// IdleTimeout 空闲超时时间，未启用时为 0
+func IdleTimeout() time.Duration {
+	return time.Duration(config.LatestConfig.Session.IdleTimeoutMinutes) * time.Minute
+}
+
+// capIdle 启用空闲超时时，缓存有效期不超过一个空闲超时：此后需重新查询 last_active
+func capIdle(ttl time.Duration) time.Duration {
+	if idle := IdleTimeout(); idle > 0 {
+		return min(ttl, idle)
+	}
+	return ttl
+}
+
+// expiredCondition 清理任务使用的过期条件与参数
+func expiredCondition() (string, []any) {
+	expireHours := config.LatestConfig.Session.ExpireHours
+	if idle := config.LatestConfig.Session.IdleTimeoutMinutes; idle > 0 {
+		return expiredIdleWhere, []any{expireHours, idle}
+	}
+	return expiredWhere, []any{expireHours}
+}
+
+// MarkActive 空闲超时：在后台记录会话活跃时间，使用 ctx 中的会话存储
+// 同一会话在 touch_interval 内只写入一次数据库；启用滑动过期时由 TouchSession 写入，不需要调用
+func MarkActive(ctx context.Context, sessionID string) {
+	interval := time.Duration(config.LatestConfig.Session.TouchInterval) * time.Second
+	if !sessionTouchLimiter.allow(sessionID, interval) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := sessionStore(ctx).MarkActive(ctx, sessionID); err != nil {
+			metricIdleTouchErrors.Inc()
+			logger.Warn("mark session active failed", logging.Session(sessionID), "error", err)
+			return
+		}
+		metricIdleTouches.Inc()
+	}()
+}
+
+// MarkActive 将未失效会话的 last_active 更新为当前时间
+func (gatewayStore) MarkActive(ctx context.Context, sessionID string) error {
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, activeSQL,
+		sessionID, config.LatestConfig.Session.ExpireHours, config.LatestConfig.Session.IdleTimeoutMinutes)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	return err
+}
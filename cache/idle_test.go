@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	f := withFakeGateway(t)
+	cfg := config.LatestConfig
+	cfg.Session.ExpireHours = 24
+	cfg.Session.IdleTimeoutMinutes = 10
+	cfg.Cache.KnownFilter = false
+	ctx := context.Background()
+
+	for _, id := range []string{"active", "idle"} {
+		if _, err := SaveSession(ctx, id, 7, 0, SessionMeta{}, "test"); err != nil {
+			t.Fatal(err)
+		}
+		if uid, err := GetUserIDBySession(ctx, id); err != nil || uid != 7 {
+			t.Fatalf("Get(%s) = %d, %v", id, uid, err)
+		}
+	}
+
+	// 只有 active 在空闲超时前记录了活跃时间
+	f.now = f.now.Add(9 * time.Minute)
+	if err := (gatewayStore{}).MarkActive(ctx, "active"); err != nil {
+		t.Fatal(err)
+	}
+	f.now = f.now.Add(9 * time.Minute)
+	if uid, err := GetUserIDBySession(ctx, "active"); err != nil || uid != 7 {
+		t.Fatalf("Get(active) = %d, %v", uid, err)
+	}
+	if _, err := GetUserIDBySession(ctx, "idle"); err == nil {
+		t.Fatal("Get(idle) succeeded after the idle timeout")
+	}
+
+	// 空闲超时的会话不再记录活跃时间
+	if err := (gatewayStore{}).MarkActive(ctx, "idle"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.sessions["idle"].active.IsZero() {
+		t.Fatal("last_active written for an idle session")
+	}
+	f.now = f.now.Add(2 * time.Minute)
+	if _, err := GetUserIDBySession(ctx, "active"); err == nil {
+		t.Fatal("Get(active) succeeded after the idle timeout")
+	}
+}
+
+func TestExpiredCondition(t *testing.T) {
+	saved := config.LatestConfig.Session
+	t.Cleanup(func() { config.LatestConfig.Session = saved })
+	config.LatestConfig.Session.ExpireHours = 24
+
+	config.LatestConfig.Session.IdleTimeoutMinutes = 0
+	if where, args := expiredCondition(); where != expiredWhere || len(args) != 1 {
+		t.Fatalf("expiredCondition() = %q, %v", where, args)
+	}
+	config.LatestConfig.Session.IdleTimeoutMinutes = 30
+	if where, args := expiredCondition(); where != expiredIdleWhere || len(args) != 2 || args[1] != 30 {
+		t.Fatalf("expiredCondition() with idle timeout = %q, %v", where, args)
+	}
+}
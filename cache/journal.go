@@ -0,0 +1,249 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"StealthIMSession/obfuscate"
+	"StealthIMSession/query"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 会话历史事件类型
+const (
+	journalCreate = "create"
+	journalDelete = "delete"
+	journalRenew  = "renew"
+
+	journalFreeze   = "freeze"
+	journalUnfreeze = "unfreeze"
+)
+
+// journalSchema 会话历史表结构（只追加），见 migrations
+const journalSchema = `CREATE TABLE IF NOT EXISTS session_journal_db (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	session_id VARCHAR(64) NOT NULL,
+	uid INT NOT NULL,
+	event VARCHAR(16) NOT NULL,
+	caller VARCHAR(64) NOT NULL DEFAULT '',
+	event_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	anonymized TINYINT NOT NULL DEFAULT 0,
+	INDEX idx_session (session_id),
+	INDEX idx_event_time (event_time)
+)`
+
+// journalCreateSession 记录会话创建事件
+// 历史记录不随调用方取消而中断，ctx 只用于传递追踪上下文
+func journalCreateSession(ctx context.Context, sessionID string, uid int32, ttlSeconds int64, meta SessionMeta, caller string) {
+	if !config.LatestConfig.Journal.Enable {
+		return
+	}
+	_, err := gateway.ExecSQLParams(context.WithoutCancel(ctx), pb.SqlDatabases_Session, true,
+		"INSERT INTO session_journal_db (session_id, uid, event, caller, device, client_ip, user_agent, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, NOW() + INTERVAL ? SECOND)",
+		sessionID, uid, journalCreate, caller, meta.Device, meta.ClientIP, meta.UserAgent, ttlSeconds)
+	if err != nil {
+		logger.Error("failed to record journal create event", logging.Session(sessionID), "error", err)
+	}
+}
+
+// journalDeleteSession 记录会话删除事件（需在删除会话行之前调用）
+func journalDeleteSession(ctx context.Context, sessionID string, caller string) {
+	if !config.LatestConfig.Journal.Enable {
+		return
+	}
+	_, err := gateway.ExecSQLParams(context.WithoutCancel(ctx), pb.SqlDatabases_Session, true,
+		"INSERT INTO session_journal_db (session_id, uid, event, caller) SELECT session_id, uid, ?, ? FROM session_db WHERE session_id = ?",
+		journalDelete, caller, sessionID)
+	if err != nil {
+		logger.Error("failed to record journal delete event", logging.Session(sessionID), "error", err)
+	}
+}
+
+// journalRenewSession 记录会话续期事件（Renew 与滑动过期），expires_at 为续期后的过期时间
+func journalRenewSession(ctx context.Context, sessionID string, caller string) {
+	if !config.LatestConfig.Journal.Enable {
+		return
+	}
+	_, err := gateway.ExecSQLParams(context.WithoutCancel(ctx), pb.SqlDatabases_Session, true,
+		"INSERT INTO session_journal_db (session_id, uid, event, caller, expires_at) SELECT session_id, uid, ?, ?, expires_at FROM session_db WHERE session_id = ?",
+		journalRenew, caller, sessionID)
+	if err != nil {
+		logger.Error("failed to record journal renew event", logging.Session(sessionID), "error", err)
+	}
+}
+
+// journalPendingDeleted 记录尚未由异步写入保存到数据库即被删除的会话的创建与删除事件
+func journalPendingDeleted(ctx context.Context, p pendingSession, caller string) {
+	if !config.LatestConfig.Journal.Enable {
+		return
+	}
+	journalCreateSession(ctx, p.sessionID, p.uid, int64(p.ttl/time.Second), p.meta, p.caller)
+	_, err := gateway.ExecSQLParams(context.WithoutCancel(ctx), pb.SqlDatabases_Session, true,
+		"INSERT INTO session_journal_db (session_id, uid, event, caller) VALUES (?, ?, ?, ?)",
+		p.sessionID, p.uid, journalDelete, caller)
+	if err != nil {
+		logger.Error("failed to record journal delete event", logging.Session(p.sessionID), "error", err)
+	}
+}
+
+// journalDeleteUID 记录用户满足 where 条件的会话的删除事件（需在删除会话行之前调用）
+func journalDeleteUID(ctx context.Context, uid int32, caller string, where string, args ...any) {
+	if !config.LatestConfig.Journal.Enable {
+		return
+	}
+	_, err := gateway.ExecSQLParams(context.WithoutCancel(ctx), pb.SqlDatabases_Session, true,
+		"INSERT INTO session_journal_db (session_id, uid, event, caller) SELECT session_id, uid, ?, ? FROM session_db WHERE "+where,
+		append([]any{journalDelete, caller}, args...)...)
+	if err != nil {
+		logger.Error("failed to record journal delete events", "uid", obfuscate.UID(uid), "error", err)
+	}
+}
+
+// journalFreezeUID 记录用户的冻结或解冻事件，会话ID为空
+func journalFreezeUID(ctx context.Context, uid int32, event string, caller string) {
+	if !config.LatestConfig.Journal.Enable {
+		return
+	}
+	_, err := gateway.ExecSQLParams(context.WithoutCancel(ctx), pb.SqlDatabases_Session, true,
+		"INSERT INTO session_journal_db (session_id, uid, event, caller) VALUES ('', ?, ?, ?)",
+		uid, event, caller)
+	if err != nil {
+		logger.Error("failed to record journal freeze event", "uid", obfuscate.UID(uid), "event", event, "error", err)
+	}
+}
+
+// SessionHistory 会话在历史表中的生命周期
+type SessionHistory struct {
+	CreatedAt time.Time // 创建时间，零值表示无记录
+	DeletedAt time.Time // 删除时间，零值表示未删除
+	ExpiresAt time.Time // 最后一次创建或续期后的过期时间，零值表示旧记录未保存过期时间
+}
+
+// ValidAt 判断会话在指定时间点是否有效
+// 续期只在会话有效时成功，创建到最后一次续期后的过期时间之间会话一直有效
+// 旧记录没有过期时间时按当前配置的 ExpireHours 计算
+func (h SessionHistory) ValidAt(t time.Time) bool {
+	if h.CreatedAt.IsZero() || t.Before(h.CreatedAt) {
+		return false
+	}
+	if !h.DeletedAt.IsZero() && !t.Before(h.DeletedAt) {
+		return false
+	}
+	expireAt := h.ExpiresAt
+	if expireAt.IsZero() {
+		expireAt = h.CreatedAt.Add(time.Duration(config.LatestConfig.Session.ExpireHours) * time.Hour)
+	}
+	return t.Before(expireAt)
+}
+
+// GetSessionHistory 从历史表查询会话属于指定用户期间的生命周期，过期时间取创建与续期事件中最晚的
+func GetSessionHistory(ctx context.Context, sessionID string, uid int32) (SessionHistory, error) {
+	var history SessionHistory
+	if !config.LatestConfig.Journal.Enable {
+		return history, fmt.Errorf("session journal is disabled")
+	}
+
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT UNIX_TIMESTAMP(MIN(CASE WHEN event = ? THEN event_time END)), UNIX_TIMESTAMP(MIN(CASE WHEN event = ? THEN event_time END)), UNIX_TIMESTAMP(MAX(CASE WHEN event IN (?, ?) THEN expires_at END)) FROM session_journal_db WHERE session_id = ? AND uid = ?",
+		journalCreate, journalDelete, journalCreate, journalRenew, sessionID, uid)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return history, fmt.Errorf("database error: %v", err)
+	}
+	if len(sqlResp.Data) == 0 || len(sqlResp.Data[0].Result) < 2 {
+		return history, nil
+	}
+
+	row := sqlResp.Data[0].Result
+	if created, ok := gateway.ScanInt64(row[0]); ok {
+		history.CreatedAt = time.Unix(created, 0)
+	}
+	if deleted, ok := gateway.ScanInt64(row[1]); ok {
+		history.DeletedAt = time.Unix(deleted, 0)
+	}
+	if len(row) > 2 {
+		if expires, ok := gateway.ScanInt64(row[2]); ok {
+			history.ExpiresAt = time.Unix(expires, 0)
+		}
+	}
+	return history, nil
+}
+
+// JournalEntry 会话历史中的一条事件
+type JournalEntry struct {
+	ID        int64
+	SessionID string
+	UID       int32
+	Event     string
+	Caller    string
+	EventTime time.Time
+}
+
+// journalQuerySchema 会话历史审计查询允许的过滤与排序字段
+var journalQuerySchema = query.Schema{
+	Fields: map[string]query.Field{
+		"id":         {Column: "id", Kind: query.Int, Sortable: true},
+		"session_id": {Column: "session_id", Kind: query.String},
+		"uid":        {Column: "uid", Kind: query.Int},
+		"event":      {Column: "event", Kind: query.String},
+		"caller":     {Column: "caller", Kind: query.String},
+		"event_time": {Column: "UNIX_TIMESTAMP(event_time)", Kind: query.Time, Sortable: true},
+	},
+	Key:          "id",
+	DefaultSort:  "id",
+	DefaultDesc:  true,
+	DefaultLimit: 100,
+	MaxLimit:     1000,
+}
+
+// QueryJournal 按过滤条件分页查询会话历史，返回本页事件与下一页游标
+func QueryJournal(ctx context.Context, req query.Request) ([]JournalEntry, string, error) {
+	plan, err := journalQuerySchema.Build(req)
+	if err != nil {
+		return nil, "", err
+	}
+	sql, args := plan.SQL(
+		"SELECT id, session_id, uid, event, caller, UNIX_TIMESTAMP(event_time) FROM session_journal_db", "")
+
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, sql, args...)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("database error: %v", err)
+	}
+
+	entries := make([]JournalEntry, 0, len(sqlResp.Data))
+	for _, row := range sqlResp.Data {
+		if len(row.Result) < 6 {
+			continue
+		}
+		var entry JournalEntry
+		entry.ID, _ = gateway.ScanInt64(row.Result[0])
+		entry.SessionID, _ = gateway.ScanString(row.Result[1])
+		uid, _ := gateway.ScanInt64(row.Result[2])
+		entry.UID = int32(uid)
+		entry.Event, _ = gateway.ScanString(row.Result[3])
+		entry.Caller, _ = gateway.ScanString(row.Result[4])
+		if t, ok := gateway.ScanInt64(row.Result[5]); ok {
+			entry.EventTime = time.Unix(t, 0)
+		}
+		entries = append(entries, entry)
+	}
+
+	size, next := plan.Page(len(entries), func(i int) (string, string) {
+		e := entries[i]
+		id := strconv.FormatInt(e.ID, 10)
+		if plan.Sort == "event_time" {
+			return strconv.FormatInt(e.EventTime.Unix(), 10), id
+		}
+		return id, id
+	})
+	return entries[:size], next, nil
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionHistoryValidAt(t *testing.T) {
+	created := time.Unix(1700000000, 0)
+	// 过期时间为最后一次续期后的过期时间
+	h := SessionHistory{CreatedAt: created, ExpiresAt: created.Add(3 * time.Hour)}
+	for _, tc := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{created.Add(-time.Second), false},
+		{created, true},
+		{created.Add(2 * time.Hour), true},
+		{created.Add(3 * time.Hour), false},
+	} {
+		if got := h.ValidAt(tc.at); got != tc.want {
+			t.Errorf("ValidAt(%v) = %v, want %v", tc.at.Sub(created), got, tc.want)
+		}
+	}
+	h.DeletedAt = created.Add(time.Hour)
+	if h.ValidAt(created.Add(2 * time.Hour)) {
+		t.Error("deleted session valid after deletion")
+	}
+}
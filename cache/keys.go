@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 热路径上的键与语句
+// 使用字符串直接拼接代替 fmt.Sprintf，每次只产生一次内存分配
+
+const redisSessionPrefix = "session:session:"
+
+// expiresAtExpr 会话过期时间表达式
+// 未设置 expires_at 的旧会话按 created_at 加全局 ExpireHours 计算，需传入 ExpireHours 参数
+const expiresAtExpr = "IFNULL(expires_at, created_at + INTERVAL ? HOUR)"
+
+// uidQuery 根据会话ID查询用户ID与剩余有效秒数的参数化语句
+// 参数：ExpireHours、会话ID
+const uidQuery = "SELECT uid, TIMESTAMPDIFF(SECOND, NOW(), " + expiresAtExpr + ") FROM session_db WHERE session_id = ? LIMIT 1"
+
+// redisSessionKey 会话在 Redis 中的键
+func redisSessionKey(sessionID string) string {
+	return redisSessionPrefix + sessionID
+}
+
+// redisSessionValue 有效会话在 Redis 中的值：uid 与过期时间（Unix 秒），以 ":" 分隔
+// 从 Redis 回填内存缓存时据此限制有效期，避免会话过期后仍在内存中命中
+func redisSessionValue(uid int32, expiresAt time.Time) string {
+	return strconv.FormatInt(int64(uid), 10) + ":" + strconv.FormatInt(expiresAt.Unix(), 10)
+}
+
+// parseRedisSessionValue 解析 Redis 中的会话值
+// 无效会话标记（-1）与旧版本写入的值只有 uid，过期时间返回零值
+func parseRedisSessionValue(value string) (int32, time.Time, error) {
+	uidPart, expiresPart, hasExpiry := strings.Cut(value, ":")
+	uid, err := strconv.ParseInt(uidPart, 10, 32)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if !hasExpiry {
+		return int32(uid), time.Time{}, nil
+	}
+	expires, err := strconv.ParseInt(expiresPart, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int32(uid), time.Unix(expires, 0), nil
+}
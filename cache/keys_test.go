@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+const benchSessionID = "0123456789abcdef0123456789abcdef"
+
+func TestRedisSessionKey(t *testing.T) {
+	want := fmt.Sprintf("session:session:%s", benchSessionID)
+	if got := redisSessionKey(benchSessionID); got != want {
+		t.Fatalf("redisSessionKey() = %q, want %q", got, want)
+	}
+}
+
+func TestRedisSessionValue(t *testing.T) {
+	expires := time.Unix(1735689600, 0)
+	cases := []struct {
+		value   string
+		uid     int32
+		expires time.Time
+		ok      bool
+	}{
+		{redisSessionValue(42, expires), 42, expires, true},
+		{"42", 42, time.Time{}, true}, // 旧版本写入的值
+		{"-1", -1, time.Time{}, true},
+		{"42:", 0, time.Time{}, false},
+		{"abc", 0, time.Time{}, false},
+	}
+	for _, c := range cases {
+		uid, exp, err := parseRedisSessionValue(c.value)
+		if (err == nil) != c.ok || uid != c.uid || !exp.Equal(c.expires) {
+			t.Errorf("parseRedisSessionValue(%q) = %d, %v, %v", c.value, uid, exp, err)
+		}
+	}
+}
+
+var benchSink string
+
+func BenchmarkRedisSessionKeySprintf(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchSink = fmt.Sprintf("session:session:%s", benchSessionID)
+	}
+}
+
+func BenchmarkRedisSessionKey(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchSink = redisSessionKey(benchSessionID)
+	}
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/bloom"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/metrics"
+	"StealthIMSession/scheduler"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 已知会话过滤器：启用 cache.known_filter 时，本实例维护一个包含全部会话ID的布隆过滤器，
+// 内存缓存未命中且过滤器判断会话ID一定不存在时直接拒绝，不查询 Redis 与 MySQL，也不写入无效标记
+// 过滤器在启动后从数据库建立，之后每隔 known_filter_rebuild 分钟重建（清除已删除的会话）；
+// 本实例创建的会话立即加入，其他实例创建的会话经失效广播加入
+
+// knownFilterJob 重建过滤器在调度器中的任务名
+const knownFilterJob = "known_filter_rebuild"
+
+var (
+	metricKnownFilterRejected = metrics.NewCounter("stealthim_session_known_filter_rejected_total", "Lookups rejected by the known session filter without querying redis or mysql")
+	metricKnownFilterItems    = metrics.NewGauge("stealthim_session_known_filter_items", "Session IDs loaded into the known session filter at the last rebuild")
+	metricKnownFilterBytes    = metrics.NewGauge("stealthim_session_known_filter_bytes", "Memory used by the known session filter")
+)
+
+// knownFilter 已知会话过滤器
+// 重建期间新加入的会话同时加入正在建立的过滤器，加入与替换都持有 mu，替换后不会丢失
+type knownFilter struct {
+	cur atomic.Pointer[bloom.Filter] // nil 表示尚未建立，此时不拒绝任何查询
+
+	mu   sync.Mutex
+	next *bloom.Filter // 正在建立的过滤器
+}
+
+var knownSessions knownFilter
+
+// startKnownFilter 启用时在调度器中注册过滤器的建立与重建任务
+func startKnownFilter() {
+	if !config.LatestConfig.Cache.KnownFilter {
+		return
+	}
+	scheduler.Add(scheduler.Job{
+		Name: knownFilterJob,
+		Every: func() time.Duration {
+			return time.Duration(config.LatestConfig.Cache.KnownFilterRebuild) * time.Minute
+		},
+		Delay: time.Second,
+		Run: func(ctx context.Context) error {
+			if !config.LatestConfig.Cache.KnownFilter {
+				return nil
+			}
+			return knownSessions.rebuild(ctx)
+		},
+	})
+}
+
+// add 将会话ID加入过滤器
+func (k *knownFilter) add(sessionID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if f := k.cur.Load(); f != nil {
+		f.Add(sessionID)
+	}
+	if k.next != nil {
+		k.next.Add(sessionID)
+	}
+}
+
+// mayExist 会话ID可能存在时返回 true；未启用或过滤器尚未建立时总是返回 true
+func (k *knownFilter) mayExist(sessionID string) bool {
+	if !config.LatestConfig.Cache.KnownFilter {
+		return true
+	}
+	f := k.cur.Load()
+	return f == nil || f.MayContain(sessionID)
+}
+
+// rebuild 从数据库按会话ID分页读取全部会话，建立新的过滤器后替换
+// 包含已过期但尚未清理的会话；失败时保留原过滤器
+func (k *knownFilter) rebuild(ctx context.Context) error {
+	cfg := config.LatestConfig.Cache
+	next := bloom.New(cfg.KnownFilterCapacity, cfg.KnownFilterFPRate)
+	k.mu.Lock()
+	k.next = next
+	k.mu.Unlock()
+	defer func() {
+		k.mu.Lock()
+		k.next = nil
+		k.mu.Unlock()
+	}()
+
+	var items int64
+	cursor := ""
+	for {
+		// 不读副本：复制延迟中的会话会被误判为不存在
+		sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, migrationQuery, cursor, cfg.KnownFilterBatch)
+		if err == nil {
+			err = gateway.CheckResult(sqlResp)
+		}
+		if err != nil {
+			return fmt.Errorf("database error: %v", err)
+		}
+		for _, row := range sqlResp.Data {
+			if len(row.Result) == 0 {
+				continue
+			}
+			if sessionID, ok := gateway.ScanString(row.Result[0]); ok {
+				cursor = sessionID
+				next.Add(sessionID)
+				items++
+			}
+		}
+		if len(sqlResp.Data) < cfg.KnownFilterBatch {
+			break
+		}
+	}
+
+	k.mu.Lock()
+	k.cur.Store(next)
+	k.mu.Unlock()
+	metricKnownFilterItems.Set(items)
+	metricKnownFilterBytes.Set(int64(next.Bytes()))
+	if items > int64(cfg.KnownFilterCapacity) {
+		logger.Warn("known session filter over capacity, false positive rate increased", "items", items, "capacity", cfg.KnownFilterCapacity)
+	}
+	logger.Info("known session filter rebuilt", "items", items, "bytes", next.Bytes())
+	return nil
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKnownFilter(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	cfg := &config.LatestConfig.Cache
+	cfg.KnownFilter = true
+	cfg.KnownFilterCapacity = 1000
+	cfg.KnownFilterFPRate = 0.001
+	cfg.KnownFilterBatch = 2 // 覆盖分页
+	t.Cleanup(func() { knownSessions = knownFilter{} })
+	for _, id := range []string{"s0", "s1", "s2"} {
+		f.sessions[id] = fakeSession{uid: 7, expires: f.now.Add(time.Hour)}
+	}
+
+	// 建立前不拒绝任何查询
+	if _, err := GetUserIDBySession(ctx, "missing0"); err == nil {
+		t.Fatal("missing0 accepted")
+	}
+	if _, ok := f.redis[redisSessionKey("missing0")]; !ok {
+		t.Fatal("lookup before the filter is built did not reach the backend")
+	}
+
+	if err := knownSessions.rebuild(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"s0", "s1", "s2"} {
+		if uid, err := GetUserIDBySession(ctx, id); err != nil || uid != 7 {
+			t.Fatalf("GetUserIDBySession(%s) = %d, %v", id, uid, err)
+		}
+	}
+
+	// 一定不存在的会话ID直接拒绝，不写入无效标记
+	if _, err := GetUserIDBySession(ctx, "missing1"); err == nil {
+		t.Fatal("missing1 accepted")
+	}
+	if _, ok := f.redis[redisSessionKey("missing1")]; ok {
+		t.Fatal("lookup rejected by the filter reached the backend")
+	}
+
+	// 新建与经失效广播收到的会话立即加入
+	if _, err := SaveSession(ctx, "s3", 8, time.Hour, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	f.sessions["s4"] = fakeSession{uid: 9, expires: f.now.Add(time.Hour)}
+	PurgeLocal("s4")
+	sessionCache = newCache[SessionRecord](1, true)
+	if uid, err := GetUserIDBySession(ctx, "s3"); err != nil || uid != 8 {
+		t.Fatalf("GetUserIDBySession(s3) = %d, %v", uid, err)
+	}
+	if uid, err := GetUserIDBySession(ctx, "s4"); err != nil || uid != 9 {
+		t.Fatalf("GetUserIDBySession(s4) = %d, %v", uid, err)
+	}
+}
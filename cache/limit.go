@@ -0,0 +1,56 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"StealthIMSession/obfuscate"
+	"context"
+	"fmt"
+)
+
+// oldestSessionsSQL 用户在一个命名空间中的有效会话，按创建时间从早到晚
+const oldestSessionsSQL = "SELECT session_id FROM session_db WHERE uid = ? AND " + expiresAtExpr + " > NOW() AND namespace = ? ORDER BY created_at, session_id"
+
+// EvictForNewSession 为用户即将在命名空间 ns 中创建的会话腾出位置：有效会话数达到 max_sessions_per_user 时删除最早创建的会话
+// 各命名空间分别计数，返回被删除的会话ID（不含命名空间），未配置上限时不做任何事
+// 并发创建同一用户的会话时，会话数可能短暂超过上限，下一次创建时会被收回
+func EvictForNewSession(ctx context.Context, ns string, uid int32, caller string) ([]string, error) {
+	limit := config.LatestConfig.Session.MaxSessionsPerUser
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		oldestSessionsSQL, uid, config.LatestConfig.Session.ExpireHours, ns)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	excess := len(sqlResp.Data) - limit + 1
+	if excess <= 0 {
+		return nil, nil
+	}
+
+	evicted := make([]string, 0, excess)
+	for _, row := range sqlResp.Data[:excess] {
+		if len(row.Result) == 0 {
+			continue
+		}
+		sessionID, ok := gateway.ScanString(row.Result[0])
+		if !ok {
+			continue
+		}
+		if _, err := DeleteSession(ctx, sessionID, caller); err != nil {
+			return evicted, err
+		}
+		metricLimitEvictions.Inc()
+		logger.Info("session evicted by per-user limit", logging.Session(sessionID), "uid", obfuscate.UID(uid))
+		_, id := SplitNamespace(sessionID)
+		evicted = append(evicted, id)
+	}
+	return evicted, nil
+}
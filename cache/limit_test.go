@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEvictForNewSession(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	config.LatestConfig.Session.MaxSessionsPerUser = 2
+
+	for i, id := range []string{"s0", "s1", "s2"} {
+		if _, err := SaveSession(ctx, id, 7, time.Hour, SessionMeta{}, "test"); err != nil {
+			t.Fatal(err)
+		}
+		f.now = f.now.Add(time.Second)
+		if i == 0 {
+			// 已过期的会话与其他用户的会话不计入上限
+			SaveSession(ctx, "expired", 7, time.Second, SessionMeta{}, "test")
+			SaveSession(ctx, "other", 8, time.Hour, SessionMeta{}, "test")
+			f.now = f.now.Add(2 * time.Second)
+		}
+	}
+
+	// 3 个有效会话，为第 4 个腾出位置需要删除最早的 2 个
+	evicted, err := EvictForNewSession(ctx, "", 7, "test")
+	if err != nil || !slices.Equal(evicted, []string{"s0", "s1"}) {
+		t.Fatalf("EvictForNewSession() = %v, %v, want [s0 s1]", evicted, err)
+	}
+	for _, id := range evicted {
+		if _, ok := f.sessions[id]; ok {
+			t.Fatalf("%s still in session_db", id)
+		}
+		if _, err := GetUserIDBySession(ctx, id); err == nil {
+			t.Fatalf("Get(%s) succeeded after eviction", id)
+		}
+	}
+	if _, ok := f.sessions["s2"]; !ok {
+		t.Fatal("newest session evicted")
+	}
+
+	config.LatestConfig.Session.MaxSessionsPerUser = 0
+	if evicted, err := EvictForNewSession(ctx, "", 7, "test"); err != nil || evicted != nil {
+		t.Fatalf("EvictForNewSession() without limit = %v, %v", evicted, err)
+	}
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/query"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SessionInfo 用户的一个会话
+type SessionInfo struct {
+	SessionID string
+	CreatedAt time.Time
+	Meta      SessionMeta
+}
+
+// listEntry 用户会话列表缓存项
+type listEntry struct {
+	sessions   []SessionInfo
+	expiration int64 // 过期时的 monotonic 读数（纳秒）
+}
+
+// listCache 按 uid 缓存会话列表
+// owners 记录已缓存列表中会话所属的 uid，删除会话时据此失效对应列表
+type listCache struct {
+	mu      sync.Mutex
+	entries map[int32]listEntry
+	owners  map[string]int32
+}
+
+var sessionListCache = &listCache{
+	entries: make(map[int32]listEntry),
+	owners:  make(map[string]int32),
+}
+
+func (lc *listCache) get(uid int32) ([]SessionInfo, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	entry, ok := lc.entries[uid]
+	if !ok || int64(monotonic()) > entry.expiration {
+		return nil, false
+	}
+	return entry.sessions, true
+}
+
+func (lc *listCache) set(uid int32, sessions []SessionInfo, ttl time.Duration) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if _, ok := lc.entries[uid]; !ok && len(lc.entries) >= config.LatestConfig.Cache.MemMaxsize {
+		// 缓存已满时淘汰任意一项
+		for k := range lc.entries {
+			lc.removeLocked(k)
+			break
+		}
+	}
+	lc.removeLocked(uid)
+	lc.entries[uid] = listEntry{
+		sessions:   sessions,
+		expiration: int64(monotonic() + ttl),
+	}
+	for _, s := range sessions {
+		lc.owners[s.SessionID] = uid
+	}
+}
+
+// invalidateUID 失效指定用户的会话列表
+func (lc *listCache) invalidateUID(uid int32) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.removeLocked(uid)
+}
+
+// invalidateSession 失效包含指定会话的会话列表
+func (lc *listCache) invalidateSession(sessionID string) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if uid, ok := lc.owners[sessionID]; ok {
+		lc.removeLocked(uid)
+	}
+}
+
+// clear 清空全部会话列表
+func (lc *listCache) clear() {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	clear(lc.entries)
+	clear(lc.owners)
+}
+
+func (lc *listCache) removeLocked(uid int32) {
+	entry, ok := lc.entries[uid]
+	if !ok {
+		return
+	}
+	for _, s := range entry.sessions {
+		delete(lc.owners, s.SessionID)
+	}
+	delete(lc.entries, uid)
+}
+
+// ListSessionsByUID 获取用户所有未过期的会话，按创建时间倒序
+// 配置了 list_cache_ttl 时结果在内存中缓存
+func ListSessionsByUID(ctx context.Context, uid int32) ([]SessionInfo, error) {
+	ttl := time.Duration(config.LatestConfig.Cache.ListCacheTTL) * time.Second
+	if ttl > 0 {
+		if sessions, ok := sessionListCache.get(uid); ok {
+			return sessions, nil
+		}
+	}
+
+	sessions, err := sessionStore(ctx).ListByUID(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+
+	if ttl > 0 {
+		sessionListCache.set(uid, sessions, ttl)
+	}
+	return sessions, nil
+}
+
+// CountSessionsByUID 获取用户未过期的会话数
+// 列表缓存中有该用户的会话列表时直接返回其长度，否则在数据库中计数，不读取会话内容
+func CountSessionsByUID(ctx context.Context, uid int32) (int64, error) {
+	if config.LatestConfig.Cache.ListCacheTTL > 0 {
+		if sessions, ok := sessionListCache.get(uid); ok {
+			return int64(len(sessions)), nil
+		}
+	}
+	count, err := sessionStore(ctx).CountByUID(ctx, uid)
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	return count, nil
+}
+
+// sessionListSchema 用户会话列表允许的过滤与排序字段
+var sessionListSchema = query.Schema{
+	Fields: map[string]query.Field{
+		"session_id": {Column: "session_id", Kind: query.String, Sortable: true},
+		"created_at": {Column: "UNIX_TIMESTAMP(created_at)", Kind: query.Time, Sortable: true},
+		"device":     {Column: "device", Kind: query.String},
+		"client_ip":  {Column: "client_ip", Kind: query.String},
+		"user_agent": {Column: "user_agent", Kind: query.String},
+		"platform":   {Column: "platform", Kind: query.String},
+	},
+	Key:          "session_id",
+	DefaultSort:  "created_at",
+	DefaultDesc:  true,
+	DefaultLimit: 50,
+	MaxLimit:     500,
+}
+
+// ListSessionsPage 按过滤条件分页获取用户未过期的会话，返回本页会话与下一页游标
+// 不经过会话列表缓存
+func ListSessionsPage(ctx context.Context, uid int32, req query.Request) ([]SessionInfo, string, error) {
+	plan, err := sessionListSchema.Build(req)
+	if err != nil {
+		return nil, "", err
+	}
+	sql, args := plan.SQL(
+		"SELECT session_id, UNIX_TIMESTAMP(created_at), "+metaColumns+" FROM session_db",
+		"uid = ? AND "+expiresAtExpr+" > NOW()",
+		uid, config.LatestConfig.Session.ExpireHours)
+
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, sql, args...)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("database error: %v", err)
+	}
+
+	sessions := scanSessionInfos(sqlResp.Data)
+
+	size, next := plan.Page(len(sessions), func(i int) (string, string) {
+		s := sessions[i]
+		if plan.Sort == "created_at" {
+			return strconv.FormatInt(s.CreatedAt.Unix(), 10), s.SessionID
+		}
+		return s.SessionID, s.SessionID
+	})
+	return sessions[:size], next, nil
+}
@@ -2,136 +2,543 @@ package cache
 
 import (
 	"StealthIMSession/config"
+	"StealthIMSession/scheduler"
+	"container/list"
+	"context"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type item struct {
-	value      int32
-	expiration int64
+// itemOverhead 单个缓存项除键以外的估算内存占用（map 桶、链表节点、item 结构体、字符串头）
+const itemOverhead = 152
+
+// 淘汰策略
+const (
+	EvictLRU    = "lru"    // 淘汰最久未使用的项
+	EvictRandom = "random" // 随机淘汰
+)
+
+type item[V any] struct {
+	key        string
+	value      V
+	size       int   // 估算内存占用，见 itemSize
+	expiration int64 // 过期时的 monotonic 读数（纳秒）
 }
 
-// Cache 表示一个具有字符串键和int32值的内存缓存
-type Cache struct {
-	items    map[string]item
-	mu       sync.RWMutex
-	maxItems int // 最大缓存项数量
+// sizer 由值类型实现，返回值引用的额外内存（如字符串内容），用于估算缓存内存占用
+type sizer interface {
+	memSize() int
 }
 
-// New 创建一个新的缓存，并启动一个定期清理过期项目的协程
-func New() *Cache {
-	c := &Cache{
-		items:    make(map[string]item),
-		maxItems: config.LatestConfig.Cache.MemMaxsize,
+// itemSize 估算缓存项的内存占用：键、固定开销与值引用的额外内存
+func itemSize[V any](key string, value V) int {
+	n := len(key) + itemOverhead
+	if sz, ok := any(value).(sizer); ok {
+		n += sz.memSize()
 	}
+	return n
+}
+
+// 内存缓存在调度器中的任务名
+const (
+	janitorJob  = "cache_janitor"
+	pressureJob = "cache_pressure"
+)
+
+// Cache 表示一个以字符串为键的内存缓存，会话缓存的值为 SessionRecord
+// 按键的哈希分为多个分片，每个分片独立加锁、独立清理，容量与淘汰均在分片内进行
+type Cache[V any] struct {
+	shards []*shard[V]
+	lru    bool // 是否使用 LRU 淘汰策略
+
+	// 内存压力下的容量上限，0 表示不限制，见 pressure.go
+	pressureCap atomic.Int64
+
+	// 增量维护的统计值，读取时无需加锁
+	count atomic.Int64
+	bytes atomic.Int64
+
+	// 自创建起累计的计数，见 Stats；同时计入进程级的 Prometheus 指标
+	hits              atomic.Uint64
+	misses            atomic.Uint64
+	evictions         atomic.Uint64
+	expired           atomic.Uint64
+	admissionRejected atomic.Uint64
+}
+
+// shard 缓存分片
+type shard[V any] struct {
+	items map[string]*list.Element
+	order *list.List // 按最近使用排序，最近使用的在前（random 策略下为写入顺序）
+	mu    sync.RWMutex
+	cache *Cache[V] // 所属缓存，用于读取容量与更新统计
+	bytes int       // 分片中缓存项的估算内存占用，受 mu 保护
+
+	freq *sketch // 访问频率，启用 TinyLFU 准入时非空，见 admission.go
+}
+
+// clock 当前系统时间，仅用于与 Redis 中记录的过期时间比较，测试中替换以模拟时间流逝
+var clock = time.Now
+
+// monoStart 进程内单调时钟的起点
+var monoStart = time.Now()
 
-	// 启动一个协程定期清理过期项目
-	go c.janitor()
+// monotonic 返回单调时钟读数，内存缓存只用它判断过期，
+// 系统时间被 NTP 校正或虚拟机时钟跳变时不会批量过期或永不过期，测试中替换以模拟时间流逝
+var monotonic = func() time.Duration { return time.Since(monoStart) }
+
+// New 创建一个新的缓存，并在调度器中注册过期清理与内存压力检查任务
+func New[V any]() *Cache[V] {
+	n := max(config.LatestConfig.Cache.Shards, 1)
+	c := newCache[V](n, config.LatestConfig.Cache.EvictionPolicy != EvictRandom)
+	if config.LatestConfig.Cache.Admission == AdmitTinyLFU {
+		c.useTinyLFU()
+	}
+
+	// 定期清理过期项目，各分片依次加锁
+	scheduler.Add(scheduler.Job{
+		Name: janitorJob,
+		Every: func() time.Duration {
+			return time.Duration(config.LatestConfig.Cache.MemCleantime) * time.Second
+		},
+		Jitter: 0.1,
+		Delay:  time.Second,
+		Run: func(ctx context.Context) error {
+			// 各分片的清理分散在半个间隔内进行
+			spread := time.Duration(config.LatestConfig.Cache.MemCleantime) * time.Second / 2
+			n, err := c.sweep(ctx, spread)
+			scheduler.ReportRows(ctx, int64(n))
+			return err
+		},
+	})
+	// 根据内存压力调整容量
+	scheduler.Add(scheduler.Job{
+		Name: pressureJob,
+		Every: func() time.Duration {
+			return time.Duration(config.LatestConfig.Cache.PressureInterval) * time.Second
+		},
+		Delay: time.Duration(config.LatestConfig.Cache.PressureInterval) * time.Second,
+		Run: func(context.Context) error {
+			c.checkMemoryPressure()
+			return nil
+		},
+	})
 
 	return c
 }
 
-// Set 向缓存添加一个键值对
-func (c *Cache) Set(key string, value int32) {
-	expiration := time.Now().Add(time.Duration(config.LatestConfig.Cache.MemTimeout) * time.Second).UnixNano()
+// Stop 停止过期清理与内存压力检查任务，缓存仍可读写，过期项在 Get 时视为未命中
+// 任务按名称注册，之后由 New 创建的缓存会替换这些任务，不应再对旧缓存调用 Stop
+func (c *Cache[V]) Stop() {
+	scheduler.Remove(janitorJob)
+	scheduler.Remove(pressureJob)
+}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Reconfigure 在重载配置后应用新的 mem_timeout、mem_maxsize、max_memory_mb 与 mem_cleantime：
+// 缩短剩余有效期超过新 mem_timeout 的缓存项，淘汰超出新容量的缓存项，并从现在起按新间隔安排清理与压力检查
+// 分片数、淘汰策略与准入策略在创建时确定，修改需重启
+func (c *Cache[V]) Reconfigure() {
+	deadline := int64(monotonic() + time.Duration(config.LatestConfig.Cache.MemTimeout)*time.Second)
+	for _, s := range c.shards {
+		s.capExpiration(deadline)
+	}
+	c.shrinkTo(c.maxItems())
+	scheduler.Reschedule(janitorJob)
+	scheduler.Reschedule(pressureJob)
+}
 
-	// 检查是否超过项目数量限制
-	if len(c.items) >= config.LatestConfig.Cache.MemMaxsize && c.items[key] == (item{}) {
-		// 需要淘汰一个随机项
-		c.evictRandom()
+// newCache 创建包含 n 个分片的缓存，不启动后台协程
+func newCache[V any](n int, lru bool) *Cache[V] {
+	c := &Cache[V]{
+		shards: make([]*shard[V], n),
+		lru:    lru,
 	}
+	for i := range c.shards {
+		c.shards[i] = &shard[V]{
+			items: make(map[string]*list.Element),
+			order: list.New(),
+			cache: c,
+		}
+	}
+	return c
+}
 
-	c.items[key] = item{
-		value:      value,
-		expiration: expiration,
+// useTinyLFU 启用 TinyLFU 准入：缓存已满时，只有访问频率高于被淘汰项的新项才会写入
+// 用于防止大量只出现一次的会话ID（如扫描探测）挤出热点会话，需在使用缓存前调用
+func (c *Cache[V]) useTinyLFU() {
+	for _, s := range c.shards {
+		s.freq = newSketch(c.shardMaxItems())
 	}
 }
 
-// evictRandom 随机淘汰一个缓存项
-func (c *Cache) evictRandom() {
-	// 确保在调用此方法前已获取写锁
-	if len(c.items) == 0 {
-		return
+// shardFor 返回键所在的分片
+func (c *Cache[V]) shardFor(key string) *shard[V] {
+	if len(c.shards) == 1 {
+		return c.shards[0]
 	}
+	return c.shards[hashKey(key)%uint32(len(c.shards))]
+}
 
-	// 获取所有键
-	keys := make([]string, 0, len(c.items))
-	for k := range c.items {
-		keys = append(keys, k)
+// hashKey 键的 FNV-1a 哈希，用于选择分片
+func hashKey(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// Set 向缓存添加一个键值对
+func (c *Cache[V]) Set(key string, value V) {
+	c.SetTTL(key, value, 0)
+}
+
+// SetTTL 向缓存添加一个键值对，有效期不超过 ttl 与 MemTimeout 中的较小值
+// ttl 不大于 0 时使用 MemTimeout；有效期按 ExpireJitter 随机缩短
+func (c *Cache[V]) SetTTL(key string, value V, ttl time.Duration) {
+	timeout := time.Duration(config.LatestConfig.Cache.MemTimeout) * time.Second
+	if ttl > 0 && ttl < timeout {
+		timeout = ttl
 	}
+	c.shardFor(key).set(key, value, int64(monotonic()+jitter(timeout)))
+}
 
-	// 随机选择一个键淘汰
-	randomIndex := rand.Intn(len(keys))
-	delete(c.items, keys[randomIndex])
+// jitter 将有效期随机缩短 0~ExpireJitter%，使同一批写入的缓存项分散过期，不集中回源到 Redis
+// 只缩短不延长：缓存项的有效期仍不超过 mem_timeout 与会话剩余有效期
+func jitter(timeout time.Duration) time.Duration {
+	percent := config.LatestConfig.Cache.ExpireJitter
+	if percent <= 0 {
+		return timeout
+	}
+	return timeout - time.Duration(rand.Float64()*float64(percent)/100*float64(timeout))
 }
 
 // Get 通过键从缓存中检索值
 // 第二个返回值表示键是否被找到
-func (c *Cache) Get(key string) (int32, bool) {
-	now := time.Now().UnixNano()
+func (c *Cache[V]) Get(key string) (V, bool) {
+	value, found := c.shardFor(key).get(key)
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return value, found
+}
+
+// Delete 从缓存中删除一个键值对
+func (c *Cache[V]) Delete(key string) {
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(key)
+}
 
-	c.mu.RLock()
-	item, found := c.items[key]
-	if !found || now > item.expiration {
-		c.mu.RUnlock()
-		return 0, false
+// maxItems 返回当前最大缓存项数量：配置值与内存压力上限中的较小值
+func (c *Cache[V]) maxItems() int {
+	limit := config.LatestConfig.Cache.MemMaxsize
+	if pressureCap := int(c.pressureCap.Load()); pressureCap > 0 && pressureCap < limit {
+		limit = pressureCap
 	}
-	c.mu.RUnlock()
+	return limit
+}
 
-	return item.value, true
+// shardMaxItems 返回单个分片的最大缓存项数量
+func (c *Cache[V]) shardMaxItems() int {
+	n := len(c.shards)
+	return max((c.maxItems()+n-1)/n, 1)
 }
 
-// janitor 定期从缓存中删除过期的项目
-func (c *Cache) janitor() {
-	time.Sleep(1*time.Second)
-	ticker := time.NewTicker(time.Duration(config.LatestConfig.Cache.MemCleantime) * time.Second)
-	defer ticker.Stop()
+// shardMaxBytes 返回单个分片的估算内存上限，0 表示不按内存限制
+func (c *Cache[V]) shardMaxBytes() int {
+	return config.LatestConfig.Cache.MaxMemoryMB << 20 / len(c.shards)
+}
 
-	for range ticker.C {
-		c.deleteExpired()
+// shrinkTo 按淘汰策略淘汰缓存项，直到数量不超过 n
+func (c *Cache[V]) shrinkTo(n int) {
+	perShard := max((n+len(c.shards)-1)/len(c.shards), 1)
+	for _, s := range c.shards {
+		s.shrinkTo(perShard)
 	}
 }
 
-// deleteExpired 高效地从缓存中删除所有过期项目
-func (c *Cache) deleteExpired() {
-	now := time.Now().UnixNano()
+// deleteExpired 删除所有分片中的过期项目，返回删除的数量
+func (c *Cache[V]) deleteExpired() int {
+	n, _ := c.sweep(context.Background(), 0)
+	return n
+}
+
+// sweep 依次清理各分片中的过期项目，相邻分片之间等待 spread / 分片数，
+// 使清理的加锁与回源分散在 spread 内，返回删除的数量；ctx 取消时停止并返回已删除的数量
+func (c *Cache[V]) sweep(ctx context.Context, spread time.Duration) (int, error) {
+	pause := spread / time.Duration(len(c.shards))
+	n := 0
+	for i, s := range c.shards {
+		if i > 0 && pause > 0 {
+			select {
+			case <-ctx.Done():
+				return n, ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+		n += s.deleteExpired()
+	}
+	return n, nil
+}
+
+// Clear 删除所有分片中的缓存项，返回删除的数量
+func (c *Cache[V]) Clear() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for key := range s.items {
+			s.remove(key)
+			n++
+		}
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Len 返回缓存项数量（近似值，无需加锁）
+func (c *Cache[V]) Len() int64 {
+	return c.count.Load()
+}
+
+// MemoryEstimate 返回缓存估算内存占用字节数（近似值，无需加锁）
+func (c *Cache[V]) MemoryEstimate() int64 {
+	return c.bytes.Load()
+}
+
+// Stats 返回缓存的统计，计数自缓存创建起累计，各项分别原子读取，无需加锁
+// 命中与未命中只统计 Get，内存缓存旁路时的查询不计入
+func (c *Cache[V]) Stats() CacheStats {
+	return CacheStats{
+		Items:             c.Len(),
+		Bytes:             c.MemoryEstimate(),
+		Capacity:          int64(c.maxItems()),
+		PressureCap:       c.pressureCap.Load(),
+		Hits:              c.hits.Load(),
+		Misses:            c.misses.Load(),
+		Evictions:         c.evictions.Load(),
+		Expired:           c.expired.Load(),
+		AdmissionRejected: c.admissionRejected.Load(),
+	}
+}
+
+// set 向分片添加一个键值对
+func (s *shard[V]) set(key string, value V, expiration int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := itemSize(key, value)
+	maxBytes := s.cache.shardMaxBytes()
+	if maxBytes > 0 && size > maxBytes {
+		// 单个缓存项超过分片内存上限，不写入
+		s.remove(key)
+		return
+	}
+	if elem, exists := s.items[key]; exists {
+		it := elem.Value.(*item[V])
+		s.resized(size - it.size)
+		it.value = value
+		it.size = size
+		it.expiration = expiration
+		s.order.MoveToFront(elem)
+		// 新值更大时淘汰其他项，直到不超过内存上限
+		for maxBytes > 0 && s.bytes > maxBytes && s.victim() != key {
+			s.evict()
+		}
+		return
+	}
+
+	// 检查是否超过项目数量与内存上限
+	if s.full(size, maxBytes) {
+		victim := s.victim()
+		if !s.admit(key, victim) {
+			s.cache.admissionRejected.Add(1)
+			metricAdmissionRejected.Inc()
+			return
+		}
+		s.remove(victim)
+		s.cache.evictions.Add(1)
+		metricEvictions.Inc()
+		for len(s.items) > 0 && s.full(size, maxBytes) {
+			s.evict()
+		}
+	}
+
+	s.added(size)
+	s.items[key] = s.order.PushFront(&item[V]{
+		key:        key,
+		value:      value,
+		size:       size,
+		expiration: expiration,
+	})
+}
+
+// get 从分片中检索值
+func (s *shard[V]) get(key string) (V, bool) {
+	var zero V
+	now := int64(monotonic())
+	if s.freq != nil {
+		s.freq.increment(key)
+	}
+
+	if s.cache.lru {
+		// LRU 需要调整访问顺序，使用写锁
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		elem, found := s.items[key]
+		if !found {
+			return zero, false
+		}
+		it := elem.Value.(*item[V])
+		if now > it.expiration {
+			return zero, false
+		}
+		s.order.MoveToFront(elem)
+		return it.value, true
+	}
+
+	s.mu.RLock()
+	elem, found := s.items[key]
+	if !found {
+		s.mu.RUnlock()
+		return zero, false
+	}
+	it := *elem.Value.(*item[V])
+	s.mu.RUnlock()
+
+	if now > it.expiration {
+		return zero, false
+	}
+	return it.value, true
+}
+
+// full 分片写入估算内存占用为 size 的新项前是否需要淘汰（需持有锁）
+func (s *shard[V]) full(size int, maxBytes int) bool {
+	return len(s.items) >= s.cache.shardMaxItems() || (maxBytes > 0 && s.bytes+size > maxBytes)
+}
+
+// shrinkTo 按淘汰策略淘汰分片中的缓存项，直到数量不超过 n 且估算内存不超过上限
+func (s *shard[V]) shrinkTo(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maxBytes := s.cache.shardMaxBytes()
+	for len(s.items) > n || (maxBytes > 0 && s.bytes > maxBytes) {
+		s.evict()
+	}
+}
+
+// capExpiration 将过期时间晚于 deadline 的缓存项改为在 deadline 过期
+func (s *shard[V]) capExpiration(deadline int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, elem := range s.items {
+		if it := elem.Value.(*item[V]); it.expiration > deadline {
+			it.expiration = deadline
+		}
+	}
+}
+
+// evict 按淘汰策略淘汰一个缓存项
+func (s *shard[V]) evict() {
+	// 确保在调用此方法前已获取写锁
+	if len(s.items) == 0 {
+		return
+	}
+	s.remove(s.victim())
+	s.cache.evictions.Add(1)
+	metricEvictions.Inc()
+}
+
+// victim 按淘汰策略选出下一个被淘汰的键，分片不能为空（需持有写锁）
+func (s *shard[V]) victim() string {
+	if s.cache.lru {
+		return s.order.Back().Value.(*item[V]).key
+	}
+
+	// 获取所有键，随机选择一个
+	keys := make([]string, 0, len(s.items))
+	for k := range s.items {
+		keys = append(keys, k)
+	}
+	return keys[rand.Intn(len(keys))]
+}
+
+// admit 判断新键能否替换被淘汰的键（需持有写锁）
+// 未启用准入或被淘汰项已过期时总是写入，否则新键的访问频率须高于被淘汰项
+func (s *shard[V]) admit(key string, victim string) bool {
+	if s.freq == nil {
+		return true
+	}
+	if int64(monotonic()) > s.items[victim].Value.(*item[V]).expiration {
+		return true
+	}
+	return s.freq.estimate(key) > s.freq.estimate(victim)
+}
+
+// deleteExpired 高效地从分片中删除所有过期项目，返回删除的数量
+func (s *shard[V]) deleteExpired() int {
+	now := int64(monotonic())
 
 	// 预分配一个切片来存储需要删除的键
 	// 这避免了在迭代时删除，并减少了锁定时间
 	var keysToDelete []string
 
 	// 第一阶段：识别过期的键（读锁）
-	c.mu.RLock()
+	s.mu.RLock()
 	// 以合理的容量预分配，避免重新分配
-	keysToDelete = make([]string, 0, len(c.items)/10)
-	for k, v := range c.items {
-		if now > v.expiration {
+	keysToDelete = make([]string, 0, len(s.items)/10)
+	for k, elem := range s.items {
+		if now > elem.Value.(*item[V]).expiration {
 			keysToDelete = append(keysToDelete, k)
 		}
 	}
-	c.mu.RUnlock()
+	s.mu.RUnlock()
 
 	// 只有在有项目需要删除时才获取写锁
+	removed := 0
 	if len(keysToDelete) > 0 {
-		c.mu.Lock()
+		s.mu.Lock()
 		for _, k := range keysToDelete {
 			// 在写锁下再次检查过期时间，因为它可能已经改变
-			if item, found := c.items[k]; found && now > item.expiration {
-				delete(c.items, k)
+			if elem, found := s.items[k]; found && now > elem.Value.(*item[V]).expiration {
+				s.remove(k)
+				s.cache.expired.Add(1)
+				metricExpired.Inc()
+				removed++
 			}
 		}
-		c.mu.Unlock()
+		s.mu.Unlock()
 	}
+	return removed
 }
 
-// Delete 从缓存中删除一个键值对
-func (c *Cache) Delete(key string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// added 记录新增缓存项（需持有写锁）
+func (s *shard[V]) added(size int) {
+	s.cache.count.Add(1)
+	s.resized(size)
+}
 
-	delete(c.items, key)
+// resized 记录分片估算内存占用的变化（需持有写锁）
+func (s *shard[V]) resized(delta int) {
+	s.bytes += delta
+	s.cache.bytes.Add(int64(delta))
+}
+
+// remove 删除缓存项并更新统计（需持有写锁）
+func (s *shard[V]) remove(key string) {
+	elem, ok := s.items[key]
+	if !ok {
+		return
+	}
+	s.order.Remove(elem)
+	delete(s.items, key)
+	s.cache.count.Add(-1)
+	s.resized(-elem.Value.(*item[V]).size)
 }
@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheLRUEviction(t *testing.T) {
+	config.LatestConfig.Cache.MemTimeout = 60
+	config.LatestConfig.Cache.MemMaxsize = 2
+
+	c := newCache[int32](1, true)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a") // a 变为最近使用
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatalf("least recently used key b was not evicted")
+	}
+	for key, want := range map[string]int32{"a": 1, "c": 3} {
+		if got, ok := c.Get(key); !ok || got != want {
+			t.Fatalf("Get(%q) = %d, %v, want %d, true", key, got, ok, want)
+		}
+	}
+	if n := c.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+}
+
+func TestCacheShards(t *testing.T) {
+	config.LatestConfig.Cache.MemTimeout = 60
+	config.LatestConfig.Cache.MemMaxsize = 1000
+
+	c := newCache[int32](8, true)
+	for i := range 100 {
+		c.Set(fmt.Sprintf("session-%d", i), int32(i))
+	}
+	for i := range 100 {
+		if got, ok := c.Get(fmt.Sprintf("session-%d", i)); !ok || got != int32(i) {
+			t.Fatalf("Get(session-%d) = %d, %v, want %d, true", i, got, ok, i)
+		}
+	}
+	if n := c.Len(); n != 100 {
+		t.Fatalf("Len() = %d, want 100", n)
+	}
+	c.Delete("session-0")
+	if _, ok := c.Get("session-0"); ok {
+		t.Fatalf("deleted key is still present")
+	}
+}
+
+func TestCacheTinyLFUAdmission(t *testing.T) {
+	config.LatestConfig.Cache.MemTimeout = 60
+	config.LatestConfig.Cache.MemMaxsize = 10
+
+	c := newCache[int32](1, true)
+	c.useTinyLFU()
+	for i := range 10 {
+		key := fmt.Sprintf("hot-%d", i)
+		c.Set(key, int32(i))
+		for range 3 {
+			c.Get(key)
+		}
+	}
+
+	// 只查询一次的会话ID不会挤出热点会话
+	for i := range 100 {
+		key := fmt.Sprintf("probe-%d", i)
+		c.Get(key)
+		c.Set(key, -1)
+	}
+	for i := range 10 {
+		if _, ok := c.Get(fmt.Sprintf("hot-%d", i)); !ok {
+			t.Fatalf("hot-%d evicted by one-off keys", i)
+		}
+	}
+
+	// 反复查询的会话ID频率超过被淘汰项后可以写入
+	for range 10 {
+		c.Get("rising")
+	}
+	c.Set("rising", 42)
+	if got, ok := c.Get("rising"); !ok || got != 42 {
+		t.Fatalf("Get(rising) = %d, %v, want 42, true", got, ok)
+	}
+	if n := c.Len(); n != 10 {
+		t.Fatalf("Len() = %d, want 10", n)
+	}
+}
+
+func TestCacheClockSkew(t *testing.T) {
+	config.LatestConfig.Cache.MemTimeout = 60
+	config.LatestConfig.Cache.MemMaxsize = 100
+	savedClock, savedMono := clock, monotonic
+	t.Cleanup(func() { clock, monotonic = savedClock, savedMono })
+	wall, mono := time.Now(), time.Duration(0)
+	clock = func() time.Time { return wall }
+	monotonic = func() time.Duration { return mono }
+
+	c := newCache[int32](1, true)
+	c.Set("a", 1)
+	c.SetTTL("b", 2, 10*time.Second)
+	lc := &listCache{entries: make(map[int32]listEntry), owners: make(map[string]int32)}
+	lc.set(1, []SessionInfo{{SessionID: "a"}}, time.Minute)
+
+	// 系统时间向前跳一天，缓存项不应批量过期
+	wall = wall.Add(24 * time.Hour)
+	if n := c.deleteExpired(); n != 0 {
+		t.Fatalf("deleteExpired() after forward jump = %d, want 0", n)
+	}
+	if got, ok := c.Get("a"); !ok || got != 1 {
+		t.Fatalf("Get(a) after forward jump = %d, %v, want 1, true", got, ok)
+	}
+	if _, ok := lc.get(1); !ok {
+		t.Fatal("session list expired after forward jump")
+	}
+
+	// 系统时间向后跳一年，缓存项仍应按实际经过的时间过期
+	wall = wall.Add(-365 * 24 * time.Hour)
+	mono += 11 * time.Second
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b survived its TTL after backward jump")
+	}
+	mono += time.Minute
+	if n := c.deleteExpired(); n != 2 {
+		t.Fatalf("deleteExpired() after backward jump = %d, want 2", n)
+	}
+	if _, ok := lc.get(1); ok {
+		t.Fatal("session list survived its TTL after backward jump")
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	config.LatestConfig.Cache.MemTimeout = 60
+	config.LatestConfig.Cache.MemMaxsize = 2
+	savedMono := monotonic
+	t.Cleanup(func() { monotonic = savedMono })
+	mono := time.Duration(0)
+	monotonic = func() time.Duration { return mono }
+
+	c := newCache[int32](1, true)
+	c.Set("a", 1)
+	c.SetTTL("b", 2, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Set("c", 3) // 淘汰 b
+	mono += 2 * time.Minute
+	c.Set("d", 4) // 淘汰 a
+	c.deleteExpired()
+
+	got := c.Stats()
+	want := CacheStats{Capacity: 2, Hits: 1, Misses: 1, Evictions: 2, Expired: 1, Items: 1, Bytes: got.Bytes}
+	if got != want {
+		t.Fatalf("Stats() = %+v, want %+v", got, want)
+	}
+	if got.Bytes <= 0 {
+		t.Fatalf("Stats().Bytes = %d, want > 0", got.Bytes)
+	}
+}
+
+func TestCacheExpireJitter(t *testing.T) {
+	config.LatestConfig.Cache.MemTimeout = 60
+	config.LatestConfig.Cache.MemMaxsize = 1000
+	config.LatestConfig.Cache.ExpireJitter = 20
+	t.Cleanup(func() { config.LatestConfig.Cache.ExpireJitter = 0 })
+	savedMono := monotonic
+	t.Cleanup(func() { monotonic = savedMono })
+	mono := time.Duration(0)
+	monotonic = func() time.Duration { return mono }
+
+	c := newCache[int32](4, true)
+	for i := range 100 {
+		c.Set(fmt.Sprintf("session-%d", i), int32(i))
+	}
+
+	// 有效期在 48s~60s 之间，不会全部同时过期
+	mono = 48 * time.Second
+	if n := c.deleteExpired(); n != 0 {
+		t.Fatalf("deleteExpired() at 48s = %d, want 0", n)
+	}
+	mono = 54 * time.Second
+	if n := c.deleteExpired(); n == 0 || n == 100 {
+		t.Fatalf("deleteExpired() at 54s = %d, want some but not all", n)
+	}
+	mono = 61 * time.Second
+	c.deleteExpired()
+	if n := c.Len(); n != 0 {
+		t.Fatalf("Len() after mem_timeout = %d, want 0", n)
+	}
+
+	// 清理被取消时停止在当前分片
+	c.Set("a", 1)
+	mono = 2 * time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.sweep(ctx, time.Hour); err == nil {
+		t.Fatal("sweep() with canceled context returned nil error")
+	}
+}
+
+func TestCacheSessionRecordSize(t *testing.T) {
+	config.LatestConfig.Cache.MemTimeout = 60
+	config.LatestConfig.Cache.MemMaxsize = 10
+
+	c := newCache[SessionRecord](1, true)
+	c.Set("a", validRecord(1, time.Now().Add(time.Hour)))
+	base := c.MemoryEstimate()
+
+	// 元数据计入估算内存，覆盖写入时按新值重新计算
+	meta := &SessionMeta{Device: "phone", UserAgent: strings.Repeat("x", 200)}
+	c.Set("a", SessionRecord{UID: 1, Meta: meta})
+	if got := c.MemoryEstimate(); got <= base+200 {
+		t.Fatalf("MemoryEstimate() with meta = %d, want > %d", got, base+200)
+	}
+	if got, ok := c.Get("a"); !ok || got.Meta != meta {
+		t.Fatalf("Get(a) = %+v, %v", got, ok)
+	}
+	c.Set("a", revokedRecord)
+	if got := c.MemoryEstimate(); got != base {
+		t.Fatalf("MemoryEstimate() after overwrite = %d, want %d", got, base)
+	}
+	c.Delete("a")
+	if got := c.MemoryEstimate(); got != 0 {
+		t.Fatalf("MemoryEstimate() after Delete = %d, want 0", got)
+	}
+}
+
+func TestCacheMaxMemory(t *testing.T) {
+	config.LatestConfig.Cache.MemTimeout = 60
+	config.LatestConfig.Cache.MemMaxsize = 1000
+	config.LatestConfig.Cache.MaxMemoryMB = 1
+	t.Cleanup(func() { config.LatestConfig.Cache.MaxMemoryMB = 0 })
+
+	c := newCache[SessionRecord](1, true)
+	meta := &SessionMeta{UserAgent: strings.Repeat("x", 100<<10)}
+	for i := range 20 {
+		c.Set(fmt.Sprintf("session-%d", i), SessionRecord{UID: int32(i), Meta: meta})
+	}
+
+	// 按估算内存淘汰最久未使用的项，数量远低于 mem_maxsize
+	if got := c.MemoryEstimate(); got > 1<<20 {
+		t.Fatalf("MemoryEstimate() = %d, want <= %d", got, 1<<20)
+	}
+	if n := c.Len(); n != 10 {
+		t.Fatalf("Len() = %d, want 10", n)
+	}
+	if _, ok := c.Get("session-9"); ok {
+		t.Fatal("session-9 not evicted")
+	}
+	if _, ok := c.Get("session-19"); !ok {
+		t.Fatal("session-19 evicted")
+	}
+
+	// 覆盖为更大的值时淘汰其他项，超过上限的值不写入
+	c.Set("session-19", SessionRecord{UID: 19, Meta: &SessionMeta{UserAgent: strings.Repeat("x", 300<<10)}})
+	if got := c.MemoryEstimate(); got > 1<<20 {
+		t.Fatalf("MemoryEstimate() after growing an entry = %d, want <= %d", got, 1<<20)
+	}
+	c.Set("huge", SessionRecord{Meta: &SessionMeta{UserAgent: strings.Repeat("x", 2<<20)}})
+	if _, ok := c.Get("huge"); ok {
+		t.Fatal("entry larger than max_memory_mb cached")
+	}
+}
+
+func TestCacheReconfigure(t *testing.T) {
+	config.LatestConfig.Cache.MemTimeout = 60
+	config.LatestConfig.Cache.MemMaxsize = 10
+	savedMono := monotonic
+	t.Cleanup(func() { monotonic = savedMono })
+	mono := time.Duration(0)
+	monotonic = func() time.Duration { return mono }
+
+	c := newCache[int32](1, true)
+	for i := range 10 {
+		c.Set(fmt.Sprintf("session-%d", i), int32(i))
+	}
+
+	// 缩小容量与有效期后，已有的缓存项按新配置淘汰与过期
+	config.LatestConfig.Cache.MemTimeout = 10
+	config.LatestConfig.Cache.MemMaxsize = 4
+	c.Reconfigure()
+	if n := c.Len(); n != 4 {
+		t.Fatalf("Len() after Reconfigure = %d, want 4", n)
+	}
+	if _, ok := c.Get("session-9"); !ok {
+		t.Fatal("most recently used entry evicted")
+	}
+	mono = 11 * time.Second
+	if _, ok := c.Get("session-9"); ok {
+		t.Fatal("entry outlived the new mem_timeout")
+	}
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/gateway"
+	"context"
+	"fmt"
+	"unicode/utf8"
+)
+
+// SessionMeta 会话元数据，均为可选
+type SessionMeta struct {
+	Device    string // 设备名称
+	ClientIP  string // 客户端 IP
+	UserAgent string // User-Agent
+	Platform  string // 平台，如 android、ios、web
+	Gateway   string // 客户端所连接的接入节点，供消息服务路由
+}
+
+// 元数据字段长度上限，与表结构一致
+const (
+	maxDeviceLen    = 128
+	maxClientIPLen  = 64
+	maxUserAgentLen = 512
+	maxPlatformLen  = 32
+	maxGatewayLen   = 64
+)
+
+// truncate 按字符数截断字符串
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n])
+}
+
+// Normalize 截断超长字段，避免写入数据库失败
+func (m SessionMeta) Normalize() SessionMeta {
+	return SessionMeta{
+		Device:    truncate(m.Device, maxDeviceLen),
+		ClientIP:  truncate(m.ClientIP, maxClientIPLen),
+		UserAgent: truncate(m.UserAgent, maxUserAgentLen),
+		Platform:  truncate(m.Platform, maxPlatformLen),
+		Gateway:   truncate(m.Gateway, maxGatewayLen),
+	}
+}
+
+// metaColumns 查询元数据时的字段列表，顺序与 scanMeta 一致
+const metaColumns = "device, client_ip, user_agent, platform, gateway"
+
+// scanMeta 从查询结果中解析元数据
+func scanMeta(row []*pb.InterFaceType) SessionMeta {
+	var meta SessionMeta
+	fields := []*string{&meta.Device, &meta.ClientIP, &meta.UserAgent, &meta.Platform, &meta.Gateway}
+	for i, field := range fields {
+		if i < len(row) {
+			*field, _ = gateway.ScanString(row[i])
+		}
+	}
+	return meta
+}
+
+// GetSessionMeta 查询会话元数据
+func GetSessionMeta(ctx context.Context, sessionID string) (SessionMeta, error) {
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT "+metaColumns+" FROM session_db WHERE session_id = ? LIMIT 1", sessionID)
+	if err != nil {
+		return SessionMeta{}, fmt.Errorf("database error: %v", err)
+	}
+	if sqlResp == nil || len(sqlResp.Data) == 0 {
+		return SessionMeta{}, fmt.Errorf("session not found: %s", sessionID)
+	}
+	return scanMeta(sqlResp.Data[0].Result), nil
+}
@@ -0,0 +1,34 @@
+package cache
+
+import "StealthIMSession/metrics"
+
+var (
+	metricMemHits            = metrics.NewCounter("stealthim_session_cache_lookups_total", "Session lookups by answering tier", "tier", "memory")
+	metricRedisHits          = metrics.NewCounter("stealthim_session_cache_lookups_total", "Session lookups by answering tier", "tier", "redis")
+	metricSQLLookups         = metrics.NewCounter("stealthim_session_cache_lookups_total", "Session lookups by answering tier", "tier", "mysql")
+	metricMemMisses          = metrics.NewCounter("stealthim_session_cache_memory_misses_total", "Session lookups not answered by the memory cache")
+	metricNegativeHits       = metrics.NewCounter("stealthim_session_cache_negative_hits_total", "Lookups answered by a cached invalid-session marker")
+	metricEvictions          = metrics.NewCounter("stealthim_session_cache_evictions_total", "Memory cache entries evicted because the cache was full")
+	metricAdmissionRejected  = metrics.NewCounter("stealthim_session_cache_admission_rejected_total", "New entries not written to the full memory cache because they were accessed less often than the entry they would evict")
+	metricExpired            = metrics.NewCounter("stealthim_session_cache_expired_total", "Memory cache entries removed by the janitor")
+	metricMissShared         = metrics.NewCounter("stealthim_session_cache_miss_shared_total", "Memory cache misses answered by joining an in-flight backend lookup")
+	metricPressureShrinks    = metrics.NewCounter("stealthim_session_cache_pressure_shrinks_total", "Times the memory cache was shrunk because of process memory pressure")
+	metricPressureCap        = metrics.NewGauge("stealthim_session_cache_pressure_cap", "Memory cache item cap imposed by memory pressure (0 when not limited)")
+	metricTouches            = metrics.NewCounter("stealthim_session_touches_total", "Sliding-expiration renewals written by Get")
+	metricTouchErrors        = metrics.NewCounter("stealthim_session_touch_errors_total", "Sliding-expiration renewals that failed")
+	metricIdleTouches        = metrics.NewCounter("stealthim_session_idle_touches_total", "Last-active times written by Get for the idle timeout")
+	metricIdleTouchErrors    = metrics.NewCounter("stealthim_session_idle_touch_errors_total", "Last-active time writes for the idle timeout that failed")
+	metricBackendUnavailable = metrics.NewCounter("stealthim_session_cache_backend_unavailable_total", "Lookups that failed because MySQL could not be queried")
+
+	metricSignedTrusted = metrics.NewCounter("stealthim_session_signed_ids_total", "Signed session IDs checked on lookup", "result", "trusted")
+	metricSignedExpired = metrics.NewCounter("stealthim_session_signed_ids_total", "Signed session IDs checked on lookup", "result", "expired")
+	metricSignedInvalid = metrics.NewCounter("stealthim_session_signed_ids_total", "Signed session IDs checked on lookup", "result", "invalid")
+
+	metricArchiveErrors  = metrics.NewCounter("stealthim_session_archive_errors_total", "Deleted sessions that could not be copied to session_history_db")
+	metricLimitEvictions = metrics.NewCounter("stealthim_session_limit_evictions_total", "Sessions deleted to keep a user within max_sessions_per_user")
+	metricFrozenUIDs     = metrics.NewGauge("stealthim_session_frozen_uids", "Users whose sessions are frozen, as of the last sync")
+
+	metricLegacyValues    = metrics.NewGauge("stealthim_session_cache_legacy_redis_values", "Legacy-format Redis session values found by the last full migration pass (-1 before the first pass)")
+	metricLegacyAccess    = metrics.NewCounter("stealthim_session_cache_legacy_redis_migrated_total", "Legacy-format Redis session values replaced", "via", "access")
+	metricLegacyMigration = metrics.NewCounter("stealthim_session_cache_legacy_redis_migrated_total", "Legacy-format Redis session values replaced", "via", "migration")
+)
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/scheduler"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// redisMigrationJob 旧格式 Redis 值迁移在调度器中的任务名
+const redisMigrationJob = "redis_migration"
+
+// redisMigrationPause 迁移批次之间的等待时间
+const redisMigrationPause = 100 * time.Millisecond
+
+// migrationQuery 按会话ID分页遍历会话表，参数：上一批最后的会话ID、批大小
+const migrationQuery = "SELECT session_id FROM session_db WHERE session_id > ? ORDER BY session_id LIMIT ?"
+
+// migrationDone 最近一次完整扫描没有发现旧格式的值，不再定时扫描
+var migrationDone atomic.Bool
+
+func init() {
+	metricLegacyValues.Set(-1)
+}
+
+// startRedisMigration 在调度器中注册旧格式 Redis 值的迁移任务
+// 启动后执行一次完整扫描，之后每隔 redis_migration_interval 分钟扫描一次，直到某次扫描没有发现旧格式的值
+func startRedisMigration() {
+	scheduler.Add(scheduler.Job{
+		Name: redisMigrationJob,
+		Every: func() time.Duration {
+			if migrationDone.Load() {
+				return 0
+			}
+			return time.Duration(config.LatestConfig.Cache.RedisMigrationInterval) * time.Minute
+		},
+		Delay: 30 * time.Second,
+		Run: func(ctx context.Context) error {
+			if config.LatestConfig.Cache.RedisMigrationInterval <= 0 || bypassRedis.Load() {
+				return nil
+			}
+			found, err := MigrateLegacyRedis(ctx, config.LatestConfig.Cache.RedisMigrationBatch)
+			scheduler.ReportRows(ctx, found)
+			return err
+		},
+	})
+}
+
+// MigrateLegacyRedis 遍历会话表，删除 Redis 中旧版本格式（只有 uid，没有过期时间）的会话值，返回发现的数量
+// 删除而不是改写：删除只会造成一次未命中，不会与并发的删除会话竞争而写回已删除的会话；下次查询时以新格式回填
+// 完整扫描结束后更新 stealthim_session_cache_legacy_redis_values，没有发现旧格式的值时停止定时扫描
+func MigrateLegacyRedis(ctx context.Context, batch int) (int64, error) {
+	var found int64
+	cursor := ""
+	for {
+		// 新写入的会话都是新格式，可以读副本
+		sqlResp, err := gateway.ExecSQLParams(gateway.WithReplica(ctx), pb.SqlDatabases_Session, false, migrationQuery, cursor, batch)
+		if err == nil {
+			err = gateway.CheckResult(sqlResp)
+		}
+		if err != nil {
+			return found, fmt.Errorf("database error: %v", err)
+		}
+
+		for _, row := range sqlResp.Data {
+			if len(row.Result) == 0 {
+				continue
+			}
+			sessionID, ok := gateway.ScanString(row.Result[0])
+			if !ok {
+				continue
+			}
+			cursor = sessionID
+			evicted, err := evictLegacyValue(ctx, sessionID)
+			if err != nil {
+				return found, err
+			}
+			if evicted {
+				found++
+			}
+		}
+		if len(sqlResp.Data) < batch {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return found, ctx.Err()
+		case <-time.After(redisMigrationPause):
+		}
+	}
+
+	metricLegacyValues.Set(found)
+	if found == 0 {
+		migrationDone.Store(true)
+		logger.Info("no legacy redis values left, migration finished")
+	} else {
+		logger.Info("legacy redis values evicted", "count", found)
+	}
+	return found, nil
+}
+
+// evictLegacyValue 会话在 Redis 中的值为旧格式时删除，返回是否删除
+func evictLegacyValue(ctx context.Context, sessionID string) (bool, error) {
+	key := redisSessionKey(sessionID)
+	resp, err := gateway.ExecRedisGet(ctx, &pb.RedisGetStringRequest{Key: key})
+	if err != nil {
+		return false, fmt.Errorf("redis error: %v", err)
+	}
+	if resp == nil || resp.Value == "" {
+		return false, nil
+	}
+	uid, expiresAt, err := parseRedisSessionValue(resp.Value)
+	if err == nil && (uid == -1 || !expiresAt.IsZero()) {
+		return false, nil
+	}
+	if _, err := gateway.ExecRedisDel(ctx, &pb.RedisDelRequest{Key: key}); err != nil {
+		return false, fmt.Errorf("redis error: %v", err)
+	}
+	metricLegacyMigration.Inc()
+	return true, nil
+}
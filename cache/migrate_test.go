@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"testing"
+	"time"
+)
+
+// withFakeGateway 切换到 fakeGateway 与其时钟，测试结束后恢复配置与内存缓存
+func withFakeGateway(t *testing.T) *fakeGateway {
+	saved := *config.LatestConfig
+	savedCache, savedClock, savedMono := sessionCache, clock, monotonic
+	f := newFakeGateway()
+	restore := gateway.Override(f)
+	t.Cleanup(func() {
+		restore()
+		*config.LatestConfig = saved
+		sessionCache, clock, monotonic = savedCache, savedClock, savedMono
+	})
+	cfg := config.LatestConfig
+	cfg.Cache.MemTimeout = 10
+	cfg.Cache.MemMaxsize = 1000
+	cfg.Cache.RedisTTL = 20
+	cfg.Cache.CoalesceWindow = 0
+	cfg.Journal.Enable = false
+	cfg.Invalidation.Enable = false
+	cfg.DBGateway.Timeout = 1000
+	cfg.DBGateway.RetryAttempts = 1
+	cfg.DBGateway.BreakerThreshold = 0
+	sessionCache = newCache[SessionRecord](1, true)
+	clock = func() time.Time { return f.now }
+	start := f.now
+	monotonic = func() time.Duration { return f.now.Sub(start) }
+	return f
+}
+
+func TestMigrateLegacyRedis(t *testing.T) {
+	f := withFakeGateway(t)
+	migrationDone.Store(false)
+	t.Cleanup(func() { migrationDone.Store(false) })
+
+	current := redisSessionValue(2, f.now.Add(time.Hour))
+	for id, value := range map[string]string{"s0": "1", "s1": current, "s2": "-1", "s3": "3", "s4": ""} {
+		f.sessions[id] = fakeSession{uid: 1, expires: f.now.Add(time.Hour)}
+		if value != "" {
+			f.redis[redisSessionKey(id)] = fakeRedisValue{value: value}
+		}
+	}
+
+	// 批大小小于会话数，覆盖分页
+	found, err := MigrateLegacyRedis(context.Background(), 2)
+	if err != nil || found != 2 {
+		t.Fatalf("MigrateLegacyRedis() = %d, %v, want 2", found, err)
+	}
+	for _, id := range []string{"s0", "s3", "s4"} {
+		if _, ok := f.redis[redisSessionKey(id)]; ok {
+			t.Fatalf("%s still in redis", id)
+		}
+	}
+	if f.redis[redisSessionKey("s1")].value != current || f.redis[redisSessionKey("s2")].value != "-1" {
+		t.Fatalf("current-format values changed: %v", f.redis)
+	}
+	if v := metricLegacyValues.Value(); v != 2 {
+		t.Fatalf("legacy gauge = %d, want 2", v)
+	}
+	if migrationDone.Load() {
+		t.Fatal("migration marked done while legacy values were found")
+	}
+
+	found, err = MigrateLegacyRedis(context.Background(), 2)
+	if err != nil || found != 0 || !migrationDone.Load() || metricLegacyValues.Value() != 0 {
+		t.Fatalf("second pass = %d, %v, done = %v", found, err, migrationDone.Load())
+	}
+}
+
+func TestLegacyRedisValueUpgradedOnAccess(t *testing.T) {
+	f := withFakeGateway(t)
+	f.sessions["s0"] = fakeSession{uid: 7, expires: f.now.Add(time.Hour)}
+	f.redis[redisSessionKey("s0")] = fakeRedisValue{value: "9"}
+
+	before := metricLegacyAccess.Value()
+	uid, err := GetUserIDBySession(context.Background(), "s0")
+	if err != nil || uid != 7 {
+		t.Fatalf("GetUserIDBySession() = %d, %v, want 7 from mysql", uid, err)
+	}
+	if got, want := f.redis[redisSessionKey("s0")].value, redisSessionValue(7, f.now.Add(time.Hour)); got != want {
+		t.Fatalf("redis value = %q, want %q", got, want)
+	}
+	if metricLegacyAccess.Value() != before+1 {
+		t.Fatal("access upgrade not counted")
+	}
+}
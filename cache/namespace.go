@@ -0,0 +1,40 @@
+package cache
+
+import "strings"
+
+// 命名空间（租户）：同一部署为多个环境或分片保存会话时，各命名空间的会话互相隔离
+// 带命名空间的会话在 session_db、缓存与 Redis 中以 "<命名空间>:<会话ID>" 为键，
+// 会话ID不包含 ':'，因此该键不会与其他命名空间或默认命名空间（空字符串）的会话冲突
+
+// maxNamespaceLen 命名空间最大长度，与签名会话ID相加后不超过 session_id 列的 128 字节
+const maxNamespaceLen = 16
+
+// ValidNamespace 检查命名空间：为空（默认命名空间）或不超过 16 字节，只包含小写字母、数字、下划线与连字符
+func ValidNamespace(ns string) bool {
+	if len(ns) > maxNamespaceLen {
+		return false
+	}
+	for i := 0; i < len(ns); i++ {
+		c := ns[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// NamespacedID 返回会话在存储与缓存中的键，默认命名空间时即会话ID
+func NamespacedID(ns string, sessionID string) string {
+	if ns == "" {
+		return sessionID
+	}
+	return ns + ":" + sessionID
+}
+
+// SplitNamespace 将存储与缓存中的键拆分为命名空间与会话ID
+func SplitNamespace(key string) (ns string, sessionID string) {
+	if ns, sessionID, ok := strings.Cut(key, ":"); ok {
+		return ns, sessionID
+	}
+	return "", key
+}
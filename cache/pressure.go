@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+)
+
+// 内存压力下每次调整容量上限的比例
+const (
+	pressureShrink = 0.75 // 超过阈值时收缩到当前容量的比例
+	pressureGrow   = 1.25 // 回落后恢复时扩大的比例
+	pressureFloor  = 0.05 // 容量上限不低于配置值的比例
+	pressureHyst   = 10   // 回落到阈值以下该百分点后才开始恢复
+)
+
+// 与 GOMEMLIMIT 计算方式一致：运行时占用的全部内存减去已归还给系统的堆内存
+var pressureSamples = []metrics.Sample{
+	{Name: "/memory/classes/total:bytes"},
+	{Name: "/memory/classes/heap/released:bytes"},
+}
+
+// memoryLimit 返回进程内存上限：优先使用配置值，其次为 GOMEMLIMIT，均未设置时返回 0
+func memoryLimit() int64 {
+	if mb := config.LatestConfig.Cache.MemoryLimit; mb > 0 {
+		return int64(mb) << 20
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		return limit
+	}
+	return 0
+}
+
+// memoryInUse 返回当前运行时占用的内存字节数
+func memoryInUse() int64 {
+	metrics.Read(pressureSamples)
+	return int64(pressureSamples[0].Value.Uint64() - pressureSamples[1].Value.Uint64())
+}
+
+// checkMemoryPressure 执行一次内存压力检查
+func (c *Cache[V]) checkMemoryPressure() {
+	threshold := config.LatestConfig.Cache.PressureThreshold
+	limit := memoryLimit()
+	if threshold <= 0 || limit <= 0 {
+		if c.pressureCap.Swap(0) != 0 {
+			metricPressureCap.Set(0)
+		}
+		return
+	}
+
+	configured := config.LatestConfig.Cache.MemMaxsize
+	current := c.maxItems()
+	usage := memoryInUse() * 100 / limit
+
+	switch {
+	case usage >= int64(threshold):
+		next := max(int(float64(current)*pressureShrink), int(float64(configured)*pressureFloor), 1)
+		if next >= current {
+			return
+		}
+		logger.Warn("memory pressure, shrinking memory cache", "usage_percent", usage, "items", next)
+		metricPressureShrinks.Inc()
+		c.pressureCap.Store(int64(next))
+		metricPressureCap.Set(int64(next))
+		c.deleteExpired()
+		c.shrinkTo(next)
+	case usage < int64(threshold-pressureHyst) && c.pressureCap.Load() > 0:
+		next := int(float64(current)*pressureGrow) + 1
+		if next >= configured {
+			logger.Info("memory pressure relieved, memory cache restored", "items", configured)
+			c.pressureCap.Store(0)
+			metricPressureCap.Set(0)
+			return
+		}
+		c.pressureCap.Store(int64(next))
+		metricPressureCap.Set(int64(next))
+	}
+}
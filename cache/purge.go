@@ -0,0 +1,110 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/audit"
+	"StealthIMSession/bus"
+	"StealthIMSession/events"
+	"StealthIMSession/gateway"
+	"StealthIMSession/obfuscate"
+	"context"
+	"fmt"
+	"time"
+)
+
+// PurgeReport 删除用户数据的结果，各项为实际删除的行数或缓存项数
+type PurgeReport struct {
+	Sessions       int64     // 会话（含尚未写入 MySQL 的异步写入会话）
+	RefreshTokens  int64     // 刷新令牌
+	JournalEntries int64     // 会话历史（含冻结与解冻事件）
+	HistoryEntries int64     // 保留的已删除会话，见 archive.go
+	AuditEntries   int64     // 审计表中的记录
+	CachedSessions int64     // Redis 与内存缓存中被清除的会话
+	PurgedAt       time.Time // 完成时间
+}
+
+// purgeTables 按 uid 删除用户数据的表，依次删除，会话最先删除，使会话立即失效
+var purgeTables = []struct {
+	table string
+	count func(*PurgeReport) *int64
+}{
+	{"session_db", func(r *PurgeReport) *int64 { return &r.Sessions }},
+	{"session_refresh_db", func(r *PurgeReport) *int64 { return &r.RefreshTokens }},
+	{"session_journal_db", func(r *PurgeReport) *int64 { return &r.JournalEntries }},
+	{"session_history_db", func(r *PurgeReport) *int64 { return &r.HistoryEntries }},
+	{audit.Table, func(r *PurgeReport) *int64 { return &r.AuditEntries }},
+}
+
+// PurgeUserData 删除用户在会话库中的全部数据：会话、刷新令牌、会话历史、保留的已删除会话与审计记录，
+// 并清除这些会话在 Redis 与各实例内存缓存中的值。与 DelAllByUID 不同，删除不写入会话历史，也不保留会话行
+// 中途失败时返回已完成部分的结果与错误，重试是安全的；冻结状态与 uid 别名不在删除范围内
+func PurgeUserData(ctx context.Context, uid int32) (PurgeReport, error) {
+	ctx = context.WithoutCancel(ctx)
+	var report PurgeReport
+
+	// 尚未写入 MySQL 的会话直接丢弃
+	pending := writeBehind.cancelUID(uid)
+	report.Sessions = int64(len(pending))
+
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT session_id FROM session_db WHERE uid = ?", uid)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		writeBehind.requeue(pending)
+		return PurgeReport{}, fmt.Errorf("database error: %v", err)
+	}
+	sessionIDs := make([]string, 0, len(sqlResp.Data)+len(pending))
+	for _, row := range sqlResp.Data {
+		if len(row.Result) == 0 {
+			continue
+		}
+		if sessionID, ok := gateway.ScanString(row.Result[0]); ok {
+			sessionIDs = append(sessionIDs, sessionID)
+		}
+	}
+	for _, p := range pending {
+		sessionIDs = append(sessionIDs, p.sessionID)
+	}
+
+	for i, t := range purgeTables {
+		req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+			"DELETE FROM "+t.table+" WHERE uid = ?", uid)
+		if err != nil {
+			return report, err
+		}
+		req.GetRowCount = true
+		sqlResp, err := gateway.ExecSQL(ctx, req)
+		if err == nil {
+			err = gateway.CheckResult(sqlResp)
+		}
+		if err != nil {
+			return report, fmt.Errorf("purge %s: %v", t.table, err)
+		}
+		*t.count(&report) += sqlResp.RowsAffected
+		if i == 0 {
+			// 会话行已删除，先清除缓存，避免其余步骤失败时缓存中的会话仍然有效
+			report.CachedSessions = purgeCached(ctx, uid, sessionIDs)
+		}
+	}
+
+	report.PurgedAt = time.Now()
+	logger.Info("user data purged", "uid", obfuscate.UID(uid), "sessions", report.Sessions,
+		"journal", report.JournalEntries, "history", report.HistoryEntries, "audit", report.AuditEntries)
+	return report, nil
+}
+
+// purgeCached 清除会话在 Redis 与内存中的缓存并通知其他实例，返回处理的会话数
+// Redis 中写入不含 uid 的无效标记而不是删除键，签名会话ID在过期前仍会被拒绝
+func purgeCached(ctx context.Context, uid int32, sessionIDs []string) int64 {
+	for _, sessionID := range sessionIDs {
+		cacheInvalidSession(ctx, sessionID)
+		sessionAttrCache.invalidate(sessionID)
+		sessionTouchLimiter.forget(sessionID)
+	}
+	sessionListCache.invalidateUID(uid)
+	bus.Publish(sessionIDs...)
+	events.Emit(events.Event{Type: events.Revoked, UID: uid})
+	return int64(len(sessionIDs))
+}
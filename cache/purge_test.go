@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"testing"
+)
+
+func TestPurgeUserData(t *testing.T) {
+	f := withFakeGateway(t)
+	config.LatestConfig.Session.ExpireHours = 24
+	ctx := context.Background()
+	for id, uid := range map[string]int32{"a": 7, "b": 7, "c": 8} {
+		if _, err := SaveSession(ctx, id, uid, 0, SessionMeta{}, "test"); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := GetUserIDBySession(ctx, id); err != nil || got != uid {
+			t.Fatalf("Get(%s) = %d, %v", id, got, err)
+		}
+	}
+
+	report, err := PurgeUserData(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sessions != 2 || report.CachedSessions != 2 || report.PurgedAt.IsZero() {
+		t.Fatalf("PurgeUserData() = %+v", report)
+	}
+	// Redis 中只留下不含 uid 的无效标记，内存缓存中的会话同样失效
+	for _, id := range []string{"a", "b"} {
+		if v := f.redis[redisSessionKey(id)].value; v != "-1" {
+			t.Fatalf("redis value of %s = %q, want invalid marker", id, v)
+		}
+		if _, err := GetUserIDBySession(ctx, id); err == nil {
+			t.Fatalf("Get(%s) succeeded after purge", id)
+		}
+	}
+	if uid, err := GetUserIDBySession(ctx, "c"); err != nil || uid != 8 {
+		t.Fatalf("Get(c) = %d, %v, other users must be kept", uid, err)
+	}
+
+	// 重复删除是安全的
+	if report, err := PurgeUserData(ctx, 7); err != nil || report.Sessions != 0 {
+		t.Fatalf("PurgeUserData() again = %+v, %v", report, err)
+	}
+}
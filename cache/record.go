@@ -0,0 +1,29 @@
+package cache
+
+import "time"
+
+// SessionRecord 内存缓存中的会话
+// 无效会话（不存在、已删除或已过期）同样缓存，Revoked 为 true，避免重复回源
+type SessionRecord struct {
+	UID       int32        // 用户ID，Revoked 时为 0
+	ExpiresAt time.Time    // 会话失效时刻（系统时间），未知时为零值
+	Revoked   bool         // 无效会话标记，对应 Redis 中的 -1
+	Meta      *SessionMeta // 会话元数据，未加载时为 nil
+}
+
+// revokedRecord 无效会话标记
+var revokedRecord = SessionRecord{Revoked: true}
+
+// validRecord 有效会话，expiresAt 为会话失效时刻
+func validRecord(uid int32, expiresAt time.Time) SessionRecord {
+	return SessionRecord{UID: uid, ExpiresAt: expiresAt}
+}
+
+// memSize 元数据字符串的内存占用，见 itemSize
+func (r SessionRecord) memSize() int {
+	if r.Meta == nil {
+		return 0
+	}
+	m := r.Meta
+	return 80 + len(m.Device) + len(m.ClientIP) + len(m.UserAgent) + len(m.Platform) + len(m.Gateway)
+}
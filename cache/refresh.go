@@ -0,0 +1,144 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// refreshSchema 刷新令牌，见 migrations
+// 只保存令牌的 SHA-256，数据库泄露时无法直接使用其中的令牌
+const refreshSchema = `CREATE TABLE IF NOT EXISTS session_refresh_db (
+	token_hash CHAR(64) NOT NULL PRIMARY KEY,
+	uid INT NOT NULL,
+	session_id VARCHAR(128) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	INDEX idx_uid (uid),
+	INDEX idx_session (session_id),
+	INDEX idx_expires_at (expires_at)
+)`
+
+// ErrRefreshNotFound 刷新令牌不存在、已过期或已被使用
+var ErrRefreshNotFound = errors.New("refresh token not found")
+
+// refreshTokenLen 刷新令牌长度（32 字节随机数的十六进制）
+const refreshTokenLen = 64
+
+// ValidRefreshToken 检查刷新令牌格式，格式不合法的令牌不可能由 Set 签发
+func ValidRefreshToken(token string) bool {
+	if len(token) != refreshTokenLen {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
+
+// hashRefreshToken 计算令牌在数据库中的键
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshTTL 刷新令牌有效期
+func RefreshTTL() time.Duration {
+	return time.Duration(config.LatestConfig.Refresh.ExpireHours) * time.Hour
+}
+
+// SaveRefreshToken 保存与会话绑定的刷新令牌，返回过期时间
+func SaveRefreshToken(ctx context.Context, token string, uid int32, sessionID string) (time.Time, error) {
+	ttlSeconds := int64(RefreshTTL() / time.Second)
+	expiresAt := time.Now().Add(time.Duration(ttlSeconds) * time.Second)
+	sqlResp, err := gateway.ExecSQLParams(context.WithoutCancel(ctx), pb.SqlDatabases_Session, true,
+		"INSERT INTO session_refresh_db (token_hash, uid, session_id, expires_at) VALUES (?, ?, ?, NOW() + INTERVAL ? SECOND)",
+		hashRefreshToken(token), uid, sessionID, ttlSeconds)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("database error: %v", err)
+	}
+	return expiresAt, nil
+}
+
+// ConsumeRefreshToken 使用刷新令牌：删除令牌并返回其 uid 与绑定的会话ID
+// 令牌只能使用一次，并发使用同一令牌时只有一个调用成功，其余返回 ErrRefreshNotFound
+func ConsumeRefreshToken(ctx context.Context, token string) (int32, string, error) {
+	ctx = context.WithoutCancel(ctx)
+	hash := hashRefreshToken(token)
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT uid, session_id FROM session_refresh_db WHERE token_hash = ? AND expires_at > NOW() LIMIT 1", hash)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("database error: %v", err)
+	}
+	if len(sqlResp.Data) == 0 || len(sqlResp.Data[0].Result) < 2 {
+		return 0, "", ErrRefreshNotFound
+	}
+	uid, ok1 := gateway.ScanInt64(sqlResp.Data[0].Result[0])
+	sessionID, ok2 := gateway.ScanString(sqlResp.Data[0].Result[1])
+	if !ok1 || !ok2 {
+		return 0, "", fmt.Errorf("unexpected refresh token row")
+	}
+
+	// 以删除的行数判断是否由本次调用使用了令牌
+	req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+		"DELETE FROM session_refresh_db WHERE token_hash = ?", hash)
+	if err != nil {
+		return 0, "", err
+	}
+	req.GetRowCount = true
+	sqlResp, err = gateway.ExecSQL(ctx, req)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("database error: %v", err)
+	}
+	if sqlResp.RowsAffected != 1 {
+		return 0, "", ErrRefreshNotFound
+	}
+	return int32(uid), sessionID, nil
+}
+
+// deleteRefreshTokens 删除会话或用户的刷新令牌，未启用刷新令牌时不执行
+// 删除失败只记录日志：会话已删除，令牌仍可换取新会话直到过期
+func deleteRefreshTokens(ctx context.Context, column string, value any) {
+	if !config.LatestConfig.Refresh.Enable {
+		return
+	}
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, true,
+		"DELETE FROM session_refresh_db WHERE "+column+" = ?", value)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		logger.Error("failed to delete refresh tokens", "by", column, "error", err)
+	}
+}
+
+// DeleteExpiredRefreshTokens 删除最多 limit 个过期的刷新令牌，返回删除的行数
+func DeleteExpiredRefreshTokens(ctx context.Context, limit int) (int64, error) {
+	req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+		"DELETE FROM session_refresh_db WHERE expires_at <= NOW() LIMIT ?", limit)
+	if err != nil {
+		return 0, err
+	}
+	req.GetRowCount = true
+	sqlResp, err := gateway.ExecSQL(ctx, req)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	return sqlResp.RowsAffected, nil
+}
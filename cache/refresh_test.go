@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRefreshToken(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	config.LatestConfig.Refresh.Enable = true
+	config.LatestConfig.Refresh.ExpireHours = 1
+	token := strings.Repeat("ab", 32)
+	if !ValidRefreshToken(token) || ValidRefreshToken(token[1:]) || ValidRefreshToken(strings.Repeat("zz", 32)) {
+		t.Fatal("ValidRefreshToken() mismatch")
+	}
+
+	if _, err := SaveRefreshToken(ctx, token, 42, "s0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.refresh[token]; ok {
+		t.Fatal("refresh token stored in plain text")
+	}
+
+	// 令牌只能使用一次
+	uid, sessionID, err := ConsumeRefreshToken(ctx, token)
+	if err != nil || uid != 42 || sessionID != "s0" {
+		t.Fatalf("ConsumeRefreshToken() = %d, %q, %v", uid, sessionID, err)
+	}
+	if _, _, err := ConsumeRefreshToken(ctx, token); !errors.Is(err, ErrRefreshNotFound) {
+		t.Fatalf("second ConsumeRefreshToken() error = %v, want ErrRefreshNotFound", err)
+	}
+
+	// 过期的令牌不能使用
+	SaveRefreshToken(ctx, token, 42, "s1")
+	f.now = f.now.Add(time.Hour)
+	if _, _, err := ConsumeRefreshToken(ctx, token); !errors.Is(err, ErrRefreshNotFound) {
+		t.Fatalf("expired ConsumeRefreshToken() error = %v, want ErrRefreshNotFound", err)
+	}
+
+	// 删除会话或用户的全部会话时删除其刷新令牌
+	other := strings.Repeat("cd", 32)
+	SaveRefreshToken(ctx, token, 42, "s2")
+	SaveRefreshToken(ctx, other, 42, "s3")
+	f.sessions["s2"] = fakeSession{uid: 42, expires: f.now.Add(time.Hour)}
+	if _, err := DeleteSession(ctx, "s2", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ConsumeRefreshToken(ctx, token); !errors.Is(err, ErrRefreshNotFound) {
+		t.Fatalf("ConsumeRefreshToken() after Del error = %v, want ErrRefreshNotFound", err)
+	}
+	if _, err := DeleteSessionsByUID(ctx, 42, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.refresh) != 0 {
+		t.Fatalf("%d refresh tokens left after deleting all sessions of the user", len(f.refresh))
+	}
+}
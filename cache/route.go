@@ -0,0 +1,71 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxRouteUIDs 单次批量查询路由提示的用户数上限
+const MaxRouteUIDs = 500
+
+// RouteHint 用户一个有效会话的路由提示，供消息服务决定推送的设备
+type RouteHint struct {
+	SessionID  string
+	LastActive time.Time // 最后活跃时间，未续期过的会话为创建时间
+	Meta       SessionMeta
+}
+
+// GetRouteHints 批量获取用户所有未过期会话的路由提示，按最后活跃时间倒序
+// 没有有效会话的用户不出现在结果中
+func GetRouteHints(ctx context.Context, uids []int32) (map[int32][]RouteHint, error) {
+	hints := make(map[int32][]RouteHint, len(uids))
+	if len(uids) == 0 {
+		return hints, nil
+	}
+	if len(uids) > MaxRouteUIDs {
+		return nil, fmt.Errorf("too many uids: %d > %d", len(uids), MaxRouteUIDs)
+	}
+
+	args := make([]any, 0, len(uids)+1)
+	for _, uid := range uids {
+		args = append(args, uid)
+	}
+	args = append(args, config.LatestConfig.Session.ExpireHours)
+
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT uid, session_id, UNIX_TIMESTAMP(IFNULL(last_active, created_at)) AS active, "+metaColumns+
+			" FROM session_db WHERE uid IN (?"+strings.Repeat(", ?", len(uids)-1)+") AND "+expiresAtExpr+" > NOW() ORDER BY active DESC",
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	if sqlResp == nil {
+		return hints, nil
+	}
+
+	for _, row := range sqlResp.Data {
+		if len(row.Result) < 3 {
+			continue
+		}
+		uid, ok := gateway.ScanInt64(row.Result[0])
+		if !ok {
+			continue
+		}
+		sessionID, ok := gateway.ScanString(row.Result[1])
+		if !ok {
+			continue
+		}
+		hint := RouteHint{SessionID: sessionID}
+		if active, ok := gateway.ScanInt64(row.Result[2]); ok {
+			hint.LastActive = time.Unix(active, 0)
+		}
+		hint.Meta = scanMeta(row.Result[3:])
+		hints[int32(uid)] = append(hints[int32(uid)], hint)
+	}
+	return hints, nil
+}
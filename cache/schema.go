@@ -0,0 +1,158 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/audit"
+	"StealthIMSession/counters"
+	"StealthIMSession/gateway"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// schemaVersionTable 已执行的结构变更版本
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS session_schema_db (
+	version INT NOT NULL PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// migrations 会话库结构变更，按顺序执行，版本号为下标加一
+// 只能在末尾追加，不能修改已发布的条目
+var migrations = []string{
+	// 1: 会话历史表
+	journalSchema,
+	// 2: 会话元数据
+	`ALTER TABLE session_db
+	ADD COLUMN device VARCHAR(128) NOT NULL DEFAULT '',
+	ADD COLUMN client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '',
+	ADD COLUMN platform VARCHAR(32) NOT NULL DEFAULT ''`,
+	// 3: 会话历史中的元数据
+	`ALTER TABLE session_journal_db
+	ADD COLUMN device VARCHAR(128) NOT NULL DEFAULT '',
+	ADD COLUMN client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT ''`,
+	// 4: 会话独立过期时间
+	`ALTER TABLE session_db
+	ADD COLUMN expires_at TIMESTAMP NULL DEFAULT NULL,
+	ADD INDEX idx_expires_at (expires_at)`,
+	// 5: 会话历史中的过期时间
+	`ALTER TABLE session_journal_db
+	ADD COLUMN expires_at TIMESTAMP NULL DEFAULT NULL`,
+	// 6: 会话最后活跃时间（滑动过期）
+	`ALTER TABLE session_db
+	ADD COLUMN last_active TIMESTAMP NULL DEFAULT NULL`,
+	// 7: 会话接入节点（消息路由提示）
+	`ALTER TABLE session_db
+	ADD COLUMN gateway VARCHAR(64) NOT NULL DEFAULT ''`,
+	// 8: 冻结的用户
+	freezeSchema,
+	// 9: 累计计数
+	counters.Schema,
+	// 10、11: 签名会话ID（见 signed.go）最长 128 字节
+	`ALTER TABLE session_db
+	MODIFY session_id VARCHAR(128) NOT NULL`,
+	`ALTER TABLE session_journal_db
+	MODIFY session_id VARCHAR(128) NOT NULL`,
+	// 12: 刷新令牌
+	refreshSchema,
+	// 13: 会话属性（见 attrs.go）
+	`ALTER TABLE session_db
+	ADD COLUMN attrs JSON NULL DEFAULT NULL`,
+	// 14: 会话命名空间（见 namespace.go）
+	`ALTER TABLE session_db
+	ADD COLUMN namespace VARCHAR(16) NOT NULL DEFAULT '',
+	ADD INDEX idx_namespace (namespace)`,
+	// 15: 审计记录
+	audit.Schema,
+	// 16: 会话有效期长度（空闲超时写入 last_active 后，Renew 仍按原有效期续期）
+	`ALTER TABLE session_db
+	ADD COLUMN ttl_seconds INT NULL DEFAULT NULL`,
+	// 17: 已删除会话的保留（见 archive.go）
+	archiveSchema,
+}
+
+// InitSchema 执行未完成的结构变更
+// DBGateway 连接是异步建立的，因此在后台重试直到成功
+func InitSchema() {
+	go func() {
+		for {
+			err := migrate()
+			if err == nil {
+				logger.Info("session schema up to date")
+				return
+			}
+			logger.Error("schema migration failed, retrying", "error", err)
+			time.Sleep(5 * time.Second)
+		}
+	}()
+}
+
+// migrate 依次执行尚未执行的结构变更
+// 多个实例可能同时执行，每一步都是幂等的：建表使用 IF NOT EXISTS，MODIFY 可重复执行，
+// 加列与加索引因已存在而失败时视为已由其他实例完成（单条 ALTER 整体生效或整体不生效），版本记录使用 INSERT IGNORE，
+// 因此网关调用失败时可以重试
+func migrate() error {
+	ctx := gateway.WithIdempotent(context.Background())
+	sqlResp, err := gateway.ExecSQL(ctx, &pb.SqlRequest{
+		Sql:    schemaVersionTable,
+		Db:     pb.SqlDatabases_Session,
+		Commit: true,
+	})
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return err
+	}
+
+	sqlResp, err = gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT IFNULL(MAX(version), 0) FROM session_schema_db")
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return err
+	}
+	var current int64
+	if len(sqlResp.Data) > 0 && len(sqlResp.Data[0].Result) > 0 {
+		current, _ = gateway.ScanInt64(sqlResp.Data[0].Result[0])
+	}
+
+	for i := int(current); i < len(migrations); i++ {
+		version := i + 1
+		logger.Info("applying schema migration", "version", version)
+		sqlResp, err := gateway.ExecSQL(ctx, &pb.SqlRequest{
+			Sql:    migrations[i],
+			Db:     pb.SqlDatabases_Session,
+			Commit: true,
+		})
+		if err == nil && alreadyApplied(sqlResp) {
+			logger.Info("schema migration already applied", "version", version)
+		} else if err == nil {
+			err = gateway.CheckResult(sqlResp)
+		}
+		if err != nil {
+			return fmt.Errorf("migration %d: %v", version, err)
+		}
+		sqlResp, err = gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, true,
+			"INSERT IGNORE INTO session_schema_db (version) VALUES (?)", version)
+		if err == nil {
+			err = gateway.CheckResult(sqlResp)
+		}
+		if err != nil {
+			return fmt.Errorf("record migration %d: %v", version, err)
+		}
+	}
+	return nil
+}
+
+// alreadyApplied 结构变更是否因列或索引已存在（MySQL 错误 1060、1061）而失败
+func alreadyApplied(res *pb.SqlResponse) bool {
+	if res == nil || res.Result == nil || res.Result.Code == 0 {
+		return false
+	}
+	return strings.Contains(res.Result.Msg, "Duplicate column name") ||
+		strings.Contains(res.Result.Msg, "Duplicate key name")
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/gateway"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// schemaGateway 只支持结构变更语句的 DBGateway，模拟 MySQL 对重复加列的报错
+type schemaGateway struct {
+	pb.StealthIMDBGatewayClient
+
+	applied  map[string]bool // 已生效的 ALTER
+	versions []int64
+	fail     string // 执行该语句时返回其他错误
+}
+
+func (g *schemaGateway) Mysql(ctx context.Context, in *pb.SqlRequest, opts ...grpc.CallOption) (*pb.SqlResponse, error) {
+	ok := &pb.Result{}
+	switch {
+	case in.Sql == g.fail:
+		return &pb.SqlResponse{Result: &pb.Result{Code: 1, Msg: "Error 1205 (HY000): Lock wait timeout exceeded"}}, nil
+	case in.Sql == "SELECT IFNULL(MAX(version), 0) FROM session_schema_db":
+		var v int64
+		if len(g.versions) > 0 {
+			v = slices.Max(g.versions)
+		}
+		return &pb.SqlResponse{Result: ok, Data: []*pb.SqlLine{{Result: []*pb.InterFaceType{{Response: &pb.InterFaceType_Int64{Int64: v}}}}}}, nil
+	case strings.HasPrefix(in.Sql, "INSERT IGNORE INTO session_schema_db "):
+		v, _ := gateway.ScanInt64(in.Params[0])
+		if !slices.Contains(g.versions, v) {
+			g.versions = append(g.versions, v)
+		}
+		return &pb.SqlResponse{Result: ok}, nil
+	case strings.Contains(in.Sql, " ADD "):
+		if g.applied[in.Sql] {
+			return &pb.SqlResponse{Result: &pb.Result{Code: 1, Msg: "Error 1060 (42S01): Duplicate column name 'device'"}}, nil
+		}
+		g.applied[in.Sql] = true
+	}
+	return &pb.SqlResponse{Result: ok}, nil
+}
+
+func TestMigrate(t *testing.T) {
+	withFakeGateway(t)
+
+	// 其他实例已执行结构变更 2 但尚未记录版本
+	g := &schemaGateway{applied: map[string]bool{migrations[1]: true}, versions: []int64{1}, fail: migrations[3]}
+	t.Cleanup(gateway.Override(g))
+	if err := migrate(); err == nil || !strings.Contains(err.Error(), "migration 4") {
+		t.Fatalf("migrate() = %v, want migration 4 error", err)
+	}
+	if !slices.Equal(g.versions, []int64{1, 2, 3}) {
+		t.Fatalf("versions = %v, want [1 2 3]", g.versions)
+	}
+
+	g.fail = ""
+	if err := migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.versions) != len(migrations) {
+		t.Fatalf("versions = %v, want %d", g.versions, len(migrations))
+	}
+}
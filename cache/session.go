@@ -2,177 +2,486 @@ package cache
 
 import (
 	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/bus"
+	"StealthIMSession/config"
+	"StealthIMSession/counters"
+	"StealthIMSession/events"
 	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"StealthIMSession/tracing"
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-var sessionCache *Cache
+// ErrBackendUnavailable 会话存储不可用，无法确认会话是否存在
+var ErrBackendUnavailable = errors.New("session backend unavailable")
+
+var logger = logging.For("cache")
+
+var sessionCache *Cache[SessionRecord]
+var missFlight = newCoalescer[SessionRecord](metricMissShared)
 
 // InitSessionCache 初始化会话缓存
 func InitSessionCache() {
-	sessionCache = New()
-	log.Println("[Cache] Session cache initialized")
+	sessionCache = New[SessionRecord]()
+	ApplyBypassConfig()
+	startRedisMigration()
+	startHashMigration()
+	startFreezeSync()
+	startArchivePurge()
+	startKnownFilter()
+	metrics.NewGaugeFunc("stealthim_session_cache_items", "Approximate number of memory cache entries", sessionCache.Len)
+	metrics.NewGaugeFunc("stealthim_session_cache_memory_bytes", "Approximate memory used by the memory cache", sessionCache.MemoryEstimate)
+	logger.Info("session cache initialized")
+}
+
+// ResetMemoryCache 按当前配置重建内存缓存，丢弃全部缓存项
+// 用于测试之间隔离状态，不启动 InitSessionCache 中的后台任务
+func ResetMemoryCache() {
+	sessionCache = New[SessionRecord]()
+}
+
+// ReconfigureMemoryCache 重载配置后将新的内存缓存配置应用到本实例的内存缓存，见 Cache.Reconfigure
+func ReconfigureMemoryCache() {
+	sessionCache.Reconfigure()
 }
 
 // GetUserIDBySession 根据会话ID获取用户ID
+func GetUserIDBySession(ctx context.Context, sessionID string) (int32, error) {
+	record, err := GetSessionRecord(ctx, sessionID)
+	return record.UID, err
+}
+
+// GetSessionRecord 根据会话ID获取有效会话的缓存记录，会话无效时返回错误
 // 实现三级缓存查询：内存缓存 -> Redis -> MySQL
-func GetUserIDBySession(sessionID string) (int32, error) {
+// 内存缓存未命中时，同一会话ID同时只有一个请求查询后端，其余请求等待其结果；
+// 配置了 coalesce_window 时先等待该窗口再查询，窗口内到达的相同请求共享结果，内存缓存命中不受影响
+func GetSessionRecord(ctx context.Context, sessionID string) (SessionRecord, error) {
 	// 1. 检查内存缓存
-	if uid, found := sessionCache.Get(sessionID); found {
-		// 如果值为-1，表示无效会话
-		if uid == -1 {
-			return 0, fmt.Errorf("invalid session: %s", sessionID)
+	_, span := tracing.Start(ctx, "cache.memory")
+	record, found := memoryGet(sessionID)
+	span.SetAttributes(attribute.Bool("cache.hit", found))
+	span.End()
+	if found {
+		metricMemHits.Inc()
+		if record.Revoked {
+			metricNegativeHits.Inc()
+			return SessionRecord{}, fmt.Errorf("invalid session: %s", sessionID)
 		}
-		return uid, nil
+		return record, nil
+	}
+	metricMemMisses.Inc()
+
+	// 已知会话过滤器判断一定不存在的会话ID不再查询 Redis 与 MySQL
+	if !knownSessions.mayExist(sessionID) {
+		metricKnownFilterRejected.Inc()
+		return SessionRecord{}, fmt.Errorf("unknown session: %s", sessionID)
 	}
 
+	window := time.Duration(config.LatestConfig.Cache.CoalesceWindow) * time.Microsecond
+	return missFlight.do(ctx, sessionID, window, func(ctx context.Context) (SessionRecord, error) {
+		return lookupBackend(ctx, sessionID)
+	})
+}
+
+// lookupBackend 内存缓存未命中时依次查询 Redis 与 MySQL，并回填缓存
+// 调用方设置了截止时间时，Redis 只占用其中 redis_budget% 的时间，
+// 剩余时间留给 MySQL，保证 Redis 缓慢时仍能回源
+// 签名会话ID签名错误时直接拒绝；签名有效、未过期且 Redis 确认没有无效标记时信任其中的 uid，不查询 MySQL
+func lookupBackend(ctx context.Context, sessionID string) (SessionRecord, error) {
+	claim, signed, valid := verifySignedID(sessionID)
+	if signed && !valid {
+		// 不写入无效缓存：校验签名比查询缓存更快，伪造的会话ID也不应占用缓存
+		metricSignedInvalid.Inc()
+		return SessionRecord{}, fmt.Errorf("invalid session signature: %s", sessionID)
+	}
+	// 已过期的签名会话ID可能已被续期，仍从存储查询
+	// 签名中没有活跃时间，启用空闲超时时同样从存储查询
+	live := valid && clock().Before(claim.expiresAt)
+	if valid && !live {
+		metricSignedExpired.Inc()
+	}
+	trusted := live && IdleTimeout() == 0
+
 	// 2. 检查Redis缓存
-	redisKey := fmt.Sprintf("session:session:%s", sessionID)
+	redisKey := redisSessionKey(sessionID)
 	redisReq := &pb.RedisGetStringRequest{
 		Key: redisKey,
 	}
 
-	redisResp, err := gateway.ExecRedisGet(redisReq)
+	var redisResp *pb.RedisGetStringResponse
+	var err error
+	if !bypassRedis.Load() {
+		redisCtx, redisCancel := gateway.SplitBudget(ctx, config.LatestConfig.DBGateway.RedisBudget)
+		redisResp, err = gateway.ExecRedisGet(redisCtx, redisReq)
+		redisCancel()
+	}
 	if err == nil && redisResp != nil && redisResp.Value != "" {
-		// Redis中找到了数据
-		uid, err := strconv.ParseInt(redisResp.Value, 10, 32)
-		if err == nil {
+		// Redis中找到了数据，已过期的值（Redis 有效期按秒取整）视为未命中
+		// 旧版本写入的值没有过期时间，同样视为未命中，下面从 MySQL 查询后以新格式写回
+		uid, expiresAt, err := parseRedisSessionValue(redisResp.Value)
+		legacy := err == nil && uid != -1 && expiresAt.IsZero()
+		if legacy {
+			metricLegacyAccess.Inc()
+		}
+		if err == nil && !legacy && (uid == -1 || clock().Before(expiresAt)) {
+			metricRedisHits.Inc()
 			// 如果值为-1，表示无效会话
 			if uid == -1 {
+				metricNegativeHits.Inc()
 				// 存入内存缓存
-				sessionCache.Set(sessionID, -1)
-				return 0, fmt.Errorf("invalid session: %s", sessionID)
+				sessionCache.SetTTL(sessionID, revokedRecord, negativeTTL())
+				return SessionRecord{}, fmt.Errorf("invalid session: %s", sessionID)
 			}
-			// 存入内存缓存
-			sessionCache.Set(sessionID, int32(uid))
-			return int32(uid), nil
+			// 存入内存缓存 (不超过会话剩余有效期)
+			record := validRecord(uid, expiresAt)
+			sessionCache.SetTTL(sessionID, record, expiresAt.Sub(clock()))
+			return record, nil
 		}
 	}
 
-	// 3. 从MySQL数据库查询
-	sqlQuery := fmt.Sprintf("SELECT uid FROM session_db WHERE session_id = '%s' LIMIT 1", sessionID)
-	sqlReq := &pb.SqlRequest{
-		Sql: sqlQuery,
-		Db:  pb.SqlDatabases_Session,
+	// Redis 中没有无效标记（查询成功且未被旁路），签名会话ID在过期前视为有效
+	// Redis 出错或被旁路时无法确认会话未被删除，仍从存储查询
+	if trusted && err == nil && !bypassRedis.Load() {
+		metricSignedTrusted.Inc()
+		record := validRecord(claim.uid, claim.expiresAt)
+		sessionCache.SetTTL(sessionID, record, claim.expiresAt.Sub(clock()))
+		return record, nil
 	}
 
-	sqlResp, err := gateway.ExecSQL(sqlReq)
+	// 3. 从会话存储（MySQL）查询
+	metricSQLLookups.Inc()
+	uid, remaining, err := sessionStore(ctx).Get(ctx, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		// 未找到会话或记录无法解析，将-1写入缓存
+		cacheInvalidSession(ctx, sessionID)
+		return SessionRecord{}, fmt.Errorf("%w: %s", err, sessionID)
+	}
 	if err != nil {
-		// 查询失败，将-1写入缓存
-		cacheInvalidSession(sessionID)
-		return 0, fmt.Errorf("database error: %v", err)
+		// 调用方已取消或超时，不计为后端不可用
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return SessionRecord{}, ctxErr
+		}
+		// 后端不可用时无法确认会话不存在，不写入无效缓存
+		metricBackendUnavailable.Inc()
+		return SessionRecord{}, fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
 	}
 
-	// 检查是否有返回数据
-	if sqlResp == nil || len(sqlResp.Data) == 0 {
-		// 未找到会话，将-1写入缓存
-		cacheInvalidSession(sessionID)
-		return 0, fmt.Errorf("session not found: %s", sessionID)
+	if uid <= 0 {
+		// 无效UID，将-1写入缓存
+		cacheInvalidSession(ctx, sessionID)
+		return SessionRecord{}, fmt.Errorf("invalid uid: %d", uid)
 	}
 
-	// 提取 uid 值
-	row := sqlResp.Data[0]
-	if len(row.Result) == 0 {
-		// 结果为空，将-1写入缓存
-		cacheInvalidSession(sessionID)
-		return 0, fmt.Errorf("empty result from database")
+	// 检查会话是否已过期（有效期按秒计，不足 1 秒视为已过期）
+	if remaining < time.Second {
+		// 会话已过期，将-1写入缓存
+		cacheInvalidSession(ctx, sessionID)
+		return SessionRecord{}, fmt.Errorf("session expired: %s", sessionID)
 	}
 
-	// 获取第一个字段（uid）
-	uidValue := row.Result[0]
-	var uid int32
+	// 将结果存入Redis (最多 redis_ttl 秒，且不超过会话剩余有效期)
+	record := validRecord(uid, clock().Add(remaining))
+	redisTTL := min(int64(remaining/time.Second), int64(config.LatestConfig.Cache.RedisTTL))
+	redisSetReq := &pb.RedisSetStringRequest{
+		Key:   redisKey,
+		Value: redisSessionValue(uid, record.ExpiresAt),
+		Ttl:   int32(redisTTL),
+	}
 
-	// 根据返回值类型确定UID
-	switch v := uidValue.Response.(type) {
-	case *pb.InterFaceType_Int32:
-		uid = v.Int32
-	case *pb.InterFaceType_Int64:
-		uid = int32(v.Int64)
-	case *pb.InterFaceType_Str:
-		i, err := strconv.ParseInt(v.Str, 10, 32)
-		if err != nil {
-			// 无效UID，将-1写入缓存
-			cacheInvalidSession(sessionID)
-			return 0, fmt.Errorf("invalid uid string: %s", v.Str)
+	gateway.ExecRedisSet(ctx, redisSetReq)
+
+	// 将结果存入内存缓存 (不超过会话剩余有效期)
+	sessionCache.SetTTL(sessionID, record, remaining)
+
+	return record, nil
+}
+
+// negativeTTL 无效会话标记（-1）的缓存时间
+func negativeTTL() time.Duration {
+	return time.Duration(config.LatestConfig.Cache.NegativeTTL) * time.Second
+}
+
+// 缓存无效会话（Redis 中写入-1）
+// 签名会话ID在过期前可不经 MySQL 通过校验，Redis 中的无效标记需保留到其过期
+func cacheInvalidSession(ctx context.Context, sessionID string) {
+	cacheInvalidSessions(ctx, []string{sessionID})
+}
+
+// cacheInvalidSessions 缓存多个无效会话，Redis 中的无效标记一次写入（见 gateway.ExecRedisMSet）
+func cacheInvalidSessions(ctx context.Context, sessionIDs []string) {
+	ttl := negativeTTL()
+	reqs := make([]*pb.RedisSetStringRequest, len(sessionIDs))
+	signed := make(map[string]time.Time)
+	for i, sessionID := range sessionIDs {
+		// 内存缓存写入无效会话标记
+		sessionCache.SetTTL(sessionID, revokedRecord, ttl)
+
+		redisTTL := ttl
+		if claim, _, valid := verifySignedID(sessionID); valid {
+			redisTTL = max(redisTTL, claim.expiresAt.Sub(clock())+time.Second)
+			signed[sessionID] = claim.expiresAt
+		}
+		// Redis缓存设为-1
+		reqs[i] = &pb.RedisSetStringRequest{
+			Key:   redisSessionKey(sessionID),
+			Value: "-1",
+			Ttl:   int32(redisTTL / time.Second),
+		}
+	}
+	if err := gateway.ExecRedisMSet(ctx, reqs); err != nil {
+		for sessionID, expiresAt := range signed {
+			logger.Error("failed to write invalid marker for signed session, it stays valid until it expires",
+				logging.Session(sessionID), "expires_at", expiresAt, "error", err)
 		}
-		uid = int32(i)
-	default:
-		// 意外类型，将-1写入缓存
-		cacheInvalidSession(sessionID)
-		return 0, fmt.Errorf("unexpected uid type")
 	}
+}
 
-	if uid <= 0 {
-		// 无效UID，将-1写入缓存
-		cacheInvalidSession(sessionID)
-		return 0, fmt.Errorf("invalid uid: %d", uid)
+// SessionTTL 计算会话有效期，ttl 不大于 0 时使用全局 ExpireHours
+func SessionTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return time.Duration(config.LatestConfig.Session.ExpireHours) * time.Hour
 	}
+	return ttl
+}
 
-	// 将结果存入Redis (永远使用3600秒作为TTL)
-	redisSetReq := &pb.RedisSetStringRequest{
-		Key:   redisKey,
-		Value: strconv.FormatInt(int64(uid), 10),
-		Ttl:   3600, // 1小时
+// SaveSession 保存新的会话信息（仅保存到数据库，启用异步写入时见 writebehind.go），返回过期时间
+// ttl 不大于 0 时使用全局 ExpireHours，caller 为调用方地址，记录到会话历史中
+// 写入不随调用方取消而中断，ctx 只用于传递追踪上下文
+func SaveSession(ctx context.Context, sessionID string, uid int32, ttl time.Duration, meta SessionMeta, caller string) (time.Time, error) {
+	meta = meta.Normalize()
+	ttlSeconds := int64(SessionTTL(ttl) / time.Second)
+	expiresAt := clock().Add(time.Duration(ttlSeconds) * time.Second)
+
+	ctx = context.WithoutCancel(ctx)
+
+	// 写入前加入已知会话过滤器，并经失效广播通知其他实例，创建后立即查询不会被拒绝
+	if config.LatestConfig.Cache.KnownFilter {
+		knownSessions.add(sessionID)
+		bus.Publish(sessionID)
 	}
 
-	gateway.ExecRedisSet(redisSetReq)
+	// 启用异步写入时先写入缓存，由后台写入会话存储与会话历史
+	if saveWriteBehind(ctx, sessionID, uid, time.Duration(ttlSeconds)*time.Second, expiresAt, meta, caller) {
+		sessionListCache.invalidateUID(uid)
+		events.Emit(events.Event{Type: events.Created, SessionID: sessionID, UID: uid})
+		counters.SessionsCreated.Add(1)
+		return expiresAt, nil
+	}
 
-	// 将结果存入内存缓存
-	sessionCache.Set(sessionID, uid)
+	// 保存到会话存储
+	if err := sessionStore(ctx).Save(ctx, sessionID, uid, time.Duration(ttlSeconds)*time.Second, meta); err != nil {
+		return time.Time{}, fmt.Errorf("database error: %v", err)
+	}
 
-	return uid, nil
-}
+	sessionListCache.invalidateUID(uid)
+	journalCreateSession(ctx, sessionID, uid, ttlSeconds, meta, caller)
+	events.Emit(events.Event{Type: events.Created, SessionID: sessionID, UID: uid})
+	counters.SessionsCreated.Add(1)
 
-// 缓存无效会话（将-1写入缓存）
-func cacheInvalidSession(sessionID string) {
-	// 内存缓存设为-1
-	sessionCache.Set(sessionID, -1)
+	return expiresAt, nil
+}
 
-	// Redis缓存设为-1
-	redisKey := fmt.Sprintf("session:session:%s", sessionID)
-	redisSetReq := &pb.RedisSetStringRequest{
-		Key:   redisKey,
-		Value: "-1",
-		Ttl:   3600, // 1小时
+// PrimeSession 将新建会话写入 Redis 与本地内存缓存
+// 用于 Set 的读写一致选项：返回前写入共享的 Redis，同一部署内其他副本的 Get 不会因 MySQL 复制延迟而未命中
+// ttl 为会话有效期，缓存有效期不超过 ttl（启用空闲超时时同时不超过空闲超时）
+func PrimeSession(ctx context.Context, sessionID string, uid int32, ttl time.Duration) error {
+	ttl = capIdle(SessionTTL(ttl))
+	if !bypassRedis.Load() {
+		redisTTL := min(int64(ttl/time.Second), int64(config.LatestConfig.Cache.RedisTTL))
+		_, err := gateway.ExecRedisSet(ctx, &pb.RedisSetStringRequest{
+			Key:   redisSessionKey(sessionID),
+			Value: redisSessionValue(uid, clock().Add(ttl)),
+			Ttl:   int32(redisTTL),
+		})
+		if err != nil {
+			return fmt.Errorf("redis error: %v", err)
+		}
 	}
-	gateway.ExecRedisSet(redisSetReq)
+	sessionCache.SetTTL(sessionID, validRecord(uid, clock().Add(ttl)), ttl)
+	return nil
 }
 
-// SaveSession 保存新的会话信息（仅保存到数据库）
-func SaveSession(sessionID string, uid int32) error {
-	// 保存到数据库
-	sqlQuery := fmt.Sprintf("INSERT INTO session_db (session_id, uid) VALUES ('%s', %d)", sessionID, uid)
-	sqlReq := &pb.SqlRequest{
-		Sql: sqlQuery,
-		Db:  pb.SqlDatabases_Session,
+// DeleteSession 删除会话，返回会话删除前是否存在
+// 会话已不存在时同样失效缓存，重复删除是安全的
+// 数据库删除失败时不修改缓存，调用方可以重试
+// caller 为调用方地址，记录到会话历史中；删除不随调用方取消而中断，ctx 只用于传递追踪上下文
+func DeleteSession(ctx context.Context, sessionID string, caller string) (bool, error) {
+	ctx = context.WithoutCancel(ctx)
+	// 尚未写入数据库的会话从异步写入队列移除
+	pending, queued := writeBehind.cancel(sessionID)
+	var uid int32
+	if queued {
+		uid = pending.uid
+	} else {
+		journalDeleteSession(ctx, sessionID, caller)
+		archiveSessions(ctx, archiveDelete, caller, "session_id = ?", sessionID)
+		if events.Enabled() {
+			uid = sessionOwner(ctx, sessionID)
+		}
 	}
 
-	_, err := gateway.ExecSQL(sqlReq)
+	// 1. 从会话存储删除
+	existed, err := sessionStore(ctx).Delete(ctx, sessionID)
 	if err != nil {
-		return fmt.Errorf("database error: %v", err)
+		if queued {
+			writeBehind.requeue([]pendingSession{pending})
+		}
+		return false, fmt.Errorf("database error: %v", err)
+	}
+	if queued {
+		journalPendingDeleted(ctx, pending, caller)
+		existed = true
+	} else if !existed {
+		// 其他实例队列中的会话：写入前看到下面的无效标记后放弃写入，同样视为删除前存在
+		if owner, ok := pendingElsewhere(ctx, sessionID); ok {
+			existed, uid = true, owner
+		}
 	}
 
-	return nil
+	// 2. 将缓存替换为无效内容（-1），并通知其他实例清除内存缓存
+	cacheInvalidSession(ctx, sessionID)
+	deleteRefreshTokens(ctx, "session_id", sessionID)
+	sessionListCache.invalidateSession(sessionID)
+	sessionAttrCache.invalidate(sessionID)
+	sessionTouchLimiter.forget(sessionID)
+	bus.Publish(sessionID)
+	if existed {
+		events.Emit(events.Event{Type: events.Deleted, SessionID: sessionID, UID: uid})
+		counters.SessionsDeleted.Add(1)
+	}
+
+	return existed, nil
+}
+
+// sessionOwner 查询会话所属的用户，用于删除事件；查询失败或会话不存在时返回 0
+func sessionOwner(ctx context.Context, sessionID string) int32 {
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT uid FROM session_db WHERE session_id = ?", sessionID)
+	if err != nil || sqlResp == nil || len(sqlResp.Data) == 0 || len(sqlResp.Data[0].Result) == 0 {
+		return 0
+	}
+	uid, _ := gateway.ScanInt64(sqlResp.Data[0].Result[0])
+	return int32(uid)
+}
+
+// PurgeLocal 清除本实例中会话的内存缓存，用于处理其他实例的失效广播
+// Redis 中的无效标记由删除会话的实例写入，清除后的查询会从 Redis 读取
+// 收到广播的会话ID也可能是其他实例新建的会话，同时加入已知会话过滤器
+func PurgeLocal(sessionID string) {
+	knownSessions.add(sessionID)
+	sessionCache.Delete(sessionID)
+	sessionListCache.invalidateSession(sessionID)
+	sessionAttrCache.invalidate(sessionID)
+	sessionTouchLimiter.forget(sessionID)
+}
+
+// DeleteExpiredSessions 从会话存储删除至多 limit 个过期会话，返回找到的过期会话与实际删除的数量
+func DeleteExpiredSessions(ctx context.Context, limit int) ([]ExpiredSession, int64, error) {
+	return sessionStore(ctx).DeleteExpired(ctx, limit)
 }
 
-// DeleteSession 删除会话
-func DeleteSession(sessionID string) error {
-	// 1. 从数据库删除
-	sqlQuery := fmt.Sprintf("DELETE FROM session_db WHERE session_id = '%s'", sessionID)
-	sqlReq := &pb.SqlRequest{
-		Sql: sqlQuery,
-		Db:  pb.SqlDatabases_Session,
+// CountExpiredSessions 返回会话存储中已过期、尚未被清理器删除的会话数
+func CountExpiredSessions(ctx context.Context) (int64, error) {
+	return sessionStore(ctx).CountExpired(ctx)
+}
+
+// CountSessionsByAge 返回未过期会话按创建天数的分布，创建超过 maxDays 天的计入最后一项
+func CountSessionsByAge(ctx context.Context, maxDays int) ([]int64, error) {
+	return sessionStore(ctx).CountByAge(ctx, maxDays)
+}
+
+// PurgeExpired 清除清理器删除的过期会话在 Redis 与内存中的缓存，并通知其他实例清除内存缓存
+// 删除 Redis 键而不是写入无效标记，过期会话不会再被频繁查询；一批会话的键一次删除（见 gateway.ExecRedisMDel）
+// 清除失败只记录日志，缓存会在会话过期时间之后自然失效
+func PurgeExpired(ctx context.Context, sessionIDs []string) {
+	keys := make([]string, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		keys[i] = redisSessionKey(sessionID)
+		PurgeLocal(sessionID)
+	}
+	if err := gateway.ExecRedisMDel(ctx, keys); err != nil {
+		logger.Warn("failed to purge expired sessions from redis", "total", len(sessionIDs), "error", err)
 	}
+	bus.Publish(sessionIDs...)
+}
 
-	_, err := gateway.ExecSQL(sqlReq)
+// DeleteSessionsByUID 删除用户的所有会话，返回删除的会话数量
+// caller 为调用方地址，记录到会话历史中
+func DeleteSessionsByUID(ctx context.Context, uid int32, caller string) (int, error) {
+	// 尚未写入数据库的会话先从异步写入队列移除，正在写入的会话写完后才能被下面的查询找到
+	pending := writeBehind.cancelUID(uid)
+
+	// 1. 查询用户的所有会话ID，用于失效缓存
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT session_id FROM session_db WHERE uid = ?", uid)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
 	if err != nil {
-		return fmt.Errorf("database error: %v", err)
+		writeBehind.requeue(pending)
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	sessionIDs := make([]string, 0, len(sqlResp.Data)+len(pending))
+	for _, row := range sqlResp.Data {
+		if len(row.Result) == 0 {
+			continue
+		}
+		if sessionID, ok := gateway.ScanString(row.Result[0]); ok {
+			sessionIDs = append(sessionIDs, sessionID)
+		}
 	}
 
-	// 2. 将缓存替换为无效内容（-1）
-	cacheInvalidSession(sessionID)
+	// 2. 按查到的会话ID从数据库删除，查询之后新建的会话不受影响
+	var deleted int64
+	if len(sessionIDs) > 0 {
+		args := make([]any, 0, len(sessionIDs)+1)
+		args = append(args, uid)
+		for _, sessionID := range sessionIDs {
+			args = append(args, sessionID)
+		}
+		where := "uid = ? AND session_id IN (?" + strings.Repeat(", ?", len(sessionIDs)-1) + ")"
+		journalDeleteUID(ctx, uid, caller, where, args...)
+		archiveSessions(ctx, archiveRevoke, caller, where, args...)
+		req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+			"DELETE FROM session_db WHERE "+where, args...)
+		if err != nil {
+			writeBehind.requeue(pending)
+			return 0, err
+		}
+		req.GetRowCount = true
+		delResp, err := gateway.ExecSQL(ctx, req)
+		if err == nil {
+			err = gateway.CheckResult(delResp)
+		}
+		if err != nil {
+			writeBehind.requeue(pending)
+			return 0, fmt.Errorf("database error: %v", err)
+		}
+		deleted = delResp.RowsAffected
+	}
+	for _, p := range pending {
+		journalPendingDeleted(ctx, p, caller)
+		sessionIDs = append(sessionIDs, p.sessionID)
+	}
 
-	return nil
+	// 3. 将缓存替换为无效内容（-1），并通知其他实例清除内存缓存
+	cacheInvalidSessions(ctx, sessionIDs)
+	for _, sessionID := range sessionIDs {
+		sessionAttrCache.invalidate(sessionID)
+	}
+	deleteRefreshTokens(ctx, "uid", uid)
+	sessionListCache.invalidateUID(uid)
+	bus.Publish(sessionIDs...)
+	events.Emit(events.Event{Type: events.Revoked, UID: uid})
+	deleted += int64(len(pending))
+	counters.SessionsDeleted.Add(deleted)
+
+	return int(deleted), nil
 }
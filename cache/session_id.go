@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// maxSessionIDLen 会话ID最大长度（前缀最多 16 字节，随机部分最多 48 字节，签名部分最多 48 字节，受众标记 9 字节）
+const maxSessionIDLen = 128
+
+// ValidSessionID 检查会话ID格式：非空、不超过 128 字节，只包含字母、数字、下划线、连字符与点（签名会话ID的分隔符），
+// 且主体为接受的前缀加符合当前（或修改前）id_encoding 与 id_bytes 的随机部分
+// 格式不合法的会话ID不可能由 Set 生成，调用方可直接视为不存在，不必查询后端或写入无效缓存
+func ValidSessionID(id string) bool {
+	if id == "" || len(id) > maxSessionIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return matchesIDFormat(id)
+}
+
+// idFormat 会话ID随机部分的格式
+type idFormat struct {
+	encoding string
+	bytes    int
+}
+
+// encodedLen 随机部分编码后的字符数
+func (f idFormat) encodedLen() int {
+	switch f.encoding {
+	case config.IDEncodingBase62:
+		return int(math.Ceil(float64(f.bytes*8) / math.Log2(62)))
+	case config.IDEncodingBase64URL:
+		return base64.RawURLEncoding.EncodedLen(f.bytes)
+	}
+	return hex.EncodedLen(f.bytes)
+}
+
+// encode 编码随机部分，base62 左侧补 '0' 到固定长度
+func (f idFormat) encode(b []byte) string {
+	switch f.encoding {
+	case config.IDEncodingBase62:
+		s := new(big.Int).SetBytes(b).Text(62)
+		return strings.Repeat("0", f.encodedLen()-len(s)) + s
+	case config.IDEncodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	return hex.EncodeToString(b)
+}
+
+// matches 检查 s 是否为该格式的随机部分
+func (f idFormat) matches(s string) bool {
+	if len(s) != f.encodedLen() {
+		return false
+	}
+	for _, c := range []byte(s) {
+		digit := '0' <= c && c <= '9'
+		lower := 'a' <= c && c <= 'z'
+		var ok bool
+		switch f.encoding {
+		case config.IDEncodingBase62:
+			ok = digit || lower || 'A' <= c && c <= 'Z'
+		case config.IDEncodingBase64URL:
+			ok = digit || lower || 'A' <= c && c <= 'Z' || c == '-' || c == '_'
+		default:
+			ok = digit || 'a' <= c && c <= 'f'
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesBody 检查会话ID主体是否为接受的前缀加该格式的随机部分
+// 前缀为 accepted_prefixes 中的任意一个，未配置时为 id_prefix；accepted_prefixes 中的 "" 接受任意前缀
+func (f idFormat) matchesBody(body string) bool {
+	prefixes := config.LatestConfig.Session.AcceptedPrefixes
+	if len(prefixes) == 0 {
+		prefix := config.LatestConfig.Session.IDPrefix
+		return strings.HasPrefix(body, prefix) && f.matches(body[len(prefix):])
+	}
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			if n := len(body) - f.encodedLen(); n >= 0 && f.matches(body[n:]) {
+				return true
+			}
+		} else if strings.HasPrefix(body, prefix) && f.matches(body[len(prefix):]) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSessionIDBody 生成新会话ID的主体：id_prefix 加按 id_encoding 编码的 id_bytes 字节随机数
+func NewSessionIDBody() (string, error) {
+	cfg := config.LatestConfig.Session
+	b := make([]byte, cfg.IDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return cfg.IDPrefix + idFormat{cfg.IDEncoding, cfg.IDBytes}.encode(b), nil
+}
+
+// matchesIDFormat 检查会话ID的随机部分是否符合当前或修改前的格式，未配置 id_bytes 时不检查
+// 签名会话ID的主体在第一个 '.' 之前；未签名的会话ID末尾可能带有受众标记，去掉后再检查
+func matchesIDFormat(id string) bool {
+	cfg := config.LatestConfig.Session
+	if cfg.IDBytes == 0 {
+		return true
+	}
+	body, _, signed := strings.Cut(id, ".")
+	untagged := ""
+	if n := len(body) - audienceTagLen; !signed && n > 0 && body[n] == '-' {
+		untagged = body[:n]
+	}
+	match := func(f idFormat) bool {
+		return f.matchesBody(body) || untagged != "" && f.matchesBody(untagged)
+	}
+	return match(idFormat{cfg.IDEncoding, cfg.IDBytes}) ||
+		cfg.PreviousIDEncoding != "" && match(idFormat{cfg.PreviousIDEncoding, cfg.PreviousIDBytes})
+}
+
+// audienceTagLen 会话ID末尾受众标记的长度：分隔符 '-' 加 8 位十六进制
+const audienceTagLen = 9
+
+// audienceTag 计算会话ID主体在当前受众下的标记（HMAC-SHA256 前 4 字节）
+// 受众不是密钥，标记用于防止不同环境的数据库或配置被错误串接时接受对方的会话ID，而不是防止伪造
+func audienceTag(audience string, body string) string {
+	mac := hmac.New(sha256.New, []byte(audience))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil)[:4])
+}
+
+// TagSessionID 为新生成的会话ID追加当前受众的标记，未配置 session.audience 时原样返回
+func TagSessionID(id string) string {
+	audience := config.LatestConfig.Session.Audience
+	if audience == "" {
+		return id
+	}
+	return id + "-" + audienceTag(audience, id)
+}
+
+// AudienceMatches 检查会话ID的受众标记是否属于当前受众，未配置 session.audience 时总是通过
+// 没有标记的会话ID（配置受众前生成）只在 accept_untagged 为 true 时通过
+func AudienceMatches(id string) bool {
+	audience := config.LatestConfig.Session.Audience
+	if audience == "" {
+		return true
+	}
+	n := len(id) - audienceTagLen
+	if n < 0 || id[n] != '-' {
+		return config.LatestConfig.Session.AcceptUntagged
+	}
+	body, tag := id[:n], id[n+1:]
+	return hmac.Equal([]byte(tag), []byte(audienceTag(audience, body)))
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzValidSessionID(f *testing.F) {
+	for _, seed := range []string{
+		benchSessionID,
+		"prod1_" + benchSessionID,
+		"",
+		"a b",
+		"x\x00y",
+		"会话",
+		strings.Repeat("a", maxSessionIDLen+1),
+		"../../etc/passwd",
+		"1' OR '1'='1",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, id string) {
+		if !ValidSessionID(id) {
+			return
+		}
+		// 合法的会话ID可安全用作 Redis 键与日志字段
+		if len(id) > maxSessionIDLen || strings.ContainsAny(id, " \t\r\n\x00:'\"\\/%*") {
+			t.Fatalf("ValidSessionID(%q) = true", id)
+		}
+		if key := redisSessionKey(id); !strings.HasPrefix(key, redisSessionPrefix) || len(key) != len(redisSessionPrefix)+len(id) {
+			t.Fatalf("redisSessionKey(%q) = %q", id, key)
+		}
+	})
+}
+
+func TestAudienceTag(t *testing.T) {
+	saved := config.LatestConfig.Session
+	t.Cleanup(func() { config.LatestConfig.Session = saved })
+	cfg := &config.LatestConfig.Session
+
+	cfg.Audience = ""
+	if id := TagSessionID("prod1_" + benchSessionID); id != "prod1_"+benchSessionID || !AudienceMatches("anything") {
+		t.Fatalf("audience disabled: TagSessionID() = %q", id)
+	}
+
+	cfg.Audience = "staging"
+	staging := TagSessionID("prod1_" + benchSessionID)
+	cfg.Audience = "production"
+	production := TagSessionID("prod1_" + benchSessionID)
+	if !ValidSessionID(production) || len(production) != len("prod1_"+benchSessionID)+audienceTagLen {
+		t.Fatalf("TagSessionID() = %q", production)
+	}
+
+	cfg.AcceptUntagged = true
+	for id, want := range map[string]bool{
+		production:                           true,
+		staging:                              false,
+		production[:len(production)-1]:       true, // 去掉一位后末尾不再是标记，视为旧会话ID
+		"prod1_" + benchSessionID:            true,
+		"x" + production[1:]:                 false,
+		"-" + production[len(production)-8:]: false,
+	} {
+		if got := AudienceMatches(id); got != want {
+			t.Errorf("AudienceMatches(%q) = %v, want %v", id, got, want)
+		}
+	}
+
+	cfg.AcceptUntagged = false
+	if AudienceMatches("prod1_"+benchSessionID) || !AudienceMatches(production) {
+		t.Fatal("untagged session ID accepted with accept_untagged = false")
+	}
+}
+
+func TestSessionIDFormat(t *testing.T) {
+	saved := config.LatestConfig.Session
+	t.Cleanup(func() { config.LatestConfig.Session = saved })
+	cfg := &config.LatestConfig.Session
+	cfg.IDPrefix = "stim_prod_"
+	cfg.PreviousIDEncoding, cfg.PreviousIDBytes = "", 0
+
+	for _, tc := range []struct {
+		encoding string
+		bytes    int
+		length   int
+	}{
+		{config.IDEncodingHex, 16, 32},
+		{config.IDEncodingHex, 24, 48},
+		{config.IDEncodingBase62, 16, 22},
+		{config.IDEncodingBase62, 24, 33},
+		{config.IDEncodingBase64URL, 16, 22},
+		{config.IDEncodingBase64URL, 24, 32},
+	} {
+		cfg.IDEncoding, cfg.IDBytes = tc.encoding, tc.bytes
+		for range 100 {
+			body, err := NewSessionIDBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(body, "stim_prod_") || len(body) != len("stim_prod_")+tc.length || !ValidSessionID(body) {
+				t.Fatalf("%s/%d: NewSessionIDBody() = %q", tc.encoding, tc.bytes, body)
+			}
+			if ValidSessionID(body[:len(body)-1]) {
+				t.Fatalf("%s/%d: truncated session ID %q accepted", tc.encoding, tc.bytes, body[:len(body)-1])
+			}
+		}
+	}
+
+	// 随机部分的字符集与长度不符时在查询后端前拒绝
+	cfg.IDEncoding, cfg.IDBytes = config.IDEncodingHex, 16
+	for _, id := range []string{"x", "stim_prod_" + strings.Repeat("g", 32), strings.ToUpper(benchSessionID), "stim_prod_" + benchSessionID[1:]} {
+		if ValidSessionID(id) {
+			t.Errorf("ValidSessionID(%q) = true", id)
+		}
+	}
+
+	// 前缀为 accepted_prefixes 中的一个，未配置时为 id_prefix
+	if ValidSessionID("stim_test_" + benchSessionID) {
+		t.Error("session ID with another prefix accepted")
+	}
+	cfg.AcceptedPrefixes = []string{"stim_test_", "stim_prod_"}
+	if !ValidSessionID("stim_test_"+benchSessionID) || ValidSessionID(benchSessionID) {
+		t.Error("accepted_prefixes not applied")
+	}
+	cfg.AcceptedPrefixes = []string{""}
+	if !ValidSessionID("legacy" + benchSessionID) {
+		t.Error(`accepted_prefixes = [""] rejected a prefixed session ID`)
+	}
+	cfg.AcceptedPrefixes = nil
+
+	// 签名与受众标记不影响检查
+	cfg.SigningKey = strings.Repeat("k", 32)
+	cfg.Audience = "production"
+	signed := TagSessionID(SignSessionID("", "stim_prod_"+benchSessionID, 7, time.Now().Add(time.Hour)))
+	if !ValidSessionID(signed) || !ValidSessionID(TagSessionID("stim_prod_"+benchSessionID)) {
+		t.Fatalf("signed or tagged session ID %q rejected", signed)
+	}
+
+	// 修改格式后，previous_id_encoding 与 previous_id_bytes 描述的旧会话ID仍然接受
+	cfg.IDEncoding, cfg.IDBytes = config.IDEncodingBase62, 20
+	if ValidSessionID("stim_prod_" + benchSessionID) {
+		t.Fatal("old format accepted without previous_id_encoding")
+	}
+	cfg.PreviousIDEncoding, cfg.PreviousIDBytes = config.IDEncodingHex, 16
+	if !ValidSessionID("stim_prod_"+benchSessionID) || !ValidSessionID(signed) {
+		t.Fatal("old format rejected with previous_id_encoding")
+	}
+}
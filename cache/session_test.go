@@ -0,0 +1,75 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/gateway"
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestPurgeExpired(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	for _, id := range []string{"s0", "s1"} {
+		if err := PrimeSession(ctx, id, 7, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	PurgeExpired(ctx, []string{"s0"})
+	if _, ok := f.redis[redisSessionKey("s0")]; ok {
+		t.Fatal("s0 still in redis")
+	}
+	if _, ok := sessionCache.Get("s0"); ok {
+		t.Fatal("s0 still in memory cache")
+	}
+	if _, ok := sessionCache.Get("s1"); !ok || f.redis[redisSessionKey("s1")].value == "" {
+		t.Fatal("s1 purged")
+	}
+}
+
+// insertAfterSelect 在查询用户会话ID之后插入一个新会话，模拟查询与删除之间新建的会话
+type insertAfterSelect struct {
+	*fakeGateway
+}
+
+func (g insertAfterSelect) Mysql(ctx context.Context, in *pb.SqlRequest, opts ...grpc.CallOption) (*pb.SqlResponse, error) {
+	res, err := g.fakeGateway.Mysql(ctx, in, opts...)
+	if in.Sql == "SELECT session_id FROM session_db WHERE uid = ?" {
+		g.sessions["new"] = fakeSession{uid: 7, created: g.sqlNow(), expires: g.sqlNow().Add(time.Hour)}
+	}
+	return res, err
+}
+
+func TestDeleteSessionsByUID(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	for _, id := range []string{"a", "b"} {
+		if _, err := SaveSession(ctx, id, 7, 0, SessionMeta{}, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := SaveSession(ctx, "c", 8, 0, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 查询之后新建的会话不被删除
+	t.Cleanup(gateway.Override(insertAfterSelect{f}))
+	if n, err := DeleteSessionsByUID(ctx, 7, "test"); err != nil || n != 2 {
+		t.Fatalf("DeleteSessionsByUID() = %d, %v, want 2", n, err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if _, found := f.sessions[id]; found {
+			t.Fatalf("%s not deleted", id)
+		}
+	}
+	if _, found := f.sessions["new"]; !found {
+		t.Fatal("session created after the query was deleted")
+	}
+	if _, found := f.sessions["c"]; !found {
+		t.Fatal("other user's session deleted")
+	}
+}
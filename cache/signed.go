@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 签名会话ID：<主体>.<uid>.<过期时间>.<签名>，启用受众时末尾再追加受众标记
+// 主体为前缀加随机部分，uid 与过期时间（Unix 秒）为 36 进制，
+// 签名为 HMAC-SHA256(signing_key, "<主体>.<uid>.<过期时间>") 前 16 字节的十六进制，
+// 带命名空间的会话签名内容前加 "<命名空间>:"，其他命名空间中同一会话ID的签名无效
+// 签名只证明会话ID由持有密钥的实例签发，删除后的会话仍需 Redis 中的无效标记才能拒绝
+
+// signatureLen 签名部分的长度（十六进制字符数）
+const signatureLen = 32
+
+// signedClaim 签名会话ID中携带的 uid 与过期时间
+type signedClaim struct {
+	uid       int32
+	expiresAt time.Time
+}
+
+// signPayload 计算签名部分
+func signPayload(key string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil)[:signatureLen/2])
+}
+
+// SignSessionID 为命名空间 ns 中的会话ID主体追加 uid、过期时间与签名，未配置 session.signing_key 时原样返回
+// expiresAt 不应晚于会话在存储中的过期时间，否则校验通过的会话ID可能已被清理
+func SignSessionID(ns string, body string, uid int32, expiresAt time.Time) string {
+	key := config.LatestConfig.Session.SigningKey
+	if key == "" {
+		return body
+	}
+	payload := body + "." + strconv.FormatInt(int64(uid), 36) + "." + strconv.FormatInt(expiresAt.Unix(), 36)
+	return payload + "." + signPayload(key, NamespacedID(ns, payload))
+}
+
+// verifySignedID 校验会话（存储中的键，见 NamespacedID）的签名，当前密钥或轮换前的密钥签发的都视为有效
+// signed 为 false 表示不是签名会话ID（未配置密钥时签发，或未配置任何密钥），此时只能查询存储
+// signed 为 true 且 valid 为 false 表示签名错误，会话ID不可能由本服务签发
+func verifySignedID(key string) (claim signedClaim, signed bool, valid bool) {
+	cfg := config.LatestConfig.Session
+	if cfg.SigningKey == "" && cfg.PreviousSigningKey == "" {
+		return claim, false, false
+	}
+	ns, id := SplitNamespace(key)
+	n := strings.LastIndexByte(id, '.')
+	if n < 0 {
+		return claim, false, false
+	}
+	// 受众标记以 '-' 开头，签名为十六进制，不会包含 '-'
+	payload, sig := id[:n], id[n+1:]
+	sig, _, _ = strings.Cut(sig, "-")
+	fields := strings.Split(payload, ".")
+	if len(fields) != 3 || len(sig) != signatureLen {
+		return claim, true, false
+	}
+	uid, err := strconv.ParseInt(fields[1], 36, 32)
+	if err != nil {
+		return claim, true, false
+	}
+	exp, err := strconv.ParseInt(fields[2], 36, 64)
+	if err != nil {
+		return claim, true, false
+	}
+	for _, secret := range []string{cfg.SigningKey, cfg.PreviousSigningKey} {
+		if secret != "" && hmac.Equal([]byte(sig), []byte(signPayload(secret, NamespacedID(ns, payload)))) {
+			return signedClaim{uid: int32(uid), expiresAt: time.Unix(exp, 0)}, true, true
+		}
+	}
+	return claim, true, false
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignSessionID(t *testing.T) {
+	saved := config.LatestConfig.Session
+	t.Cleanup(func() { config.LatestConfig.Session = saved })
+	cfg := &config.LatestConfig.Session
+	expires := time.Unix(1735689600, 0)
+
+	cfg.SigningKey = ""
+	if id := SignSessionID("", benchSessionID, 42, expires); id != benchSessionID {
+		t.Fatalf("signing disabled: SignSessionID() = %q", id)
+	}
+
+	cfg.SigningKey = strings.Repeat("k", 32)
+	id := SignSessionID("", "prod1_"+benchSessionID, 42, expires)
+	if !ValidSessionID(id) {
+		t.Fatalf("SignSessionID() = %q, not a valid session ID", id)
+	}
+	claim, signed, valid := verifySignedID(id)
+	if !signed || !valid || claim.uid != 42 || !claim.expiresAt.Equal(expires) {
+		t.Fatalf("verifySignedID(%q) = %+v, %v, %v", id, claim, signed, valid)
+	}
+
+	// 受众标记追加在签名之后
+	cfg.Audience = "production"
+	if _, _, valid := verifySignedID(TagSessionID(id)); !valid {
+		t.Fatal("signed session ID with audience tag rejected")
+	}
+
+	for _, forged := range []string{
+		strings.Replace(id, ".16.", ".17.", 1), // 修改 uid
+		id[:len(id)-1] + "0",
+		id + "0",
+		"prod1_" + benchSessionID + ".16.x.y",
+	} {
+		if _, signed, valid := verifySignedID(forged); !signed || valid {
+			t.Errorf("verifySignedID(%q) = %v, %v, want signed and invalid", forged, signed, valid)
+		}
+	}
+	// 签名绑定命名空间
+	scoped := SignSessionID("eu", "prod1_"+benchSessionID, 42, expires)
+	if _, _, valid := verifySignedID(NamespacedID("eu", scoped)); !valid {
+		t.Fatal("namespaced session ID rejected in its namespace")
+	}
+	for _, ns := range []string{"", "us"} {
+		if _, _, valid := verifySignedID(NamespacedID(ns, scoped)); valid {
+			t.Errorf("session ID signed for namespace eu accepted in namespace %q", ns)
+		}
+	}
+	if _, signed, _ := verifySignedID(benchSessionID); signed {
+		t.Fatal("unsigned session ID treated as signed")
+	}
+
+	// 轮换后旧密钥签发的会话ID仍有效，移除旧密钥后失效
+	cfg.PreviousSigningKey, cfg.SigningKey = cfg.SigningKey, strings.Repeat("n", 32)
+	if _, _, valid := verifySignedID(id); !valid {
+		t.Fatal("session ID signed with previous key rejected")
+	}
+	cfg.PreviousSigningKey = ""
+	if _, _, valid := verifySignedID(id); valid {
+		t.Fatal("session ID signed with removed key accepted")
+	}
+}
+
+func TestSignedLookup(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	config.LatestConfig.Session.SigningKey = strings.Repeat("k", 32)
+	config.LatestConfig.Cache.NegativeTTL = 5
+
+	// 签名有效且 Redis 中没有无效标记时不查询 MySQL
+	id := SignSessionID("", benchSessionID, 42, f.now.Add(time.Hour))
+	if uid, err := GetUserIDBySession(ctx, id); err != nil || uid != 42 {
+		t.Fatalf("GetUserIDBySession(signed) = %d, %v", uid, err)
+	}
+
+	// 签名错误时直接拒绝，不写入无效标记
+	forged := id[:len(id)-1] + "0"
+	if id[len(id)-1] == '0' {
+		forged = id[:len(id)-1] + "1"
+	}
+	if _, err := GetUserIDBySession(ctx, forged); err == nil {
+		t.Fatal("forged session ID accepted")
+	}
+	if _, ok := f.redis[redisSessionKey(forged)]; ok {
+		t.Fatal("invalid marker written for forged session ID")
+	}
+
+	// 删除后的无效标记保留到会话ID过期，而不是 negative_ttl
+	f.sessions[id] = fakeSession{uid: 42, expires: f.now.Add(time.Hour)}
+	if _, err := DeleteSession(ctx, id, "test"); err != nil {
+		t.Fatal(err)
+	}
+	f.now = f.now.Add(30 * time.Minute)
+	sessionCache = newCache[SessionRecord](1, true)
+	if _, err := GetUserIDBySession(ctx, id); err == nil {
+		t.Fatal("deleted signed session accepted after negative_ttl")
+	}
+
+	// 已过期的签名会话ID从存储查询，续期后的会话仍然有效
+	renewed := SignSessionID("", benchSessionID+"0", 7, f.now.Add(-time.Minute))
+	f.sessions[renewed] = fakeSession{uid: 7, expires: f.now.Add(time.Hour)}
+	if uid, err := GetUserIDBySession(ctx, renewed); err != nil || uid != 7 {
+		t.Fatalf("GetUserIDBySession(expired signature, renewed) = %d, %v", uid, err)
+	}
+}
@@ -0,0 +1,46 @@
+package cache
+
+import "StealthIMSession/bus"
+
+// CacheStats 内存缓存的统计，见 Cache.Stats
+type CacheStats struct {
+	Items             int64  // 缓存项数量（近似值）
+	Bytes             int64  // 估算内存占用字节数
+	Capacity          int64  // 当前最大缓存项数量（受内存压力上限影响）
+	PressureCap       int64  // 内存压力上限，0 表示不限制
+	Hits              uint64 // 由内存缓存回答的查询（含无效标记）
+	Misses            uint64 // 内存缓存未命中的查询
+	Evictions         uint64 // 缓存已满时淘汰的项
+	Expired           uint64 // 过期清理删除的项
+	AdmissionRejected uint64 // 未通过 TinyLFU 准入的新项
+}
+
+// HitRate 命中率，没有查询时为 0
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// MemoryStats 返回本实例内存缓存的统计，计数自缓存创建（启动或 ResetMemoryCache）起累计
+func MemoryStats() CacheStats {
+	return sessionCache.Stats()
+}
+
+// FlushMemory 清空本实例的内存缓存（会话、会话列表与会话属性），返回清除的会话缓存项数量
+// 只影响本实例，之后的查询从 Redis 与 MySQL 重新加载
+func FlushMemory() int {
+	n := sessionCache.Clear()
+	sessionListCache.clear()
+	sessionAttrCache.clear()
+	logger.Warn("memory cache flushed", "items", n)
+	return n
+}
+
+// InvalidateCached 清除会话在本实例的内存缓存，并经失效广播通知其他实例
+// Redis 中的缓存值不受影响
+func InvalidateCached(sessionID string) {
+	PurgeLocal(sessionID)
+	bus.Publish(sessionID)
+}
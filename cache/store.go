@@ -0,0 +1,369 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSessionNotFound 会话存储中没有该会话（或记录无法解析）
+var ErrSessionNotFound = errors.New("session not found")
+
+// ExpiredSession 被清理的过期会话
+type ExpiredSession struct {
+	SessionID string
+	UID       int32
+	Renewed   bool // 找到后、删除前被续期而未删除
+}
+
+// NewSession 批量写入的新会话，见 SessionStore.SaveBatch
+type NewSession struct {
+	SessionID string
+	UID       int32
+	TTL       time.Duration // 剩余有效期
+	Lifetime  time.Duration // 创建时的有效期，续期按该长度延长
+	Meta      SessionMeta
+}
+
+// SessionStore 会话的持久化存储，内存缓存与 Redis 之后的最后一级
+// 默认实现 gatewayStore 通过 gateway 包读写 MySQL 的 session_db，gateway 按 [storage] 配置经由 DBGateway 或直连
+type SessionStore interface {
+	// Get 返回会话的 uid 与剩余有效期（已过期时不大于 0），会话不存在时返回 ErrSessionNotFound
+	Get(ctx context.Context, sessionID string) (int32, time.Duration, error)
+	// Save 写入新会话，ttl 为有效期
+	Save(ctx context.Context, sessionID string, uid int32, ttl time.Duration, meta SessionMeta) error
+	// SaveBatch 写入多个新会话，已存在的会话保持不变：写入成功但响应丢失后可以重试
+	SaveBatch(ctx context.Context, sessions []NewSession) error
+	// Renew 按创建时的有效期延长未失效会话的有效期并记录活跃时间，返回新的过期时间
+	// 会话不存在或已失效（含空闲超时）时返回 ErrSessionNotFound
+	Renew(ctx context.Context, sessionID string) (time.Time, error)
+	// MarkActive 记录未失效会话的活跃时间，会话不存在或已失效时不报错
+	MarkActive(ctx context.Context, sessionID string) error
+	// Delete 删除会话，返回删除前是否存在
+	Delete(ctx context.Context, sessionID string) (bool, error)
+	// DeleteExpired 删除至多 limit 个过期会话，返回找到的过期会话与实际删除的数量
+	// 找到与删除之间被续期的会话不会被删除，并标记为 Renewed
+	DeleteExpired(ctx context.Context, limit int) ([]ExpiredSession, int64, error)
+	// CountExpired 返回已过期、尚未被删除的会话数
+	CountExpired(ctx context.Context) (int64, error)
+	// CountByAge 返回未过期会话按创建天数的分布，下标为天数，创建超过 maxDays 天的计入下标 maxDays
+	CountByAge(ctx context.Context, maxDays int) ([]int64, error)
+	// ListByUID 返回用户未过期的会话，按创建时间倒序
+	ListByUID(ctx context.Context, uid int32) ([]SessionInfo, error)
+	// CountByUID 返回用户未过期的会话数，与 ListByUID 的结果数相同
+	CountByUID(ctx context.Context, uid int32) (int64, error)
+	// Attrs 返回未过期会话的属性，会话不存在或已过期时返回 ErrSessionNotFound
+	Attrs(ctx context.Context, sessionID string) (map[string]string, error)
+	// SetAttr 设置未过期会话的属性，会话不存在时返回 ErrSessionNotFound，
+	// 属性不存在且属性数已达 maxAttrs 时返回 ErrTooManyAttrs
+	SetAttr(ctx context.Context, sessionID string, key string, value string, maxAttrs int) error
+	// DelAttr 删除会话属性，会话或属性不存在时不报错
+	DelAttr(ctx context.Context, sessionID string, key string) error
+}
+
+// storeOverride 替代默认存储的实现，见 UseStore
+var storeOverride atomic.Pointer[SessionStore]
+
+// UseStore 使之后的会话读写改用 s，返回恢复默认存储的函数
+func UseStore(s SessionStore) (restore func()) {
+	storeOverride.Store(&s)
+	return func() { storeOverride.Store(nil) }
+}
+
+// storeKey 上下文中注入的会话存储，见 WithStore
+type storeKey struct{}
+
+// WithStore 返回在其中的会话读写改用 s 的上下文，优先于 UseStore
+func WithStore(ctx context.Context, s SessionStore) context.Context {
+	return context.WithValue(ctx, storeKey{}, s)
+}
+
+// sessionStore 返回 ctx 中使用的会话存储
+func sessionStore(ctx context.Context) SessionStore {
+	if s, ok := ctx.Value(storeKey{}).(SessionStore); ok {
+		return s
+	}
+	if s := storeOverride.Load(); s != nil {
+		return *s
+	}
+	return gatewayStore{}
+}
+
+// expiredWhere 过期会话的条件，参数为全局 ExpireHours
+// 有独立过期时间的会话按 expires_at 判断，旧会话按全局 ExpireHours 判断
+// 滑动过期与 Renew 会推后 expires_at，因此活跃会话不会被清理
+const expiredWhere = expiresAtExpr + " < NOW()"
+
+// gatewayStore 通过 gateway 包读写 session_db
+type gatewayStore struct{}
+
+func (gatewayStore) Get(ctx context.Context, sessionID string) (int32, time.Duration, error) {
+	var sqlResp *pb.SqlResponse
+	var err error
+	if idle := config.LatestConfig.Session.IdleTimeoutMinutes; idle > 0 {
+		sqlResp, err = gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, uidIdleQuery,
+			config.LatestConfig.Session.ExpireHours, idle, sessionID)
+	} else {
+		sqlResp, err = gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, uidQuery,
+			config.LatestConfig.Session.ExpireHours, sessionID)
+	}
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(sqlResp.Data) == 0 || len(sqlResp.Data[0].Result) == 0 {
+		return 0, 0, ErrSessionNotFound
+	}
+
+	// 获取第一个字段（uid），根据返回值类型确定 UID
+	row := sqlResp.Data[0]
+	var uid int32
+	switch v := row.Result[0].Response.(type) {
+	case *pb.InterFaceType_Int32:
+		uid = v.Int32
+	case *pb.InterFaceType_Int64:
+		uid = int32(v.Int64)
+	case *pb.InterFaceType_Str:
+		i, err := strconv.ParseInt(v.Str, 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: invalid uid string: %s", ErrSessionNotFound, v.Str)
+		}
+		uid = int32(i)
+	default:
+		return 0, 0, fmt.Errorf("%w: unexpected uid type", ErrSessionNotFound)
+	}
+
+	var remaining int64
+	if len(row.Result) > 1 {
+		remaining, _ = gateway.ScanInt64(row.Result[1])
+	}
+	return uid, time.Duration(remaining) * time.Second, nil
+}
+
+// session_db 的插入语句，Save 与异步写入共用
+const (
+	sessionInsertColumns = "INTO session_db (session_id, uid, device, client_ip, user_agent, platform, gateway, expires_at, namespace, ttl_seconds) VALUES "
+	sessionInsertRow     = "(?, ?, ?, ?, ?, ?, ?, NOW() + INTERVAL ? SECOND, ?, ?)"
+)
+
+// sessionInserts 合并并发 Save 的 INSERT，见 dbgateway.batch_max_delay
+var sessionInserts = gateway.NewInsertBatcher(pb.SqlDatabases_Session, false, "INSERT "+sessionInsertColumns, sessionInsertRow)
+
+// sessionInsertArgs 一行会话的插入参数，顺序与 sessionInsertRow 一致
+// remaining 为距过期的时间，用于 expires_at；lifetime 为创建时的有效期，写入 ttl_seconds 供续期使用
+func sessionInsertArgs(sessionID string, uid int32, remaining time.Duration, lifetime time.Duration, meta SessionMeta) []any {
+	ns, _ := SplitNamespace(sessionID)
+	return []any{sessionID, uid, meta.Device, meta.ClientIP, meta.UserAgent, meta.Platform, meta.Gateway,
+		int64(remaining / time.Second), ns, int64(lifetime / time.Second)}
+}
+
+// Save 的 sessionID 为带命名空间的键（见 NamespacedID），命名空间同时写入 namespace 列
+func (gatewayStore) Save(ctx context.Context, sessionID string, uid int32, ttl time.Duration, meta SessionMeta) error {
+	return sessionInserts.Insert(ctx, sessionInsertArgs(sessionID, uid, ttl, ttl, meta)...)
+}
+
+func (gatewayStore) Delete(ctx context.Context, sessionID string) (bool, error) {
+	req, err := gateway.BuildSQL(pb.SqlDatabases_Session, false,
+		"DELETE FROM session_db WHERE session_id = ?", sessionID)
+	if err != nil {
+		return false, err
+	}
+	req.GetRowCount = true
+	sqlResp, err := gateway.ExecSQL(ctx, req)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return false, err
+	}
+	return sqlResp.RowsAffected > 0, nil
+}
+
+// DeleteExpired 先查出会话ID再按ID删除，删除时再次检查过期条件
+// 删除的行数少于找到的会话数时再次查询这些会话，仍存在的即为期间被续期的会话
+// 启用空闲超时时同时删除空闲超时的会话
+func (gatewayStore) DeleteExpired(ctx context.Context, limit int) ([]ExpiredSession, int64, error) {
+	where, whereArgs := expiredCondition()
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT session_id, uid FROM session_db WHERE "+where+" LIMIT ?", append(slices.Clone(whereArgs), limit)...)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	expired := make([]ExpiredSession, 0, len(sqlResp.Data))
+	for _, row := range sqlResp.Data {
+		if len(row.Result) < 2 {
+			continue
+		}
+		sessionID, ok := gateway.ScanString(row.Result[0])
+		if !ok {
+			continue
+		}
+		uid, _ := gateway.ScanInt64(row.Result[1])
+		expired = append(expired, ExpiredSession{SessionID: sessionID, UID: int32(uid)})
+	}
+	if len(expired) == 0 {
+		return nil, 0, nil
+	}
+
+	args := slices.Clone(whereArgs)
+	for _, s := range expired {
+		args = append(args, s.SessionID)
+	}
+	deleteWhere := where + " AND session_id IN (?" + strings.Repeat(", ?", len(expired)-1) + ")"
+	archiveSessions(ctx, archiveExpire, "", deleteWhere, args...)
+	req, err := gateway.BuildSQL(pb.SqlDatabases_Session, true,
+		"DELETE FROM session_db WHERE "+deleteWhere, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.GetRowCount = true
+	delResp, err := gateway.ExecSQL(ctx, req)
+	if err == nil {
+		err = gateway.CheckResult(delResp)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if delResp.RowsAffected < int64(len(expired)) {
+		markRenewed(ctx, expired)
+	}
+	return expired, delResp.RowsAffected, nil
+}
+
+// markRenewed 将删除后仍存在的会话标记为 Renewed
+// 查询失败时无法区分，全部标记为 Renewed：宁可漏发过期事件，也不为仍有效的会话发出
+func markRenewed(ctx context.Context, expired []ExpiredSession) {
+	args := make([]any, len(expired))
+	for i, s := range expired {
+		args[i] = s.SessionID
+	}
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT session_id FROM session_db WHERE session_id IN (?"+strings.Repeat(", ?", len(expired)-1)+")", args...)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		logger.Warn("failed to check renewed sessions after cleaning", "error", err)
+		for i := range expired {
+			expired[i].Renewed = true
+		}
+		return
+	}
+	remaining := make(map[string]bool, len(sqlResp.Data))
+	for _, row := range sqlResp.Data {
+		if len(row.Result) > 0 {
+			if id, ok := gateway.ScanString(row.Result[0]); ok {
+				remaining[id] = true
+			}
+		}
+	}
+	for i := range expired {
+		expired[i].Renewed = remaining[expired[i].SessionID]
+	}
+}
+
+func (gatewayStore) ListByUID(ctx context.Context, uid int32) ([]SessionInfo, error) {
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT session_id, UNIX_TIMESTAMP(created_at), "+metaColumns+" FROM session_db WHERE uid = ? AND "+expiresAtExpr+" > NOW() ORDER BY created_at DESC",
+		uid, config.LatestConfig.Session.ExpireHours)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanSessionInfos(sqlResp.Data), nil
+}
+
+func (gatewayStore) CountExpired(ctx context.Context) (int64, error) {
+	where, whereArgs := expiredCondition()
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT COUNT(*) FROM session_db WHERE "+where, whereArgs...)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if len(sqlResp.Data) > 0 && len(sqlResp.Data[0].Result) > 0 {
+		count, _ = gateway.ScanInt64(sqlResp.Data[0].Result[0])
+	}
+	return count, nil
+}
+
+func (gatewayStore) CountByAge(ctx context.Context, maxDays int) ([]int64, error) {
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT LEAST(DATEDIFF(NOW(), created_at), ?) AS age, COUNT(*) FROM session_db WHERE "+expiresAtExpr+" > NOW() GROUP BY age",
+		maxDays, config.LatestConfig.Session.ExpireHours)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	byAge := make([]int64, maxDays+1)
+	for _, row := range sqlResp.Data {
+		if len(row.Result) < 2 {
+			continue
+		}
+		age, ok := gateway.ScanInt64(row.Result[0])
+		if !ok {
+			continue
+		}
+		count, _ := gateway.ScanInt64(row.Result[1])
+		byAge[min(max(age, 0), int64(maxDays))] += count
+	}
+	return byAge, nil
+}
+
+func (gatewayStore) CountByUID(ctx context.Context, uid int32) (int64, error) {
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT COUNT(*) FROM session_db WHERE uid = ? AND "+expiresAtExpr+" > NOW()",
+		uid, config.LatestConfig.Session.ExpireHours)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if len(sqlResp.Data) > 0 && len(sqlResp.Data[0].Result) > 0 {
+		count, _ = gateway.ScanInt64(sqlResp.Data[0].Result[0])
+	}
+	return count, nil
+}
+
+// scanSessionInfos 解析 session_id、创建时间与元数据字段组成的查询结果
+func scanSessionInfos(rows []*pb.SqlLine) []SessionInfo {
+	sessions := make([]SessionInfo, 0, len(rows))
+	for _, row := range rows {
+		if len(row.Result) < 2 {
+			continue
+		}
+		sessionID, ok := gateway.ScanString(row.Result[0])
+		if !ok {
+			continue
+		}
+		info := SessionInfo{SessionID: sessionID}
+		if created, ok := gateway.ScanInt64(row.Result[1]); ok {
+			info.CreatedAt = time.Unix(created, 0)
+		}
+		info.Meta = scanMeta(row.Result[2:])
+		sessions = append(sessions, info)
+	}
+	return sessions
+}
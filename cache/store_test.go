@@ -0,0 +1,42 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/query"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// errorGateway 对所有 SQL 返回 DBGateway 的错误结果（调用本身成功）
+type errorGateway struct {
+	pb.StealthIMDBGatewayClient
+}
+
+func (errorGateway) Mysql(ctx context.Context, in *pb.SqlRequest, opts ...grpc.CallOption) (*pb.SqlResponse, error) {
+	return &pb.SqlResponse{Result: &pb.Result{Code: 1, Msg: "Error 1146 (42S02): Table doesn't exist"}}, nil
+}
+
+func TestListQueriesCheckResult(t *testing.T) {
+	withFakeGateway(t)
+	config.LatestConfig.Journal.Enable = true
+	t.Cleanup(gateway.Override(errorGateway{}))
+	ctx := context.Background()
+
+	// 错误结果不能被当作空列表返回
+	if sessions, err := (gatewayStore{}).ListByUID(ctx, 1); err == nil {
+		t.Errorf("ListByUID() = %v, want error", sessions)
+	}
+	if sessions, _, err := ListSessionsPage(ctx, 1, query.Request{}); err == nil {
+		t.Errorf("ListSessionsPage() = %v, want error", sessions)
+	}
+	if history, err := GetSessionHistory(ctx, "s", 1); err == nil {
+		t.Errorf("GetSessionHistory() = %+v, want error", history)
+	}
+	if entries, _, err := QueryJournal(ctx, query.Request{}); err == nil {
+		t.Errorf("QueryJournal() = %v, want error", entries)
+	}
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// renewWindowExpr 续期后的有效期长度（秒）：创建时的有效期 ttl_seconds，
+// 没有该列的旧会话为 expires_at 与上次活跃时间之差
+// 参数：ExpireHours
+const renewWindowExpr = "IFNULL(ttl_seconds, TIMESTAMPDIFF(SECOND, IFNULL(last_active, created_at), " + expiresAtExpr + "))"
+
+// renewSQL 延长会话有效期并记录活跃时间
+// MySQL 按书写顺序求值 SET，因此 expires_at 必须先于 last_active 更新
+// 参数：ExpireHours、会话ID、ExpireHours
+const renewSQL = "UPDATE session_db SET expires_at = NOW() + INTERVAL " + renewWindowExpr + " SECOND, last_active = NOW() WHERE session_id = ? AND " + expiresAtExpr + " > NOW()"
+
+// renewIdleSQL 与 renewSQL 相同，已空闲超时的会话不能续期
+// 参数：ExpireHours、会话ID、ExpireHours、IdleTimeoutMinutes
+const renewIdleSQL = "UPDATE session_db SET expires_at = NOW() + INTERVAL " + renewWindowExpr + " SECOND, last_active = NOW() WHERE session_id = ? AND " + validUntilExpr + " > NOW()"
+
+// touchMaxKeys 限流表的会话数上限，达到上限后记录新会话前先淘汰一个
+const touchMaxKeys = 4096
+
+// touchEvictSample 淘汰时抽查的会话数
+const touchEvictSample = 8
+
+// touchLimiter 限制同一会话活跃时间的写入频率
+// 记录数不超过 touchMaxKeys，淘汰只抽查少量记录，开销与记录数无关
+type touchLimiter struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+var sessionTouchLimiter = &touchLimiter{last: make(map[string]time.Time)}
+
+// allow 判断会话距上次写入是否已超过 interval，是则记录本次写入
+func (l *touchLimiter) allow(sessionID string, interval time.Duration) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t, ok := l.last[sessionID]
+	if ok && now.Sub(t) < interval {
+		return false
+	}
+	if !ok && len(l.last) >= touchMaxKeys {
+		l.evict()
+	}
+	l.last[sessionID] = now
+	return true
+}
+
+// evict 从随机抽查的 touchEvictSample 个记录中淘汰最早写入的一个
+// 被淘汰的会话下次访问时提前写入一次数据库，不影响正确性
+func (l *touchLimiter) evict() {
+	var victim string
+	var oldest time.Time
+	n := 0
+	for id, t := range l.last {
+		if n == 0 || t.Before(oldest) {
+			victim, oldest = id, t
+		}
+		if n++; n == touchEvictSample {
+			break
+		}
+	}
+	delete(l.last, victim)
+}
+
+// forget 删除会话的限流记录
+func (l *touchLimiter) forget(sessionID string) {
+	l.mu.Lock()
+	delete(l.last, sessionID)
+	l.mu.Unlock()
+}
+
+// RenewSession 延长会话有效期，返回新的过期时间；续期成功时记录到会话历史，caller 为调用方地址
+func RenewSession(ctx context.Context, sessionID string, caller string) (time.Time, error) {
+	expires, err := sessionStore(ctx).Renew(ctx, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("database error: %v", err)
+	}
+	sessionTouchLimiter.allow(sessionID, 0)
+	journalRenewSession(ctx, sessionID, caller)
+	return expires, nil
+}
+
+// Renew 更新后再查询 expires_at，未能续期的会话（如已空闲超时）查询不到
+func (gatewayStore) Renew(ctx context.Context, sessionID string) (time.Time, error) {
+	expireHours := config.LatestConfig.Session.ExpireHours
+	idle := config.LatestConfig.Session.IdleTimeoutMinutes
+	var sqlResp *pb.SqlResponse
+	var err error
+	if idle > 0 {
+		sqlResp, err = gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, renewIdleSQL,
+			expireHours, sessionID, expireHours, idle)
+	} else {
+		sqlResp, err = gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, renewSQL,
+			expireHours, sessionID, expireHours)
+	}
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	query, args := "SELECT UNIX_TIMESTAMP(expires_at) FROM session_db WHERE session_id = ? AND expires_at > NOW() LIMIT 1", []any{sessionID}
+	if idle > 0 {
+		query, args = "SELECT UNIX_TIMESTAMP(expires_at) FROM session_db WHERE session_id = ? AND expires_at > NOW() AND "+idleDeadlineExpr+" > NOW() LIMIT 1", []any{sessionID, idle}
+	}
+	sqlResp, err = gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false, query, args...)
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(sqlResp.Data) == 0 || len(sqlResp.Data[0].Result) == 0 {
+		return time.Time{}, ErrSessionNotFound
+	}
+	expires, ok := gateway.ScanInt64(sqlResp.Data[0].Result[0])
+	if !ok {
+		return time.Time{}, fmt.Errorf("unexpected expires_at type")
+	}
+	return time.Unix(expires, 0), nil
+}
+
+// TouchSession 滑动过期：在后台延长会话有效期，使用 ctx 中的会话存储
+// 同一会话在 touch_interval 内只写入一次数据库
+func TouchSession(ctx context.Context, sessionID string) {
+	interval := time.Duration(config.LatestConfig.Session.TouchInterval) * time.Second
+	if !sessionTouchLimiter.allow(sessionID, interval) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if _, err := RenewSession(ctx, sessionID, ""); err != nil {
+			metricTouchErrors.Inc()
+			logger.Warn("touch session failed", logging.Session(sessionID), "error", err)
+			return
+		}
+		metricTouches.Inc()
+	}()
+}
@@ -0,0 +1,26 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTouchLimiterBounded(t *testing.T) {
+	l := &touchLimiter{last: make(map[string]time.Time)}
+	if !l.allow("a", time.Hour) || l.allow("a", time.Hour) {
+		t.Fatal("second touch within interval allowed")
+	}
+	// 达到 touchMaxKeys 后记录新会话前淘汰一个，记录数不再增长
+	for i := range touchMaxKeys + 100 {
+		l.allow(fmt.Sprintf("s%d", i), time.Hour)
+	}
+	if n := len(l.last); n != touchMaxKeys {
+		t.Fatalf("len = %d, want %d", n, touchMaxKeys)
+	}
+	// 已有记录的会话不触发淘汰
+	l.allow("s0", 0)
+	if n := len(l.last); n != touchMaxKeys {
+		t.Fatalf("len after existing key = %d, want %d", n, touchMaxKeys)
+	}
+}
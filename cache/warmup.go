@@ -0,0 +1,70 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"fmt"
+	"time"
+)
+
+// warmupBatch 预热时每批读取的会话数
+const warmupBatch = 1000
+
+// warmupQuery 按最后活跃时间从新到旧分页读取未过期的会话与剩余有效秒数
+// 参数：ExpireHours、ExpireHours、LIMIT、OFFSET
+const warmupQuery = "SELECT session_id, uid, TIMESTAMPDIFF(SECOND, NOW(), " + expiresAtExpr + ") FROM session_db WHERE " + expiresAtExpr +
+	" > NOW() ORDER BY IFNULL(last_active, created_at) DESC, session_id LIMIT ? OFFSET ?"
+
+// warmupIdleQuery 与 warmupQuery 相同，剩余有效秒数同时受空闲超时限制
+// 参数：ExpireHours、IdleTimeoutMinutes、ExpireHours、IdleTimeoutMinutes、LIMIT、OFFSET
+const warmupIdleQuery = "SELECT session_id, uid, TIMESTAMPDIFF(SECOND, NOW(), " + validUntilExpr + ") FROM session_db WHERE " + validUntilExpr +
+	" > NOW() ORDER BY IFNULL(last_active, created_at) DESC, session_id LIMIT ? OFFSET ?"
+
+// WarmUp 将最近活跃的 cache.warmup 个会话（不超过内存缓存容量）载入本实例的内存缓存，返回载入的数量
+// 在 GRPC 服务开始接受请求前调用，避免部署后冷缓存的请求集中落到 Redis 与 MySQL；未配置时不做任何事
+// 只写入内存缓存，Redis 不受影响；超时或出错时保留已载入的会话并返回错误；配置了只读副本时从副本读取
+func WarmUp(ctx context.Context) (int, error) {
+	cfg := config.LatestConfig
+	limit := min(cfg.Cache.Warmup, sessionCache.maxItems())
+	if limit <= 0 {
+		return 0, nil
+	}
+	start := time.Now()
+	loaded, offset := 0, 0
+	for offset < limit {
+		batch := min(warmupBatch, limit-offset)
+		query, args := warmupQuery, []any{cfg.Session.ExpireHours, cfg.Session.ExpireHours, batch, offset}
+		if idle := cfg.Session.IdleTimeoutMinutes; idle > 0 {
+			query, args = warmupIdleQuery, []any{cfg.Session.ExpireHours, idle, cfg.Session.ExpireHours, idle, batch, offset}
+		}
+		sqlResp, err := gateway.ExecSQLParams(gateway.WithReplica(ctx), pb.SqlDatabases_Session, false, query, args...)
+		if err == nil {
+			err = gateway.CheckResult(sqlResp)
+		}
+		if err != nil {
+			return loaded, fmt.Errorf("database error: %v", err)
+		}
+		for _, row := range sqlResp.Data {
+			if len(row.Result) < 3 {
+				continue
+			}
+			sessionID, ok := gateway.ScanString(row.Result[0])
+			uid, _ := gateway.ScanInt64(row.Result[1])
+			remaining, _ := gateway.ScanInt64(row.Result[2])
+			if !ok || remaining <= 0 {
+				continue
+			}
+			ttl := time.Duration(remaining) * time.Second
+			sessionCache.SetTTL(sessionID, validRecord(int32(uid), clock().Add(ttl)), ttl)
+			loaded++
+		}
+		offset += len(sqlResp.Data)
+		if len(sqlResp.Data) < batch {
+			break
+		}
+	}
+	logger.Info("memory cache warmed up", "sessions", loaded, "duration", time.Since(start))
+	return loaded, nil
+}
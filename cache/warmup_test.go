@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWarmUp(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	for i := range 5 {
+		id := "s" + strconv.Itoa(i)
+		f.sessions[id] = fakeSession{uid: int32(i), created: f.now.Add(time.Duration(i) * time.Minute), expires: f.now.Add(time.Hour)}
+	}
+	f.sessions["expired"] = fakeSession{uid: 9, created: f.now.Add(time.Hour), expires: f.now.Add(-time.Minute)}
+
+	// 未配置时不预热
+	if n, err := WarmUp(ctx); err != nil || n != 0 {
+		t.Fatalf("WarmUp() disabled = %d, %v", n, err)
+	}
+
+	// 只载入最近活跃的会话，跳过已过期的会话
+	config.LatestConfig.Cache.Warmup = 3
+	if n, err := WarmUp(ctx); err != nil || n != 3 {
+		t.Fatalf("WarmUp() = %d, %v", n, err)
+	}
+	for i := range 5 {
+		record, ok := sessionCache.Get("s" + strconv.Itoa(i))
+		if want := i >= 2; ok != want || (ok && record.UID != int32(i)) {
+			t.Errorf("s%d in memory cache = %v (uid %d), want %v", i, ok, record.UID, want)
+		}
+	}
+	if _, ok := sessionCache.Get("expired"); ok {
+		t.Error("expired session loaded")
+	}
+}
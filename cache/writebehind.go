@@ -0,0 +1,378 @@
+package cache
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 异步写入（write-behind）：启用 session.write_behind 时 SaveSession 先将会话写入 Redis 与内存缓存并立即返回，
+// 由后台协程批量写入 MySQL，Set 的延迟不再取决于 MySQL
+// 写入失败时按退避间隔持续重试，关闭时写完队列；队列不持久化，进程崩溃时队列中的会话只保留在 Redis 中，redis_ttl 后失效
+// 尚未写入 MySQL 的会话在本实例删除时直接从队列移除；其他实例删除时写入的 Redis 无效标记在写入前检查，
+// 删除的实例按 Redis 中的有效缓存判断会话删除前存在（见 pendingElsewhere）
+
+// 写入失败后的退避间隔
+const (
+	writeBehindMinBackoff = 100 * time.Millisecond
+	writeBehindMaxBackoff = 10 * time.Second
+)
+
+var (
+	metricWriteBehindQueued  = metrics.NewGauge("stealthim_session_write_behind_queued", "Sessions waiting to be written to MySQL by the write-behind worker")
+	metricWriteBehindWritten = metrics.NewCounter("stealthim_session_write_behind_written_total", "Sessions written to MySQL by the write-behind worker")
+	metricWriteBehindErrors  = metrics.NewCounter("stealthim_session_write_behind_errors_total", "Write-behind batches that failed and will be retried")
+	metricWriteBehindSync    = metrics.NewCounter("stealthim_session_write_behind_sync_total", "Sessions written synchronously because the write-behind queue was full or Redis was unavailable")
+)
+
+// pendingSession 等待写入 MySQL 的会话
+type pendingSession struct {
+	ctx       context.Context // 保存时的上下文（不可取消），携带注入的存储与网关
+	store     SessionStore
+	sessionID string
+	uid       int32
+	ttl       time.Duration // 创建时的有效期，写入 ttl_seconds
+	expiresAt time.Time     // 写入时按剩余有效期计算，过期时间不因排队而推迟
+	meta      SessionMeta
+	caller    string
+}
+
+// writeBehindQueue 异步写入队列
+// flushMu 在写入一批期间持有，删除会话时先获取它，保证正在写入的会话写完后再从数据库删除
+type writeBehindQueue struct {
+	mu      sync.Mutex
+	pending []pendingSession
+	running bool
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+
+	flushMu sync.Mutex
+}
+
+var writeBehind = &writeBehindQueue{}
+
+// StartWriteBehind 按 session.write_behind 启动异步写入协程，未启用时不做任何事
+func StartWriteBehind() {
+	if !config.LatestConfig.Session.WriteBehind {
+		return
+	}
+	writeBehind.start()
+	logger.Info("write-behind enabled", "batch", config.LatestConfig.Session.WriteBehindBatch,
+		"interval_ms", config.LatestConfig.Session.WriteBehindInterval)
+}
+
+// StopWriteBehind 停止接收新的会话并写完队列，ctx 结束时放弃剩余的会话并返回错误
+func StopWriteBehind(ctx context.Context) error {
+	return writeBehind.shutdown(ctx)
+}
+
+func (q *writeBehindQueue) start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running {
+		return
+	}
+	q.running = true
+	q.wake = make(chan struct{}, 1)
+	q.stop = make(chan struct{})
+	q.done = make(chan struct{})
+	go q.run(q.stop, q.done)
+}
+
+func (q *writeBehindQueue) shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.running {
+		q.mu.Unlock()
+		return nil
+	}
+	q.running = false
+	close(q.stop)
+	done := q.done
+	q.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		n := len(q.pending)
+		q.mu.Unlock()
+		logger.Error("write-behind queue not drained before shutdown, sessions only kept in redis", "pending", n)
+		return fmt.Errorf("%d sessions not written: %w", n, ctx.Err())
+	}
+}
+
+// saveWriteBehind 启用异步写入时将会话写入 Redis 与内存缓存并加入队列，返回 false 时调用方需同步写入
+// Redis 被旁路或写入失败时其他实例查询不到该会话，队列已满时避免积压过多，两种情况都改为同步写入
+func saveWriteBehind(ctx context.Context, sessionID string, uid int32, ttl time.Duration, expiresAt time.Time, meta SessionMeta, caller string) bool {
+	if !writeBehind.enabled() {
+		return false
+	}
+	if bypassRedis.Load() || PrimeSession(ctx, sessionID, uid, ttl) != nil {
+		metricWriteBehindSync.Inc()
+		return false
+	}
+	if !writeBehind.enqueue(pendingSession{
+		ctx:       ctx,
+		store:     sessionStore(ctx),
+		sessionID: sessionID,
+		uid:       uid,
+		ttl:       ttl,
+		expiresAt: expiresAt,
+		meta:      meta,
+		caller:    caller,
+	}) {
+		metricWriteBehindSync.Inc()
+		return false
+	}
+	return true
+}
+
+// enabled 异步写入协程是否在运行
+func (q *writeBehindQueue) enabled() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.running
+}
+
+// enqueue 将会话加入队列，未启用或队列已满时返回 false
+func (q *writeBehindQueue) enqueue(p pendingSession) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.running || len(q.pending) >= config.LatestConfig.Session.WriteBehindQueue {
+		return false
+	}
+	q.pending = append(q.pending, p)
+	metricWriteBehindQueued.Set(int64(len(q.pending)))
+	if len(q.pending) >= config.LatestConfig.Session.WriteBehindBatch {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// cancel 从队列移除尚未写入的会话，正在写入时等待写完（此时返回 false，会话已在数据库中）
+func (q *writeBehindQueue) cancel(sessionID string) (pendingSession, bool) {
+	removed := q.remove(func(p pendingSession) bool { return p.sessionID == sessionID })
+	if len(removed) == 0 {
+		return pendingSession{}, false
+	}
+	return removed[0], true
+}
+
+// cancelUID 从队列移除用户尚未写入的全部会话
+func (q *writeBehindQueue) cancelUID(uid int32) []pendingSession {
+	return q.remove(func(p pendingSession) bool { return p.uid == uid })
+}
+
+// requeue 将删除失败的会话放回队首，调用方可以重试删除
+func (q *writeBehindQueue) requeue(sessions []pendingSession) {
+	if len(sessions) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(slices.Clone(sessions), q.pending...)
+	metricWriteBehindQueued.Set(int64(len(q.pending)))
+}
+
+func (q *writeBehindQueue) remove(match func(pendingSession) bool) []pendingSession {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var removed []pendingSession
+	q.pending = slices.DeleteFunc(q.pending, func(p pendingSession) bool {
+		if match(p) {
+			removed = append(removed, p)
+			return true
+		}
+		return false
+	})
+	metricWriteBehindQueued.Set(int64(len(q.pending)))
+	return removed
+}
+
+// run 按间隔或队列达到一批时写入，失败时退避后重试；stop 关闭后写完队列再退出
+func (q *writeBehindQueue) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	var backoff time.Duration
+	stopping := false
+	for {
+		switch {
+		case stopping:
+			time.Sleep(backoff)
+		case backoff > 0:
+			select {
+			case <-time.After(backoff):
+			case <-stop:
+				stopping = true
+			}
+		default:
+			select {
+			case <-q.wake:
+			case <-time.After(time.Duration(config.LatestConfig.Session.WriteBehindInterval) * time.Millisecond):
+			case <-stop:
+				stopping = true
+			}
+		}
+
+		if err := q.flushAll(); err != nil {
+			metricWriteBehindErrors.Inc()
+			backoff = min(max(backoff*2, writeBehindMinBackoff), writeBehindMaxBackoff)
+			logger.Warn("write-behind flush failed, retrying", "backoff", backoff, "error", err)
+			continue
+		}
+		backoff = 0
+		if stopping {
+			return
+		}
+	}
+}
+
+// flushAll 写入队列中的全部会话，遇到错误时停止，未写入的会话留在队列中
+func (q *writeBehindQueue) flushAll() error {
+	for {
+		n, err := q.flushBatch()
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+}
+
+// flushBatch 写入队首的一批会话，返回处理的数量
+func (q *writeBehindQueue) flushBatch() (int, error) {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+
+	q.mu.Lock()
+	batch := q.pending[:min(len(q.pending), config.LatestConfig.Session.WriteBehindBatch)]
+	batch = append([]pendingSession(nil), batch...)
+	q.mu.Unlock()
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	// 按存储分组写入，写入成功的组出队，失败时其余会话留在队列中
+	// 已过期或已被其他实例删除的会话直接出队
+	done := make(map[string]bool, len(batch))
+	var written []pendingSession
+	var err error
+	for _, group := range groupByStore(batch) {
+		deleted := deletedElsewhere(group)
+		live := make([]pendingSession, 0, len(group))
+		for _, p := range group {
+			if clock().Before(p.expiresAt) && !deleted[p.sessionID] {
+				live = append(live, p)
+			}
+		}
+		if err = saveBatch(live); err != nil {
+			break
+		}
+		for _, p := range group {
+			done[p.sessionID] = true
+		}
+		written = append(written, live...)
+	}
+
+	q.mu.Lock()
+	q.pending = slices.DeleteFunc(q.pending, func(p pendingSession) bool { return done[p.sessionID] })
+	metricWriteBehindQueued.Set(int64(len(q.pending)))
+	q.mu.Unlock()
+	for _, p := range written {
+		journalCreateSession(p.ctx, p.sessionID, p.uid, int64(p.ttl/time.Second), p.meta, p.caller)
+	}
+	metricWriteBehindWritten.Add(uint64(len(written)))
+	return len(done), err
+}
+
+// groupByStore 按存储分组，保持队列顺序
+func groupByStore(batch []pendingSession) [][]pendingSession {
+	var groups [][]pendingSession
+	index := make(map[SessionStore]int)
+	for _, p := range batch {
+		i, ok := index[p.store]
+		if !ok {
+			i = len(groups)
+			index[p.store] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], p)
+	}
+	return groups
+}
+
+// deletedElsewhere 返回同一存储的一组会话中已被其他实例删除的会话：删除时数据库中还没有该会话，只留下 Redis 中的无效标记
+// 一组会话的键一次读取（见 gateway.ExecRedisMGet），查询失败时视为都未删除
+func deletedElsewhere(group []pendingSession) map[string]bool {
+	if len(group) == 0 {
+		return nil
+	}
+	keys := make([]string, len(group))
+	for i, p := range group {
+		keys[i] = redisSessionKey(p.sessionID)
+	}
+	values, err := gateway.ExecRedisMGet(group[0].ctx, keys)
+	if err != nil {
+		logger.Warn("failed to check write-behind sessions for deletion", "sessions", len(group), "error", err)
+		return nil
+	}
+	deleted := make(map[string]bool)
+	for i, value := range values {
+		if uid, _, err := parseRedisSessionValue(value); err == nil && uid == -1 {
+			logger.Info("session deleted before write-behind flush", logging.Session(group[i].sessionID))
+			deleted[group[i].sessionID] = true
+		}
+	}
+	return deleted
+}
+
+// pendingElsewhere 删除时数据库中没有的会话是否仍在其他实例的异步写入队列中：Redis 中还有它的有效缓存
+// 返回会话所属的用户；未启用异步写入或查询失败时视为不在队列中
+func pendingElsewhere(ctx context.Context, sessionID string) (int32, bool) {
+	if !config.LatestConfig.Session.WriteBehind || bypassRedis.Load() {
+		return 0, false
+	}
+	resp, err := gateway.ExecRedisGet(ctx, &pb.RedisGetStringRequest{Key: redisSessionKey(sessionID)})
+	if err != nil || resp == nil {
+		return 0, false
+	}
+	uid, expiresAt, err := parseRedisSessionValue(resp.Value)
+	if err != nil || uid <= 0 || (!expiresAt.IsZero() && !clock().Before(expiresAt)) {
+		return 0, false
+	}
+	return uid, true
+}
+
+// saveBatch 写入同一存储的一组会话
+// expires_at 按排队后的剩余有效期计算，创建时的有效期不变，续期不会因排队而缩短
+func saveBatch(group []pendingSession) error {
+	if len(group) == 0 {
+		return nil
+	}
+	sessions := make([]NewSession, len(group))
+	for i, p := range group {
+		sessions[i] = NewSession{SessionID: p.sessionID, UID: p.uid, TTL: p.expiresAt.Sub(clock()), Lifetime: p.ttl, Meta: p.meta}
+	}
+	return group[0].store.SaveBatch(group[0].ctx, sessions)
+}
+
+// SaveBatch 以一条 INSERT 写入多个会话，Lifetime 写入 ttl_seconds
+// 使用 INSERT IGNORE：写入成功但响应丢失后重试时不会因主键重复而一直失败
+func (gatewayStore) SaveBatch(ctx context.Context, sessions []NewSession) error {
+	rows := make([][]any, len(sessions))
+	for i, s := range sessions {
+		rows[i] = sessionInsertArgs(s.SessionID, s.UID, s.TTL, s.Lifetime, s.Meta)
+	}
+	return gateway.ExecInsert(ctx, pb.SqlDatabases_Session, false, "INSERT IGNORE "+sessionInsertColumns, sessionInsertRow, rows)
+}
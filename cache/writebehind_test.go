@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWriteBehind(t *testing.T) {
+	f := withFakeGateway(t)
+	ctx := context.Background()
+	cfg := &config.LatestConfig.Session
+	cfg.WriteBehind = true
+	cfg.WriteBehindBatch = 100
+	cfg.WriteBehindInterval = 60000 // 只在关闭时写入
+	cfg.WriteBehindQueue = 10
+	writeBehind.start()
+	t.Cleanup(func() { writeBehind.shutdown(ctx) })
+
+	// 返回时只写入了缓存，查询不依赖 MySQL
+	if _, err := SaveSession(ctx, "s0", 7, time.Hour, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.sessions["s0"]; ok {
+		t.Fatal("s0 written synchronously")
+	}
+	sessionCache = newCache[SessionRecord](1, true)
+	if uid, err := GetUserIDBySession(ctx, "s0"); err != nil || uid != 7 {
+		t.Fatalf("GetUserIDBySession(s0) = %d, %v", uid, err)
+	}
+
+	// 写入前删除的会话不会写入 MySQL
+	if _, err := SaveSession(ctx, "s1", 7, time.Hour, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if existed, err := DeleteSession(ctx, "s1", "test"); err != nil || !existed {
+		t.Fatalf("DeleteSession(s1) = %v, %v", existed, err)
+	}
+	if _, err := GetUserIDBySession(ctx, "s1"); err == nil {
+		t.Fatal("deleted pending session accepted")
+	}
+
+	// 其他实例删除时留下的无效标记在写入前检查
+	if _, err := SaveSession(ctx, "s2", 8, time.Hour, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	f.redis[redisSessionKey("s2")] = fakeRedisValue{value: "-1"}
+
+	// 删除其他实例队列中的会话（数据库中没有，Redis 中有有效缓存）时同样返回删除前存在
+	f.redis[redisSessionKey("s6")] = fakeRedisValue{value: redisSessionValue(10, f.now.Add(time.Hour))}
+	if existed, err := DeleteSession(ctx, "s6", "test"); err != nil || !existed {
+		t.Fatalf("DeleteSession(s6) = %v, %v", existed, err)
+	}
+
+	// 删除用户的全部会话时移除队列中的会话
+	if _, err := SaveSession(ctx, "s3", 9, time.Hour, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := DeleteSessionsByUID(ctx, 9, "test"); err != nil || n != 1 {
+		t.Fatalf("DeleteSessionsByUID(9) = %d, %v", n, err)
+	}
+
+	// 关闭时写完队列：expires_at 按剩余有效期计算，ttl_seconds 为创建时的有效期
+	f.now = f.now.Add(10 * time.Minute)
+	if err := StopWriteBehind(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := f.sessions["s0"]; !ok || s.uid != 7 || s.ttl != time.Hour || !s.expires.Equal(f.sqlNow().Add(50*time.Minute)) {
+		t.Fatalf("s0 not written on shutdown: %+v", s)
+	}
+	for _, id := range []string{"s1", "s2", "s3"} {
+		if _, ok := f.sessions[id]; ok {
+			t.Errorf("deleted session %s written", id)
+		}
+	}
+
+	// 未启用或队列已满时同步写入
+	if _, err := SaveSession(ctx, "s4", 7, time.Hour, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.WriteBehindQueue = 0
+	writeBehind.start()
+	if _, err := SaveSession(ctx, "s5", 7, time.Hour, SessionMeta{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"s4", "s5"} {
+		if _, ok := f.sessions[id]; !ok {
+			t.Errorf("%s not written synchronously", id)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package client 会话服务的客户端辅助工具
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// RetryOptions 自动重试配置
+type RetryOptions struct {
+	MaxAttempts int           // 最多尝试次数（含首次），不大于 1 时不重试
+	Backoff     time.Duration // 首次重试前的等待时间，之后每次翻倍
+	MaxBackoff  time.Duration // 单次等待时间上限，0 表示不限制
+}
+
+// DefaultRetryOptions 默认重试配置
+var DefaultRetryOptions = RetryOptions{
+	MaxAttempts: 3,
+	Backoff:     50 * time.Millisecond,
+	MaxBackoff:  time.Second,
+}
+
+// idempotencyCache 方法名 -> 幂等级别
+var idempotencyCache sync.Map
+
+// idempotencyLevel 从 proto 描述符读取 RPC 的 idempotency_level 选项
+// 方法未注册或未声明时返回 IDEMPOTENCY_UNKNOWN
+func idempotencyLevel(files *protoregistry.Files, fullMethod string) descriptorpb.MethodOptions_IdempotencyLevel {
+	// "/pkg.Service/Method" -> "pkg.Service.Method"
+	name := protoreflect.FullName(strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1))
+	desc, err := files.FindDescriptorByName(name)
+	if err != nil {
+		return descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+	}
+	opts, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || opts == nil {
+		return descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+	}
+	return opts.GetIdempotencyLevel()
+}
+
+// RetrySafe 判断方法是否声明为可安全重试（NO_SIDE_EFFECTS 或 IDEMPOTENT）
+func RetrySafe(fullMethod string) bool {
+	if v, ok := idempotencyCache.Load(fullMethod); ok {
+		return v.(bool)
+	}
+	level := idempotencyLevel(protoregistry.GlobalFiles, fullMethod)
+	safe := level == descriptorpb.MethodOptions_NO_SIDE_EFFECTS || level == descriptorpb.MethodOptions_IDEMPOTENT
+	idempotencyCache.Store(fullMethod, safe)
+	return safe
+}
+
+// retryableCode 可能未送达或未完成的错误码
+// 不含 ResourceExhausted：限流时服务端不返回重试等待时间，按退避立即重试只会加重过载
+func retryableCode(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryInterceptor 返回按 proto 幂等声明自动重试的客户端拦截器
+// 只有声明为 NO_SIDE_EFFECTS 或 IDEMPOTENT 的方法会在可重试的错误码上重试，
+// 其余方法（如 Set）只调用一次
+func RetryInterceptor(opts RetryOptions) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+		if err == nil || opts.MaxAttempts <= 1 || !RetrySafe(method) {
+			return err
+		}
+
+		backoff := opts.Backoff
+		for attempt := 1; attempt < opts.MaxAttempts; attempt++ {
+			if !retryableCode(status.Code(err)) {
+				return err
+			}
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+			backoff *= 2
+			if opts.MaxBackoff > 0 && backoff > opts.MaxBackoff {
+				backoff = opts.MaxBackoff
+			}
+
+			err = invoker(ctx, method, req, reply, cc, callOpts...)
+			if err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestIdempotencyLevel(t *testing.T) {
+	method := func(name string, level descriptorpb.MethodOptions_IdempotencyLevel) *descriptorpb.MethodDescriptorProto {
+		m := &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(".test.Empty"),
+			OutputType: proto.String(".test.Empty"),
+		}
+		if level != descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN {
+			m.Options = &descriptorpb.MethodOptions{IdempotencyLevel: level.Enum()}
+		}
+		return m
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("test.proto"),
+		Package:     proto.String("test"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Empty")}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Session"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("Get", descriptorpb.MethodOptions_NO_SIDE_EFFECTS),
+				method("Del", descriptorpb.MethodOptions_IDEMPOTENT),
+				method("Set", descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN),
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := &protoregistry.Files{}
+	if err := files.RegisterFile(fd); err != nil {
+		t.Fatal(err)
+	}
+
+	for method, want := range map[string]descriptorpb.MethodOptions_IdempotencyLevel{
+		"/test.Session/Get":     descriptorpb.MethodOptions_NO_SIDE_EFFECTS,
+		"/test.Session/Del":     descriptorpb.MethodOptions_IDEMPOTENT,
+		"/test.Session/Set":     descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN,
+		"/test.Session/Missing": descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN,
+	} {
+		if got := idempotencyLevel(files, method); got != want {
+			t.Errorf("idempotencyLevel(%q) = %v, want %v", method, got, want)
+		}
+	}
+}
+
+func TestRetryableCode(t *testing.T) {
+	for code, want := range map[codes.Code]bool{
+		codes.Unavailable:       true,
+		codes.DeadlineExceeded:  true,
+		codes.Aborted:           true,
+		codes.ResourceExhausted: false, // 限流时立即重试只会加重过载
+		codes.InvalidArgument:   false,
+	} {
+		if got := retryableCode(code); got != want {
+			t.Errorf("retryableCode(%v) = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"StealthIMSession/cron"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"google.golang.org/grpc/codes"
+)
+
+// sessionIDChars 会话ID前缀允许的字符（cache.ValidSessionID 另外允许签名会话ID的分隔符 '.'）
+const sessionIDChars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_-"
+
+// Validate 检查配置取值，返回所有不合法的字段
+func Validate(cfg Config) []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	validPort := func(port int) bool {
+		return port > 0 && port <= 65535
+	}
+
+	check(len(cfg.GRPCProxy.Listen) > 0 || validPort(cfg.GRPCProxy.Port), "grpc.port must be in 1..65535, got %d", cfg.GRPCProxy.Port)
+	seenAddrs := make(map[string]bool)
+	for _, addr := range cfg.GRPCProxy.Listen {
+		network, address := SplitListenAddr(addr)
+		if network == "unix" {
+			check(address != "", "grpc.listen entry %q must have a socket path", addr)
+		} else {
+			_, port, err := net.SplitHostPort(address)
+			n, _ := strconv.Atoi(port)
+			check(err == nil && validPort(n), "grpc.listen entry %q must be host:port or unix:path", addr)
+		}
+		check(!seenAddrs[addr], "grpc.listen entry %q is duplicated", addr)
+		seenAddrs[addr] = true
+	}
+	check((cfg.GRPCProxy.TLSCert == "") == (cfg.GRPCProxy.TLSKey == ""), "grpc.tls_cert and grpc.tls_key must be set together")
+	check(cfg.GRPCProxy.ClientCA == "" || cfg.GRPCProxy.TLSCert != "", "grpc.client_ca requires grpc.tls_cert")
+	check(!cfg.GRPCProxy.RequireClientCert || cfg.GRPCProxy.ClientCA != "", "grpc.require_client_cert requires grpc.client_ca")
+	for _, token := range cfg.GRPCProxy.ServiceTokens {
+		check(len(token) >= 16, "grpc.service_tokens entries must be at least 16 bytes, got %d", len(token))
+	}
+	check(len(cfg.GRPCProxy.AllowedClientSANs) == 0 || cfg.GRPCProxy.ClientCA != "", "grpc.allowed_client_sans requires grpc.client_ca")
+	check(cfg.GRPCProxy.KeepaliveMinTime >= 0, "grpc.keepalive_min_time must be >= 0, got %d", cfg.GRPCProxy.KeepaliveMinTime)
+	check(cfg.GRPCProxy.MaxConnectionIdle >= 0, "grpc.max_connection_idle must be >= 0, got %d", cfg.GRPCProxy.MaxConnectionIdle)
+	check(cfg.GRPCProxy.MaxConnectionAge >= 0, "grpc.max_connection_age must be >= 0, got %d", cfg.GRPCProxy.MaxConnectionAge)
+	check(cfg.GRPCProxy.MaxConnectionAgeGrace >= 0, "grpc.max_connection_age_grace must be >= 0, got %d", cfg.GRPCProxy.MaxConnectionAgeGrace)
+	check(cfg.GRPCProxy.KeepaliveTime >= 0, "grpc.keepalive_time must be >= 0, got %d", cfg.GRPCProxy.KeepaliveTime)
+	check(cfg.GRPCProxy.KeepaliveTimeout >= 0, "grpc.keepalive_timeout must be >= 0, got %d", cfg.GRPCProxy.KeepaliveTimeout)
+	check(cfg.GRPCProxy.MaxConnections >= 0, "grpc.max_connections must be >= 0, got %d", cfg.GRPCProxy.MaxConnections)
+	check(cfg.GRPCProxy.MaxConcurrentStreams >= 0, "grpc.max_concurrent_streams must be >= 0, got %d", cfg.GRPCProxy.MaxConcurrentStreams)
+	check(cfg.GRPCProxy.MaxRecvMsgMB >= 0, "grpc.max_recv_msg_mb must be >= 0, got %d", cfg.GRPCProxy.MaxRecvMsgMB)
+	check(cfg.GRPCProxy.MaxSendMsgMB >= 0, "grpc.max_send_msg_mb must be >= 0, got %d", cfg.GRPCProxy.MaxSendMsgMB)
+	check(cfg.GRPCProxy.DrainDelay >= 0, "grpc.drain_delay must be >= 0, got %d", cfg.GRPCProxy.DrainDelay)
+	check(cfg.GRPCProxy.ShutdownGrace >= 0, "grpc.shutdown_grace must be >= 0, got %d", cfg.GRPCProxy.ShutdownGrace)
+
+	check(cfg.DBGateway.Host != "", "dbgateway.host must not be empty")
+	check(validPort(cfg.DBGateway.Port), "dbgateway.port must be in 1..65535, got %d", cfg.DBGateway.Port)
+	primaries := 0
+	for i, ep := range cfg.DBGateway.Endpoints {
+		check(ep.Host != "", "dbgateway.endpoints[%d].host must not be empty", i)
+		check(validPort(ep.Port), "dbgateway.endpoints[%d].port must be in 1..65535, got %d", i, ep.Port)
+		check(ep.Priority >= 0, "dbgateway.endpoints[%d].priority must be >= 0, got %d", i, ep.Priority)
+		check(ep.Weight >= 0, "dbgateway.endpoints[%d].weight must be >= 0, got %d", i, ep.Weight)
+		if !ep.Replica {
+			primaries++
+		}
+	}
+	check(len(cfg.DBGateway.Endpoints) == 0 || primaries > 0, "dbgateway.endpoints must contain an endpoint with replica = false")
+	check(cfg.DBGateway.ConnNum >= 1, "dbgateway.conn_num must be >= 1, got %d", cfg.DBGateway.ConnNum)
+	check(cfg.DBGateway.Timeout > 0, "dbgateway.sql_timeout must be > 0, got %d", cfg.DBGateway.Timeout)
+	check(cfg.DBGateway.RedisTimeout > 0, "dbgateway.redis_timeout must be > 0, got %d", cfg.DBGateway.RedisTimeout)
+	check(cfg.DBGateway.RetryAttempts >= 1, "dbgateway.retry_attempts must be >= 1, got %d", cfg.DBGateway.RetryAttempts)
+	check(cfg.DBGateway.RetryBackoff >= 0, "dbgateway.retry_backoff must be >= 0, got %d", cfg.DBGateway.RetryBackoff)
+	check(cfg.DBGateway.RetryMaxBackoff >= cfg.DBGateway.RetryBackoff, "dbgateway.retry_max_backoff must be >= retry_backoff, got %d", cfg.DBGateway.RetryMaxBackoff)
+	for _, name := range cfg.DBGateway.RetryCodes {
+		check(validCode(name), "dbgateway.retry_codes: unknown gRPC code %q", name)
+	}
+	check(cfg.DBGateway.BreakerThreshold >= 0, "dbgateway.breaker_threshold must be >= 0, got %d", cfg.DBGateway.BreakerThreshold)
+	check(cfg.DBGateway.BreakerThreshold == 0 || cfg.DBGateway.BreakerCooldown > 0, "dbgateway.breaker_cooldown must be > 0 when breaker_threshold is set, got %d", cfg.DBGateway.BreakerCooldown)
+	check(cfg.DBGateway.HealthInterval >= 1, "dbgateway.health_interval must be >= 1, got %d", cfg.DBGateway.HealthInterval)
+	check(cfg.DBGateway.RedialBackoff >= 1, "dbgateway.redial_backoff must be >= 1, got %d", cfg.DBGateway.RedialBackoff)
+	check(cfg.DBGateway.RedialMaxBackoff >= cfg.DBGateway.RedialBackoff, "dbgateway.redial_max_backoff must be >= redial_backoff, got %d", cfg.DBGateway.RedialMaxBackoff)
+	check(slices.Contains([]string{BalanceRoundRobin, BalanceRandom, BalanceLeastOutstanding}, cfg.DBGateway.Balance),
+		"dbgateway.balance must be one of round_robin, random, least_outstanding, got %q", cfg.DBGateway.Balance)
+	check(cfg.DBGateway.BatchMaxRows >= 1, "dbgateway.batch_max_rows must be >= 1, got %d", cfg.DBGateway.BatchMaxRows)
+	check(cfg.DBGateway.BatchMaxDelay >= 0, "dbgateway.batch_max_delay must be >= 0, got %d", cfg.DBGateway.BatchMaxDelay)
+	// gRPC 要求客户端 keepalive 间隔不小于 10 秒
+	check(cfg.DBGateway.KeepaliveTime == 0 || cfg.DBGateway.KeepaliveTime >= 10, "dbgateway.keepalive_time must be 0 or >= 10, got %d", cfg.DBGateway.KeepaliveTime)
+	check(cfg.DBGateway.KeepaliveTimeout >= 1, "dbgateway.keepalive_timeout must be >= 1, got %d", cfg.DBGateway.KeepaliveTimeout)
+	check(cfg.DBGateway.MaxRecvMsgMB >= 1, "dbgateway.max_recv_msg_mb must be >= 1, got %d", cfg.DBGateway.MaxRecvMsgMB)
+	check(cfg.DBGateway.MaxSendMsgMB >= 1, "dbgateway.max_send_msg_mb must be >= 1, got %d", cfg.DBGateway.MaxSendMsgMB)
+	check(cfg.DBGateway.ConnectBackoff >= 1, "dbgateway.connect_backoff must be >= 1, got %d", cfg.DBGateway.ConnectBackoff)
+	check(cfg.DBGateway.ConnectMaxBackoff >= cfg.DBGateway.ConnectBackoff, "dbgateway.connect_max_backoff must be >= connect_backoff, got %d", cfg.DBGateway.ConnectMaxBackoff)
+	check(cfg.DBGateway.ConnectTimeout >= 1, "dbgateway.connect_timeout must be >= 1, got %d", cfg.DBGateway.ConnectTimeout)
+	check(cfg.DBGateway.RedisBudget >= 0 && cfg.DBGateway.RedisBudget < 100, "dbgateway.redis_budget must be in 0..99, got %d", cfg.DBGateway.RedisBudget)
+
+	check(cfg.Cache.MemTimeout > 0, "cache.mem_timeout must be > 0, got %d", cfg.Cache.MemTimeout)
+	check(cfg.Cache.MemMaxsize > 0, "cache.mem_maxsize must be > 0, got %d", cfg.Cache.MemMaxsize)
+	check(cfg.Cache.MaxMemoryMB >= 0, "cache.max_memory_mb must be >= 0, got %d", cfg.Cache.MaxMemoryMB)
+	check(cfg.Cache.MemCleantime > 0, "cache.mem_cleantime must be > 0, got %d", cfg.Cache.MemCleantime)
+	check(cfg.Cache.CoalesceWindow >= 0, "cache.coalesce_window must be >= 0, got %d", cfg.Cache.CoalesceWindow)
+	check(cfg.Cache.ListCacheTTL >= 0, "cache.list_cache_ttl must be >= 0, got %d", cfg.Cache.ListCacheTTL)
+	check(cfg.Cache.AttrCacheTTL >= 0, "cache.attr_cache_ttl must be >= 0, got %d", cfg.Cache.AttrCacheTTL)
+	check(cfg.Cache.Shards >= 1 && cfg.Cache.Shards <= cfg.Cache.MemMaxsize, "cache.shards must be in 1..mem_maxsize, got %d", cfg.Cache.Shards)
+	check(cfg.Cache.MemoryLimit >= 0, "cache.memory_limit must be >= 0, got %d", cfg.Cache.MemoryLimit)
+	check(cfg.Cache.PressureThreshold >= 0 && cfg.Cache.PressureThreshold <= 100, "cache.pressure_threshold must be in 0..100, got %d", cfg.Cache.PressureThreshold)
+	check(cfg.Cache.PressureThreshold == 0 || cfg.Cache.PressureInterval > 0, "cache.pressure_interval must be > 0 when pressure_threshold is set, got %d", cfg.Cache.PressureInterval)
+	check(cfg.Cache.RedisTTL > 0, "cache.redis_ttl must be > 0, got %d", cfg.Cache.RedisTTL)
+	check(cfg.Cache.ExpireJitter >= 0 && cfg.Cache.ExpireJitter <= 50, "cache.expire_jitter must be in 0..50, got %d", cfg.Cache.ExpireJitter)
+	check(cfg.Cache.NegativeTTL > 0, "cache.negative_ttl must be > 0, got %d", cfg.Cache.NegativeTTL)
+	check(cfg.Cache.RedisMigrationInterval >= 0, "cache.redis_migration_interval must be >= 0, got %d", cfg.Cache.RedisMigrationInterval)
+	check(cfg.Cache.RedisMigrationBatch >= 1, "cache.redis_migration_batch must be >= 1, got %d", cfg.Cache.RedisMigrationBatch)
+	check(cfg.Cache.Warmup >= 0, "cache.warmup must be >= 0, got %d", cfg.Cache.Warmup)
+	check(cfg.Cache.Warmup == 0 || cfg.Cache.WarmupTimeout > 0, "cache.warmup_timeout must be > 0 when warmup is set, got %d", cfg.Cache.WarmupTimeout)
+	check(!cfg.Cache.KnownFilter || cfg.Cache.KnownFilterCapacity >= 1, "cache.known_filter_capacity must be >= 1, got %d", cfg.Cache.KnownFilterCapacity)
+	check(!cfg.Cache.KnownFilter || (cfg.Cache.KnownFilterFPRate > 0 && cfg.Cache.KnownFilterFPRate < 1), "cache.known_filter_fp_rate must be in (0, 1), got %v", cfg.Cache.KnownFilterFPRate)
+	check(!cfg.Cache.KnownFilter || cfg.Cache.KnownFilterRebuild >= 1, "cache.known_filter_rebuild must be >= 1, got %d", cfg.Cache.KnownFilterRebuild)
+	check(!cfg.Cache.KnownFilter || cfg.Cache.KnownFilterBatch >= 1, "cache.known_filter_batch must be >= 1, got %d", cfg.Cache.KnownFilterBatch)
+	check(cfg.Cache.Admission == "none" || cfg.Cache.Admission == "tinylfu", "cache.admission must be \"none\" or \"tinylfu\", got %q", cfg.Cache.Admission)
+	check(cfg.Cache.EvictionPolicy == "lru" || cfg.Cache.EvictionPolicy == "random", "cache.eviction_policy must be \"lru\" or \"random\", got %q", cfg.Cache.EvictionPolicy)
+
+	check(cfg.Session.ExpireHours > 0, "session.expire_hours must be > 0, got %d", cfg.Session.ExpireHours)
+	check(cfg.Session.CleanInterval > 0, "session.clean_interval must be > 0, got %d", cfg.Session.CleanInterval)
+	if cfg.Session.CleanCron != "" {
+		_, err := cron.Parse(cfg.Session.CleanCron)
+		check(err == nil, "session.clean_cron: %v", err)
+	}
+	check(cfg.Metrics.CounterFlushInterval >= 0, "metrics.counter_flush_interval must be >= 0, got %d", cfg.Metrics.CounterFlushInterval)
+	check(cfg.Session.CleanBatch >= 1, "session.clean_batch must be >= 1, got %d", cfg.Session.CleanBatch)
+	check(cfg.Session.CleanPause >= 0, "session.clean_pause must be >= 0, got %d", cfg.Session.CleanPause)
+	check(cfg.Session.TouchInterval >= 0, "session.touch_interval must be >= 0, got %d", cfg.Session.TouchInterval)
+	check(cfg.Session.IdleTimeoutMinutes >= 0, "session.idle_timeout_minutes must be >= 0, got %d", cfg.Session.IdleTimeoutMinutes)
+	check(cfg.Session.IdleTimeoutMinutes == 0 || cfg.Session.TouchInterval < cfg.Session.IdleTimeoutMinutes*60,
+		"session.touch_interval must be shorter than session.idle_timeout_minutes, got %d s", cfg.Session.TouchInterval)
+	check(len(cfg.Session.Audience) <= 64, "session.audience must be at most 64 bytes, got %d", len(cfg.Session.Audience))
+	check(!cfg.Events.Enable || cfg.Events.Buffer >= 1, "events.buffer must be >= 1 when events are enabled, got %d", cfg.Events.Buffer)
+	check(!cfg.Events.Enable || !cfg.Invalidation.Enable || cfg.Events.Channel != "", "events.channel must not be empty when events and invalidation are enabled")
+	check(cfg.Events.Channel == "" || cfg.Events.Channel != cfg.Invalidation.Channel, "events.channel must differ from invalidation.channel")
+	check(cfg.Audit.Sink == "" || slices.Contains([]string{AuditFile, AuditDB, AuditStream}, cfg.Audit.Sink), "audit.sink must be one of file, db, stream or empty, got %q", cfg.Audit.Sink)
+	check(cfg.Audit.Sink != AuditFile || cfg.Audit.File != "", "audit.file must not be empty when audit.sink = file")
+	check(cfg.Audit.Sink != AuditStream || cfg.Invalidation.Enable, "audit.sink = stream requires invalidation.enable")
+	check(cfg.Audit.Sink != AuditStream || cfg.Audit.Channel != "", "audit.channel must not be empty when audit.sink = stream")
+	check(cfg.Audit.Sink != AuditStream || (cfg.Audit.Channel != cfg.Invalidation.Channel && cfg.Audit.Channel != cfg.Events.Channel), "audit.channel must differ from invalidation.channel and events.channel")
+	check(cfg.Audit.Buffer >= 1, "audit.buffer must be >= 1, got %d", cfg.Audit.Buffer)
+	check(cfg.Publisher.Kind == "" || cfg.Publisher.Kind == PublisherNATS || cfg.Publisher.Kind == PublisherKafkaREST, "publisher.kind must be \"nats\", \"kafka_rest\" or empty, got %q", cfg.Publisher.Kind)
+	check(cfg.Publisher.Kind == "" || cfg.Publisher.URL != "", "publisher.url must not be empty when publisher.kind is set")
+	check(cfg.Publisher.Kind == "" || cfg.Publisher.SubjectPrefix != "", "publisher.subject_prefix must not be empty when publisher.kind is set")
+	check(cfg.Publisher.Buffer >= 1, "publisher.buffer must be >= 1, got %d", cfg.Publisher.Buffer)
+	check(cfg.Publisher.Batch >= 1, "publisher.batch must be >= 1, got %d", cfg.Publisher.Batch)
+	check(cfg.Publisher.Timeout > 0, "publisher.timeout must be > 0, got %d", cfg.Publisher.Timeout)
+	check(cfg.Publisher.RetryBackoff >= 1, "publisher.retry_backoff must be >= 1, got %d", cfg.Publisher.RetryBackoff)
+	check(cfg.Publisher.RetryMaxBackoff >= cfg.Publisher.RetryBackoff, "publisher.retry_max_backoff must be >= retry_backoff, got %d", cfg.Publisher.RetryMaxBackoff)
+	check(cfg.Reload.Debounce >= 0, "reload.debounce must be >= 0, got %d", cfg.Reload.Debounce)
+	check(cfg.Session.MaxSessionsPerUser >= 0, "session.max_sessions_per_user must be >= 0, got %d", cfg.Session.MaxSessionsPerUser)
+	check(cfg.Session.MaxAttrs >= 1, "session.max_attrs must be >= 1, got %d", cfg.Session.MaxAttrs)
+	check(cfg.Session.MaxAttrBytes >= 1 && cfg.Session.MaxAttrBytes <= 65535, "session.max_attr_bytes must be in 1..65535, got %d", cfg.Session.MaxAttrBytes)
+	check(!cfg.Session.WriteBehind || cfg.Session.WriteBehindBatch > 0, "session.write_behind_batch must be > 0, got %d", cfg.Session.WriteBehindBatch)
+	check(!cfg.Session.WriteBehind || cfg.Session.WriteBehindInterval > 0, "session.write_behind_interval must be > 0, got %d", cfg.Session.WriteBehindInterval)
+	check(!cfg.Session.WriteBehind || cfg.Session.WriteBehindQueue >= cfg.Session.WriteBehindBatch, "session.write_behind_queue must be >= write_behind_batch, got %d", cfg.Session.WriteBehindQueue)
+	check(cfg.Session.FreezeSyncInterval > 0, "session.freeze_sync_interval must be > 0, got %d", cfg.Session.FreezeSyncInterval)
+	check(len(cfg.Session.IDPrefix) <= 16, "session.id_prefix must be at most 16 bytes, got %d", len(cfg.Session.IDPrefix))
+	check(strings.Trim(cfg.Session.IDPrefix, sessionIDChars) == "", "session.id_prefix may only contain letters, digits, '_' and '-', got %q", cfg.Session.IDPrefix)
+	idEncodings := []string{IDEncodingHex, IDEncodingBase62, IDEncodingBase64URL}
+	check(slices.Contains(idEncodings, cfg.Session.IDEncoding), "session.id_encoding must be one of hex, base62, base64url, got %q", cfg.Session.IDEncoding)
+	check(cfg.Session.IDBytes >= 16 && cfg.Session.IDBytes <= 24, "session.id_bytes must be in 16..24, got %d", cfg.Session.IDBytes)
+	check(cfg.Session.PreviousIDEncoding == "" || slices.Contains(idEncodings, cfg.Session.PreviousIDEncoding),
+		"session.previous_id_encoding must be one of hex, base62, base64url or empty, got %q", cfg.Session.PreviousIDEncoding)
+	check(cfg.Session.PreviousIDEncoding == "" || cfg.Session.PreviousIDBytes >= 16 && cfg.Session.PreviousIDBytes <= 24,
+		"session.previous_id_bytes must be in 16..24, got %d", cfg.Session.PreviousIDBytes)
+	check(len(cfg.Session.AcceptedPrefixes) == 0 || slices.Contains(cfg.Session.AcceptedPrefixes, cfg.Session.IDPrefix),
+		"session.accepted_prefixes must contain session.id_prefix %q", cfg.Session.IDPrefix)
+	check(cfg.Session.SigningKey == "" || len(cfg.Session.SigningKey) >= 32, "session.signing_key must be at least 32 bytes, got %d", len(cfg.Session.SigningKey))
+	check(cfg.Session.PreviousSigningKey == "" || cfg.Session.SigningKey != "", "session.previous_signing_key requires session.signing_key")
+
+	check(!cfg.Refresh.Enable || cfg.Refresh.AccessTTL > 0, "refresh.access_ttl must be > 0, got %d", cfg.Refresh.AccessTTL)
+	check(!cfg.Refresh.Enable || cfg.Refresh.ExpireHours > 0, "refresh.expire_hours must be > 0, got %d", cfg.Refresh.ExpireHours)
+
+	check(cfg.Journal.AnonymizeDays >= 0, "journal.anonymize_days must be >= 0, got %d", cfg.Journal.AnonymizeDays)
+	check(cfg.Journal.AnonymizeDays == 0 || cfg.Journal.AnonymizeInterval > 0, "journal.anonymize_interval must be > 0 when anonymize_days is set, got %d", cfg.Journal.AnonymizeInterval)
+	check(cfg.Journal.RetainDeletedDays >= 0, "journal.retain_deleted_days must be >= 0, got %d", cfg.Journal.RetainDeletedDays)
+
+	check(!cfg.HTTP.Enable || validPort(cfg.HTTP.Port), "http.port must be in 1..65535, got %d", cfg.HTTP.Port)
+	check(!cfg.HTTP.Enable || !cfg.Metrics.Enable || cfg.HTTP.Host != cfg.Metrics.Host || cfg.HTTP.Port != cfg.Metrics.Port, "http.port must differ from metrics.port")
+	check(!cfg.HTTP.Enable || len(cfg.GRPCProxy.Listen) > 0 || cfg.HTTP.Host != cfg.GRPCProxy.Host || cfg.HTTP.Port != cfg.GRPCProxy.Port, "http.port must differ from grpc.port")
+	check(!cfg.Admin.Enable || cfg.Admin.Port == 0 || validPort(cfg.Admin.Port), "admin.port must be 0 or in 1..65535, got %d", cfg.Admin.Port)
+	check(!cfg.Admin.Enable || cfg.Admin.Port == 0 || len(cfg.GRPCProxy.Listen) > 0 || cfg.Admin.Host != cfg.GRPCProxy.Host || cfg.Admin.Port != cfg.GRPCProxy.Port, "admin.port must differ from grpc.port, use 0 to share it")
+	check(!cfg.Admin.Enable || cfg.Admin.Port == 0 || !cfg.HTTP.Enable || cfg.Admin.Host != cfg.HTTP.Host || cfg.Admin.Port != cfg.HTTP.Port, "admin.port must differ from http.port")
+	check(!cfg.Admin.Enable || cfg.Admin.Port == 0 || !cfg.Metrics.Enable || cfg.Admin.Host != cfg.Metrics.Host || cfg.Admin.Port != cfg.Metrics.Port, "admin.port must differ from metrics.port")
+	check(cfg.RateLimit.GlobalQPS >= 0 && cfg.RateLimit.GlobalBurst >= 0, "ratelimit.global_qps and global_burst must be >= 0, got %d and %d", cfg.RateLimit.GlobalQPS, cfg.RateLimit.GlobalBurst)
+	check(cfg.RateLimit.CallerQPS >= 0 && cfg.RateLimit.CallerBurst >= 0, "ratelimit.caller_qps and caller_burst must be >= 0, got %d and %d", cfg.RateLimit.CallerQPS, cfg.RateLimit.CallerBurst)
+	check(cfg.RateLimit.SetPerUID >= 0 && cfg.RateLimit.SetPerUIDBurst >= 0, "ratelimit.set_per_uid and set_per_uid_burst must be >= 0, got %d and %d", cfg.RateLimit.SetPerUID, cfg.RateLimit.SetPerUIDBurst)
+	check(cfg.Startup.WaitBackends >= 0, "startup.wait_backends must be >= 0, got %d", cfg.Startup.WaitBackends)
+	check(!cfg.Startup.RequireBackends || cfg.Startup.WaitBackends > 0, "startup.require_backends requires startup.wait_backends > 0")
+	check(!cfg.Metrics.Enable || validPort(cfg.Metrics.Port), "metrics.port must be in 1..65535, got %d", cfg.Metrics.Port)
+	check(cfg.Metrics.SessionCountInterval >= 0, "metrics.session_count_interval must be >= 0, got %d", cfg.Metrics.SessionCountInterval)
+	check(cfg.Metrics.SessionCountFrom >= 0 && cfg.Metrics.SessionCountFrom < 24, "metrics.session_count_from must be in 0..23, got %d", cfg.Metrics.SessionCountFrom)
+	check(cfg.Metrics.SessionCountTo >= 1 && cfg.Metrics.SessionCountTo <= 24, "metrics.session_count_to must be in 1..24, got %d", cfg.Metrics.SessionCountTo)
+
+	check(slices.Contains([]string{"debug", "info", "warn", "error"}, cfg.Log.Level), "log.level must be one of debug, info, warn, error, got %q", cfg.Log.Level)
+	check(cfg.Log.Format == "text" || cfg.Log.Format == "json", "log.format must be \"text\" or \"json\", got %q", cfg.Log.Format)
+
+	check(!cfg.Tracing.Enable || cfg.Tracing.Endpoint != "", "tracing.endpoint must not be empty when tracing is enabled")
+	check(!cfg.Tracing.Enable || cfg.Tracing.ServiceName != "", "tracing.service_name must not be empty when tracing is enabled")
+	check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be in 0..1, got %v", cfg.Tracing.SampleRatio)
+
+	check(cfg.Scheduler.History >= 1, "scheduler.history must be >= 1, got %d", cfg.Scheduler.History)
+	check(cfg.Scheduler.FailureAlert >= 0, "scheduler.failure_alert must be >= 0, got %d", cfg.Scheduler.FailureAlert)
+
+	check(!cfg.Invalidation.Enable || cfg.Invalidation.RedisAddr != "", "invalidation.redis_addr must not be empty when invalidation is enabled")
+	check(!cfg.Invalidation.Enable || cfg.Invalidation.Channel != "", "invalidation.channel must not be empty when invalidation is enabled")
+	check(!cfg.Invalidation.Enable || cfg.Invalidation.Buffer >= 1, "invalidation.buffer must be >= 1 when invalidation is enabled, got %d", cfg.Invalidation.Buffer)
+
+	storageModes := []string{StorageDBGateway, StorageDirect}
+	check(slices.Contains(storageModes, cfg.Storage.MySQL), "storage.mysql must be \"dbgateway\" or \"direct\", got %q", cfg.Storage.MySQL)
+	check(slices.Contains(storageModes, cfg.Storage.Redis), "storage.redis must be \"dbgateway\" or \"direct\", got %q", cfg.Storage.Redis)
+	check(cfg.Storage.MySQL != StorageDirect || cfg.Storage.MySQLDSN != "", "storage.mysql_dsn must not be empty when storage.mysql is \"direct\"")
+	check(cfg.Storage.MySQLMaxConns >= 1, "storage.mysql_max_conns must be >= 1, got %d", cfg.Storage.MySQLMaxConns)
+	check(cfg.Storage.Redis != StorageDirect || cfg.Storage.RedisAddr != "", "storage.redis_addr must not be empty when storage.redis is \"direct\"")
+	check(cfg.Storage.RedisDB >= 0, "storage.redis_db must be >= 0, got %d", cfg.Storage.RedisDB)
+	check(cfg.Storage.RedisMaxIdle >= 0, "storage.redis_max_idle must be >= 0, got %d", cfg.Storage.RedisMaxIdle)
+
+	check(cfg.Privacy.ResolverToken == "" || cfg.Privacy.UIDHMACKey != "", "privacy.resolver_token is set but privacy.uid_hmac_key is empty")
+
+	return errs
+}
+
+// RunCheck 执行 config check 子命令，返回进程退出码
+// 校验配置文件（含未知字段），并输出合并默认值后的生效配置，密钥、密码与令牌隐去（见 Redacted）
+func RunCheck(args []string) int {
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	path := fs.String("config", "config.toml", "配置文件位置")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := load(*path, true)
+	if err != nil {
+		var strictErr *toml.StrictMissingError
+		var decodeErr *toml.DecodeError
+		switch {
+		case errors.As(err, &strictErr):
+			fmt.Fprintf(os.Stderr, "%s: unknown fields:\n%s\n", *path, strictErr.String())
+		case errors.As(err, &decodeErr):
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *path, decodeErr.String())
+		default:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *path, err)
+		}
+		return 1
+	}
+
+	errs := Validate(cfg)
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *path, e)
+	}
+
+	out, err := toml.Marshal(Redacted(cfg))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshalling effective config: %v\n", err)
+		return 1
+	}
+	fmt.Printf("# Effective config for %s\n%s", *path, out)
+
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// validCode 判断是否为 gRPC 状态码名称（如 "Unavailable"）
+func validCode(name string) bool {
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c.String() == name {
+			return true
+		}
+	}
+	return false
+}
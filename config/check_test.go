@@ -0,0 +1,93 @@
+package config
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if errs := Validate(Default()); len(errs) > 0 {
+		t.Fatalf("embedded defaults are invalid: %v", errs)
+	}
+}
+
+func TestValidateListsAllViolations(t *testing.T) {
+	cfg := Default()
+	cfg.Cache.MemCleantime = 0
+	cfg.DBGateway.Timeout = 0
+	cfg.GRPCProxy.Port = -1
+	cfg.Session.CleanCron = "0 25 * * *"
+
+	errs := Validate(cfg)
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	all := strings.Join(msgs, "\n")
+	for _, field := range []string{"cache.mem_cleantime", "dbgateway.sql_timeout", "grpc.port", "session.clean_cron"} {
+		if !strings.Contains(all, field) {
+			t.Errorf("violation for %s not reported:\n%s", field, all)
+		}
+	}
+	if len(errs) != 4 {
+		t.Fatalf("got %d violations, want 4:\n%s", len(errs), all)
+	}
+}
+
+func TestValidateListen(t *testing.T) {
+	cfg := Default()
+	cfg.GRPCProxy.Port = 0
+	cfg.GRPCProxy.Listen = []string{"0.0.0.0:50054", "unix:/run/session.sock", "[::1]:50055"}
+	if errs := Validate(cfg); len(errs) != 0 {
+		t.Fatalf("Validate() = %v, want no errors", errs)
+	}
+	if got := cfg.GRPCProxy.Addrs(); len(got) != 3 || got[1] != "unix:/run/session.sock" {
+		t.Fatalf("Addrs() = %v", got)
+	}
+	if network, address := SplitListenAddr("unix:/run/session.sock"); network != "unix" || address != "/run/session.sock" {
+		t.Fatalf("SplitListenAddr() = %s %s", network, address)
+	}
+
+	cfg.GRPCProxy.Listen = []string{"0.0.0.0", "unix:", "127.0.0.1:70000", "127.0.0.1:50054", "127.0.0.1:50054"}
+	if errs := Validate(cfg); len(errs) != 4 {
+		t.Fatalf("Validate() = %v, want 4 errors", errs)
+	}
+
+	cfg.GRPCProxy.Listen = nil
+	if got := cfg.GRPCProxy.Addrs(); len(got) != 1 || got[0] != net.JoinHostPort(cfg.GRPCProxy.Host, "0") {
+		t.Fatalf("Addrs() without listen = %v", got)
+	}
+}
+
+func TestRunCheckRedacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[http]\ntoken = \"http-secret-token\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		output <- out
+	}()
+	stdout := os.Stdout
+	os.Stdout = w
+	code := RunCheck([]string{"--config=" + path})
+	os.Stdout = stdout
+	w.Close()
+	out := <-output
+
+	if code != 0 {
+		t.Fatalf("RunCheck() = %d, want 0", code)
+	}
+	if strings.Contains(string(out), "http-secret-token") || !strings.Contains(string(out), redacted) {
+		t.Fatalf("effective config not redacted:\n%s", out)
+	}
+}
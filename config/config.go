@@ -1,52 +1,63 @@
 package config
 
 import (
+	"StealthIMSession/logging"
+	"errors"
 	"flag"
-	"log"
-	"os"
-
-	"github.com/pelletier/go-toml/v2"
 )
 
-// Version 版本号
-const Version = "0.0.1"
+var logger = logging.For("config")
 
 var cfgPath = "config.toml"
 
 var LatestConfig = &Config{}
 
-// ReadConf 读取配置
+// Path 返回配置文件路径
+func Path() string {
+	return cfgPath
+}
+
+// ReadConf 读取配置，文件无法解析或取值不合法时退出
 func ReadConf() Config {
 	flag.StringVar(&cfgPath, "config", "config.toml", "配置文件位置")
 	flag.Parse()
 	initCfg()
-	data, err := os.ReadFile(cfgPath)
+	config, err := load(cfgPath, false)
 	if err != nil {
-		log.Fatalf("Error reading config file: %v\n", err)
+		logging.Fatal(logger, "error reading config file", "path", cfgPath, "error", err)
 	}
-	var config Config
-	err = toml.Unmarshal(data, &config)
-	if err != nil {
-		log.Fatalf("Error unmarshalling config file: %v\n", err)
+	// 在任何子系统启动前拒绝不合法的取值，一次列出全部问题
+	if errs := Validate(config); len(errs) > 0 {
+		for _, e := range errs {
+			logger.Error("invalid config value", "path", cfgPath, "error", e)
+		}
+		logging.Fatal(logger, "refusing to start with invalid config, see `config check`", "path", cfgPath, "violations", len(errs))
 	}
-	LatestConfig = &config
+	use(&config)
 	return config
 }
 
 // ReloadConf 重新加载配置
-func ReloadConf() {
-	log.Printf("[Config] Reloading configuration from %s...", cfgPath)
-	data, err := os.ReadFile(cfgPath)
-	if err != nil {
-		log.Printf("[Config] Error reading config file: %v\n", err)
-		return
+// 文件无法解析或取值不合法时保留当前配置并返回错误
+func ReloadConf() error {
+	logger.Info("reloading configuration", "path", cfgPath)
+	config, err := load(cfgPath, false)
+	if err == nil {
+		err = errors.Join(Validate(config)...)
 	}
-	var config Config
-	err = toml.Unmarshal(data, &config)
 	if err != nil {
-		log.Printf("[Config] Error unmarshalling config file: %v\n", err)
-		return
+		logger.Error("configuration rejected, keeping current", "path", cfgPath, "error", err)
+		return err
+	}
+	use(&config)
+	logger.Info("configuration reloaded", "digest", Digest(config))
+	return nil
+}
+
+// use 设为当前配置并应用日志设置
+func use(cfg *Config) {
+	LatestConfig = cfg
+	if err := logging.Init(cfg.Log.Level, cfg.Log.Format); err != nil {
+		logger.Error("invalid log settings", "error", err)
 	}
-	LatestConfig = &config
-	log.Printf("[Config] Configuration reloaded successfully")
 }
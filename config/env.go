@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// envPrefix 覆盖配置的环境变量前缀，STIMSESSION_<段>_<字段> 覆盖对应字段，如 STIMSESSION_GRPC_PORT 覆盖 [grpc] port
+const envPrefix = "STIMSESSION_"
+
+// envOverride 一个可由环境变量覆盖的字段
+type envOverride struct {
+	name  string // 环境变量名
+	field string // 配置字段，如 grpc.port
+	value reflect.Value
+}
+
+// envOverrides 列出 cfg 中所有可覆盖的字段
+func envOverrides(cfg *Config) []envOverride {
+	var list []envOverride
+	root := reflect.ValueOf(cfg).Elem()
+	for i := range root.NumField() {
+		section := root.Type().Field(i).Tag.Get("toml")
+		sv := root.Field(i)
+		for j := range sv.NumField() {
+			key := sv.Type().Field(j).Tag.Get("toml")
+			list = append(list, envOverride{
+				name:  envPrefix + strings.ToUpper(section+"_"+key),
+				field: section + "." + key,
+				value: sv.Field(j),
+			})
+		}
+	}
+	return list
+}
+
+// applyEnv 用环境变量覆盖配置，返回被覆盖的字段
+// 列表字段以逗号分隔，无法解析的值返回错误（一次列出全部）
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) ([]string, error) {
+	var applied []string
+	var errs []error
+	for _, o := range envOverrides(cfg) {
+		raw, ok := lookup(o.name)
+		if !ok {
+			continue
+		}
+		if err := setValue(o.value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", o.name, err))
+			continue
+		}
+		applied = append(applied, o.field)
+	}
+	return applied, errors.Join(errs...)
+}
+
+// setValue 将字符串解析为字段的类型并写入
+func setValue(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		list := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		switch v.Type().Elem() {
+		case reflect.TypeFor[string]():
+			v.Set(reflect.ValueOf(list))
+		case reflect.TypeFor[DBGatewayEndpoint]():
+			eps := []DBGatewayEndpoint{}
+			for _, item := range list {
+				ep, err := parseEndpoint(item)
+				if err != nil {
+					return err
+				}
+				eps = append(eps, ep)
+			}
+			v.Set(reflect.ValueOf(eps))
+		default:
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// parseEndpoint 解析环境变量中的 DBGateway 端点：host:port，之后可跟以 ; 分隔的 priority=N、weight=N 与 replica
+func parseEndpoint(raw string) (DBGatewayEndpoint, error) {
+	parts := strings.Split(raw, ";")
+	host, port, err := net.SplitHostPort(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return DBGatewayEndpoint{}, fmt.Errorf("invalid endpoint %q", raw)
+	}
+	ep := DBGatewayEndpoint{Host: host}
+	if ep.Port, err = strconv.Atoi(port); err != nil {
+		return DBGatewayEndpoint{}, fmt.Errorf("invalid endpoint %q", raw)
+	}
+	for _, opt := range parts[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch key {
+		case "priority":
+			ep.Priority, err = strconv.Atoi(val)
+		case "weight":
+			ep.Weight, err = strconv.Atoi(val)
+		case "replica":
+			ep.Replica = true
+		default:
+			err = errors.New("unknown option")
+		}
+		if err != nil {
+			return DBGatewayEndpoint{}, fmt.Errorf("invalid endpoint %q", raw)
+		}
+	}
+	return ep, nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"STIMSESSION_DBGATEWAY_HOST":        "dbgateway.prod",
+		"STIMSESSION_GRPC_PORT":             " 50100 ",
+		"STIMSESSION_DBGATEWAY_CONN_NUM":    "8",
+		"STIMSESSION_METRICS_ENABLE":        "true",
+		"STIMSESSION_TRACING_SAMPLE_RATIO":  "0.5",
+		"STIMSESSION_DBGATEWAY_RETRY_CODES": "Unavailable, Aborted,",
+		"STIMSESSION_DISABLE_CLEANER":       "1",
+	}
+	cfg := Default()
+	applied, err := applyEnv(&cfg, func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(applied)
+	want := []string{"dbgateway.conn_num", "dbgateway.host", "dbgateway.retry_codes", "grpc.port", "metrics.enable", "tracing.sample_ratio"}
+	if !slices.Equal(applied, want) {
+		t.Fatalf("applied = %v, want %v", applied, want)
+	}
+	if cfg.DBGateway.Host != "dbgateway.prod" || cfg.GRPCProxy.Port != 50100 || cfg.DBGateway.ConnNum != 8 ||
+		!cfg.Metrics.Enable || cfg.Tracing.SampleRatio != 0.5 ||
+		!slices.Equal(cfg.DBGateway.RetryCodes, []string{"Unavailable", "Aborted"}) {
+		t.Fatalf("config = %+v", cfg)
+	}
+}
+
+func TestApplyEnvRejectsBadValues(t *testing.T) {
+	env := map[string]string{
+		"STIMSESSION_GRPC_PORT":      "fifty",
+		"STIMSESSION_METRICS_ENABLE": "maybe",
+	}
+	cfg := Default()
+	_, err := applyEnv(&cfg, func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	if err == nil || !strings.Contains(err.Error(), "STIMSESSION_GRPC_PORT") || !strings.Contains(err.Error(), "STIMSESSION_METRICS_ENABLE") {
+		t.Fatalf("applyEnv() = %v, want errors for both variables", err)
+	}
+}
+
+func TestEnvNamesAreUnique(t *testing.T) {
+	cfg := Default()
+	seen := make(map[string]string)
+	for _, o := range envOverrides(&cfg) {
+		if prev, ok := seen[o.name]; ok {
+			t.Fatalf("%s maps to both %s and %s", o.name, prev, o.field)
+		}
+		seen[o.name] = o.field
+		// 所有字段类型都能从环境变量解析
+		if err := setValue(o.value, ""); err != nil && strings.Contains(err.Error(), "unsupported") {
+			t.Fatalf("%s: %v", o.field, err)
+		}
+	}
+}
+
+func TestApplyEnvEndpoints(t *testing.T) {
+	cfg := Default()
+	_, err := applyEnv(&cfg, func(name string) (string, bool) {
+		if name == "STIMSESSION_DBGATEWAY_ENDPOINTS" {
+			return "10.0.1.10:50051;weight=2, 10.0.2.10:50051;priority=1, [::1]:50052;replica", true
+		}
+		return "", false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DBGatewayEndpoint{
+		{Host: "10.0.1.10", Port: 50051, Weight: 2},
+		{Host: "10.0.2.10", Port: 50051, Priority: 1},
+		{Host: "::1", Port: 50052, Replica: true},
+	}
+	if !slices.Equal(cfg.DBGateway.Endpoints, want) {
+		t.Fatalf("endpoints = %+v", cfg.DBGateway.Endpoints)
+	}
+
+	for _, raw := range []string{"10.0.1.10", "10.0.1.10:x", "10.0.1.10:50051;weight=x", "10.0.1.10:50051;zone=a"} {
+		if _, err := parseEndpoint(raw); err == nil {
+			t.Errorf("parseEndpoint(%q) succeeded", raw)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Addrs 返回会话服务的监听地址，未配置 listen 时为 host:port
+func (c GRPCProxyConfig) Addrs() []string {
+	if len(c.Listen) > 0 {
+		return c.Listen
+	}
+	return []string{net.JoinHostPort(c.Host, strconv.Itoa(c.Port))}
+}
+
+// unixPrefix 监听地址中 Unix 域套接字的前缀
+const unixPrefix = "unix:"
+
+// SplitListenAddr 将监听地址拆分为 net.Listen 的网络类型与地址：unix:路径 为 Unix 域套接字，其余为 TCP
+func SplitListenAddr(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		return "unix", path
+	}
+	return "tcp", addr
+}
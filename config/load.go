@@ -0,0 +1,56 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Default 返回默认配置（即内置的配置模板）
+func Default() Config {
+	var cfg Config
+	if err := toml.Unmarshal([]byte(defaultConfig), &cfg); err != nil {
+		panic("invalid embedded config.sample.toml: " + err.Error())
+	}
+	return cfg
+}
+
+// load 读取配置文件并覆盖到默认配置上，未填写的字段使用默认值，再应用环境变量覆盖（见 env.go）
+// strict 为 true 时未知字段视为错误
+func load(path string, strict bool) (Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	decoder := toml.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&cfg); err != nil {
+		return cfg, err
+	}
+	applied, err := applyEnv(&cfg, os.LookupEnv)
+	if len(applied) > 0 {
+		// 只记录字段名，值可能是密钥
+		logger.Info("config overridden by environment", "fields", strings.Join(applied, ","))
+	}
+	return cfg, err
+}
+
+// UseFile 读取并校验指定配置文件作为当前配置，用于不经过 ReadConf 的子命令
+func UseFile(path string) error {
+	cfg, err := load(path, false)
+	if err == nil {
+		err = errors.Join(Validate(cfg)...)
+	}
+	if err != nil {
+		return err
+	}
+	cfgPath = path
+	use(&cfg)
+	return nil
+}
@@ -6,32 +6,346 @@ type Config struct {
 	GRPCProxy GRPCProxyConfig `toml:"grpc"`
 	Cache     CacheConfig     `toml:"cache"`
 	Session   SessionConfig   `toml:"session"`
+	Journal   JournalConfig   `toml:"journal"`
+	Metrics   MetricsConfig   `toml:"metrics"`
+	Startup   StartupConfig   `toml:"startup"`
+	Privacy   PrivacyConfig   `toml:"privacy"`
+
+	Invalidation InvalidationConfig `toml:"invalidation"`
+	Scheduler    SchedulerConfig    `toml:"scheduler"`
+	Log          LogConfig          `toml:"log"`
+	Tracing      TracingConfig      `toml:"tracing"`
+	Events       EventsConfig       `toml:"events"`
+	Audit        AuditConfig        `toml:"audit"`
+	Publisher    PublisherConfig    `toml:"publisher"`
+	Reload       ReloadConfig       `toml:"reload"`
+	Storage      StorageConfig      `toml:"storage"`
+	HTTP         HTTPConfig         `toml:"http"`
+	Refresh      RefreshConfig      `toml:"refresh"`
+	Admin        AdminConfig        `toml:"admin"`
+	RateLimit    RateLimitConfig    `toml:"ratelimit"`
+}
+
+// RateLimitConfig 限流配置，速率为 0 表示不限制，容量为 0 时等于速率
+type RateLimitConfig struct {
+	GlobalQPS      int `toml:"global_qps"`        // 本实例所有请求合计每秒上限
+	GlobalBurst    int `toml:"global_burst"`      // 全局突发容量
+	CallerQPS      int `toml:"caller_qps"`        // 每个调用方（IP）每秒上限
+	CallerBurst    int `toml:"caller_burst"`      // 每个调用方的突发容量
+	SetPerUID      int `toml:"set_per_uid"`       // 每个 uid 每分钟 Set 次数上限
+	SetPerUIDBurst int `toml:"set_per_uid_burst"` // 每个 uid 的 Set 突发容量
+}
+
+// AdminConfig 管理服务配置
+type AdminConfig struct {
+	Enable bool   `toml:"enable"` // 启用 StealthIMSessionAdmin 服务
+	Host   string `toml:"host"`   // 监听地址，port 为 0 时忽略
+	Port   int    `toml:"port"`   // 监听端口，为 0 时注册在 GRPC 服务的端口上
+	Token  string `toml:"token"`  // 不为空时请求需在 metadata 中携带 authorization: Bearer <token>
+}
+
+// RefreshConfig 刷新令牌配置
+type RefreshConfig struct {
+	Enable      bool `toml:"enable"`       // 启用刷新令牌：Set 可同时签发刷新令牌，Refresh 以刷新令牌换取新的会话
+	AccessTTL   int  `toml:"access_ttl"`   // 带刷新令牌的会话的默认有效期（秒）
+	ExpireHours int  `toml:"expire_hours"` // 刷新令牌有效期（小时）
+}
+
+// HTTPConfig HTTP/JSON 接口配置
+type HTTPConfig struct {
+	Enable bool   `toml:"enable"` // 启用 HTTP/JSON 接口
+	Host   string `toml:"host"`   // 监听地址
+	Port   int    `toml:"port"`   // 监听端口
+	Token  string `toml:"token"`  // 不为空时请求需携带 Authorization: Bearer <token>
+}
+
+// StorageConfig 存储后端配置，MySQL 与 Redis 可分别经由 DBGateway 或直连
+type StorageConfig struct {
+	MySQL         string `toml:"mysql"`           // MySQL 访问方式：dbgateway 或 direct
+	MySQLDSN      string `toml:"mysql_dsn"`       // 直连 MySQL 的 DSN，如 user:pass@tcp(127.0.0.1:3306)/session
+	MySQLMaxConns int    `toml:"mysql_max_conns"` // 直连 MySQL 的最大连接数
+	Redis         string `toml:"redis"`           // Redis 访问方式：dbgateway 或 direct
+	RedisAddr     string `toml:"redis_addr"`      // 直连 Redis 的地址（host:port）
+	RedisPassword string `toml:"redis_password"`  // 直连 Redis 的密码，为空时不认证
+	RedisDB       int    `toml:"redis_db"`        // 直连 Redis 使用的库
+	RedisMaxIdle  int    `toml:"redis_max_idle"`  // 直连 Redis 保留的空闲连接数
+}
+
+// 存储后端的访问方式
+const (
+	StorageDBGateway = "dbgateway"
+	StorageDirect    = "direct"
+)
+
+// ReloadConfig 配置热重载
+type ReloadConfig struct {
+	Watch    bool `toml:"watch"`    // 监视配置文件，修改后自动重载
+	Debounce int  `toml:"debounce"` // 文件变化后等待的时间（毫秒），期间的多次变化合并为一次重载
+}
+
+// AuditConfig 会话操作审计配置
+type AuditConfig struct {
+	Sink      string `toml:"sink"`       // 审计输出：file、db 或 stream，为空时不记录
+	File      string `toml:"file"`       // sink = file 时追加写入的文件（JSON Lines）
+	Channel   string `toml:"channel"`    // sink = stream 时发布的频道（需启用 invalidation）
+	FailedGet bool   `toml:"failed_get"` // 同时记录失败的 Get
+	Buffer    int    `toml:"buffer"`     // 等待写入的记录数上限，超出时丢弃
+}
+
+// 审计输出
+const (
+	AuditFile   = "file"
+	AuditDB     = "db"
+	AuditStream = "stream"
+)
+
+// 会话ID随机部分的编码
+const (
+	IDEncodingHex       = "hex"
+	IDEncodingBase62    = "base62"
+	IDEncodingBase64URL = "base64url"
+)
+
+// PublisherConfig 会话生命周期事件发布到外部消息总线的配置
+type PublisherConfig struct {
+	Kind            string `toml:"kind"`              // 消息总线：nats 或 kafka_rest，为空时不发布
+	URL             string `toml:"url"`               // nats://[user:pass@]host:port 或 Kafka REST Proxy 的地址
+	SubjectPrefix   string `toml:"subject_prefix"`    // 主题为 <前缀>.<事件类型>，如 session.created
+	Buffer          int    `toml:"buffer"`            // 等待发布的事件数上限，超出时丢弃新事件
+	Batch           int    `toml:"batch"`             // 每次发布的最大事件数
+	Timeout         int    `toml:"timeout"`           // 单次发布的超时（ms）
+	RetryBackoff    int    `toml:"retry_backoff"`     // 发布失败后首次重试前的等待时间（ms），之后每次翻倍
+	RetryMaxBackoff int    `toml:"retry_max_backoff"` // 重试等待时间上限（ms）
+	Spool           string `toml:"spool"`             // 关闭时仍未发布的事件写入该文件，下次启动时重新发布；为空时丢弃
+}
+
+// 消息总线类型
+const (
+	PublisherNATS      = "nats"
+	PublisherKafkaREST = "kafka_rest"
+)
+
+// EventsConfig 会话生命周期事件（Watch）配置
+type EventsConfig struct {
+	Enable  bool   `toml:"enable"`  // 产生会话事件并接受 Watch 订阅
+	Buffer  int    `toml:"buffer"`  // 每个订阅的事件缓冲数，缓冲满时断开该订阅
+	Channel string `toml:"channel"` // 实例间转发事件的发布订阅频道（需启用 invalidation）
+}
+
+// TracingConfig OpenTelemetry 链路追踪配置
+type TracingConfig struct {
+	Enable      bool    `toml:"enable"`       // 导出追踪数据
+	Endpoint    string  `toml:"endpoint"`     // OTLP/gRPC 接收端地址（host:port）
+	Insecure    bool    `toml:"insecure"`     // 使用明文连接接收端
+	SampleRatio float64 `toml:"sample_ratio"` // 新链路的采样比例，调用方已采样的链路始终记录
+	ServiceName string  `toml:"service_name"` // 上报的服务名
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level  string `toml:"level"`  // 日志级别：debug、info、warn、error
+	Format string `toml:"format"` // 输出格式：text 或 json
+}
+
+// SchedulerConfig 后台任务调度配置
+type SchedulerConfig struct {
+	History      int `toml:"history"`       // 每个任务保留的执行记录条数
+	FailureAlert int `toml:"failure_alert"` // 连续失败达到该次数时告警，0 表示不告警
+}
+
+// InvalidationConfig 实例间缓存失效广播配置
+type InvalidationConfig struct {
+	Enable        bool   `toml:"enable"`         // 通过 Redis 发布订阅广播会话删除，其他实例清除内存缓存
+	RedisAddr     string `toml:"redis_addr"`     // Redis 地址（host:port）
+	RedisPassword string `toml:"redis_password"` // Redis 密码，为空时不认证
+	Channel       string `toml:"channel"`        // 发布订阅频道
+	Buffer        int    `toml:"buffer"`         // 等待发布的失效消息数上限，超出时丢弃
+}
+
+// PrivacyConfig 隐私配置
+type PrivacyConfig struct {
+	UIDHMACKey    string `toml:"uid_hmac_key"`   // 日志、指标与事件中 uid 的 HMAC 密钥，为空时不混淆
+	ResolverToken string `toml:"resolver_token"` // 反查 uid 别名所需的令牌，为空时禁止反查
+}
+
+// StartupConfig 启动配置
+type StartupConfig struct {
+	ReportFile string `toml:"report_file"` // 启动报告（JSON）输出文件，为空时只写入日志
+
+	WaitBackends    int  `toml:"wait_backends"`    // 启动 GRPC 服务前等待后端就绪的最长时间（秒），0 表示不等待
+	RequireBackends bool `toml:"require_backends"` // 等待超时后退出，而不是以 NOT_SERVING 状态启动
+}
+
+// MetricsConfig Prometheus 指标配置
+type MetricsConfig struct {
+	Enable               bool   `toml:"enable"`
+	Host                 string `toml:"host"`
+	Port                 int    `toml:"port"`
+	SessionCountInterval int    `toml:"session_count_interval"` // 会话数统计间隔（分钟），0 表示关闭
+	SessionCountFrom     int    `toml:"session_count_from"`     // 允许统计的时段起始小时（含）
+	SessionCountTo       int    `toml:"session_count_to"`       // 允许统计的时段结束小时（不含），小于起始小时时跨越零点
+	CounterFlushInterval int    `toml:"counter_flush_interval"` // 累计计数写入数据库的间隔（秒），0 表示不持久化
 }
 
 // GRPCProxyConfig grpc Server配置
 type GRPCProxyConfig struct {
-	Host string `toml:"host"`
-	Port int    `toml:"port"`
-	Log  bool   `toml:"log"`
+	Host              string   `toml:"host"`
+	Port              int      `toml:"port"`
+	Listen            []string `toml:"listen"` // 多个监听地址（host:port 或 unix:路径），不为空时替代 host 与 port
+	Log               bool     `toml:"log"`
+	TLSCert           string   `toml:"tls_cert"`            // 服务端证书（PEM），为空时不启用 TLS
+	TLSKey            string   `toml:"tls_key"`             // 服务端私钥（PEM）
+	ClientCA          string   `toml:"client_ca"`           // 校验客户端证书的 CA（PEM），为空时不校验
+	RequireClientCert bool     `toml:"require_client_cert"` // 要求客户端提供证书（mTLS）
+	Reflection        bool     `toml:"reflection"`          // 注册 gRPC 服务反射，grpcurl 等工具无需 .proto 文件即可调用
+
+	ServiceTokens     []string `toml:"service_tokens"`      // 调用受保护方法的服务令牌，任一匹配即可，多个用于轮换
+	AllowedClientSANs []string `toml:"allowed_client_sans"` // 客户端证书 SAN（DNS 或 URI）在列表中时可调用受保护方法
+	ProtectedMethods  []string `toml:"protected_methods"`   // 需要服务令牌或客户端证书的方法，未配置令牌与 SAN 时不检查
+
+	KeepaliveMinTime             int  `toml:"keepalive_min_time"`              // 客户端 keepalive ping 的最小间隔（秒），更频繁时断开连接
+	KeepalivePermitWithoutStream bool `toml:"keepalive_permit_without_stream"` // 允许客户端在没有进行中请求时发送 ping
+	MaxConnectionIdle            int  `toml:"max_connection_idle"`             // 连接空闲超过该秒数后关闭，0 表示不限制
+	MaxConnectionAge             int  `toml:"max_connection_age"`              // 连接存活超过该秒数后关闭，0 表示不限制
+	MaxConnectionAgeGrace        int  `toml:"max_connection_age_grace"`        // 达到 max_connection_age 后等待进行中请求完成的秒数，0 表示不限制
+	KeepaliveTime                int  `toml:"keepalive_time"`                  // 连接空闲该秒数后服务端发送 keepalive ping，0 表示使用 gRPC 默认值（2 小时）
+	KeepaliveTimeout             int  `toml:"keepalive_timeout"`               // 等待 keepalive 响应的秒数，超时后关闭连接，0 表示使用 gRPC 默认值（20 秒）
+
+	MaxConnections       int `toml:"max_connections"`        // 同时打开的连接数上限，超出时新连接立即关闭，0 表示不限制
+	MaxConcurrentStreams int `toml:"max_concurrent_streams"` // 每个连接上同时进行的请求数上限，0 表示不限制
+	MaxRecvMsgMB         int `toml:"max_recv_msg_mb"`        // 接收消息的大小上限（MB），0 表示使用 gRPC 默认值（4 MB）
+	MaxSendMsgMB         int `toml:"max_send_msg_mb"`        // 发送消息的大小上限（MB），0 表示不限制
+
+	DrainDelay    int `toml:"drain_delay"`    // 关闭前健康检查报告 NOT_SERVING 的秒数，让客户端迁移到其他副本
+	ShutdownGrace int `toml:"shutdown_grace"` // 发送 GOAWAY 后等待进行中请求完成的秒数，超时后强制关闭
 }
 
 // CacheConfig 缓存配置
 type CacheConfig struct {
-	MemTimeout   int `toml:"mem_timeout"`
-	MemMaxsize   int `toml:"mem_maxsize"`
-	MemCleantime int `toml:"mem_cleantime"`
+	MemTimeout        int    `toml:"mem_timeout"`
+	MemMaxsize        int    `toml:"mem_maxsize"`
+	MemCleantime      int    `toml:"mem_cleantime"`
+	CoalesceWindow    int    `toml:"coalesce_window"`    // 内存缓存未命中时相同会话查询的合并窗口（微秒），0 表示关闭
+	ListCacheTTL      int    `toml:"list_cache_ttl"`     // 用户会话列表缓存时间（秒），0 表示不缓存
+	AttrCacheTTL      int    `toml:"attr_cache_ttl"`     // 会话属性缓存时间（秒），0 表示不缓存
+	BypassMemory      bool   `toml:"bypass_memory"`      // 跳过内存缓存读取（故障排查用）
+	BypassRedis       bool   `toml:"bypass_redis"`       // 跳过 Redis 缓存读取（故障排查用）
+	EvictionPolicy    string `toml:"eviction_policy"`    // 内存缓存淘汰策略：lru 或 random
+	Admission         string `toml:"admission"`          // 内存缓存准入策略：none 或 tinylfu
+	MemoryLimit       int    `toml:"memory_limit"`       // 进程内存上限（MB），0 表示使用 GOMEMLIMIT
+	PressureThreshold int    `toml:"pressure_threshold"` // 内存占用达到上限的百分比时收缩内存缓存，0 表示关闭
+	PressureInterval  int    `toml:"pressure_interval"`  // 内存压力检查间隔（秒）
+	Shards            int    `toml:"shards"`             // 内存缓存分片数
+	RedisTTL          int    `toml:"redis_ttl"`          // 有效会话在 Redis 中的缓存时间上限（秒）
+	NegativeTTL       int    `toml:"negative_ttl"`       // 无效会话标记在 Redis 与内存中的缓存时间（秒），内存中不超过 mem_timeout
+	ExpireJitter      int    `toml:"expire_jitter"`      // 内存缓存项有效期随机缩短的最大百分比，0 表示不抖动
+	MaxMemoryMB       int    `toml:"max_memory_mb"`      // 内存缓存的估算内存上限（MB），0 表示只按 mem_maxsize 限制
+
+	RedisMigrationInterval int `toml:"redis_migration_interval"` // 扫描并清除旧格式 Redis 值的间隔（分钟），0 表示关闭
+	RedisMigrationBatch    int `toml:"redis_migration_batch"`    // 每批检查的会话数
+
+	Warmup        int `toml:"warmup"`         // 启动时载入内存缓存的最近活跃会话数，0 表示不预热
+	WarmupTimeout int `toml:"warmup_timeout"` // 预热的最长时间（秒），超时后照常启动
+
+	KnownFilter         bool    `toml:"known_filter"`          // 已知会话过滤器：一定不存在的会话ID不查询 Redis 与 MySQL
+	KnownFilterCapacity int     `toml:"known_filter_capacity"` // 过滤器容量（会话数）
+	KnownFilterFPRate   float64 `toml:"known_filter_fp_rate"`  // 容量内的误判率
+	KnownFilterRebuild  int     `toml:"known_filter_rebuild"`  // 从数据库重建过滤器的间隔（分钟）
+	KnownFilterBatch    int     `toml:"known_filter_batch"`    // 重建时每批读取的会话数
 }
 
 // DBGatewayConfig grpc DBGateway 配置
 type DBGatewayConfig struct {
-	Host    string `toml:"host"`
-	Port    int    `toml:"port"`
-	ConnNum int    `toml:"conn_num"`
-	Timeout int    `toml:"sql_timeout"`
+	Host         string              `toml:"host"`
+	Port         int                 `toml:"port"`
+	Endpoints    []DBGatewayEndpoint `toml:"endpoints"` // 多个 DBGateway 端点，不为空时替代 host 与 port
+	ConnNum      int                 `toml:"conn_num"`
+	Timeout      int                 `toml:"sql_timeout"`   // MySQL 调用的超时（ms）
+	RedisTimeout int                 `toml:"redis_timeout"` // Redis 调用的超时（ms）
+	RedisBudget  int                 `toml:"redis_budget"`  // Redis 查询占调用方剩余时间的百分比，其余留给 MySQL
+
+	RetryAttempts   int      `toml:"retry_attempts"`    // MySQL 查询与 Redis 读写的最大尝试次数（含首次），1 表示不重试
+	RetryBackoff    int      `toml:"retry_backoff"`     // 首次重试前的最大退避时间（ms），之后每次翻倍
+	RetryMaxBackoff int      `toml:"retry_max_backoff"` // 退避时间上限（ms）
+	RetryCodes      []string `toml:"retry_codes"`       // 可重试的 gRPC 状态码名称，如 "Unavailable"
+
+	BreakerThreshold int `toml:"breaker_threshold"` // 连续网关故障达到该次数后熔断，0 表示不熔断
+	BreakerCooldown  int `toml:"breaker_cooldown"`  // 熔断后等待该秒数再放行一次探测调用
+
+	HealthInterval   int `toml:"health_interval"`    // 每个连接健康检查的间隔（秒）
+	RedialBackoff    int `toml:"redial_backoff"`     // 健康检查失败后首次重建连接前的等待时间（ms），之后每次翻倍
+	RedialMaxBackoff int `toml:"redial_max_backoff"` // 重建等待时间上限（ms）
+
+	Balance string `toml:"balance"` // 端点内连接的选择策略：round_robin、random 或 least_outstanding
+
+	BatchMaxRows  int `toml:"batch_max_rows"`  // 合并为一条 INSERT 的最大行数
+	BatchMaxDelay int `toml:"batch_max_delay"` // 并发 INSERT 的合并窗口（μs），0 表示不合并
+
+	Warmup            bool `toml:"warmup"`              // 启动时立即建立全部连接，健康检查成功后才报告就绪
+	KeepaliveTime     int  `toml:"keepalive_time"`      // 连接空闲该秒数后发送 keepalive ping，0 表示不发送
+	KeepaliveTimeout  int  `toml:"keepalive_timeout"`   // 等待 keepalive 响应的时间（秒），超时后关闭连接
+	MaxRecvMsgMB      int  `toml:"max_recv_msg_mb"`     // 接收消息的大小上限（MB）
+	MaxSendMsgMB      int  `toml:"max_send_msg_mb"`     // 发送消息的大小上限（MB）
+	ConnectBackoff    int  `toml:"connect_backoff"`     // 连接断开后首次重连前的等待时间（ms），之后按 1.6 倍增长
+	ConnectMaxBackoff int  `toml:"connect_max_backoff"` // 重连等待时间上限（ms）
+	ConnectTimeout    int  `toml:"connect_timeout"`     // 建立连接的最短超时（ms）
+}
+
+// 端点内连接的选择策略
+const (
+	BalanceRoundRobin       = "round_robin"
+	BalanceRandom           = "random"
+	BalanceLeastOutstanding = "least_outstanding"
+)
+
+// DBGatewayEndpoint 一个 DBGateway 端点
+type DBGatewayEndpoint struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Priority int    `toml:"priority"` // 数值小的优先，同一优先级的端点全部不可用时才使用下一级
+	Weight   int    `toml:"weight"`   // 同一优先级内按权重分配请求，0 视为 1
+	Replica  bool   `toml:"replica"`  // 只读副本，只处理允许读副本的查询
 }
 
 // SessionConfig 会话配置
 type SessionConfig struct {
-	ExpireHours   int `toml:"expire_hours"`   // 会话过期时间（小时）
-	CleanInterval int `toml:"clean_interval"` // 清理间隔（分钟）
+	ExpireHours        int      `toml:"expire_hours"`         // 会话过期时间（小时）
+	CleanInterval      int      `toml:"clean_interval"`       // 清理间隔（分钟）
+	CleanCron          string   `toml:"clean_cron"`           // 清理时间的 cron 表达式（本地时区），非空时代替 clean_interval
+	CleanBatch         int      `toml:"clean_batch"`          // 每批删除的过期会话数
+	CleanPause         int      `toml:"clean_pause"`          // 清理批次之间的等待时间（毫秒）
+	Sliding            bool     `toml:"sliding"`              // 滑动过期：Get 成功时延长会话有效期
+	TouchInterval      int      `toml:"touch_interval"`       // 同一会话写入活跃时间（延长有效期）的最小间隔（秒）
+	IDPrefix           string   `toml:"id_prefix"`            // 新会话ID的前缀（如环境或版本标识）
+	IDEncoding         string   `toml:"id_encoding"`          // 新会话ID随机部分的编码：hex、base62 或 base64url
+	IDBytes            int      `toml:"id_bytes"`             // 新会话ID随机部分的字节数
+	PreviousIDEncoding string   `toml:"previous_id_encoding"` // 修改编码或字节数前的随机部分编码，旧会话全部过期前仍然接受，为空时不接受
+	PreviousIDBytes    int      `toml:"previous_id_bytes"`    // 修改前的随机部分字节数
+	AcceptedPrefixes   []string `toml:"accepted_prefixes"`    // 接受的会话ID前缀，为空时只接受 id_prefix
+	Audience           string   `toml:"audience"`             // 环境受众标识，写入新会话ID的标记并在查询时校验，为空时不启用
+	AcceptUntagged     bool     `toml:"accept_untagged"`      // 启用受众后仍接受没有受众标记的旧会话ID
+	HashIDs            bool     `toml:"hash_ids"`             // 存储与缓存中只保存会话ID的 SHA-256，已有的明文会话ID在后台迁移，需要重启
+
+	SigningKey         string `toml:"signing_key"`          // 签名密钥，不为空时新会话ID携带 uid 与过期时间的签名，Get 可在本地校验
+	PreviousSigningKey string `toml:"previous_signing_key"` // 轮换前的签名密钥，只用于校验
+
+	IdleTimeoutMinutes int `toml:"idle_timeout_minutes"`  // 空闲超时（分钟）：超过该时间没有 Get 的会话失效，0 表示不启用
+	FreezeSyncInterval int `toml:"freeze_sync_interval"`  // 从数据库同步冻结用户列表的间隔（秒）
+	MaxSessionsPerUser int `toml:"max_sessions_per_user"` // 每个用户的有效会话数上限，超出时删除最早的会话，0 表示不限制
+	MaxAttrs           int `toml:"max_attrs"`             // 每个会话的属性数上限
+	MaxAttrBytes       int `toml:"max_attr_bytes"`        // 单个属性值的最大字节数
+
+	WriteBehind         bool `toml:"write_behind"`          // 异步写入：Set 先写入 Redis 与内存缓存并返回，由后台批量写入 MySQL
+	WriteBehindBatch    int  `toml:"write_behind_batch"`    // 每批写入的会话数
+	WriteBehindInterval int  `toml:"write_behind_interval"` // 写入间隔（毫秒），队列达到一批时立即写入
+	WriteBehindQueue    int  `toml:"write_behind_queue"`    // 队列上限，队列已满时 Set 同步写入
+}
+
+// JournalConfig 会话历史配置
+type JournalConfig struct {
+	Enable            bool   `toml:"enable"`              // 记录会话历史（用于按时间点追溯会话）
+	AnonymizeDays     int    `toml:"anonymize_days"`      // 超过该天数的历史记录脱敏，0 表示不脱敏
+	AnonymizeSalt     string `toml:"anonymize_salt"`      // 脱敏哈希盐，为空时直接清除
+	AnonymizeInterval int    `toml:"anonymize_interval"`  // 脱敏任务间隔（分钟）
+	RetainDeletedDays int    `toml:"retain_deleted_days"` // 删除会话时将会话行复制到 session_history_db 并保留的天数，0 表示直接删除
 }
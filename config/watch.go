@@ -0,0 +1,66 @@
+package config
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// k8sDataLink Kubernetes 挂载 ConfigMap 时通过替换该符号链接原子更新文件
+const k8sDataLink = "..data"
+
+// Watch 监视配置文件，文件变化后等待 debounce（期间的变化合并）再调用 onChange，返回停止监视的函数
+// 监视所在目录而不是文件本身，编辑器以重命名方式保存与 ConfigMap 的符号链接切换都能被发现
+func Watch(debounce time.Duration, onChange func()) (stop func(), err error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Clean(cfgPath)
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return nil, err
+	}
+	logger.Info("watching config file", "path", path)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var timer *time.Timer
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if !ev.Has(fsnotify.Write | fsnotify.Create | fsnotify.Rename) {
+					continue
+				}
+				if filepath.Clean(ev.Name) != path && filepath.Base(ev.Name) != k8sDataLink {
+					continue
+				}
+				logger.Debug("config file changed", "path", ev.Name, "op", ev.Op.String())
+				if timer == nil {
+					timer = time.AfterFunc(debounce, onChange)
+				} else {
+					timer.Reset(debounce)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("config watcher error", "error", err)
+			}
+		}
+	}()
+	return func() {
+		w.Close()
+		<-done
+	}, nil
+}
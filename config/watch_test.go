@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTempConfig 将配置文件切换到临时目录中的默认配置，测试结束后恢复
+func useTempConfig(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(defaultConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	savedPath, savedCfg := cfgPath, LatestConfig
+	t.Cleanup(func() { cfgPath, LatestConfig = savedPath, savedCfg })
+	cfgPath = path
+	cfg := Default()
+	LatestConfig = &cfg
+	return path
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	path := useTempConfig(t)
+	current := LatestConfig
+
+	for name, content := range map[string]string{
+		"syntax": "[grpc\nport = 1",
+		"value":  "[grpc]\nport = 0\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ReloadConf(); err == nil {
+			t.Fatalf("%s: ReloadConf() accepted a broken config", name)
+		}
+		if LatestConfig != current {
+			t.Fatalf("%s: current config replaced by a broken one", name)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("[grpc]\nport = 50099\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReloadConf(); err != nil || LatestConfig.GRPCProxy.Port != 50099 {
+		t.Fatalf("ReloadConf() = %v, port %d", err, LatestConfig.GRPCProxy.Port)
+	}
+}
+
+func TestWatchDebouncesChanges(t *testing.T) {
+	path := useTempConfig(t)
+	changed := make(chan struct{}, 10)
+	stop, err := Watch(50*time.Millisecond, func() { changed <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// 无关文件不触发
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), "other.toml"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 编辑器式保存：写入临时文件后重命名替换，多次变化合并为一次
+	for range 3 {
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(defaultConfig), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("change was not reported")
+	}
+	select {
+	case <-changed:
+		t.Fatal("changes were not debounced")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
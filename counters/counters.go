@@ -0,0 +1,139 @@
+// Package counters 累计计数（会话创建、删除与清理数）持久化到数据库，重启与发布后不清零
+// 所有实例的计数累加到同一张表，导出的是整个部署的累计值
+package counters
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"StealthIMSession/scheduler"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Schema 累计计数表结构，由会话库结构变更创建
+const Schema = `CREATE TABLE IF NOT EXISTS session_counter_db (
+	name VARCHAR(64) NOT NULL PRIMARY KEY,
+	value BIGINT NOT NULL DEFAULT 0
+)`
+
+// flushJob 计数持久化在调度器中的任务名
+const flushJob = "counter_flush"
+
+var logger = logging.For("counters")
+
+// Counter 持久化的累计计数
+type Counter struct {
+	name    string
+	pending atomic.Int64 // 尚未写入数据库的增量
+	total   atomic.Int64 // 最近一次从数据库读取的累计值
+}
+
+var (
+	all    []*Counter
+	loaded atomic.Bool // 是否已从数据库读取过累计值
+	mu     sync.Mutex  // 保证同时只有一次写入
+)
+
+// 累计计数
+var (
+	SessionsCreated = newCounter("sessions_created") // Set 创建的会话
+	SessionsDeleted = newCounter("sessions_deleted") // Del、DelAllByUID 与会话数上限删除的会话
+	CleanerDeleted  = newCounter("cleaner_deleted")  // 清理器删除的过期会话
+)
+
+func newCounter(name string) *Counter {
+	c := &Counter{name: name}
+	all = append(all, c)
+	return c
+}
+
+// Add 增加计数，下次持久化时写入数据库
+func (c *Counter) Add(n int64) {
+	if n != 0 {
+		c.pending.Add(n)
+	}
+}
+
+// Value 返回整个部署的累计值（数据库中的值加本实例尚未写入的增量），尚未读取数据库时返回 -1
+func (c *Counter) Value() int64 {
+	if !loaded.Load() {
+		return -1
+	}
+	return c.total.Load() + c.pending.Load()
+}
+
+// Start 导出累计计数指标，并在调度器中注册定期持久化任务；未配置 counter_flush_interval 时不做任何事
+func Start() {
+	if config.LatestConfig.Metrics.CounterFlushInterval <= 0 {
+		return
+	}
+	for _, c := range all {
+		metrics.NewGaugeFunc("stealthim_session_lifetime", "Deployment-wide lifetime counters persisted across restarts (-1 until loaded)", c.Value, "counter", c.name)
+	}
+	scheduler.Add(scheduler.Job{
+		Name: flushJob,
+		Every: func() time.Duration {
+			return time.Duration(config.LatestConfig.Metrics.CounterFlushInterval) * time.Second
+		},
+		Jitter: 0.1,
+		Delay:  5 * time.Second,
+		Run:    Flush,
+	})
+}
+
+// Flush 将本实例的增量写入数据库并读取最新的累计值
+// 写入失败的增量保留到下次；写入结果未知（如超时）时重试可能重复计数
+func Flush(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, c := range all {
+		n := c.pending.Swap(0)
+		if n == 0 {
+			continue
+		}
+		sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, true,
+			"INSERT INTO session_counter_db (name, value) VALUES (?, ?) ON DUPLICATE KEY UPDATE value = value + VALUES(value)",
+			c.name, n)
+		if err == nil {
+			err = gateway.CheckResult(sqlResp)
+		}
+		if err != nil {
+			c.pending.Add(n)
+			return fmt.Errorf("flush counter %s: %v", c.name, err)
+		}
+	}
+
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT name, value FROM session_counter_db")
+	if err == nil {
+		err = gateway.CheckResult(sqlResp)
+	}
+	if err != nil {
+		return fmt.Errorf("load counters: %v", err)
+	}
+	totals := make(map[string]int64, len(sqlResp.Data))
+	for _, row := range sqlResp.Data {
+		if len(row.Result) < 2 {
+			continue
+		}
+		name, ok := gateway.ScanString(row.Result[0])
+		if !ok {
+			continue
+		}
+		totals[name], _ = gateway.ScanInt64(row.Result[1])
+	}
+	for _, c := range all {
+		c.total.Store(totals[c.name])
+	}
+	if !loaded.Swap(true) {
+		logger.Info("lifetime counters loaded", "counters", totals)
+	}
+	return nil
+}
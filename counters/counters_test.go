@@ -0,0 +1,76 @@
+package counters
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// fakeDB 内存实现的累计计数表，fail 为 true 时写入失败
+type fakeDB struct {
+	pb.StealthIMDBGatewayClient
+
+	values map[string]int64
+	fail   bool
+}
+
+func (f *fakeDB) Mysql(ctx context.Context, in *pb.SqlRequest, opts ...grpc.CallOption) (*pb.SqlResponse, error) {
+	ok := &pb.Result{}
+	if in.Sql == "SELECT name, value FROM session_counter_db" {
+		resp := &pb.SqlResponse{Result: ok}
+		for name, v := range f.values {
+			resp.Data = append(resp.Data, &pb.SqlLine{Result: []*pb.InterFaceType{
+				{Response: &pb.InterFaceType_Str{Str: name}},
+				{Response: &pb.InterFaceType_Int64{Int64: v}},
+			}})
+		}
+		return resp, nil
+	}
+	if f.fail {
+		return nil, errors.New("write failed")
+	}
+	name, _ := gateway.ScanString(in.Params[0])
+	n, _ := gateway.ScanInt64(in.Params[1])
+	f.values[name] += n
+	return &pb.SqlResponse{Result: ok, RowsAffected: 1}, nil
+}
+
+func TestFlush(t *testing.T) {
+	config.LatestConfig.DBGateway.Timeout = 1000
+	config.LatestConfig.DBGateway.RetryAttempts = 1
+	config.LatestConfig.DBGateway.BreakerThreshold = 0
+	// 其他实例已写入的累计值
+	f := &fakeDB{values: map[string]int64{"sessions_created": 100}}
+	defer gateway.Override(f)()
+	ctx := context.Background()
+
+	SessionsCreated.Add(3)
+	if v := SessionsCreated.Value(); v != -1 {
+		t.Fatalf("Value() before load = %d, want -1", v)
+	}
+	if err := Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := SessionsCreated.Value(); v != 103 || f.values["sessions_created"] != 103 {
+		t.Fatalf("Value() = %d, stored %d, want 103", v, f.values["sessions_created"])
+	}
+
+	// 写入失败的增量保留到下次
+	f.fail = true
+	SessionsDeleted.Add(2)
+	if err := Flush(ctx); err == nil {
+		t.Fatal("Flush() succeeded with failing writes")
+	}
+	if v := SessionsDeleted.Value(); v != 2 {
+		t.Fatalf("Value() after failed flush = %d, want 2", v)
+	}
+	f.fail = false
+	if err := Flush(ctx); err != nil || f.values["sessions_deleted"] != 2 || SessionsDeleted.Value() != 2 {
+		t.Fatalf("Flush() = %v, stored %d, value %d", err, f.values["sessions_deleted"], SessionsDeleted.Value())
+	}
+}
@@ -0,0 +1,49 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	loc := time.UTC
+	from := time.Date(2026, 10, 15, 14, 30, 20, 0, loc) // 周四
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 3 * * *", time.Date(2026, 10, 16, 3, 0, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2026, 10, 15, 14, 45, 0, 0, loc)},
+		{"30 14 * * *", time.Date(2026, 10, 16, 14, 30, 0, 0, loc)},
+		{"0 1-5/2 * * *", time.Date(2026, 10, 16, 1, 0, 0, 0, loc)},
+		{"0 3 * * 0", time.Date(2026, 10, 18, 3, 0, 0, 0, loc)},
+		{"0 3 * * 7", time.Date(2026, 10, 18, 3, 0, 0, 0, loc)},
+		{"0 0 1 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, loc)},
+		// 日与周都受限时满足其一即可：20 日或周六
+		{"0 0 20 * 6", time.Date(2026, 10, 17, 0, 0, 0, 0, loc)},
+		{"0 2,4 * * 1-5", time.Date(2026, 10, 16, 2, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", tt.expr, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next() = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	never, _ := Parse("0 0 30 2 *")
+	if got := never.Next(from); !got.IsZero() {
+		t.Errorf("Next() for Feb 30 = %v, want zero", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package events 会话生命周期事件，供下游服务通过 Watch 订阅，在会话失效时立即丢弃自己缓存的认证状态
+package events
+
+import (
+	"StealthIMSession/bus"
+	"StealthIMSession/config"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"encoding/json"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 事件类型
+const (
+	Created = "created" // 会话创建
+	Deleted = "deleted" // 会话被删除（Del 或超出会话数上限）
+	Expired = "expired" // 过期会话被清理
+	Revoked = "revoked" // 用户的所有会话失效（DelAllByUID 或冻结），SessionID 为空
+)
+
+var logger = logging.For("events")
+
+var (
+	metricWatchers = metrics.NewGauge("stealthim_session_watchers", "Active Watch subscriptions on this instance")
+	metricDropped  = metrics.NewCounter("stealthim_session_watch_dropped_total", "Watch subscriptions closed because the subscriber fell behind")
+	eventMetrics   sync.Map // type -> *metrics.Counter
+)
+
+// Event 一条会话生命周期事件
+type Event struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session,omitempty"`
+	UID       int32  `json:"uid"`
+	Time      int64  `json:"time"` // Unix 秒
+}
+
+// Subscription 一个 Watch 订阅
+// 订阅方处理过慢导致缓冲满时 C 被关闭，Lagged 返回 true；服务关闭时 C 同样被关闭
+type Subscription struct {
+	C <-chan Event
+
+	ch     chan Event
+	uids   []int32
+	lagged bool
+}
+
+var (
+	subLock sync.Mutex
+	subs    = make(map[*Subscription]struct{})
+)
+
+// Enabled 是否启用会话事件
+func Enabled() bool {
+	return config.LatestConfig.Events.Enable
+}
+
+// hooks 本实例产生事件时额外调用的函数（写时复制），见 OnEmit
+var (
+	hooksLock sync.Mutex
+	hooks     atomic.Pointer[[]func(Event)]
+)
+
+// OnEmit 注册本实例产生事件时调用的函数（如发布到外部消息总线），不受 events.enable 影响
+// 其他实例转发来的事件不会调用；fn 在产生事件的请求中同步调用，不能阻塞
+func OnEmit(fn func(Event)) {
+	hooksLock.Lock()
+	defer hooksLock.Unlock()
+	var next []func(Event)
+	if cur := hooks.Load(); cur != nil {
+		next = slices.Clone(*cur)
+	}
+	next = append(next, fn)
+	hooks.Store(&next)
+}
+
+// Emit 产生事件：调用 OnEmit 注册的函数，投递给本实例的订阅，并转发给其他实例
+// 未启用时只调用 OnEmit 注册的函数；转发经由失效广播的发布队列，不阻塞，失败只记录日志
+func Emit(ev Event) {
+	if ev.Time == 0 {
+		ev.Time = time.Now().Unix()
+	}
+	if cur := hooks.Load(); cur != nil {
+		for _, fn := range *cur {
+			fn(ev)
+		}
+	}
+	if !Enabled() {
+		return
+	}
+	counter(ev.Type).Inc()
+	deliver(ev)
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	bus.PublishEvent(string(payload))
+}
+
+// Receive 处理其他实例转发的事件
+func Receive(payload string) {
+	if !Enabled() {
+		return
+	}
+	var ev Event
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+		logger.Warn("invalid forwarded event", "error", err)
+		return
+	}
+	deliver(ev)
+}
+
+// Subscribe 订阅事件，uids 为空时订阅所有用户
+func Subscribe(uids []int32) *Subscription {
+	ch := make(chan Event, max(config.LatestConfig.Events.Buffer, 1))
+	sub := &Subscription{C: ch, ch: ch, uids: slices.Clone(uids)}
+	subLock.Lock()
+	subs[sub] = struct{}{}
+	subLock.Unlock()
+	metricWatchers.Add(1)
+	return sub
+}
+
+// Close 取消订阅，可重复调用
+func (s *Subscription) Close() {
+	subLock.Lock()
+	defer subLock.Unlock()
+	s.closeLocked()
+}
+
+// Lagged 订阅是否因处理过慢被断开
+func (s *Subscription) Lagged() bool {
+	subLock.Lock()
+	defer subLock.Unlock()
+	return s.lagged
+}
+
+// closeLocked 移除订阅并关闭通道，调用方需持有 subLock
+func (s *Subscription) closeLocked() {
+	if _, ok := subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	close(s.ch)
+	metricWatchers.Add(-1)
+}
+
+// CloseAll 关闭所有订阅，用于服务关闭时结束 Watch 流
+func CloseAll() {
+	subLock.Lock()
+	defer subLock.Unlock()
+	for s := range subs {
+		s.closeLocked()
+	}
+}
+
+// deliver 投递事件给匹配的订阅，不阻塞：缓冲满的订阅被断开，由订阅方重新订阅
+func deliver(ev Event) {
+	subLock.Lock()
+	defer subLock.Unlock()
+	for s := range subs {
+		if len(s.uids) > 0 && !slices.Contains(s.uids, ev.UID) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			s.lagged = true
+			s.closeLocked()
+			metricDropped.Inc()
+		}
+	}
+}
+
+// counter 返回事件类型的计数器
+func counter(eventType string) *metrics.Counter {
+	c, ok := eventMetrics.Load(eventType)
+	if !ok {
+		c, _ = eventMetrics.LoadOrStore(eventType,
+			metrics.NewCounter("stealthim_session_events_total", "Session lifecycle events emitted by this instance", "type", eventType))
+	}
+	return c.(*metrics.Counter)
+}
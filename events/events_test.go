@@ -0,0 +1,70 @@
+package events
+
+import (
+	"StealthIMSession/config"
+	"testing"
+)
+
+func TestDeliver(t *testing.T) {
+	saved := config.LatestConfig.Events
+	t.Cleanup(func() { config.LatestConfig.Events = saved })
+	config.LatestConfig.Events.Enable = true
+	config.LatestConfig.Events.Buffer = 2
+
+	all := Subscribe(nil)
+	one := Subscribe([]int32{7})
+	defer all.Close()
+	defer one.Close()
+
+	Emit(Event{Type: Created, SessionID: "s1", UID: 7})
+	Receive(`{"type":"revoked","uid":8,"time":1760000000}`)
+
+	if ev := <-one.C; ev.SessionID != "s1" || ev.Time == 0 {
+		t.Fatalf("uid 7 subscription got %+v", ev)
+	}
+	if ev := <-all.C; ev.Type != Created {
+		t.Fatalf("first event = %+v", ev)
+	}
+	if ev := <-all.C; ev.Type != Revoked || ev.UID != 8 || ev.Time != 1760000000 {
+		t.Fatalf("forwarded event = %+v", ev)
+	}
+	select {
+	case ev := <-one.C:
+		t.Fatalf("uid 7 subscription got event for uid %d", ev.UID)
+	default:
+	}
+
+	// 缓冲满时断开订阅，不阻塞其他订阅
+	for i := 0; i < 3; i++ {
+		Emit(Event{Type: Deleted, SessionID: "s1", UID: 8})
+	}
+	for range all.C {
+	}
+	if !all.Lagged() || one.Lagged() {
+		t.Fatalf("Lagged() = %v, %v, want true, false", all.Lagged(), one.Lagged())
+	}
+
+	CloseAll()
+	if _, ok := <-one.C; ok || one.Lagged() {
+		t.Fatal("subscription still open after CloseAll")
+	}
+	if v := metricWatchers.Value(); v != 0 {
+		t.Fatalf("watchers gauge = %d after CloseAll", v)
+	}
+}
+
+func TestOnEmit(t *testing.T) {
+	saved := config.LatestConfig.Events
+	t.Cleanup(func() { config.LatestConfig.Events = saved })
+	config.LatestConfig.Events.Enable = false
+
+	var got []Event
+	OnEmit(func(ev Event) { got = append(got, ev) })
+
+	// 未启用 events 时仍然调用，其他实例转发来的事件不调用
+	Emit(Event{Type: Expired, SessionID: "s1", UID: 7})
+	Receive(`{"type":"revoked","uid":8,"time":1760000000}`)
+	if len(got) != 1 || got[0].Type != Expired || got[0].Time == 0 {
+		t.Fatalf("hook got %+v", got)
+	}
+}
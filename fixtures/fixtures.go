@@ -0,0 +1,281 @@
+// Package fixtures 每个 RPC 的标准请求与响应示例
+// testdata 中的 golden 文件为对应的 protojson 编码，供兼容性测试与其他语言的下游调用方使用；
+// 修改线上行为（字段、状态码含义）时需同步更新示例并在评审中说明
+package fixtures
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+)
+
+// Pair 一个 RPC 的请求与响应示例
+type Pair struct {
+	Method   string // RPC 方法名，同时是 golden 文件名
+	Request  any
+	Response any // 服务端流方法为流中的一条消息
+}
+
+const (
+	session = "prod1_3f9c2a7b5e1d4c8a9b0f6e2d7c4a1b3e"
+	uid     = int32(10086)
+	created = int64(1760000000)
+)
+
+func ok() *pb.Result {
+	return &pb.Result{Code: 0, Msg: ""}
+}
+
+func meta() *pb.SessionMeta {
+	return &pb.SessionMeta{
+		Device:    "iPhone15,2",
+		ClientIp:  "203.0.113.7",
+		UserAgent: "StealthIM-iOS/2.3.1",
+		Platform:  "ios",
+		Gateway:   "gw-sh-02",
+	}
+}
+
+func query() *pb.QueryOptions {
+	return &pb.QueryOptions{
+		Filters: []*pb.QueryFilter{{Field: "created_at", Op: ">=", Value: "1759000000"}},
+		Sort:    "created_at",
+		Desc:    true,
+		Cursor:  "eyJrIjoxNzYwMDAwMDAwfQ",
+		Limit:   20,
+	}
+}
+
+// All 返回所有 RPC（含管理服务）的示例，按方法名排序
+func All() []Pair {
+	return []Pair{
+		{
+			Method:  "CacheStats",
+			Request: &pb.CacheStatsRequest{},
+			Response: &pb.CacheStatsResponse{
+				Result:            ok(),
+				Items:             81920,
+				Bytes:             12058624,
+				Capacity:          100000,
+				Hits:              900000,
+				Misses:            100000,
+				HitRate:           0.9,
+				Evictions:         4096,
+				Expired:           250000,
+				AdmissionRejected: 512,
+			},
+		},
+		{
+			Method:  "CleanerStatus",
+			Request: &pb.CleanerStatusRequest{},
+			Response: &pb.CleanerStatusResponse{
+				Result:         ok(),
+				LastRun:        created,
+				LastSuccess:    created + 42,
+				LastDurationMs: 41870,
+				LastRows:       18250,
+				NextRun:        created + 3600,
+				Runs:           168,
+				Failures:       2,
+				Rows:           2915000,
+				Backlog:        1200,
+			},
+		},
+		{
+			Method:   "CountByUID",
+			Request:  &pb.CountByUIDRequest{Uid: uid},
+			Response: &pb.CountByUIDResponse{Result: ok(), Count: 3},
+		},
+		{
+			Method:   "Del",
+			Request:  &pb.DelRequest{Session: session},
+			Response: &pb.DelResponse{Result: ok()},
+		},
+		{
+			Method:   "DelAllByUID",
+			Request:  &pb.DelAllByUIDRequest{Uid: uid},
+			Response: &pb.DelAllByUIDResponse{Result: ok(), Deleted: 3},
+		},
+		{
+			Method:   "DelAttr",
+			Request:  &pb.DelAttrRequest{Session: session, Key: "chat.draft"},
+			Response: &pb.DelAttrResponse{Result: ok()},
+		},
+		{
+			Method:   "FlushCache",
+			Request:  &pb.FlushCacheRequest{},
+			Response: &pb.FlushCacheResponse{Result: ok(), Flushed: 81920},
+		},
+		{
+			Method:   "FreezeUID",
+			Request:  &pb.FreezeUIDRequest{Uid: uid, Frozen: true, Reason: "account compromise, ticket SEC-2291"},
+			Response: &pb.FreezeUIDResponse{Result: ok()},
+		},
+		{
+			Method:   "Get",
+			Request:  &pb.GetRequest{Session: session, WithMeta: true},
+			Response: &pb.GetResponse{Result: ok(), Uid: uid, Meta: meta()},
+		},
+		{
+			Method:   "GetAttr",
+			Request:  &pb.GetAttrRequest{Session: session, Keys: []string{"chat.active_group", "chat.draft"}},
+			Response: &pb.GetAttrResponse{Result: ok(), Attrs: map[string]string{"chat.active_group": "2048"}},
+		},
+		{
+			Method:   "GetConfig",
+			Request:  &pb.GetConfigRequest{},
+			Response: &pb.GetConfigResponse{Result: ok(), Config: `{"Admin":{"Enable":true,"Host":"127.0.0.1","Port":50056,"Token":"<redacted>"}}`, Digest: "9f2c41d07be35a68"},
+		},
+		{
+			Method:  "GetJobHistory",
+			Request: &pb.GetJobHistoryRequest{Name: "journal_anonymizer"},
+			Response: &pb.GetJobHistoryResponse{Result: ok(), Runs: []*pb.JobRun{
+				{Start: created + 600, DurationMs: 840, Error: "", Rows: 1520},
+				{Start: created, DurationMs: 5012, Error: "anonymize journal: sql error 1205: Lock wait timeout exceeded", Rows: 0},
+			}},
+		},
+		{
+			Method:   "GetRouteHints",
+			Request:  &pb.GetRouteHintsRequest{Uid: uid},
+			Response: &pb.GetRouteHintsResponse{Result: ok(), Hints: []*pb.RouteHint{{Session: session, LastActive: created + 3600, Meta: meta()}}},
+		},
+		{
+			Method:  "GetRouteHintsBulk",
+			Request: &pb.GetRouteHintsBulkRequest{Uids: []int32{uid, 10087}},
+			Response: &pb.GetRouteHintsBulkResponse{Result: ok(), Users: []*pb.UserRouteHints{
+				{Uid: uid, Hints: []*pb.RouteHint{{Session: session, LastActive: created + 3600, Meta: meta()}}},
+			}},
+		},
+		{
+			Method:   "InvalidateCache",
+			Request:  &pb.InvalidateCacheRequest{Session: session},
+			Response: &pb.InvalidateCacheResponse{Result: ok()},
+		},
+		{
+			Method:  "ListJobs",
+			Request: &pb.ListJobsRequest{},
+			Response: &pb.ListJobsResponse{Result: ok(), Jobs: []*pb.JobStatus{
+				{Name: "session_cleaner", Paused: false, Running: true, LastRun: created, LastError: "clean expired sessions: sql error 1205: Lock wait timeout exceeded", NextRun: created + 1800, Runs: 42, Failures: 2, Failing: 1},
+			}},
+		},
+		{
+			Method:  "ListSessionsByUID",
+			Request: &pb.ListSessionsByUIDRequest{Uid: uid, Query: query()},
+			Response: &pb.ListSessionsByUIDResponse{
+				Result:     ok(),
+				Sessions:   []*pb.SessionInfo{{Session: session, CreatedAt: created, Meta: meta()}},
+				NextCursor: "eyJrIjoxNzU5OTAwMDAwfQ",
+			},
+		},
+		{
+			Method:   "PauseJob",
+			Request:  &pb.PauseJobRequest{Name: "session_cleaner", Paused: true},
+			Response: &pb.PauseJobResponse{Result: ok()},
+		},
+		{
+			Method:   "Ping",
+			Request:  &pb.PingRequest{},
+			Response: &pb.Pong{Version: "v1.4.0", Commit: "6b5e69f", BuildDate: "2026-10-01T08:00:00Z"},
+		},
+		{
+			Method:  "QueryAudit",
+			Request: &pb.QueryAuditRequest{Query: query()},
+			Response: &pb.QueryAuditResponse{
+				Result:     ok(),
+				Entries:    []*pb.AuditEntry{{Id: 5120, EventTime: created, Action: "set", Uid: uid, SessionPrefix: "prod1_3f9c", Caller: "10.0.3.14:41822", Identity: "spiffe://stealthim/gateway"}},
+				NextCursor: "eyJrIjo1MTIwfQ",
+			},
+		},
+		{
+			Method:  "QueryJournal",
+			Request: &pb.QueryJournalRequest{Query: query()},
+			Response: &pb.QueryJournalResponse{
+				Result:     ok(),
+				Entries:    []*pb.JournalEntry{{Id: 981, Session: session, Uid: uid, Event: "create", Caller: "gateway", EventTime: created}},
+				NextCursor: "eyJrIjo5ODF9",
+			},
+		},
+		{
+			Method:  "PurgeUserData",
+			Request: &pb.PurgeUserDataRequest{Uid: uid},
+			Response: &pb.PurgeUserDataResponse{
+				Result:         ok(),
+				Sessions:       3,
+				RefreshTokens:  2,
+				JournalEntries: 14,
+				HistoryEntries: 5,
+				AuditEntries:   21,
+				CachedSessions: 3,
+				PurgedAt:       created + 3600,
+			},
+		},
+		{
+			Method:   "QuerySessionAt",
+			Request:  &pb.QuerySessionAtRequest{Session: session, Uid: uid, Timestamp: created + 60},
+			Response: &pb.QuerySessionAtResponse{Result: ok(), Valid: true, CreatedAt: created, DeletedAt: created + 86400},
+		},
+		{
+			Method:  "Refresh",
+			Request: &pb.RefreshRequest{RefreshToken: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", Meta: meta()},
+			Response: &pb.RefreshResponse{
+				Result:           ok(),
+				Session:          "prod1_7d1e0c4b9a2f3e5d6c8b1a0f9e2d4c7b",
+				ExpiresAt:        created + 900,
+				RefreshToken:     "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+				RefreshExpiresAt: created + 30*86400,
+			},
+		},
+		{
+			Method:   "Reload",
+			Request:  &pb.ReloadRequest{},
+			Response: &pb.ReloadResponse{Result: ok()},
+		},
+		{
+			Method:   "Renew",
+			Request:  &pb.RenewRequest{Session: session},
+			Response: &pb.RenewResponse{Result: ok(), ExpiresAt: created + 7*86400},
+		},
+		{
+			Method:   "ResolveUIDAlias",
+			Request:  &pb.ResolveUIDAliasRequest{Alias: "u_5d41402abc4b2a76", Token: "resolver-token"},
+			Response: &pb.ResolveUIDAliasResponse{Result: ok(), Uid: uid},
+		},
+		{
+			Method:   "Set",
+			Request:  &pb.SetRequest{Uid: uid, Meta: meta(), TtlSeconds: 7 * 86400, PrimeCache: true},
+			Response: &pb.SetResponse{Result: ok(), Session: session, ExpiresAt: created + 7*86400, EvictedSessions: []string{"prod1_0a1b2c3d4e5f60718293a4b5c6d7e8f9"}},
+		},
+		{
+			Method:   "SetAttr",
+			Request:  &pb.SetAttrRequest{Session: session, Key: "chat.active_group", Value: "2048"},
+			Response: &pb.SetAttrResponse{Result: ok()},
+		},
+		{
+			Method:   "SetCacheBypass",
+			Request:  &pb.SetCacheBypassRequest{BypassMemory: true, BypassRedis: false},
+			Response: &pb.SetCacheBypassResponse{Result: ok(), BypassMemory: true, BypassRedis: false},
+		},
+		{
+			Method:  "Stats",
+			Request: &pb.StatsRequest{},
+			Response: &pb.StatsResponse{
+				Result: ok(),
+				Metrics: []*pb.Metric{
+					{Name: "stealthim_session_grpc_requests_total", Labels: `method="Get"`, Value: 1024},
+					{Name: "stealthim_session_grpc_latency_seconds", Labels: `method="Get"`, Value: 1024, Sum: 3.5},
+				},
+				Version:   "v1.4.0",
+				Commit:    "6b5e69f",
+				BuildDate: "2026-10-01T08:00:00Z",
+			},
+		},
+		{
+			Method:   "TriggerJob",
+			Request:  &pb.TriggerJobRequest{Name: "session_count"},
+			Response: &pb.TriggerJobResponse{Result: ok()},
+		},
+		{
+			Method:   "Watch",
+			Request:  &pb.WatchRequest{Uids: []int32{uid}},
+			Response: &pb.SessionEvent{Type: "deleted", Session: session, Uid: uid, Time: created + 3600},
+		},
+	}
+}
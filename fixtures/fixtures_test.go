@@ -0,0 +1,162 @@
+package fixtures
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata from the fixtures (requires generated StealthIM.Session)")
+
+// golden testdata 文件格式
+type golden struct {
+	Request      json.RawMessage `json:"request"`
+	Response     json.RawMessage `json:"response"`
+	RequestWire  string          `json:"requestWire,omitempty"`  // 确定性二进制编码（hex），由 -update 生成
+	ResponseWire string          `json:"responseWire,omitempty"` // 同上
+}
+
+// TestCoverage 每个 RPC 都有示例，且请求与响应类型与服务定义一致
+func TestCoverage(t *testing.T) {
+	pairs := make(map[string]Pair)
+	for _, p := range All() {
+		pairs[p.Method] = p
+	}
+	for _, svc := range []reflect.Type{
+		reflect.TypeOf((*pb.StealthIMSessionServer)(nil)).Elem(),
+		reflect.TypeOf((*pb.StealthIMSessionAdminServer)(nil)).Elem(),
+	} {
+		checkService(t, svc, pairs)
+	}
+	for name := range pairs {
+		t.Errorf("fixture %s has no matching RPC", name)
+	}
+}
+
+// checkService 检查服务的每个方法都有示例，并从 pairs 中移除已匹配的示例
+func checkService(t *testing.T, svc reflect.Type, pairs map[string]Pair) {
+	t.Helper()
+	for i := 0; i < svc.NumMethod(); i++ {
+		m := svc.Method(i)
+		if !m.IsExported() {
+			continue
+		}
+		p, ok := pairs[m.Name]
+		if !ok {
+			t.Errorf("no fixture for RPC %s", m.Name)
+			continue
+		}
+		delete(pairs, m.Name)
+		if req, resp := rpcTypes(m.Type); reflect.TypeOf(p.Request) != req || reflect.TypeOf(p.Response) != resp {
+			t.Errorf("%s: fixture types %T -> %T, service has %v -> %v", m.Name, p.Request, p.Response, req, resp)
+		}
+		if _, err := os.Stat(filepath.Join("testdata", m.Name+".json")); err != nil {
+			t.Errorf("%s: %v", m.Name, err)
+		}
+	}
+}
+
+// rpcTypes 服务方法的请求与响应类型
+// 一元方法为 (ctx, req) -> (resp, error)；服务端流方法为 (req, stream) -> error，响应类型为 stream.Send 的参数
+func rpcTypes(m reflect.Type) (req reflect.Type, resp reflect.Type) {
+	if m.NumOut() == 2 {
+		return m.In(1), m.Out(0)
+	}
+	send, ok := m.In(1).MethodByName("Send")
+	if !ok {
+		return m.In(0), nil
+	}
+	return m.In(0), send.Type.In(0)
+}
+
+// TestGolden 示例与 golden 文件一致
+// protojson 解码失败说明字段被删除或改名，二进制编码不同说明字段编号或类型变化
+func TestGolden(t *testing.T) {
+	for _, p := range All() {
+		t.Run(p.Method, func(t *testing.T) {
+			req, ok1 := p.Request.(proto.Message)
+			resp, ok2 := p.Response.(proto.Message)
+			if !ok1 || !ok2 {
+				t.Skip("StealthIM.Session is not generated code")
+			}
+			path := filepath.Join("testdata", p.Method+".json")
+			if *update {
+				writeGolden(t, path, req, resp)
+				return
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var g golden
+			if err := json.Unmarshal(data, &g); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "request", g.Request, g.RequestWire, req)
+			checkGolden(t, "response", g.Response, g.ResponseWire, resp)
+		})
+	}
+}
+
+func checkGolden(t *testing.T, name string, data json.RawMessage, wire string, want proto.Message) {
+	t.Helper()
+	got := want.ProtoReflect().New().Interface()
+	if err := protojson.Unmarshal(data, got); err != nil {
+		t.Fatalf("%s: golden JSON no longer decodes: %v", name, err)
+	}
+	if !proto.Equal(got, want) {
+		t.Fatalf("%s: golden JSON decodes to %v, fixture is %v", name, got, want)
+	}
+	if wire == "" {
+		return
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(b) != wire {
+		t.Fatalf("%s: wire encoding changed\n got %x\nwant %s", name, b, wire)
+	}
+}
+
+func writeGolden(t *testing.T, path string, req proto.Message, resp proto.Message) {
+	t.Helper()
+	var g golden
+	for _, x := range []struct {
+		msg  proto.Message
+		json *json.RawMessage
+		wire *string
+	}{{req, &g.Request, &g.RequestWire}, {resp, &g.Response, &g.ResponseWire}} {
+		data, err := protojson.Marshal(x.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, data); err != nil {
+			t.Fatal(err)
+		}
+		*x.json = buf.Bytes()
+		b, err := proto.MarshalOptions{Deterministic: true}.Marshal(x.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*x.wire = hex.EncodeToString(b)
+	}
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
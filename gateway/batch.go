@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/metrics"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 批量 INSERT：同一语句的并发调用在 dbgateway.batch_max_delay 内合并为一条多行 INSERT，
+// 减少高并发 Set 时 MySQL 的往返次数；合并后的语句失败时逐行重试，每个调用方得到自己那一行的结果
+
+var (
+	metricBatchRows     = metrics.NewHistogram("stealthim_session_gateway_batch_rows", "Rows per multi-row INSERT", []float64{1, 2, 5, 10, 20, 50, 100, 200, 500})
+	metricBatchFlush    = metrics.NewHistogram("stealthim_session_gateway_batch_flush_seconds", "Latency of multi-row INSERTs", nil)
+	metricBatchFallback = metrics.NewCounter("stealthim_session_gateway_batch_fallback_total", "Multi-row INSERTs that failed and were retried row by row")
+)
+
+// ExecInsert 以一条多行 INSERT 写入 rows，prefix 为 "INSERT INTO t (a, b) VALUES "，row 为单行的占位符如 "(?, ?)"
+func ExecInsert(ctx context.Context, db pb.SqlDatabases, commit bool, prefix string, row string, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(rows))
+	args := make([]any, 0, len(rows)*len(rows[0]))
+	for i, r := range rows {
+		placeholders[i] = row
+		args = append(args, r...)
+	}
+	start := time.Now()
+	sqlResp, err := ExecSQLParams(ctx, db, commit, prefix+strings.Join(placeholders, ", "), args...)
+	if err == nil {
+		err = CheckResult(sqlResp)
+	}
+	metricBatchRows.Observe(float64(len(rows)))
+	metricBatchFlush.ObserveSince(start)
+	return err
+}
+
+// InsertBatcher 合并同一 INSERT 语句的并发调用
+type InsertBatcher struct {
+	db     pb.SqlDatabases
+	commit bool
+	prefix string
+	row    string
+
+	mu      sync.Mutex
+	pending []*batchRow
+	timer   *time.Timer
+}
+
+// batchRow 等待合并写入的一行
+type batchRow struct {
+	ctx  context.Context
+	args []any
+	done chan error
+}
+
+// NewInsertBatcher 创建语句为 prefix 加若干个 row 的批量写入器，参数含义见 ExecInsert
+func NewInsertBatcher(db pb.SqlDatabases, commit bool, prefix string, row string) *InsertBatcher {
+	return &InsertBatcher{db: db, commit: commit, prefix: prefix, row: row}
+}
+
+// Insert 写入一行并返回该行的结果
+// batch_max_delay 为 0 时直接执行；否则等待至多 batch_max_delay，或凑满 batch_max_rows 行后与其他调用一起执行
+// ctx 取消时立即返回 ctx.Err()，该行仍可能被写入
+func (b *InsertBatcher) Insert(ctx context.Context, args ...any) error {
+	cfg := config.LatestConfig.DBGateway
+	if cfg.BatchMaxDelay <= 0 || cfg.BatchMaxRows <= 1 {
+		return ExecInsert(ctx, b.db, b.commit, b.prefix, b.row, [][]any{args})
+	}
+
+	r := &batchRow{ctx: ctx, args: args, done: make(chan error, 1)}
+	b.mu.Lock()
+	b.pending = append(b.pending, r)
+	var full []*batchRow
+	if len(b.pending) >= cfg.BatchMaxRows {
+		full = b.take()
+	} else if len(b.pending) == 1 {
+		b.timer = time.AfterFunc(time.Duration(cfg.BatchMaxDelay)*time.Microsecond, b.flushPending)
+	}
+	b.mu.Unlock()
+	// 凑满一批的调用方直接执行
+	if full != nil {
+		b.flush(full)
+	}
+
+	select {
+	case err := <-r.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// take 取出等待中的行，需持有 mu
+func (b *InsertBatcher) take() []*batchRow {
+	rows := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return rows
+}
+
+// flushPending 合并窗口结束时执行等待中的行
+func (b *InsertBatcher) flushPending() {
+	b.mu.Lock()
+	rows := b.take()
+	b.mu.Unlock()
+	b.flush(rows)
+}
+
+// flush 执行一批行，注入了不同客户端（见 WithClient）的行分开执行
+// 使用每组第一行的上下文（不随其取消而中断），失败时逐行以各自的上下文重试
+func (b *InsertBatcher) flush(rows []*batchRow) {
+	var groups [][]*batchRow
+	index := make(map[any]int)
+	for _, r := range rows {
+		key := r.ctx.Value(clientKey{})
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], r)
+	}
+
+	for _, group := range groups {
+		args := make([][]any, len(group))
+		for i, r := range group {
+			args[i] = r.args
+		}
+		err := ExecInsert(context.WithoutCancel(group[0].ctx), b.db, b.commit, b.prefix, b.row, args)
+		if err != nil && len(group) > 1 {
+			metricBatchFallback.Inc()
+			for _, r := range group {
+				r.done <- ExecInsert(r.ctx, b.db, b.commit, b.prefix, b.row, [][]any{r.args})
+			}
+			continue
+		}
+		for _, r := range group {
+			r.done <- err
+		}
+	}
+}
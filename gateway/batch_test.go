@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// insertRecorder 记录收到的 INSERT，rejectMulti 为 true 时拒绝多行语句
+type insertRecorder struct {
+	pb.StealthIMDBGatewayClient
+
+	mu          sync.Mutex
+	rows        []int // 每次调用的行数
+	rejectMulti bool
+}
+
+func (r *insertRecorder) Mysql(ctx context.Context, in *pb.SqlRequest, opts ...grpc.CallOption) (*pb.SqlResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := strings.Count(in.Sql, "(?, ?)")
+	r.rows = append(r.rows, n)
+	if r.rejectMulti && n > 1 {
+		return &pb.SqlResponse{Result: &pb.Result{Code: 1, Msg: "duplicate entry"}}, nil
+	}
+	return &pb.SqlResponse{Result: &pb.Result{}, RowsAffected: int64(n)}, nil
+}
+
+func withInsertRecorder(t *testing.T, maxRows int, maxDelay int) *insertRecorder {
+	saved := config.LatestConfig.DBGateway
+	t.Cleanup(func() { config.LatestConfig.DBGateway = saved })
+	cfg := &config.LatestConfig.DBGateway
+	cfg.Timeout = 1000
+	cfg.RetryAttempts = 1
+	cfg.BreakerThreshold = 0
+	cfg.BatchMaxRows = maxRows
+	cfg.BatchMaxDelay = maxDelay
+	r := &insertRecorder{}
+	t.Cleanup(Override(r))
+	return r
+}
+
+// insertConcurrently 并发写入 n 行，返回失败的行数
+func insertConcurrently(b *InsertBatcher, n int) int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.Insert(context.Background(), i, "v"); err != nil {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return failed
+}
+
+func TestInsertBatcher(t *testing.T) {
+	newBatcher := func() *InsertBatcher {
+		return NewInsertBatcher(pb.SqlDatabases_Session, false, "INSERT INTO t (a, b) VALUES ", "(?, ?)")
+	}
+
+	// 未启用合并时逐行执行
+	r := withInsertRecorder(t, 100, 0)
+	if failed := insertConcurrently(newBatcher(), 3); failed != 0 || len(r.rows) != 3 {
+		t.Fatalf("batching disabled: failed = %d, rows = %v", failed, r.rows)
+	}
+
+	// 凑满一批时立即执行，合并窗口很长也不等待
+	r = withInsertRecorder(t, 4, 60_000_000)
+	if failed := insertConcurrently(newBatcher(), 4); failed != 0 || len(r.rows) != 1 || r.rows[0] != 4 {
+		t.Fatalf("full batch: failed = %d, rows = %v", failed, r.rows)
+	}
+
+	// 未凑满时在合并窗口结束后执行
+	r = withInsertRecorder(t, 100, 1000)
+	if failed := insertConcurrently(newBatcher(), 3); failed != 0 {
+		t.Fatalf("partial batch: failed = %d", failed)
+	}
+	total := 0
+	for _, n := range r.rows {
+		total += n
+	}
+	if total != 3 {
+		t.Fatalf("partial batch: rows = %v, want 3 rows in total", r.rows)
+	}
+
+	// 合并后的语句失败时逐行重试
+	r = withInsertRecorder(t, 3, 60_000_000)
+	r.rejectMulti = true
+	if failed := insertConcurrently(newBatcher(), 3); failed != 0 || len(r.rows) != 4 {
+		t.Fatalf("fallback: failed = %d, rows = %v, want one batch and 3 single rows", failed, r.rows)
+	}
+}
@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/metrics"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen DBGateway 连续失败，熔断期间直接拒绝调用
+var ErrCircuitOpen = errors.New("dbgateway circuit open")
+
+// 熔断器状态，同时是 stealthim_session_gateway_breaker_state 的取值
+const (
+	breakerClosed   = 0 // 正常
+	breakerOpen     = 1 // 熔断，直接拒绝
+	breakerHalfOpen = 2 // 冷却结束，放行一次探测
+)
+
+var (
+	metricBreakerState    = metrics.NewGauge("stealthim_session_gateway_breaker_state", "DBGateway circuit breaker state (0 closed, 1 open, 2 half-open)")
+	metricBreakerOpened   = metrics.NewCounter("stealthim_session_gateway_breaker_opened_total", "Times the DBGateway circuit breaker opened")
+	metricBreakerRejected = metrics.NewCounter("stealthim_session_gateway_breaker_rejected_total", "DBGateway calls rejected while the circuit was open")
+)
+
+// breaker 熔断器
+// 连续 breaker_threshold 次网关故障后熔断，breaker_cooldown 秒后放行一次调用作为探测，成功则恢复
+// 正常状态下只读取原子变量，不加锁
+type breaker struct {
+	state    atomic.Int32
+	failures atomic.Int32 // 连续故障次数
+
+	mu       sync.Mutex // 状态转换时持有
+	openedAt time.Time
+	probing  bool // 半开状态下已放行探测调用
+}
+
+var gatewayBreaker breaker
+
+// allow 判断是否放行本次调用
+func (b *breaker) allow() bool {
+	if b.state.Load() == breakerClosed || config.LatestConfig.DBGateway.BreakerThreshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state.Load() {
+	case breakerOpen:
+		cooldown := time.Duration(config.LatestConfig.DBGateway.BreakerCooldown) * time.Second
+		if time.Since(b.openedAt) < cooldown {
+			break
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		logger.Warn("circuit half-open, probing DBGateway")
+		return true
+	case breakerHalfOpen:
+		if !b.probing {
+			b.probing = true
+			return true
+		}
+	default:
+		return true
+	}
+	metricBreakerRejected.Inc()
+	return false
+}
+
+// record 记录调用结果，callerDone 为调用方上下文已结束（其超时与取消不计为网关故障）
+func (b *breaker) record(err error, callerDone bool) {
+	threshold := config.LatestConfig.DBGateway.BreakerThreshold
+	if threshold <= 0 {
+		return
+	}
+	if !gatewayFailure(err) || callerDone {
+		if err != nil && callerDone {
+			// 调用方放弃的调用不能说明网关是否恢复
+			b.mu.Lock()
+			b.probing = false
+			b.mu.Unlock()
+			return
+		}
+		if b.state.Load() == breakerClosed && b.failures.Load() == 0 {
+			return
+		}
+		b.mu.Lock()
+		if b.state.Load() != breakerClosed {
+			logger.Info("circuit closed, DBGateway recovered")
+		}
+		b.failures.Store(0)
+		b.probing = false
+		b.setState(breakerClosed)
+		b.mu.Unlock()
+		return
+	}
+
+	failures := b.failures.Add(1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state.Load()
+	if state == breakerHalfOpen || (state == breakerClosed && int(failures) >= threshold) {
+		b.openedAt = time.Now()
+		b.probing = false
+		b.setState(breakerOpen)
+		metricBreakerOpened.Inc()
+		logger.Error("circuit open", "failures", failures, "error", err)
+	}
+}
+
+// setState 切换状态，调用方持有 b.mu
+func (b *breaker) setState(state int32) {
+	b.state.Store(state)
+	metricBreakerState.Set(int64(state))
+}
+
+// gatewayFailure 判断错误是否说明网关不可用（而非请求本身有误）
+func gatewayFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreaker(t *testing.T) {
+	fillPool(t, 1)
+	config.LatestConfig.DBGateway.BreakerThreshold = 2
+	config.LatestConfig.DBGateway.BreakerCooldown = 1
+	defer func() {
+		gatewayBreaker.record(nil, false)
+		config.LatestConfig.DBGateway.BreakerThreshold = 0
+	}()
+
+	var fail bool
+	calls := 0
+	fn := func(context.Context, pb.StealthIMDBGatewayClient) error {
+		calls++
+		if fail {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return nil
+	}
+
+	// 请求本身的错误不计为网关故障
+	call(context.Background(), metricSQL, func(context.Context, pb.StealthIMDBGatewayClient) error {
+		return status.Error(codes.InvalidArgument, "bad sql")
+	})
+	fail = true
+	call(context.Background(), metricSQL, fn)
+	if gatewayBreaker.state.Load() != breakerClosed {
+		t.Fatal("breaker opened before reaching the threshold")
+	}
+	call(context.Background(), metricSQL, fn)
+	if gatewayBreaker.state.Load() != breakerOpen {
+		t.Fatal("breaker did not open after 2 consecutive failures")
+	}
+
+	// 熔断期间直接拒绝，不调用网关
+	calls = 0
+	if err := call(context.Background(), metricSQL, fn); !errors.Is(err, ErrCircuitOpen) || calls != 0 {
+		t.Fatalf("open breaker: err=%v calls=%d", err, calls)
+	}
+
+	// 冷却结束后放行一次探测，成功则恢复
+	gatewayBreaker.openedAt = time.Now().Add(-time.Second)
+	fail = false
+	if err := call(context.Background(), metricSQL, fn); err != nil || calls != 1 {
+		t.Fatalf("probe: err=%v calls=%d", err, calls)
+	}
+	if gatewayBreaker.state.Load() != breakerClosed {
+		t.Fatal("breaker did not close after a successful probe")
+	}
+}
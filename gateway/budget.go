@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"time"
+)
+
+// timeoutKey 上下文中覆盖的单次调用超时，见 WithCallTimeout
+type timeoutKey struct{}
+
+// WithCallTimeout 返回在其中的每次网关调用（含每次重试）改用超时 d 的上下文，替代 sql_timeout 与 redis_timeout
+// 用于个别明显慢于普通查询的语句（如大批量删除），不必为此调大全部调用的超时
+func WithCallTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
+
+// callTimeout 返回 system（mysql 或 redis）单次调用的超时
+func callTimeout(ctx context.Context, system string) time.Duration {
+	if d, ok := ctx.Value(timeoutKey{}).(time.Duration); ok && d > 0 {
+		return d
+	}
+	cfg := config.LatestConfig.DBGateway
+	if system == "redis" {
+		return time.Duration(cfg.RedisTimeout) * time.Millisecond
+	}
+	return time.Duration(cfg.Timeout) * time.Millisecond
+}
+
+// callContext 生成单次网关调用的上下文，Redis 调用使用 redis_timeout，其余使用 sql_timeout
+// 调用方截止时间早于配置超时时沿用调用方的截止时间
+func callContext(ctx context.Context, system string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, callTimeout(ctx, system))
+}
+
+// SplitBudget 从调用方的剩余时间中划出 percent% 给当前层级
+// 调用方未设置截止时间时不做切分，由网关配置的超时兜底
+func SplitBudget(ctx context.Context, percent int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || percent <= 0 || percent >= 100 {
+		return context.WithCancel(ctx)
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, remaining*time.Duration(percent)/100)
+}
@@ -0,0 +1,39 @@
+package gateway
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCallTimeout(t *testing.T) {
+	saved := config.LatestConfig.DBGateway
+	t.Cleanup(func() { config.LatestConfig.DBGateway = saved })
+	config.LatestConfig.DBGateway.Timeout = 5000
+	config.LatestConfig.DBGateway.RedisTimeout = 200
+
+	ctx := context.Background()
+	if d := callTimeout(ctx, metricSQL.system); d != 5*time.Second {
+		t.Fatalf("mysql timeout = %v", d)
+	}
+	if d := callTimeout(ctx, metricRedisGet.system); d != 200*time.Millisecond {
+		t.Fatalf("redis timeout = %v", d)
+	}
+
+	// 单次覆盖对两类调用都生效，调用方更早的截止时间仍然优先
+	ctx = WithCallTimeout(ctx, time.Minute)
+	if d := callTimeout(ctx, metricSQL.system); d != time.Minute {
+		t.Fatalf("overridden mysql timeout = %v", d)
+	}
+	if d := callTimeout(ctx, metricRedisDel.system); d != time.Minute {
+		t.Fatalf("overridden redis timeout = %v", d)
+	}
+	short, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	callCtx, cancelCall := callContext(short, metricSQL.system)
+	defer cancelCall()
+	if deadline, _ := callCtx.Deadline(); time.Until(deadline) > time.Second {
+		t.Fatalf("call deadline %v later than caller's", time.Until(deadline))
+	}
+}
@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// dialOptions 按 [dbgateway] 配置返回建立连接的选项，修改后新建与重建的连接生效
+func dialOptions(cfg config.DBGatewayConfig) []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(cfg.MaxRecvMsgMB<<20),
+			grpc.MaxCallSendMsgSize(cfg.MaxSendMsgMB<<20),
+		),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  time.Duration(cfg.ConnectBackoff) * time.Millisecond,
+				Multiplier: backoff.DefaultConfig.Multiplier,
+				Jitter:     backoff.DefaultConfig.Jitter,
+				MaxDelay:   time.Duration(cfg.ConnectMaxBackoff) * time.Millisecond,
+			},
+			MinConnectTimeout: time.Duration(cfg.ConnectTimeout) * time.Millisecond,
+		}),
+	}
+	if cfg.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                time.Duration(cfg.KeepaliveTime) * time.Second,
+			Timeout:             time.Duration(cfg.KeepaliveTimeout) * time.Second,
+			PermitWithoutStream: true,
+		}))
+	}
+	return opts
+}
+
+// warmedUp 连接池预热已完成，之后就绪检查不再要求全部连接可用
+var warmedUp atomic.Bool
+
+// checkWarm 检查预热是否完成：优先级最高的主端点均已建立 conn_num 个连接，且每个连接的健康检查（Ping）都已成功
+// 其余优先级与只读副本只在故障时使用，不参与预热
+func checkWarm(context.Context) error {
+	if warmedUp.Load() {
+		return nil
+	}
+	set := currentEndpoints()
+	if set == nil || len(set.primary) == 0 {
+		return fmt.Errorf("connection pool not started")
+	}
+	want := config.LatestConfig.DBGateway.ConnNum
+	for _, ep := range set.primary[0] {
+		ready := 0
+		for _, s := range ep.slots() {
+			if s.healthy.Load() && s.conn.Load() != nil {
+				ready++
+			}
+		}
+		if ready < want {
+			return fmt.Errorf("warming up %s: %d/%d connections ready", ep.addr, ready, want)
+		}
+	}
+	warmedUp.Store(true)
+	logger.Info("connection pool warmed up", "conns", want)
+	return nil
+}
+
+// warmUp 立即为每个端点建立 conn_num 个连接，而不是每秒增加一个
+func warmUp(set *endpointSet) {
+	for _, ep := range set.all {
+		for resize(ep) {
+		}
+	}
+}
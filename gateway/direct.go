@@ -0,0 +1,498 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/resp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// redisDialTimeout 直连 Redis 时建立连接的超时时间（调用方未设置截止时间时）
+const redisDialTimeout = 3 * time.Second
+
+// direct 直连存储时的客户端，由 Start 设置
+var direct atomic.Pointer[directClient]
+
+// directClient 实现 DBGateway 的客户端接口，MySQL 与 Redis 分别直连或转发给连接池
+// 熔断、重试、指标与追踪与经由 DBGateway 时相同
+type directClient struct {
+	db        *sql.DB    // 为 nil 时 MySQL 经由 DBGateway
+	mysqlAddr string     // DSN 中的地址，用于启动报告
+	redis     *redisPool // 为 nil 时 Redis 经由 DBGateway
+}
+
+// newDirectClient 按配置创建直连客户端，两者都经由 DBGateway 时返回 nil
+// 只打开连接池而不建立连接，后端不可用时不会阻止启动
+func newDirectClient(cfg config.StorageConfig) (*directClient, error) {
+	c := &directClient{}
+	if cfg.MySQL == config.StorageDirect {
+		dsn, err := mysql.ParseDSN(cfg.MySQLDSN)
+		if err != nil {
+			return nil, fmt.Errorf("storage.mysql_dsn: %w", err)
+		}
+		connector, err := mysql.NewConnector(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("storage.mysql_dsn: %w", err)
+		}
+		c.db = sql.OpenDB(connector)
+		c.mysqlAddr = dsn.Addr
+		c.db.SetMaxOpenConns(cfg.MySQLMaxConns)
+		c.db.SetMaxIdleConns(cfg.MySQLMaxConns)
+	}
+	if cfg.Redis == config.StorageDirect {
+		c.redis = &redisPool{
+			addr:     cfg.RedisAddr,
+			password: cfg.RedisPassword,
+			db:       cfg.RedisDB,
+			idle:     make(chan *resp.Conn, cfg.RedisMaxIdle),
+		}
+	}
+	if c.db == nil && c.redis == nil {
+		return nil, nil
+	}
+	return c, nil
+}
+
+func (c *directClient) close() {
+	if c.db != nil {
+		c.db.Close()
+	}
+	if c.redis != nil {
+		c.redis.close()
+	}
+}
+
+// poolClient 从 DBGateway 连接池选择客户端，ctx 经 WithReplica 标记时优先使用只读副本
+func poolClient(ctx context.Context) (pb.StealthIMDBGatewayClient, error) {
+	conn, err := chooseConn(useReplica(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pb.NewStealthIMDBGatewayClient(conn), nil
+}
+
+// directError 将直连时的连接错误转为 gRPC 状态码，以便与经由 DBGateway 时同样重试与熔断
+func directError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+func (c *directClient) Ping(ctx context.Context, in *pb.PingRequest, opts ...grpc.CallOption) (*pb.Pong, error) {
+	if c.db != nil {
+		if err := c.db.PingContext(ctx); err != nil {
+			return nil, directError(ctx, err)
+		}
+	}
+	if c.redis != nil {
+		if _, err := c.redis.do(ctx, "PING"); err != nil {
+			return nil, err
+		}
+	}
+	return &pb.Pong{}, nil
+}
+
+// Mysql 执行一条语句，查询语句返回结果行，其他语句按请求返回影响行数与自增ID
+// 语句错误以 Result 返回（与 DBGateway 相同），连接错误返回 Unavailable
+func (c *directClient) Mysql(ctx context.Context, in *pb.SqlRequest, opts ...grpc.CallOption) (*pb.SqlResponse, error) {
+	if c.db == nil {
+		cli, err := poolClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return cli.Mysql(ctx, in, opts...)
+	}
+	args := make([]any, len(in.Params))
+	for i, p := range in.Params {
+		args[i] = paramValue(p)
+	}
+
+	if !returnsRows(in.Sql) {
+		res, err := c.db.ExecContext(ctx, in.Sql, args...)
+		if err != nil {
+			return sqlFailure(ctx, err)
+		}
+		out := &pb.SqlResponse{Result: &pb.Result{}}
+		if in.GetRowCount {
+			out.RowsAffected, _ = res.RowsAffected()
+		}
+		if in.GetLastInsertId {
+			out.LastInsertId, _ = res.LastInsertId()
+		}
+		return out, nil
+	}
+
+	rows, err := c.db.QueryContext(ctx, in.Sql, args...)
+	if err != nil {
+		return sqlFailure(ctx, err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return sqlFailure(ctx, err)
+	}
+	out := &pb.SqlResponse{Result: &pb.Result{}}
+	values := make([]any, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return sqlFailure(ctx, err)
+		}
+		line := &pb.SqlLine{Result: make([]*pb.InterFaceType, len(values))}
+		for i, v := range values {
+			line.Result[i] = columnValue(v)
+		}
+		out.Data = append(out.Data, line)
+	}
+	if err := rows.Err(); err != nil {
+		return sqlFailure(ctx, err)
+	}
+	return out, nil
+}
+
+// returnsRows 判断语句是否返回结果行
+func returnsRows(query string) bool {
+	fields := strings.Fields(strings.TrimLeft(query, " \t\r\n("))
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "SHOW", "WITH", "DESCRIBE", "DESC", "EXPLAIN":
+		return true
+	}
+	return false
+}
+
+// sqlFailure MySQL 返回的错误以 Result 返回，其他错误说明连接不可用
+func sqlFailure(ctx context.Context, err error) (*pb.SqlResponse, error) {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return &pb.SqlResponse{Result: &pb.Result{Code: int32(myErr.Number), Msg: myErr.Message}}, nil
+	}
+	return nil, directError(ctx, err)
+}
+
+// paramValue 将请求参数转为驱动接受的值
+func paramValue(p *pb.InterFaceType) any {
+	if p == nil || p.Null || p.Response == nil {
+		return nil
+	}
+	switch v := p.Response.(type) {
+	case *pb.InterFaceType_Str:
+		return v.Str
+	case *pb.InterFaceType_Int32:
+		return v.Int32
+	case *pb.InterFaceType_Int64:
+		return v.Int64
+	case *pb.InterFaceType_Bool:
+		return v.Bool
+	case *pb.InterFaceType_Float:
+		return v.Float
+	case *pb.InterFaceType_Double:
+		return v.Double
+	case *pb.InterFaceType_Blob:
+		return v.Blob
+	}
+	return nil
+}
+
+// columnValue 将驱动返回的字段转为响应字段，文本与 DECIMAL 等以字符串返回（与 DBGateway 相同）
+func columnValue(v any) *pb.InterFaceType {
+	switch v := v.(type) {
+	case nil:
+		return &pb.InterFaceType{Null: true}
+	case int64:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Int64{Int64: v}}
+	case uint64:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Str{Str: strconv.FormatUint(v, 10)}}
+	case float32:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Float{Float: v}}
+	case float64:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Double{Double: v}}
+	case bool:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Bool{Bool: v}}
+	case []byte:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Str{Str: string(v)}}
+	case string:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Str{Str: v}}
+	case time.Time:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Str{Str: v.Format(time.DateTime)}}
+	default:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Str{Str: fmt.Sprint(v)}}
+	}
+}
+
+// redisGet 读取字符串值，键不存在时返回空值（与 DBGateway 相同）
+func (c *directClient) redisGet(ctx context.Context, key string) (string, *pb.Result, error) {
+	reply, err := c.redis.do(ctx, "GET", key)
+	if callErr := redisCallError(err); callErr != nil {
+		return "", nil, callErr
+	}
+	s, _ := reply.(string)
+	return s, redisResult(err), nil
+}
+
+// redisSet 写入值，ttl 大于 0 时设置有效期（秒）
+func (c *directClient) redisSet(ctx context.Context, key string, value string, ttl int32) (*pb.RedisSetResponse, error) {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "EX", strconv.Itoa(int(ttl)))
+	}
+	_, err := c.redis.do(ctx, args...)
+	return &pb.RedisSetResponse{Result: redisResult(err)}, redisCallError(err)
+}
+
+func (c *directClient) RedisGet(ctx context.Context, in *pb.RedisGetStringRequest, opts ...grpc.CallOption) (*pb.RedisGetStringResponse, error) {
+	if c.redis == nil {
+		cli, err := poolClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return cli.RedisGet(ctx, in, opts...)
+	}
+	value, result, err := c.redisGet(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RedisGetStringResponse{Result: result, Value: value}, nil
+}
+
+func (c *directClient) RedisBGet(ctx context.Context, in *pb.RedisGetBytesRequest, opts ...grpc.CallOption) (*pb.RedisGetBytesResponse, error) {
+	if c.redis == nil {
+		cli, err := poolClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return cli.RedisBGet(ctx, in, opts...)
+	}
+	value, result, err := c.redisGet(ctx, in.Key)
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.RedisGetBytesResponse{Result: result}
+	if value != "" {
+		out.Value = []byte(value)
+	}
+	return out, nil
+}
+
+func (c *directClient) RedisSet(ctx context.Context, in *pb.RedisSetStringRequest, opts ...grpc.CallOption) (*pb.RedisSetResponse, error) {
+	if c.redis == nil {
+		cli, err := poolClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return cli.RedisSet(ctx, in, opts...)
+	}
+	return c.redisSet(ctx, in.Key, in.Value, in.Ttl)
+}
+
+func (c *directClient) RedisBSet(ctx context.Context, in *pb.RedisSetBytesRequest, opts ...grpc.CallOption) (*pb.RedisSetResponse, error) {
+	if c.redis == nil {
+		cli, err := poolClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return cli.RedisBSet(ctx, in, opts...)
+	}
+	return c.redisSet(ctx, in.Key, string(in.Value), in.Ttl)
+}
+
+func (c *directClient) RedisDel(ctx context.Context, in *pb.RedisDelRequest, opts ...grpc.CallOption) (*pb.RedisDelResponse, error) {
+	if c.redis == nil {
+		cli, err := poolClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return cli.RedisDel(ctx, in, opts...)
+	}
+	_, err := c.redis.do(ctx, "DEL", in.Key)
+	return &pb.RedisDelResponse{Result: redisResult(err)}, redisCallError(err)
+}
+
+// RedisMGet 以一条 MGET 读取多个字符串值，键不存在时为空值
+func (c *directClient) RedisMGet(ctx context.Context, keys []string) ([]string, error) {
+	reply, err := c.redis.do(ctx, append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]any)
+	if len(items) != len(keys) {
+		return nil, fmt.Errorf("redis MGET returned %d values for %d keys", len(items), len(keys))
+	}
+	values := make([]string, len(keys))
+	for i, item := range items {
+		values[i], _ = item.(string)
+	}
+	return values, nil
+}
+
+// RedisMSet 以流水线发送多条 SET，一次往返写入全部值
+func (c *directClient) RedisMSet(ctx context.Context, reqs []*pb.RedisSetStringRequest) error {
+	cmds := make([][]string, len(reqs))
+	for i, req := range reqs {
+		cmds[i] = []string{"SET", req.Key, req.Value}
+		if req.Ttl > 0 {
+			cmds[i] = append(cmds[i], "EX", strconv.Itoa(int(req.Ttl)))
+		}
+	}
+	replies, err := c.redis.pipeline(ctx, cmds)
+	if err != nil {
+		return err
+	}
+	for i, reply := range replies {
+		if respErr, ok := reply.(resp.Error); ok {
+			return fmt.Errorf("redis SET %s: %v", reqs[i].Key, respErr)
+		}
+	}
+	return nil
+}
+
+// RedisMDel 以一条 DEL 删除多个键
+func (c *directClient) RedisMDel(ctx context.Context, keys []string) error {
+	_, err := c.redis.do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// redisResult Redis 的错误回复以 Result 返回
+func redisResult(err error) *pb.Result {
+	var respErr resp.Error
+	if errors.As(err, &respErr) {
+		return &pb.Result{Code: 1, Msg: respErr.Error()}
+	}
+	return &pb.Result{}
+}
+
+// redisCallError 只有连接错误作为调用错误返回
+func redisCallError(err error) error {
+	var respErr resp.Error
+	if errors.As(err, &respErr) {
+		return nil
+	}
+	return err
+}
+
+// redisPool 直连 Redis 的连接池，空闲连接数不超过 idle 的容量
+type redisPool struct {
+	addr     string
+	password string
+	db       int
+	idle     chan *resp.Conn
+	closed   atomic.Bool
+}
+
+// do 取出连接执行一条命令，连接错误时丢弃连接并返回 Unavailable，错误回复原样返回并保留连接
+func (p *redisPool) do(ctx context.Context, args ...string) (any, error) {
+	replies, err := p.pipeline(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if respErr, ok := replies[0].(resp.Error); ok {
+		return nil, respErr
+	}
+	return replies[0], nil
+}
+
+// pipeline 在一个连接上先发送全部命令再依次读取回复，只需一次往返；错误回复以 resp.Error 放在对应位置
+// 连接错误时丢弃连接并返回 Unavailable
+func (p *redisPool) pipeline(ctx context.Context, cmds [][]string) ([]any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisDialTimeout)
+	}
+	var conn *resp.Conn
+	select {
+	case conn = <-p.idle:
+	default:
+		var err error
+		if conn, err = p.dial(time.Until(deadline)); err != nil {
+			return nil, directError(ctx, err)
+		}
+	}
+	conn.SetDeadline(deadline)
+	replies, err := roundTrip(conn, cmds)
+	if err != nil {
+		conn.Close()
+		return nil, directError(ctx, err)
+	}
+	conn.SetDeadline(time.Time{})
+	if p.closed.Load() {
+		conn.Close()
+		return replies, nil
+	}
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return replies, nil
+}
+
+// roundTrip 发送命令并读取与之对应的回复
+func roundTrip(conn *resp.Conn, cmds [][]string) ([]any, error) {
+	for _, args := range cmds {
+		if err := conn.Send(args...); err != nil {
+			return nil, err
+		}
+	}
+	replies := make([]any, len(cmds))
+	for i := range cmds {
+		reply, err := conn.Read()
+		var respErr resp.Error
+		if errors.As(err, &respErr) {
+			replies[i] = respErr
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// dial 建立连接并选择配置的库
+func (p *redisPool) dial(timeout time.Duration) (*resp.Conn, error) {
+	conn, err := resp.Dial(p.addr, p.password, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if p.db != 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		if _, err := conn.Do("SELECT", strconv.Itoa(p.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("select db %d: %v", p.db, err)
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return conn, nil
+}
+
+// close 关闭空闲连接，正在使用的连接归还时关闭
+func (p *redisPool) close() {
+	p.closed.Store(true)
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
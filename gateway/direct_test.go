@@ -0,0 +1,254 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/resp"
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestReturnsRows(t *testing.T) {
+	for query, want := range map[string]bool{
+		"SELECT uid FROM session_db":                     true,
+		"  select 1":                                     true,
+		"(SELECT 1) UNION (SELECT 2)":                    true,
+		"WITH t AS (SELECT 1) SELECT * FROM t":           true,
+		"INSERT INTO session_db (session_id) VALUES (?)": false,
+		"DELETE FROM session_db WHERE session_id = ?":    false,
+		"": false,
+	} {
+		if got := returnsRows(query); got != want {
+			t.Errorf("returnsRows(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+// fakeRedis 只支持 GET、MGET、SET、DEL、PING 的 RESP 服务端
+func fakeRedis(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	data := map[string]string{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					var reply string
+					switch strings.ToUpper(args[0]) {
+					case "PING":
+						reply = "+PONG\r\n"
+					case "GET":
+						if v, ok := data[args[1]]; ok {
+							reply = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+						} else {
+							reply = "$-1\r\n"
+						}
+					case "MGET":
+						reply = "*" + strconv.Itoa(len(args)-1) + "\r\n"
+						for _, key := range args[1:] {
+							if v, ok := data[key]; ok {
+								reply += "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+							} else {
+								reply += "$-1\r\n"
+							}
+						}
+					case "SET":
+						data[args[1]] = args[2]
+						reply = "+OK\r\n"
+					case "DEL":
+						n := 0
+						for _, key := range args[1:] {
+							if _, ok := data[key]; ok {
+								n++
+							}
+							delete(data, key)
+						}
+						reply = fmt.Sprintf(":%d\r\n", n)
+					default:
+						reply = "-ERR unknown command\r\n"
+					}
+					mu.Unlock()
+					conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// readCommand 读取一条 RESP 数组格式的命令
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestDirectRedis(t *testing.T) {
+	c, err := newDirectClient(config.StorageConfig{
+		MySQL:        config.StorageDBGateway,
+		Redis:        config.StorageDirect,
+		RedisAddr:    fakeRedis(t),
+		RedisMaxIdle: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if res, err := c.RedisGet(ctx, &pb.RedisGetStringRequest{Key: "k"}); err != nil || res.Value != "" {
+		t.Fatalf("RedisGet(missing) = %+v, %v", res, err)
+	}
+	if _, err := c.RedisSet(ctx, &pb.RedisSetStringRequest{Key: "k", Value: "42", Ttl: 60}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := c.RedisGet(ctx, &pb.RedisGetStringRequest{Key: "k"}); err != nil || res.Value != "42" {
+		t.Fatalf("RedisGet() = %+v, %v", res, err)
+	}
+	if _, err := c.RedisDel(ctx, &pb.RedisDelRequest{Key: "k"}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := c.RedisBGet(ctx, &pb.RedisGetBytesRequest{Key: "k"}); err != nil || res.Value != nil {
+		t.Fatalf("RedisBGet(deleted) = %+v, %v", res, err)
+	}
+
+	// 错误回复以 Result 返回，连接保留
+	if _, err := c.redis.do(ctx, "FLUSHALL"); err == nil {
+		t.Fatal("unknown command succeeded")
+	} else if _, ok := err.(resp.Error); !ok {
+		t.Fatalf("error reply = %T %v, want resp.Error", err, err)
+	}
+	if len(c.redis.idle) == 0 {
+		t.Fatal("connection dropped after an error reply")
+	}
+
+	// MySQL 仍经由 DBGateway，连接池为空时不可用
+	if _, err := c.Mysql(ctx, &pb.SqlRequest{Sql: "SELECT 1"}); err != errNoConn {
+		t.Fatalf("Mysql() = %v, want errNoConn", err)
+	}
+}
+
+// perKeyClient 不支持批量读写的客户端，统计单个读写的次数
+type perKeyClient struct {
+	pb.StealthIMDBGatewayClient
+	gets, sets, dels atomic.Int32
+}
+
+func (c *perKeyClient) RedisGet(ctx context.Context, in *pb.RedisGetStringRequest, opts ...grpc.CallOption) (*pb.RedisGetStringResponse, error) {
+	c.gets.Add(1)
+	return c.StealthIMDBGatewayClient.RedisGet(ctx, in, opts...)
+}
+
+func (c *perKeyClient) RedisSet(ctx context.Context, in *pb.RedisSetStringRequest, opts ...grpc.CallOption) (*pb.RedisSetResponse, error) {
+	c.sets.Add(1)
+	return c.StealthIMDBGatewayClient.RedisSet(ctx, in, opts...)
+}
+
+func (c *perKeyClient) RedisDel(ctx context.Context, in *pb.RedisDelRequest, opts ...grpc.CallOption) (*pb.RedisDelResponse, error) {
+	c.dels.Add(1)
+	return c.StealthIMDBGatewayClient.RedisDel(ctx, in, opts...)
+}
+
+func TestExecRedisMulti(t *testing.T) {
+	saved := config.LatestConfig.DBGateway
+	t.Cleanup(func() { config.LatestConfig.DBGateway = saved })
+	config.LatestConfig.DBGateway.RedisTimeout = 1000
+
+	c, err := newDirectClient(config.StorageConfig{
+		MySQL:        config.StorageDBGateway,
+		Redis:        config.StorageDirect,
+		RedisAddr:    fakeRedis(t),
+		RedisMaxIdle: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	reqs := []*pb.RedisSetStringRequest{{Key: "a", Value: "1", Ttl: 60}, {Key: "c", Value: "3"}}
+	keys := []string{"a", "b", "c"}
+	want := []string{"1", "", "3"}
+
+	// 直连 Redis 时一次往返批量读写
+	ctx := WithClient(context.Background(), c)
+	if err := ExecRedisMSet(ctx, reqs); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ExecRedisMGet(ctx, keys); err != nil || !slices.Equal(got, want) {
+		t.Fatalf("ExecRedisMGet() = %q, %v, want %q", got, err, want)
+	}
+
+	// 不支持批量读写时拆分为单个调用
+	per := &perKeyClient{StealthIMDBGatewayClient: c}
+	ctx = WithClient(context.Background(), per)
+	if err := ExecRedisMSet(ctx, []*pb.RedisSetStringRequest{{Key: "b", Value: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	want[1] = "2"
+	if got, err := ExecRedisMGet(ctx, keys); err != nil || !slices.Equal(got, want) {
+		t.Fatalf("ExecRedisMGet() per key = %q, %v, want %q", got, err, want)
+	}
+	if per.gets.Load() != 3 || per.sets.Load() != 1 {
+		t.Fatalf("per-key calls = %d gets, %d sets, want 3 and 1", per.gets.Load(), per.sets.Load())
+	}
+
+	if got, err := ExecRedisMGet(ctx, nil); err != nil || got != nil {
+		t.Fatalf("ExecRedisMGet(nil) = %q, %v", got, err)
+	}
+
+	// 批量删除：不支持时拆分为单个调用，直连时一条 DEL
+	if err := ExecRedisMDel(ctx, []string{"a", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if per.dels.Load() != 2 {
+		t.Fatalf("per-key dels = %d, want 2", per.dels.Load())
+	}
+	ctx = WithClient(context.Background(), c)
+	if err := ExecRedisMDel(ctx, []string{"b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ExecRedisMGet(ctx, keys); err != nil || !slices.Equal(got, []string{"", "", ""}) {
+		t.Fatalf("ExecRedisMGet() after ExecRedisMDel = %q, %v", got, err)
+	}
+}
@@ -3,89 +3,403 @@ package gateway
 import (
 	pb "StealthIMSession/StealthIM.DBGateway"
 	"StealthIMSession/config"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
-var conns []*grpc.ClientConn
-var mainlock sync.Mutex
+var logger = logging.For("gateway")
 
-func createConn(connID int) {
-	log.Printf("[DB]Connect %d", connID+1)
-	conn, err := grpc.NewClient(fmt.Sprintf("%s:%d", config.LatestConfig.DBGateway.Host, config.LatestConfig.DBGateway.Port),
-		grpc.WithTransportCredentials(
-			insecure.NewCredentials()))
-	if conn == nil {
-		log.Printf("[DB]Connect %d Error %v\n", connID+1, err)
-		conns[connID] = nil
-		return
+// slot 连接池中的一个位置，连接断开重建时原地替换
+type slot struct {
+	conn    atomic.Pointer[grpc.ClientConn]
+	healthy atomic.Bool // 最近一次健康检查成功，只有健康的连接参与轮询
+	retired atomic.Bool // 已从连接池移除，健康检查随之退出
+
+	inflight atomic.Int64 // 连接上进行中的调用数，least_outstanding 策略据此选择连接
+}
+
+// track 统计经由连接的进行中调用，作为连接的拦截器
+func (s *slot) track(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// endpoint 一个 DBGateway 地址及其连接池
+type endpoint struct {
+	addr     string
+	priority int
+	weight   int
+	replica  bool // 只读副本，只处理 WithReplica 标记的调用
+
+	// pool 当前的连接池，扩缩容时整体替换（写时复制），调用方读取时无需加锁
+	// 只有 InitConns 会修改连接池
+	pool atomic.Pointer[[]*slot]
+	next atomic.Uint64 // 连接轮询计数器
+}
+
+// slots 返回端点当前的连接池
+func (ep *endpoint) slots() []*slot {
+	if p := ep.pool.Load(); p != nil {
+		return *p
 	}
-	if err != nil {
-		log.Printf("[DB]Connect %d Error %v\n", connID+1, err)
-		conns[connID] = nil
-		return
+	return nil
+}
+
+// available 判断端点是否有健康的连接
+func (ep *endpoint) available() bool {
+	for _, s := range ep.slots() {
+		if s.healthy.Load() && s.conn.Load() != nil {
+			return true
+		}
 	}
-	conns[connID] = conn
+	return false
 }
 
-func checkAlive(connID int) {
-	if len(conns) <= connID {
-		return
+// endpoints 正在使用的 DBGateway 端点，由 InitConns 设置
+var endpoints atomic.Pointer[endpointSet]
+
+// endpointSet 端点按优先级从高到低分组，副本与主端点分开
+type endpointSet struct {
+	all      []*endpoint
+	primary  [][]*endpoint
+	replicas [][]*endpoint
+}
+
+// newEndpointSet 按配置创建端点，未配置 endpoints 时使用 host:port
+func newEndpointSet(cfg config.DBGatewayConfig) *endpointSet {
+	list := cfg.Endpoints
+	if len(list) == 0 {
+		list = []config.DBGatewayEndpoint{{Host: cfg.Host, Port: cfg.Port}}
 	}
-	for {
-		if len(conns) <= connID {
-			return
+	eps := make([]*endpoint, 0, len(list))
+	for _, e := range list {
+		eps = append(eps, &endpoint{
+			addr:     net.JoinHostPort(e.Host, strconv.Itoa(e.Port)),
+			priority: e.Priority,
+			weight:   max(e.Weight, 1),
+			replica:  e.Replica,
+		})
+	}
+	return groupEndpoints(eps)
+}
+
+// groupEndpoints 将端点按优先级分组，同一优先级内保持配置顺序
+func groupEndpoints(eps []*endpoint) *endpointSet {
+	set := &endpointSet{all: eps}
+	sorted := slices.Clone(eps)
+	slices.SortStableFunc(sorted, func(a, b *endpoint) int { return a.priority - b.priority })
+	for _, ep := range sorted {
+		groups := &set.primary
+		if ep.replica {
+			groups = &set.replicas
+		}
+		if n := len(*groups); n > 0 && (*groups)[n-1][0].priority == ep.priority {
+			(*groups)[n-1] = append((*groups)[n-1], ep)
+		} else {
+			*groups = append(*groups, []*endpoint{ep})
 		}
-		mainlock.Lock()
-		if conns[connID] != nil {
-			cli := pb.NewStealthIMDBGatewayClient(conns[connID])
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-			_, err := cli.Ping(ctx, &pb.PingRequest{})
-			cancel()
+	}
+	return set
+}
+
+// currentEndpoints 返回正在使用的端点，连接池未启动时为 nil
+func currentEndpoints() *endpointSet {
+	return endpoints.Load()
+}
+
+// slots 返回所有端点的连接
+func slots() []*slot {
+	set := currentEndpoints()
+	if set == nil {
+		return nil
+	}
+	var all []*slot
+	for _, ep := range set.all {
+		all = append(all, ep.slots()...)
+	}
+	return all
+}
+
+func createConn(ep *endpoint, s *slot, connID int) *grpc.ClientConn {
+	logger.Info("connecting", "endpoint", ep.addr, "conn", connID+1)
+	opts := append(dialOptions(config.LatestConfig.DBGateway), grpc.WithChainUnaryInterceptor(s.track))
+	conn, err := grpc.NewClient(ep.addr, opts...)
+	if conn == nil || err != nil {
+		logger.Error("connect failed", "endpoint", ep.addr, "conn", connID+1, "error", err)
+		return nil
+	}
+	return conn
+}
+
+// pingConn 对连接执行一次健康检查
+func pingConn(conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := pb.NewStealthIMDBGatewayClient(conn).Ping(ctx, &pb.PingRequest{})
+	return err
+}
+
+// checkAlive 每隔 health_interval 秒检查连接，失败时将连接移出轮询并重建，重建后的连接检查成功才重新加入轮询
+// 连续失败时重建前按 redial_backoff 至 redial_max_backoff 退避，连接被移除或 Close 被调用后退出
+func checkAlive(ep *endpoint, s *slot, connID int) {
+	var backoff time.Duration
+	for !s.retired.Load() {
+		if conn := s.conn.Load(); conn != nil {
+			err := pingConn(conn)
 			if err == nil {
-				mainlock.Unlock()
+				if !s.healthy.Swap(true) {
+					logger.Info("conn healthy", "endpoint", ep.addr, "conn", connID+1)
+				}
+				backoff = 0
+				if !sleep(time.Duration(config.LatestConfig.DBGateway.HealthInterval) * time.Second) {
+					return
+				}
 				continue
 			}
+			metricHealthFailures.Inc()
+			if s.healthy.Swap(false) {
+				logger.Warn("conn unhealthy, redialing", "endpoint", ep.addr, "conn", connID+1, "error", err)
+			}
+			backoff = redialBackoff(backoff)
+			if !sleep(backoff) {
+				return
+			}
+			metricRedials.Inc()
 		}
-		createConn(connID)
-		mainlock.Unlock()
-		time.Sleep(5 * time.Second)
+		if old := s.conn.Swap(createConn(ep, s, connID)); old != nil {
+			old.Close()
+		}
+		if s.retired.Load() {
+			// 重建期间被移除，关闭刚建立的连接
+			retire(s)
+			return
+		}
+		if s.conn.Load() == nil {
+			backoff = redialBackoff(backoff)
+			if !sleep(backoff) {
+				return
+			}
+		}
+	}
+}
+
+// redialBackoff 返回下一次重建前的等待时间，首次为 redial_backoff，之后翻倍直到 redial_max_backoff
+func redialBackoff(prev time.Duration) time.Duration {
+	cfg := config.LatestConfig.DBGateway
+	return min(max(prev*2, time.Duration(cfg.RedialBackoff)*time.Millisecond), time.Duration(cfg.RedialMaxBackoff)*time.Millisecond)
+}
+
+// retire 关闭移除的连接，留出一个调用超时让进行中的请求完成
+func retire(s *slot) {
+	s.retired.Store(true)
+	s.healthy.Store(false)
+	if conn := s.conn.Swap(nil); conn != nil {
+		cfg := config.LatestConfig.DBGateway
+		time.AfterFunc(time.Duration(max(cfg.Timeout, cfg.RedisTimeout))*time.Millisecond, func() {
+			conn.Close()
+		})
 	}
 }
 
-// InitConns 扩缩容连接
+var (
+	closeOnce sync.Once
+	closing   = make(chan struct{}) // Close 时关闭，InitConns 随之退出
+	closed    = make(chan struct{}) // InitConns 关闭全部连接后关闭
+)
+
+// sleep 等待 d，Close 被调用时提前返回 false
+func sleep(d time.Duration) bool {
+	select {
+	case <-closing:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// poolStarted InitConns 已启动，Close 需要等待其退出
+var poolStarted atomic.Bool
+
+// Start 按 [storage] 配置打开直连的后端，MySQL 或 Redis 经由 DBGateway 时启动连接池
+func Start(cfg config.StorageConfig) error {
+	c, err := newDirectClient(cfg)
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		direct.Store(c)
+		logger.Info("direct storage enabled", "mysql", cfg.MySQL, "redis", cfg.Redis)
+	}
+	if usesDBGateway(cfg) {
+		poolStarted.Store(true)
+		go InitConns()
+	}
+	return nil
+}
+
+// usesDBGateway 判断是否有后端经由 DBGateway 访问
+func usesDBGateway(cfg config.StorageConfig) bool {
+	return cfg.MySQL != config.StorageDirect || cfg.Redis != config.StorageDirect
+}
+
+// Close 停止扩缩容并关闭全部连接，等待 InitConns 退出或 ctx 结束
+func Close(ctx context.Context) error {
+	closeOnce.Do(func() { close(closing) })
+	if c := direct.Swap(nil); c != nil {
+		c.close()
+	}
+	if !poolStarted.Load() {
+		return nil
+	}
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// InitConns 为每个端点扩缩容连接，直到 Close 被调用
 func InitConns() {
+	set := newEndpointSet(config.LatestConfig.DBGateway)
+	endpoints.Store(set)
+	for _, ep := range set.all {
+		metrics.NewGaugeFunc("stealthim_session_gateway_endpoint_healthy", "Whether the DBGateway endpoint has a healthy connection", func() int64 {
+			if ep.available() {
+				return 1
+			}
+			return 0
+		}, "endpoint", ep.addr)
+	}
 	defer func() {
-		mainlock.Lock()
-		for _, conn := range conns {
-			conn.Close()
+		for _, s := range slots() {
+			s.retired.Store(true)
+			if conn := s.conn.Swap(nil); conn != nil {
+				conn.Close()
+			}
 		}
-		mainlock.Unlock()
+		close(closed)
 	}()
-	log.Printf("[DB]Init Conns\n")
+	logger.Info("init conns", "endpoints", len(set.all))
+	if config.LatestConfig.DBGateway.Warmup {
+		warmUp(set)
+	}
 	for {
-		time.Sleep(time.Second * 1)
-		var lenTmp = len(conns)
-		if lenTmp < config.LatestConfig.DBGateway.ConnNum {
-			log.Printf("[DB]Create Conn %d\n", lenTmp+1)
-			mainlock.Lock()
-			conns = append(conns, nil)
-			mainlock.Unlock()
-			go checkAlive(lenTmp)
-		} else if lenTmp > config.LatestConfig.DBGateway.ConnNum {
-			log.Printf("[DB]Delete Conn %d\n", lenTmp)
-			mainlock.Lock()
-			conns[lenTmp-1].Close()
-			conns = conns[:lenTmp-1]
-			mainlock.Unlock()
-		} else {
-			time.Sleep(time.Second * 5)
+		if !sleep(time.Second * 1) {
+			return
 		}
+		metricConns.Set(int64(len(slots())))
+		changed := false
+		for _, ep := range set.all {
+			changed = resize(ep) || changed
+		}
+		if !changed && !sleep(time.Second*5) {
+			return
+		}
+	}
+}
+
+// resize 将端点的连接数向 conn_num 调整一个，返回是否有变化
+func resize(ep *endpoint) bool {
+	cur := ep.slots()
+	var lenTmp = len(cur)
+	if lenTmp < config.LatestConfig.DBGateway.ConnNum {
+		logger.Info("create conn", "endpoint", ep.addr, "conn", lenTmp+1)
+		s := &slot{}
+		next := append(append(make([]*slot, 0, lenTmp+1), cur...), s)
+		ep.pool.Store(&next)
+		go checkAlive(ep, s, lenTmp)
+		return true
+	} else if lenTmp > config.LatestConfig.DBGateway.ConnNum {
+		logger.Info("delete conn", "endpoint", ep.addr, "conn", lenTmp)
+		next := append(make([]*slot, 0, lenTmp-1), cur[:lenTmp-1]...)
+		ep.pool.Store(&next)
+		retire(cur[lenTmp-1])
+		return true
+	}
+	return false
+}
+
+// Backend 一个正在使用的存储后端
+type Backend struct {
+	Name string
+	Addr string
+	Ping func(ctx context.Context) error
+}
+
+// Backends 列出正在使用的后端：DBGateway 与直连的 MySQL、Redis
+func Backends() []Backend {
+	cfg := config.LatestConfig
+	var list []Backend
+	if usesDBGateway(cfg.Storage) {
+		var addrs []string
+		for _, ep := range newEndpointSet(cfg.DBGateway).all {
+			addrs = append(addrs, ep.addr)
+		}
+		list = append(list, Backend{
+			Name: "dbgateway",
+			Addr: strings.Join(addrs, ","),
+			Ping: pingPool,
+		})
+	}
+	c := direct.Load()
+	if c == nil {
+		return list
+	}
+	if c.db != nil {
+		list = append(list, Backend{Name: "mysql", Addr: c.mysqlAddr, Ping: func(ctx context.Context) error {
+			ctx, cancel := callContext(ctx, "mysql")
+			defer cancel()
+			if err := c.db.PingContext(ctx); err != nil {
+				return directError(ctx, err)
+			}
+			return nil
+		}})
+	}
+	if c.redis != nil {
+		list = append(list, Backend{Name: "redis", Addr: c.redis.addr, Ping: func(ctx context.Context) error {
+			ctx, cancel := callContext(ctx, "redis")
+			defer cancel()
+			_, err := c.redis.do(ctx, "PING")
+			return err
+		}})
+	}
+	return list
+}
+
+// Ping 检查正在使用的后端是否全部可用
+func Ping(ctx context.Context) error {
+	var errs []error
+	for _, b := range Backends() {
+		if err := b.Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pingPool 检查 DBGateway 是否可用（至少一个主端点可用）
+func pingPool(ctx context.Context) error {
+	conn, err := chooseConn(false)
+	if err != nil {
+		return err
 	}
+	ctx, cancel := callContext(ctx, "mysql")
+	defer cancel()
+	c := pb.NewStealthIMDBGatewayClient(conn)
+	_, err = c.Ping(ctx, &pb.PingRequest{})
+	return err
 }
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"StealthIMSession/metrics"
+	"strings"
+	"time"
+)
+
+// opMetrics 单类网关调用的指标
+type opMetrics struct {
+	op      string // 操作名，同时用作 span 名
+	system  string // 后端类型：mysql 或 redis
+	calls   *metrics.Counter
+	errors  *metrics.Counter
+	latency *metrics.Histogram
+	retries *metrics.Counter
+}
+
+func newOpMetrics(op string) *opMetrics {
+	system, _, _ := strings.Cut(op, "_")
+	return &opMetrics{
+		op:      op,
+		system:  system,
+		calls:   metrics.NewCounter("stealthim_session_gateway_calls_total", "DBGateway calls", "op", op),
+		errors:  metrics.NewCounter("stealthim_session_gateway_errors_total", "DBGateway calls that returned an error", "op", op),
+		latency: metrics.NewHistogram("stealthim_session_gateway_latency_seconds", "DBGateway call latency", nil, "op", op),
+		retries: metrics.NewCounter("stealthim_session_gateway_retries_total", "DBGateway calls retried after a retryable error", "op", op),
+	}
+}
+
+// observe 记录一次调用
+func (m *opMetrics) observe(start time.Time, err error) {
+	m.calls.Inc()
+	if err != nil {
+		m.errors.Inc()
+	}
+	m.latency.ObserveSince(start)
+}
+
+var (
+	metricSQL       = newOpMetrics("mysql")
+	metricRedisGet  = newOpMetrics("redis_get")
+	metricRedisSet  = newOpMetrics("redis_set")
+	metricRedisBGet = newOpMetrics("redis_bget")
+	metricRedisBSet = newOpMetrics("redis_bset")
+	metricRedisDel  = newOpMetrics("redis_del")
+	metricRedisMGet = newOpMetrics("redis_mget")
+	metricRedisMSet = newOpMetrics("redis_mset")
+	metricRedisMDel = newOpMetrics("redis_mdel")
+	metricConns     = metrics.NewGauge("stealthim_session_gateway_conns", "DBGateway connection slots in the pool")
+
+	metricHealthFailures = metrics.NewCounter("stealthim_session_gateway_health_failures_total", "DBGateway connection health checks that failed")
+	metricRedials        = metrics.NewCounter("stealthim_session_gateway_redials_total", "DBGateway connections re-dialed after a failed health check")
+
+	metricFailovers        = metrics.NewCounter("stealthim_session_gateway_failovers_total", "DBGateway calls sent to a lower-priority endpoint because higher-priority endpoints were down")
+	metricReplicaFallbacks = metrics.NewCounter("stealthim_session_gateway_replica_fallbacks_total", "Replica reads sent to a primary endpoint because no replica was available")
+)
+
+func init() {
+	metrics.NewGaugeFunc("stealthim_session_gateway_conns_healthy", "DBGateway connections that passed the last health check and receive requests", func() int64 {
+		var n int64
+		for _, s := range slots() {
+			if s.healthy.Load() {
+				n++
+			}
+		}
+		return n
+	})
+	metrics.NewGaugeFunc("stealthim_session_gateway_inflight", "DBGateway calls in flight across pooled connections", func() int64 {
+		var n int64
+		for _, s := range slots() {
+			n += s.inflight.Load()
+		}
+		return n
+	})
+}
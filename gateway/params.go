@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"context"
+	"fmt"
+	"time"
+)
+
+// sqlTimeLayout MySQL DATETIME/TIMESTAMP 参数格式
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+// ToParam 将 Go 值转换为 SQL 参数
+// 支持 string、int、int32、int64、bool、float32、float64、[]byte、time.Time 与 nil
+func ToParam(v any) (*pb.InterFaceType, error) {
+	switch val := v.(type) {
+	case nil:
+		return &pb.InterFaceType{Null: true}, nil
+	case string:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Str{Str: val}}, nil
+	case int:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Int64{Int64: int64(val)}}, nil
+	case int32:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Int32{Int32: val}}, nil
+	case int64:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Int64{Int64: val}}, nil
+	case bool:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Bool{Bool: val}}, nil
+	case float32:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Float{Float: val}}, nil
+	case float64:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Double{Double: val}}, nil
+	case []byte:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Blob{Blob: val}}, nil
+	case time.Time:
+		return &pb.InterFaceType{Response: &pb.InterFaceType_Str{Str: val.Format(sqlTimeLayout)}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported sql param type %T", v)
+	}
+}
+
+// BuildSQL 生成参数化 SQL 请求，语句中使用 ? 作为占位符
+func BuildSQL(db pb.SqlDatabases, commit bool, sql string, args ...any) (*pb.SqlRequest, error) {
+	params := make([]*pb.InterFaceType, 0, len(args))
+	for i, arg := range args {
+		param, err := ToParam(arg)
+		if err != nil {
+			return nil, fmt.Errorf("param %d: %v", i, err)
+		}
+		params = append(params, param)
+	}
+	return &pb.SqlRequest{
+		Sql:    sql,
+		Db:     db,
+		Params: params,
+		Commit: commit,
+	}, nil
+}
+
+// ExecSQLParams 运行参数化 SQL 语句，语句中使用 ? 作为占位符
+func ExecSQLParams(ctx context.Context, db pb.SqlDatabases, commit bool, sql string, args ...any) (*pb.SqlResponse, error) {
+	req, err := BuildSQL(db, commit, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ExecSQL(ctx, req)
+}
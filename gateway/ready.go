@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"fmt"
+	"time"
+)
+
+// 等待后端就绪时的重试间隔
+const (
+	readyMinBackoff = 100 * time.Millisecond
+	readyMaxBackoff = 2 * time.Second
+)
+
+// WaitReady 等待正在使用的后端全部可用（DBGateway 至少有一个连接可用），按退避间隔重试
+// 启用 dbgateway.warmup 时首次还需等待连接池预热完成，见 checkWarm
+// ctx 结束或 Close 被调用时返回最后一次检查的错误
+func WaitReady(ctx context.Context) error {
+	cfg := config.LatestConfig
+	if !cfg.DBGateway.Warmup || !usesDBGateway(cfg.Storage) {
+		return waitFor(ctx, Ping)
+	}
+	return waitFor(ctx, func(ctx context.Context) error {
+		if err := checkWarm(ctx); err != nil {
+			return err
+		}
+		return Ping(ctx)
+	})
+}
+
+func waitFor(ctx context.Context, ping func(context.Context) error) error {
+	backoff := readyMinBackoff
+	for {
+		err := ping(ctx)
+		if err == nil {
+			return nil
+		}
+		logger.Debug("backends not ready", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("backends not ready: %w", err)
+		case <-closing:
+			return fmt.Errorf("gateway closed: %w", err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, readyMaxBackoff)
+	}
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitFor(t *testing.T) {
+	// 后端恢复后返回
+	calls := 0
+	err := waitFor(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("no connection")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("waitFor() = %v after %d calls, want nil after 3", err, calls)
+	}
+
+	// 超时时返回最后一次的错误
+	down := errors.New("down")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := waitFor(ctx, func(context.Context) error { return down }); !errors.Is(err, down) {
+		t.Fatalf("waitFor() timed out = %v, want %v", err, down)
+	}
+}
+
+func TestCheckWarm(t *testing.T) {
+	saved := config.LatestConfig.DBGateway
+	t.Cleanup(func() {
+		config.LatestConfig.DBGateway = saved
+		warmedUp.Store(false)
+	})
+	config.LatestConfig.DBGateway.ConnNum = 3
+
+	// 只读副本与低优先级端点不参与预热
+	primary := &endpoint{addr: "127.0.0.1:1", weight: 1}
+	fallback := &endpoint{addr: "127.0.0.1:2", weight: 1, priority: 1}
+	replica := &endpoint{addr: "127.0.0.1:3", weight: 1, replica: true}
+	fillEndpoint(t, primary, 3, 2)
+	fillEndpoint(t, fallback, 1)
+	fillEndpoint(t, replica, 1)
+	useEndpoints(t, primary, fallback, replica)
+
+	if err := checkWarm(context.Background()); err == nil {
+		t.Fatal("checkWarm() with 2/3 connections = nil, want error")
+	}
+	cur := primary.slots()
+	conn := fillEndpoint(t, &endpoint{addr: primary.addr}, 1)[0]
+	cur[2].conn.Store(conn)
+	if err := checkWarm(context.Background()); err != nil {
+		t.Fatalf("checkWarm() = %v, want nil", err)
+	}
+
+	// 预热完成后连接断开不再影响
+	cur[0].healthy.Store(false)
+	if err := checkWarm(context.Background()); err != nil {
+		t.Fatalf("checkWarm() after warm-up = %v, want nil", err)
+	}
+}
@@ -2,82 +2,184 @@ package gateway
 
 import (
 	pb "StealthIMSession/StealthIM.DBGateway"
-	"StealthIMSession/config"
 	"context"
-	"time"
+	"errors"
+	"fmt"
+	"sync"
 )
 
 // ExecRedisGet 运行 Redis 查询
-func ExecRedisGet(req *pb.RedisGetStringRequest) (*pb.RedisGetStringResponse, error) {
-	mainlock.Lock()
-	defer mainlock.Unlock()
-	conn, err := chooseConn()
-	if err != nil {
-		return nil, err
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.LatestConfig.DBGateway.Timeout)*time.Millisecond)
-	defer cancel()
-	c := pb.NewStealthIMDBGatewayClient(conn)
-	res, err2 := c.RedisGet(ctx, req)
-	return res, err2
+func ExecRedisGet(ctx context.Context, req *pb.RedisGetStringRequest) (*pb.RedisGetStringResponse, error) {
+	var res *pb.RedisGetStringResponse
+	err := retryCall(ctx, metricRedisGet, func(ctx context.Context, c pb.StealthIMDBGatewayClient) (err error) {
+		res, err = c.RedisGet(ctx, req)
+		return err
+	})
+	return res, err
 }
 
 // ExecRedisSet 运行 Redis 写入
-func ExecRedisSet(req *pb.RedisSetStringRequest) (*pb.RedisSetResponse, error) {
-	mainlock.Lock()
-	defer mainlock.Unlock()
-	conn, err := chooseConn()
-	if err != nil {
-		return nil, err
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.LatestConfig.DBGateway.Timeout)*time.Millisecond)
-	defer cancel()
-	c := pb.NewStealthIMDBGatewayClient(conn)
-	res, err2 := c.RedisSet(ctx, req)
-	return res, err2
+func ExecRedisSet(ctx context.Context, req *pb.RedisSetStringRequest) (*pb.RedisSetResponse, error) {
+	var res *pb.RedisSetResponse
+	err := retryCall(ctx, metricRedisSet, func(ctx context.Context, c pb.StealthIMDBGatewayClient) (err error) {
+		res, err = c.RedisSet(ctx, req)
+		return err
+	})
+	return res, err
 }
 
 // ExecRedisBGet 运行 Redis 二进制查询
-func ExecRedisBGet(req *pb.RedisGetBytesRequest) (*pb.RedisGetBytesResponse, error) {
-	mainlock.Lock()
-	defer mainlock.Unlock()
-	conn, err := chooseConn()
-	if err != nil {
-		return nil, err
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.LatestConfig.DBGateway.Timeout)*time.Millisecond)
-	defer cancel()
-	c := pb.NewStealthIMDBGatewayClient(conn)
-	res, err2 := c.RedisBGet(ctx, req)
-	return res, err2
+func ExecRedisBGet(ctx context.Context, req *pb.RedisGetBytesRequest) (*pb.RedisGetBytesResponse, error) {
+	var res *pb.RedisGetBytesResponse
+	err := call(ctx, metricRedisBGet, func(ctx context.Context, c pb.StealthIMDBGatewayClient) (err error) {
+		res, err = c.RedisBGet(ctx, req)
+		return err
+	})
+	return res, err
 }
 
 // ExecRedisBSet 运行 Redis 二进制写入
-func ExecRedisBSet(req *pb.RedisSetBytesRequest) (*pb.RedisSetResponse, error) {
-	mainlock.Lock()
-	defer mainlock.Unlock()
-	conn, err := chooseConn()
+func ExecRedisBSet(ctx context.Context, req *pb.RedisSetBytesRequest) (*pb.RedisSetResponse, error) {
+	var res *pb.RedisSetResponse
+	err := call(ctx, metricRedisBSet, func(ctx context.Context, c pb.StealthIMDBGatewayClient) (err error) {
+		res, err = c.RedisBSet(ctx, req)
+		return err
+	})
+	return res, err
+}
+
+// ExecRedisDel 运行 Redis 删除
+func ExecRedisDel(ctx context.Context, req *pb.RedisDelRequest) (*pb.RedisDelResponse, error) {
+	var res *pb.RedisDelResponse
+	err := call(ctx, metricRedisDel, func(ctx context.Context, c pb.StealthIMDBGatewayClient) (err error) {
+		res, err = c.RedisDel(ctx, req)
+		return err
+	})
+	return res, err
+}
+
+// RedisBatcher 能在一次往返中批量读写 Redis 的客户端，直连 Redis 与内存实现支持
+// DBGateway 没有批量接口，经由 DBGateway 时批量读写拆分为并发的单个调用
+type RedisBatcher interface {
+	// RedisMGet 读取多个字符串值，顺序与 keys 相同，键不存在时为空值
+	RedisMGet(ctx context.Context, keys []string) ([]string, error)
+	// RedisMSet 写入多个字符串值
+	RedisMSet(ctx context.Context, reqs []*pb.RedisSetStringRequest) error
+	// RedisMDel 删除多个键，键不存在时不报错
+	RedisMDel(ctx context.Context, keys []string) error
+}
+
+// redisMultiConcurrency 经由 DBGateway 批量读写时同时进行的调用数上限
+// 调用在 HTTP/2 连接上并发进行，不超过上限时总耗时接近一次往返
+const redisMultiConcurrency = 32
+
+// redisBatcher 返回本次调用可批量读写的客户端，经由 DBGateway 时返回 nil
+func redisBatcher(ctx context.Context) RedisBatcher {
+	c, err := chooseClient(ctx)
 	if err != nil {
-		return nil, err
+		return nil
+	}
+	if d, ok := c.(*directClient); ok && d.redis == nil {
+		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.LatestConfig.DBGateway.Timeout)*time.Millisecond)
-	defer cancel()
-	c := pb.NewStealthIMDBGatewayClient(conn)
-	res, err2 := c.RedisBSet(ctx, req)
-	return res, err2
+	b, _ := c.(RedisBatcher)
+	return b
 }
 
-// ExecRedisDel 运行 Redis 删除
-func ExecRedisDel(req *pb.RedisDelRequest) (*pb.RedisDelResponse, error) {
-	mainlock.Lock()
-	defer mainlock.Unlock()
-	conn, err := chooseConn()
+// ExecRedisMGet 读取多个字符串值，顺序与 keys 相同，键不存在时为空值
+// 直连 Redis 时为一条 MGET，经由 DBGateway 时并发执行 ExecRedisGet；任一读取失败时返回错误
+func ExecRedisMGet(ctx context.Context, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if b := redisBatcher(ctx); b != nil {
+		var values []string
+		err := retryCall(ctx, metricRedisMGet, func(ctx context.Context, _ pb.StealthIMDBGatewayClient) (err error) {
+			values, err = b.RedisMGet(ctx, keys)
+			return err
+		})
+		return values, err
+	}
+	values := make([]string, len(keys))
+	err := fanOut(len(keys), func(i int) error {
+		res, err := ExecRedisGet(ctx, &pb.RedisGetStringRequest{Key: keys[i]})
+		if err != nil {
+			return err
+		}
+		if res.Result != nil && res.Result.Code != 0 {
+			return fmt.Errorf("redis get %s: %s", keys[i], res.Result.Msg)
+		}
+		values[i] = res.Value
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.LatestConfig.DBGateway.Timeout)*time.Millisecond)
-	defer cancel()
-	c := pb.NewStealthIMDBGatewayClient(conn)
-	res, err2 := c.RedisDel(ctx, req)
-	return res, err2
+	return values, nil
+}
+
+// ExecRedisMSet 写入多个字符串值
+// 直连 Redis 时以流水线一次往返写入，经由 DBGateway 时并发执行 ExecRedisSet；返回全部失败写入的错误
+func ExecRedisMSet(ctx context.Context, reqs []*pb.RedisSetStringRequest) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+	if b := redisBatcher(ctx); b != nil {
+		return retryCall(ctx, metricRedisMSet, func(ctx context.Context, _ pb.StealthIMDBGatewayClient) error {
+			return b.RedisMSet(ctx, reqs)
+		})
+	}
+	return fanOut(len(reqs), func(i int) error {
+		res, err := ExecRedisSet(ctx, reqs[i])
+		if err != nil {
+			return err
+		}
+		if res.Result != nil && res.Result.Code != 0 {
+			return fmt.Errorf("redis set %s: %s", reqs[i].Key, res.Result.Msg)
+		}
+		return nil
+	})
+}
+
+// ExecRedisMDel 删除多个键
+// 直连 Redis 时为一条 DEL，经由 DBGateway 时并发执行 ExecRedisDel；返回全部失败删除的错误
+func ExecRedisMDel(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if b := redisBatcher(ctx); b != nil {
+		return call(ctx, metricRedisMDel, func(ctx context.Context, _ pb.StealthIMDBGatewayClient) error {
+			return b.RedisMDel(ctx, keys)
+		})
+	}
+	return fanOut(len(keys), func(i int) error {
+		res, err := ExecRedisDel(ctx, &pb.RedisDelRequest{Key: keys[i]})
+		if err != nil {
+			return err
+		}
+		if res.Result != nil && res.Result.Code != 0 {
+			return fmt.Errorf("redis del %s: %s", keys[i], res.Result.Msg)
+		}
+		return nil
+	})
+}
+
+// fanOut 并发执行 fn(0) 至 fn(n-1)，同时进行的调用不超过 redisMultiConcurrency，返回全部错误
+func fanOut(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, redisMultiConcurrency)
+	var wg sync.WaitGroup
+	for i := range n {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
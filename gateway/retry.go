@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// retryCall 执行网关调用，失败且状态码可重试时按指数退避重试
+// 退避时间为 [0, min(retry_backoff*2^n, retry_max_backoff)) 内的随机值，调用方上下文结束时不再重试
+func retryCall(ctx context.Context, m *opMetrics, fn func(context.Context, pb.StealthIMDBGatewayClient) error) error {
+	cfg := config.LatestConfig.DBGateway
+	attempts := max(cfg.RetryAttempts, 1)
+	backoff := time.Duration(cfg.RetryBackoff) * time.Millisecond
+	maxBackoff := time.Duration(cfg.RetryMaxBackoff) * time.Millisecond
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = call(ctx, m, fn)
+		if err == nil || attempt >= attempts || !retryable(err, cfg.RetryCodes) {
+			return err
+		}
+		m.retries.Inc()
+
+		wait := time.Duration(0)
+		if backoff > 0 {
+			wait = time.Duration(rand.Int64N(int64(min(backoff<<(attempt-1), maxBackoff)) + 1))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent 返回在其中执行的 SQL 写语句也可以重试的上下文
+// 只用于重复执行结果不变的语句（如 CREATE TABLE IF NOT EXISTS、INSERT IGNORE 版本记录）：
+// 请求已执行但响应丢失时重试会再执行一次，普通 INSERT 会因主键重复失败，DELETE 会报告删除了 0 行
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// sqlRetrySafe 判断 SQL 请求失败后能否重试：只读查询（SELECT 且不提交），或在 WithIdempotent 的上下文中执行
+func sqlRetrySafe(ctx context.Context, req *pb.SqlRequest) bool {
+	if v, _ := ctx.Value(idempotentKey{}).(bool); v {
+		return true
+	}
+	sql := strings.TrimSpace(req.Sql)
+	return !req.Commit && len(sql) >= 6 && strings.EqualFold(sql[:6], "SELECT")
+}
+
+// retryable 判断错误的 gRPC 状态码是否在可重试列表中
+func retryable(err error, codes []string) bool {
+	return slices.Contains(codes, status.Code(err).String())
+}
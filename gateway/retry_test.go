@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryCall(t *testing.T) {
+	fillPool(t, 1)
+	config.LatestConfig.DBGateway.RetryAttempts = 3
+	config.LatestConfig.DBGateway.RetryBackoff = 1
+	config.LatestConfig.DBGateway.RetryMaxBackoff = 2
+	config.LatestConfig.DBGateway.RetryCodes = []string{"Unavailable"}
+	defer func() { config.LatestConfig.DBGateway.RetryAttempts = 0 }()
+
+	// 可重试的错误在次数内恢复
+	calls := 0
+	err := retryCall(context.Background(), metricSQL, func(context.Context, pb.StealthIMDBGatewayClient) error {
+		calls++
+		if calls < 3 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("retryable: err=%v calls=%d, want nil after 3 calls", err, calls)
+	}
+
+	// 超过次数后返回最后一次的错误
+	calls = 0
+	err = retryCall(context.Background(), metricSQL, func(context.Context, pb.StealthIMDBGatewayClient) error {
+		calls++
+		return status.Error(codes.Unavailable, "down")
+	})
+	if status.Code(err) != codes.Unavailable || calls != 3 {
+		t.Fatalf("exhausted: err=%v calls=%d, want Unavailable after 3 calls", err, calls)
+	}
+
+	// 不可重试的错误直接返回
+	calls = 0
+	err = retryCall(context.Background(), metricSQL, func(context.Context, pb.StealthIMDBGatewayClient) error {
+		calls++
+		return status.Error(codes.InvalidArgument, "bad sql")
+	})
+	if status.Code(err) != codes.InvalidArgument || calls != 1 {
+		t.Fatalf("non-retryable: err=%v calls=%d, want InvalidArgument after 1 call", err, calls)
+	}
+}
+
+func TestSQLRetrySafe(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		req  *pb.SqlRequest
+		want bool
+	}{
+		{&pb.SqlRequest{Sql: "SELECT uid FROM session_db WHERE session_id = ?"}, true},
+		{&pb.SqlRequest{Sql: "  select 1"}, true},
+		{&pb.SqlRequest{Sql: "SELECT 1", Commit: true}, false},
+		{&pb.SqlRequest{Sql: "INSERT INTO session_db (session_id) VALUES (?)"}, false},
+		{&pb.SqlRequest{Sql: "DELETE FROM session_db WHERE session_id = ?"}, false},
+	} {
+		if got := sqlRetrySafe(ctx, tc.req); got != tc.want {
+			t.Errorf("sqlRetrySafe(%q, commit=%v) = %v, want %v", tc.req.Sql, tc.req.Commit, got, tc.want)
+		}
+	}
+	// 标记为幂等的写语句可以重试
+	if !sqlRetrySafe(WithIdempotent(ctx), &pb.SqlRequest{Sql: "CREATE TABLE IF NOT EXISTS t (id INT)", Commit: true}) {
+		t.Error("sqlRetrySafe() = false for idempotent statement")
+	}
+}
@@ -1,21 +1,218 @@
 package gateway
 
 import (
-	"errors"
-	"math/rand"
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/tracing"
+	"context"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// chooseConn 随机选择链接
-func chooseConn() (*grpc.ClientConn, error) {
-	if len(conns) == 0 {
-		return nil, errors.New("No available connections")
+// errNoConn 连接池为空或全部连接正在重建，使用 Unavailable 状态码以便重试
+var errNoConn = status.Error(codes.Unavailable, "No available connections")
+
+// nextEndpoint 同一优先级端点间按权重轮询的计数器
+var nextEndpoint atomic.Uint64
+
+// chooseConn 选择连接：replica 为 true 时优先使用可用的只读副本，否则（或副本全部不可用时）使用主端点
+// 端点按优先级从高到低尝试，同一优先级的可用端点按权重分配，端点内轮询跳过健康检查失败与正在重建的连接
+func chooseConn(replica bool) (*grpc.ClientConn, error) {
+	set := currentEndpoints()
+	if set == nil {
+		return nil, errNoConn
+	}
+	if replica && len(set.replicas) > 0 {
+		if conn, _ := pickGroups(set.replicas); conn != nil {
+			return conn, nil
+		}
+		metricReplicaFallbacks.Inc()
+	}
+	conn, level := pickGroups(set.primary)
+	if conn == nil {
+		return nil, errNoConn
+	}
+	if level > 0 {
+		metricFailovers.Inc()
+	}
+	return conn, nil
+}
+
+// pickGroups 依次在各优先级中选择连接，返回连接与所在优先级的序号
+func pickGroups(groups [][]*endpoint) (*grpc.ClientConn, int) {
+	for i, group := range groups {
+		if conn := pickGroup(group); conn != nil {
+			return conn, i
+		}
+	}
+	return nil, 0
+}
+
+// pickGroup 在同一优先级的可用端点间按权重选择连接
+func pickGroup(group []*endpoint) *grpc.ClientConn {
+	total := 0
+	for _, ep := range group {
+		if ep.available() {
+			total += ep.weight
+		}
 	}
-	for {
-		conntmp := conns[rand.Intn(len(conns))]
-		if conntmp != nil {
-			return conntmp, nil
+	if total == 0 {
+		return nil
+	}
+	n := int(nextEndpoint.Add(1) % uint64(total))
+	for _, ep := range group {
+		if !ep.available() {
+			continue
+		}
+		if n < ep.weight {
+			if conn := ep.choose(); conn != nil {
+				return conn
+			}
+			break
+		}
+		n -= ep.weight
+	}
+	// 选中的端点刚刚变为不可用，改用其他端点
+	for _, ep := range group {
+		if conn := ep.choose(); conn != nil {
+			return conn
+		}
+	}
+	return nil
+}
+
+// choose 按 dbgateway.balance 在端点的连接间选择，跳过健康检查失败与正在重建的连接
+func (ep *endpoint) choose() *grpc.ClientConn {
+	cur := ep.slots()
+	if len(cur) == 0 {
+		return nil
+	}
+	switch config.LatestConfig.DBGateway.Balance {
+	case config.BalanceRandom:
+		return chooseFrom(cur, rand.Uint64())
+	case config.BalanceLeastOutstanding:
+		return leastOutstanding(cur, ep.next.Add(1))
+	default:
+		return chooseFrom(cur, ep.next.Add(1))
+	}
+}
+
+// chooseFrom 从位置 start 起选择第一个可用的连接
+func chooseFrom(cur []*slot, start uint64) *grpc.ClientConn {
+	for i := range cur {
+		s := cur[(start+uint64(i))%uint64(len(cur))]
+		if !s.healthy.Load() {
+			continue
+		}
+		if conn := s.conn.Load(); conn != nil {
+			return conn
 		}
 	}
+	return nil
+}
+
+// leastOutstanding 选择进行中调用最少的可用连接，避免请求排在长时间执行的 SQL 之后
+// 调用数相同时从位置 start 起取第一个，使空闲时的请求仍然轮询各连接
+func leastOutstanding(cur []*slot, start uint64) *grpc.ClientConn {
+	var best *grpc.ClientConn
+	var bestN int64
+	for i := range cur {
+		s := cur[(start+uint64(i))%uint64(len(cur))]
+		if !s.healthy.Load() {
+			continue
+		}
+		conn := s.conn.Load()
+		if conn == nil {
+			continue
+		}
+		if n := s.inflight.Load(); best == nil || n < bestN {
+			best, bestN = conn, n
+		}
+	}
+	return best
+}
+
+// override 替代连接池的客户端，见 Override
+var override atomic.Pointer[pb.StealthIMDBGatewayClient]
+
+// Override 使之后的网关调用改用 c 而不经过连接池，返回恢复连接池的函数
+// 熔断、重试、指标与追踪仍然生效，用于在没有 DBGateway 时测试上层逻辑
+func Override(c pb.StealthIMDBGatewayClient) (restore func()) {
+	override.Store(&c)
+	return func() { override.Store(nil) }
+}
+
+// clientKey 上下文中注入的客户端，见 WithClient
+type clientKey struct{}
+
+// WithClient 返回在其中的网关调用改用 c 的上下文，优先于 Override
+// 用于按请求注入存储（如测试中的内存实现），由其派生的上下文同样生效
+func WithClient(ctx context.Context, c pb.StealthIMDBGatewayClient) context.Context {
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+// replicaKey 上下文中允许读副本的标记，见 WithReplica
+type replicaKey struct{}
+
+// WithReplica 返回在其中的网关调用优先发往只读副本端点的上下文，没有可用副本时仍使用主端点
+// 只用于能容忍复制延迟的只读查询（如后台扫描），写入与会话查询不应使用
+func WithReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, true)
+}
+
+// useReplica 判断 ctx 是否允许读副本
+func useReplica(ctx context.Context) bool {
+	v, _ := ctx.Value(replicaKey{}).(bool)
+	return v
+}
+
+// chooseClient 返回本次调用使用的客户端
+func chooseClient(ctx context.Context) (pb.StealthIMDBGatewayClient, error) {
+	if c, ok := ctx.Value(clientKey{}).(pb.StealthIMDBGatewayClient); ok {
+		return c, nil
+	}
+	if c := override.Load(); c != nil {
+		return *c, nil
+	}
+	if c := direct.Load(); c != nil {
+		return c, nil
+	}
+	return poolClient(ctx)
+}
+
+// call 选择连接执行一次网关调用并记录指标与 span，调用期间不持有任何锁
+// 调用在 ctx 取消或超时时中止，追踪上下文通过 metadata 传给 DBGateway；熔断期间直接返回 ErrCircuitOpen
+func call(ctx context.Context, m *opMetrics, fn func(context.Context, pb.StealthIMDBGatewayClient) error) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "gateway."+m.op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", m.system), attribute.String("db.operation", m.op)))
+	defer func() {
+		m.observe(start, err)
+		tracing.End(span, err)
+	}()
+
+	// 调用方已取消或超时时不再发起调用
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !gatewayBreaker.allow() {
+		return ErrCircuitOpen
+	}
+	client, err := chooseClient(ctx)
+	if err != nil {
+		gatewayBreaker.record(err, false)
+		return err
+	}
+	callCtx, cancel := callContext(tracing.Inject(ctx), m.system)
+	defer cancel()
+	err = fn(callCtx, client)
+	gatewayBreaker.record(err, ctx.Err() != nil)
+	return err
 }
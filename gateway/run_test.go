@@ -0,0 +1,326 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/tracing"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// fillPool 用未连接但标记为健康的客户端填充单个端点的连接池，missing 中的位置为正在重建
+func fillPool(t testing.TB, n int, missing ...int) []*grpc.ClientConn {
+	ep := &endpoint{addr: "127.0.0.1:1", weight: 1}
+	conns := fillEndpoint(t, ep, n, missing...)
+	useEndpoints(t, ep)
+	return conns
+}
+
+// fillEndpoint 用未连接但标记为健康的客户端填充端点的连接池
+func fillEndpoint(t testing.TB, ep *endpoint, n int, missing ...int) []*grpc.ClientConn {
+	config.LatestConfig.DBGateway.Timeout = 1000
+	conns := make([]*grpc.ClientConn, n)
+	cur := make([]*slot, n)
+	for i := range cur {
+		cur[i] = &slot{}
+		conn, err := grpc.NewClient(ep.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = conn
+		cur[i].conn.Store(conn)
+		cur[i].healthy.Store(true)
+	}
+	for _, i := range missing {
+		cur[i].conn.Store(nil)
+	}
+	ep.pool.Store(&cur)
+	t.Cleanup(func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	return conns
+}
+
+// useEndpoints 以 eps 作为正在使用的端点
+func useEndpoints(t testing.TB, eps ...*endpoint) {
+	endpoints.Store(groupEndpoints(eps))
+	t.Cleanup(func() { endpoints.Store(nil) })
+}
+
+func TestChooseConnRoundRobin(t *testing.T) {
+	conns := fillPool(t, 3, 1)
+
+	seen := make(map[*grpc.ClientConn]int)
+	for i := 0; i < 300; i++ {
+		conn, err := chooseConn(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[conn]++
+	}
+	// 位置 1 正在重建，其请求顺延到下一个连接
+	if seen[conns[1]] != 0 || seen[conns[0]] != 100 || seen[conns[2]] != 200 {
+		t.Fatalf("distribution = %v %v %v", seen[conns[0]], seen[conns[1]], seen[conns[2]])
+	}
+
+	// 健康检查失败的连接移出轮询
+	cur := slots()
+	cur[0].healthy.Store(false)
+	for i := 0; i < 10; i++ {
+		if conn, err := chooseConn(false); err != nil || conn != conns[2] {
+			t.Fatalf("chooseConn() with conn 0 unhealthy = %v, %v", conn, err)
+		}
+	}
+	cur[2].healthy.Store(false)
+	if _, err := chooseConn(false); err == nil {
+		t.Fatal("chooseConn() with no healthy conn succeeded")
+	}
+
+	endpoints.Store(nil)
+	if _, err := chooseConn(false); err == nil {
+		t.Fatal("chooseConn() on empty pool succeeded")
+	}
+}
+
+func TestChooseConnBalance(t *testing.T) {
+	saved := config.LatestConfig.DBGateway.Balance
+	t.Cleanup(func() { config.LatestConfig.DBGateway.Balance = saved })
+	conns := fillPool(t, 3, 1)
+	cur := slots()
+
+	// 随机选择只使用可用的连接
+	config.LatestConfig.DBGateway.Balance = config.BalanceRandom
+	seen := make(map[*grpc.ClientConn]int)
+	for range 300 {
+		conn, err := chooseConn(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[conn]++
+	}
+	if seen[conns[1]] != 0 || seen[conns[0]] == 0 || seen[conns[2]] == 0 {
+		t.Fatalf("random distribution = %v %v %v", seen[conns[0]], seen[conns[1]], seen[conns[2]])
+	}
+
+	// 选择进行中调用最少的连接，相同时轮询
+	config.LatestConfig.DBGateway.Balance = config.BalanceLeastOutstanding
+	clear(seen)
+	for range 10 {
+		conn, _ := chooseConn(false)
+		seen[conn]++
+	}
+	if seen[conns[0]] == 0 || seen[conns[2]] == 0 {
+		t.Fatalf("idle least_outstanding distribution = %v %v", seen[conns[0]], seen[conns[2]])
+	}
+	cur[0].inflight.Store(3)
+	cur[2].inflight.Store(1)
+	for range 10 {
+		if conn, _ := chooseConn(false); conn != conns[2] {
+			t.Fatal("least_outstanding chose the busier connection")
+		}
+	}
+	cur[2].healthy.Store(false)
+	if conn, _ := chooseConn(false); conn != conns[0] {
+		t.Fatal("least_outstanding skipped the only healthy connection")
+	}
+}
+
+func TestSlotTrack(t *testing.T) {
+	s := &slot{}
+	var during int64
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		during = s.inflight.Load()
+		return errors.New("failed")
+	}
+	if err := s.track(context.Background(), "/m", nil, nil, nil, invoker); err == nil {
+		t.Fatal("track() dropped the invoker error")
+	}
+	if during != 1 || s.inflight.Load() != 0 {
+		t.Fatalf("in flight = %d during call, %d after, want 1 and 0", during, s.inflight.Load())
+	}
+}
+
+func TestChooseConnFailover(t *testing.T) {
+	a := &endpoint{addr: "127.0.0.1:1", priority: 0, weight: 3}
+	b := &endpoint{addr: "127.0.0.1:2", priority: 0, weight: 1}
+	standby := &endpoint{addr: "127.0.0.1:3", priority: 1, weight: 1}
+	replica := &endpoint{addr: "127.0.0.1:4", weight: 1, replica: true}
+	connA := fillEndpoint(t, a, 1)[0]
+	connB := fillEndpoint(t, b, 1)[0]
+	connStandby := fillEndpoint(t, standby, 1)[0]
+	connReplica := fillEndpoint(t, replica, 1)[0]
+	useEndpoints(t, standby, replica, a, b)
+
+	count := func(replicaRead bool) map[*grpc.ClientConn]int {
+		seen := make(map[*grpc.ClientConn]int)
+		for i := 0; i < 400; i++ {
+			conn, err := chooseConn(replicaRead)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen[conn]++
+		}
+		return seen
+	}
+
+	// 同一优先级按权重分配，低优先级与副本不参与
+	if seen := count(false); seen[connA] != 300 || seen[connB] != 100 {
+		t.Fatalf("distribution = a:%d b:%d standby:%d replica:%d", seen[connA], seen[connB], seen[connStandby], seen[connReplica])
+	}
+	if seen := count(true); seen[connReplica] != 400 {
+		t.Fatalf("replica reads = %v", seen)
+	}
+
+	// 高优先级端点全部不可用时切换到下一级，副本不可用时读改用主端点
+	slotOf := func(ep *endpoint) *slot { return ep.slots()[0] }
+	slotOf(a).healthy.Store(false)
+	if seen := count(false); seen[connB] != 400 {
+		t.Fatalf("with a down = %v", seen)
+	}
+	slotOf(b).healthy.Store(false)
+	slotOf(replica).healthy.Store(false)
+	if seen := count(true); seen[connStandby] != 400 {
+		t.Fatalf("with zone down = %v", seen)
+	}
+
+	// 高优先级恢复后切回
+	slotOf(a).healthy.Store(true)
+	if seen := count(false); seen[connA] != 400 {
+		t.Fatalf("after recovery = %v", seen)
+	}
+}
+
+func TestNewEndpointSet(t *testing.T) {
+	set := newEndpointSet(config.DBGatewayConfig{Host: "gw", Port: 50051})
+	if len(set.all) != 1 || set.all[0].addr != "gw:50051" || set.all[0].weight != 1 || len(set.primary) != 1 {
+		t.Fatalf("default endpoint = %+v", set.all)
+	}
+
+	set = newEndpointSet(config.DBGatewayConfig{Host: "gw", Port: 50051, Endpoints: []config.DBGatewayEndpoint{
+		{Host: "b", Port: 1, Priority: 1},
+		{Host: "r", Port: 1, Replica: true},
+		{Host: "a", Port: 1, Weight: 2},
+		{Host: "c", Port: 1, Priority: 1},
+	}})
+	if len(set.all) != 4 || len(set.primary) != 2 || len(set.replicas) != 1 {
+		t.Fatalf("groups = %d primary, %d replica", len(set.primary), len(set.replicas))
+	}
+	if set.primary[0][0].addr != "a:1" || set.primary[0][0].weight != 2 ||
+		set.primary[1][0].addr != "b:1" || set.primary[1][1].addr != "c:1" {
+		t.Fatalf("primary groups = %v %v", set.primary[0], set.primary[1])
+	}
+}
+
+// simulatedCall 模拟一次耗时 1ms 的网关调用
+func simulatedCall(context.Context, pb.StealthIMDBGatewayClient) error {
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+// BenchmarkCall 并发调用，连接池大小为 5，调用期间不持有锁
+func BenchmarkCall(b *testing.B) {
+	fillPool(b, 5)
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			call(context.Background(), metricSQL, simulatedCall)
+		}
+	})
+}
+
+// BenchmarkCallSerialized 与 BenchmarkCall 相同，但像旧实现一样在整个调用期间持有全局锁
+func BenchmarkCallSerialized(b *testing.B) {
+	fillPool(b, 5)
+	var mainlock sync.Mutex
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mainlock.Lock()
+			call(context.Background(), metricSQL, simulatedCall)
+			mainlock.Unlock()
+		}
+	})
+}
+
+func TestCallPropagatesTrace(t *testing.T) {
+	fillPool(t, 1)
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctx, parent := tracing.Start(context.Background(), "parent")
+	boom := errors.New("boom")
+	var traceparent []string
+	err := call(ctx, metricSQL, func(ctx context.Context, c pb.StealthIMDBGatewayClient) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		traceparent = md.Get("traceparent")
+		return boom
+	})
+	parent.End()
+	if err != boom {
+		t.Fatalf("call() = %v", err)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 2 || spans[0].Name() != "gateway.mysql" {
+		t.Fatalf("spans = %v", spans)
+	}
+	child := spans[0]
+	if child.Parent().SpanID() != parent.SpanContext().SpanID() || child.Status().Code != codes.Error {
+		t.Fatalf("child parent = %v, status = %v", child.Parent().SpanID(), child.Status())
+	}
+	// DBGateway 收到的是网关调用 span 的上下文
+	want := "00-" + child.SpanContext().TraceID().String() + "-" + child.SpanContext().SpanID().String() + "-01"
+	if len(traceparent) != 1 || traceparent[0] != want {
+		t.Fatalf("traceparent = %v, want %s", traceparent, want)
+	}
+}
+
+func TestCallCancelledContext(t *testing.T) {
+	fillPool(t, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err := call(ctx, metricSQL, func(context.Context, pb.StealthIMDBGatewayClient) error {
+		called = true
+		return nil
+	})
+	if err != context.Canceled || called {
+		t.Fatalf("call() = %v, called = %v, want context.Canceled without calling DBGateway", err, called)
+	}
+}
+
+func TestRedialBackoff(t *testing.T) {
+	saved := config.LatestConfig.DBGateway
+	t.Cleanup(func() { config.LatestConfig.DBGateway = saved })
+	config.LatestConfig.DBGateway.RedialBackoff = 500
+	config.LatestConfig.DBGateway.RedialMaxBackoff = 1500
+
+	var got []time.Duration
+	var d time.Duration
+	for range 4 {
+		d = redialBackoff(d)
+		got = append(got, d)
+	}
+	want := []time.Duration{500 * time.Millisecond, time.Second, 1500 * time.Millisecond, 1500 * time.Millisecond}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("redial backoff = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"strconv"
+	"strings"
+)
+
+// ScanInt64 将 SQL 返回字段解析为整数
+// 字段为 NULL 或无法解析时第二个返回值为 false
+func ScanInt64(v *pb.InterFaceType) (int64, bool) {
+	if v == nil || v.Response == nil {
+		return 0, false
+	}
+	switch r := v.Response.(type) {
+	case *pb.InterFaceType_Int32:
+		return int64(r.Int32), true
+	case *pb.InterFaceType_Int64:
+		return r.Int64, true
+	case *pb.InterFaceType_Str:
+		// DECIMAL 等类型以字符串返回，去掉小数部分
+		s := r.Str
+		if idx := strings.IndexByte(s, '.'); idx >= 0 {
+			s = s[:idx]
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return i, true
+	default:
+		return 0, false
+	}
+}
+
+// ScanString 将 SQL 返回字段解析为字符串
+// 字段为 NULL 时第二个返回值为 false
+func ScanString(v *pb.InterFaceType) (string, bool) {
+	if v == nil || v.Response == nil {
+		return "", false
+	}
+	switch r := v.Response.(type) {
+	case *pb.InterFaceType_Str:
+		return r.Str, true
+	case *pb.InterFaceType_Blob:
+		return string(r.Blob), true
+	case *pb.InterFaceType_Int32:
+		return strconv.FormatInt(int64(r.Int32), 10), true
+	case *pb.InterFaceType_Int64:
+		return strconv.FormatInt(r.Int64, 10), true
+	default:
+		return "", false
+	}
+}
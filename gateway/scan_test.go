@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func FuzzScan(f *testing.F) {
+	for _, seed := range []string{"42", "-7", "3.14", "1e9", "", ".", "-", "9223372036854775808", "12.", ".5", "0x10", " 1"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		n, ok := ScanInt64(&pb.InterFaceType{Response: &pb.InterFaceType_Str{Str: s}})
+		if ok {
+			// 成功时结果等于整数部分
+			whole, _, _ := strings.Cut(s, ".")
+			want, err := strconv.ParseInt(whole, 10, 64)
+			if err != nil || n != want {
+				t.Fatalf("ScanInt64(%q) = %d, want %d (err %v)", s, n, want, err)
+			}
+		}
+		if got, ok := ScanString(&pb.InterFaceType{Response: &pb.InterFaceType_Str{Str: s}}); !ok || got != s {
+			t.Fatalf("ScanString(%q) = %q, %v", s, got, ok)
+		}
+		if got, ok := ScanString(&pb.InterFaceType{Response: &pb.InterFaceType_Blob{Blob: []byte(s)}}); !ok || got != s {
+			t.Fatalf("ScanString(blob %q) = %q, %v", s, got, ok)
+		}
+	})
+}
+
+func TestScanNull(t *testing.T) {
+	for _, v := range []*pb.InterFaceType{nil, {}, {Null: true}} {
+		if _, ok := ScanInt64(v); ok {
+			t.Fatalf("ScanInt64(%v) ok", v)
+		}
+		if _, ok := ScanString(v); ok {
+			t.Fatalf("ScanString(%v) ok", v)
+		}
+	}
+}
@@ -2,22 +2,35 @@ package gateway
 
 import (
 	pb "StealthIMSession/StealthIM.DBGateway"
-	"StealthIMSession/config"
 	"context"
-	"time"
+	"fmt"
 )
 
 // ExecSQL 运行 SQL 语句
-func ExecSQL(sql *pb.SqlRequest) (*pb.SqlResponse, error) {
-	mainlock.Lock()
-	defer mainlock.Unlock()
-	conn, err := chooseConn()
-	if err != nil {
-		return nil, err
+// 只读查询与 WithIdempotent 中的语句失败时按 retry_codes 重试，其余写语句只执行一次：
+// 请求可能已在 MySQL 执行而响应丢失，重试会重复写入
+func ExecSQL(ctx context.Context, sql *pb.SqlRequest) (*pb.SqlResponse, error) {
+	var res *pb.SqlResponse
+	fn := func(ctx context.Context, c pb.StealthIMDBGatewayClient) (err error) {
+		res, err = c.Mysql(ctx, sql)
+		return err
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.LatestConfig.DBGateway.Timeout)*time.Millisecond)
-	defer cancel()
-	c := pb.NewStealthIMDBGatewayClient(conn)
-	res, err2 := c.Mysql(ctx, sql)
-	return res, err2
+	var err error
+	if sqlRetrySafe(ctx, sql) {
+		err = retryCall(ctx, metricSQL, fn)
+	} else {
+		err = call(ctx, metricSQL, fn)
+	}
+	return res, err
+}
+
+// CheckResult 检查 DBGateway 返回的执行结果，状态码非 0 时返回错误
+func CheckResult(res *pb.SqlResponse) error {
+	if res == nil {
+		return fmt.Errorf("empty sql response")
+	}
+	if res.Result != nil && res.Result.Code != 0 {
+		return fmt.Errorf("sql error %d: %s", res.Result.Code, res.Result.Msg)
+	}
+	return nil
 }
@@ -0,0 +1,179 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/cache"
+	"StealthIMSession/config"
+	"StealthIMSession/obfuscate"
+	"StealthIMSession/query"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+)
+
+// QuerySessionAt 查询会话在指定时间点是否属于指定用户且有效
+func (s *server) QuerySessionAt(ctx context.Context, in *pb.QuerySessionAtRequest) (*pb.QuerySessionAtResponse, error) {
+	history, err := cache.GetSessionHistory(ctx, cache.StoredID(in.Session), in.Uid)
+	if err != nil {
+		return &pb.QuerySessionAtResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to query session history",
+			},
+		}, nil
+	}
+
+	var createdAt, deletedAt int64
+	if !history.CreatedAt.IsZero() {
+		createdAt = history.CreatedAt.Unix()
+	}
+	if !history.DeletedAt.IsZero() {
+		deletedAt = history.DeletedAt.Unix()
+	}
+
+	return &pb.QuerySessionAtResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Valid:     history.ValidAt(time.Unix(in.Timestamp, 0)),
+		CreatedAt: createdAt,
+		DeletedAt: deletedAt,
+	}, nil
+}
+
+// QueryJournal 按过滤条件分页查询会话历史
+func (s *server) QueryJournal(ctx context.Context, in *pb.QueryJournalRequest) (*pb.QueryJournalResponse, error) {
+	entries, next, err := cache.QueryJournal(ctx, queryFromPB(in.Query))
+	if errors.Is(err, query.ErrInvalid) {
+		return &pb.QueryJournalResponse{
+			Result: &pb.Result{
+				Code: 2,
+				Msg:  err.Error(),
+			},
+		}, nil
+	}
+	if err != nil {
+		return &pb.QueryJournalResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to query session history",
+			},
+		}, nil
+	}
+
+	list := make([]*pb.JournalEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, &pb.JournalEntry{
+			Id:        entry.ID,
+			Session:   entry.SessionID,
+			Uid:       entry.UID,
+			Event:     entry.Event,
+			Caller:    entry.Caller,
+			EventTime: entry.EventTime.Unix(),
+		})
+	}
+
+	return &pb.QueryJournalResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Entries:    list,
+		NextCursor: next,
+	}, nil
+}
+
+// ResolveUIDAlias 根据日志中的 uid 别名反查真实 uid，需提供反查令牌
+func (s *server) ResolveUIDAlias(ctx context.Context, in *pb.ResolveUIDAliasRequest) (*pb.ResolveUIDAliasResponse, error) {
+	logger.Info("resolve uid alias", "caller", callerAddr(ctx))
+	token := config.LatestConfig.Privacy.ResolverToken
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(in.Token)) != 1 {
+		return &pb.ResolveUIDAliasResponse{
+			Result: &pb.Result{
+				Code: 2,
+				Msg:  "Permission denied",
+			},
+		}, nil
+	}
+	uid, err := obfuscate.Resolve(ctx, in.Alias)
+	if err != nil {
+		return &pb.ResolveUIDAliasResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Alias not found",
+			},
+		}, nil
+	}
+	return &pb.ResolveUIDAliasResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Uid: uid,
+	}, nil
+}
+
+// FreezeUID 冻结或解冻用户：冻结期间该用户的会话在 Get 时返回冻结状态码，Set 被拒绝，解冻后恢复
+func (s *server) FreezeUID(ctx context.Context, in *pb.FreezeUIDRequest) (*pb.FreezeUIDResponse, error) {
+	if err := cache.SetFrozen(ctx, in.Uid, in.Frozen, in.Reason, callerAddr(ctx)); err != nil {
+		logger.Error("freeze uid failed", "uid", obfuscate.UID(in.Uid), "frozen", in.Frozen, "error", err)
+		return &pb.FreezeUIDResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to update freeze state",
+			},
+		}, nil
+	}
+	return &pb.FreezeUIDResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+	}, nil
+}
+
+// SetCacheBypass 运行时切换缓存层旁路，重载配置时会恢复为配置文件中的值
+func (s *server) SetCacheBypass(ctx context.Context, in *pb.SetCacheBypassRequest) (*pb.SetCacheBypassResponse, error) {
+	logger.Info("set cache bypass", "memory", in.BypassMemory, "redis", in.BypassRedis, "caller", callerAddr(ctx))
+	cache.SetBypass(in.BypassMemory, in.BypassRedis)
+	memory, redis := cache.Bypass()
+	return &pb.SetCacheBypassResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		BypassMemory: memory,
+		BypassRedis:  redis,
+	}, nil
+}
+
+// PurgeUserData 删除用户在会话服务中的全部数据，返回各存储删除的数量作为凭证
+// 调用本身按 audit 配置记录审计，作为执行删除的记录
+func (s *server) PurgeUserData(ctx context.Context, in *pb.PurgeUserDataRequest) (*pb.PurgeUserDataResponse, error) {
+	logger.Info("purge user data requested", "uid", obfuscate.UID(in.Uid), "caller", callerAddr(ctx))
+	report, err := cache.PurgeUserData(ctx, in.Uid)
+	resp := &pb.PurgeUserDataResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Sessions:       report.Sessions,
+		RefreshTokens:  report.RefreshTokens,
+		JournalEntries: report.JournalEntries,
+		HistoryEntries: report.HistoryEntries,
+		AuditEntries:   report.AuditEntries,
+		CachedSessions: report.CachedSessions,
+	}
+	if err != nil {
+		logger.Error("purge user data failed", "uid", obfuscate.UID(in.Uid), "error", err)
+		resp.Result = &pb.Result{
+			Code: 1,
+			Msg:  "Failed to purge user data",
+		}
+		return resp, nil
+	}
+	resp.PurgedAt = report.PurgedAt.Unix()
+	return resp, nil
+}
@@ -0,0 +1,249 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/audit"
+	"StealthIMSession/autoclean"
+	"StealthIMSession/cache"
+	"StealthIMSession/config"
+	"StealthIMSession/query"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// adminServer 管理服务：查看与清空本实例的内存缓存、查看生效配置，供运维排查使用
+// 所有操作只作用于处理请求的实例
+type adminServer struct {
+	pb.StealthIMSessionAdminServer
+}
+
+// adminGRPC 独立端口上的管理服务，未启用或与会话服务共用端口时为 nil
+var adminGRPC atomic.Pointer[grpc.Server]
+
+// adminInterceptors 管理服务使用的拦截器：与会话服务相同，并在最后校验令牌
+func adminInterceptors() []grpc.UnaryServerInterceptor {
+	return append(slices.Clone(unaryInterceptors), adminAuthInterceptor)
+}
+
+// adminAuthInterceptor 配置了 admin.token 时检查管理请求携带的令牌，每次请求读取当前配置
+// 与会话服务共用端口时会话服务的请求不受影响
+func adminAuthInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if _, ok := info.Server.(*adminServer); !ok {
+		return handler(ctx, req)
+	}
+	token := config.LatestConfig.Admin.Token
+	if token == "" {
+		return handler(ctx, req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if got, ok := strings.CutPrefix(v, "Bearer "); ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return handler(ctx, req)
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "missing or invalid admin token")
+}
+
+// StartAdmin 在 admin.port 上监听并在后台启动管理服务，监听失败时返回错误
+// admin.port 为 0 时管理服务由 Start 注册在会话服务的端口上
+func StartAdmin(rCfg config.Config) error {
+	lis, err := net.Listen("tcp", net.JoinHostPort(rCfg.Admin.Host, strconv.Itoa(rCfg.Admin.Port)))
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(adminInterceptors()...))
+	pb.RegisterStealthIMSessionAdminServer(s, &adminServer{})
+	adminGRPC.Store(s)
+	logger.Info("admin server listening", "addr", lis.Addr().String())
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			logger.Error("failed to serve admin", "error", err)
+		}
+	}()
+	return nil
+}
+
+// ShutdownAdmin 停止独立端口上的管理服务，等待进行中的请求完成或 ctx 结束
+func ShutdownAdmin(ctx context.Context) error {
+	s := adminGRPC.Load()
+	if s == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
+
+// CacheStats 返回本实例内存缓存的大小、命中率与淘汰统计，计数自进程启动起累计
+func (a *adminServer) CacheStats(ctx context.Context, in *pb.CacheStatsRequest) (*pb.CacheStatsResponse, error) {
+	stats := cache.MemoryStats()
+	return &pb.CacheStatsResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Items:             stats.Items,
+		Bytes:             stats.Bytes,
+		Capacity:          stats.Capacity,
+		PressureCap:       stats.PressureCap,
+		Hits:              stats.Hits,
+		Misses:            stats.Misses,
+		HitRate:           stats.HitRate(),
+		Evictions:         stats.Evictions,
+		Expired:           stats.Expired,
+		AdmissionRejected: stats.AdmissionRejected,
+	}, nil
+}
+
+// CleanerStatus 返回本实例会话清理器的最近执行情况、累计删除的会话数与尚未删除的过期会话数
+// 积压持续增长说明清理跟不上过期会话的增长，需要调大 clean_batch 或缩短 clean_interval
+func (a *adminServer) CleanerStatus(ctx context.Context, in *pb.CleanerStatusRequest) (*pb.CleanerStatusResponse, error) {
+	st, err := autoclean.Status(ctx)
+	if err != nil {
+		return &pb.CleanerStatusResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Session cleaner not running",
+			},
+		}, nil
+	}
+	return &pb.CleanerStatusResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Running:        st.Job.Running,
+		Paused:         st.Job.Paused,
+		LastRun:        unixOrZero(st.Job.LastRun),
+		LastSuccess:    unixOrZero(st.Job.LastOK),
+		LastDurationMs: st.LastDuration.Milliseconds(),
+		LastRows:       st.LastRows,
+		LastError:      st.Job.LastError,
+		NextRun:        unixOrZero(st.Job.NextRun),
+		Runs:           st.Job.Runs,
+		Failures:       st.Job.Failures,
+		Rows:           st.Job.Rows,
+		Backlog:        st.Backlog,
+	}, nil
+}
+
+// FlushCache 清空本实例的内存缓存，Redis 与其他实例不受影响
+func (a *adminServer) FlushCache(ctx context.Context, in *pb.FlushCacheRequest) (*pb.FlushCacheResponse, error) {
+	logger.Info("flush cache requested", "caller", callerAddr(ctx))
+	return &pb.FlushCacheResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Flushed: int64(cache.FlushMemory()),
+	}, nil
+}
+
+// InvalidateCache 清除会话在内存缓存中的项，并经失效广播通知其他实例
+// 带命名空间的会话以 "<命名空间>:<会话ID>" 指定
+func (a *adminServer) InvalidateCache(ctx context.Context, in *pb.InvalidateCacheRequest) (*pb.InvalidateCacheResponse, error) {
+	if ns, id := cache.SplitNamespace(in.Session); !cache.ValidNamespace(ns) || !cache.ValidSessionID(id) {
+		return &pb.InvalidateCacheResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Invalid session ID",
+			},
+		}, nil
+	}
+	logger.Info("invalidate cache requested", "caller", callerAddr(ctx))
+	cache.InvalidateCached(cache.StoredID(in.Session))
+	return &pb.InvalidateCacheResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+	}, nil
+}
+
+// GetConfig 返回本实例当前生效的配置（JSON，隐去敏感字段）与其摘要，摘要与 Ping 相同
+func (a *adminServer) GetConfig(ctx context.Context, in *pb.GetConfigRequest) (*pb.GetConfigResponse, error) {
+	cfg := *config.LatestConfig
+	data, err := json.Marshal(config.Redacted(cfg))
+	if err != nil {
+		return &pb.GetConfigResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to encode config",
+			},
+		}, nil
+	}
+	return &pb.GetConfigResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Config: string(data),
+		Digest: config.Digest(cfg),
+	}, nil
+}
+
+// QueryAudit 按过滤条件分页查询审计表，只有 audit.sink = "db" 时有记录
+func (a *adminServer) QueryAudit(ctx context.Context, in *pb.QueryAuditRequest) (*pb.QueryAuditResponse, error) {
+	entries, next, err := audit.Query(ctx, queryFromPB(in.Query))
+	if errors.Is(err, query.ErrInvalid) {
+		return &pb.QueryAuditResponse{
+			Result: &pb.Result{
+				Code: 2,
+				Msg:  err.Error(),
+			},
+		}, nil
+	}
+	if err != nil {
+		return &pb.QueryAuditResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to query audit records",
+			},
+		}, nil
+	}
+
+	list := make([]*pb.AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, &pb.AuditEntry{
+			Id:            e.ID,
+			EventTime:     e.Time.Unix(),
+			Action:        e.Action,
+			Uid:           e.UID,
+			SessionPrefix: e.SessionPrefix,
+			Caller:        e.Caller,
+			Identity:      e.Identity,
+			Code:          e.Code,
+			Error:         e.Error,
+		})
+	}
+
+	return &pb.QueryAuditResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Entries:    list,
+		NextCursor: next,
+	}, nil
+}
@@ -0,0 +1,137 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/autoclean"
+	"StealthIMSession/cache"
+	"StealthIMSession/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminCache(t *testing.T) {
+	s, _, _, ctx := newTestServer(t)
+	admin := &adminServer{}
+	set, err := s.Set(ctx, &pb.SetRequest{Uid: 42, PrimeCache: true})
+	if err != nil || set.Result.Code != 0 {
+		t.Fatalf("Set() = %+v, %v", set, err)
+	}
+	before, _ := admin.CacheStats(ctx, &pb.CacheStatsRequest{})
+	s.Get(ctx, &pb.GetRequest{Session: set.Session})
+	stats, _ := admin.CacheStats(ctx, &pb.CacheStatsRequest{})
+	if stats.Items != 1 || stats.Hits != before.Hits+1 || stats.HitRate <= 0 {
+		t.Fatalf("CacheStats() = %+v", stats)
+	}
+
+	flush, _ := admin.FlushCache(ctx, &pb.FlushCacheRequest{})
+	if flush.Result.Code != 0 || flush.Flushed != 1 {
+		t.Fatalf("FlushCache() = %+v", flush)
+	}
+	if stats, _ := admin.CacheStats(ctx, &pb.CacheStatsRequest{}); stats.Items != 0 || stats.Bytes != 0 {
+		t.Fatalf("CacheStats() after FlushCache = %+v", stats)
+	}
+	// 清空后从存储重新加载
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session}); get.Result.Code != 0 || get.Uid != 42 {
+		t.Fatalf("Get() after FlushCache = %+v", get)
+	}
+
+	if resp, _ := admin.InvalidateCache(ctx, &pb.InvalidateCacheRequest{Session: set.Session}); resp.Result.Code != 0 {
+		t.Fatalf("InvalidateCache() = %+v", resp)
+	}
+	if stats, _ := admin.CacheStats(ctx, &pb.CacheStatsRequest{}); stats.Items != 0 {
+		t.Fatalf("CacheStats() after InvalidateCache = %+v", stats)
+	}
+	if resp, _ := admin.InvalidateCache(ctx, &pb.InvalidateCacheRequest{Session: "a b"}); resp.Result.Code != 1 {
+		t.Fatalf("InvalidateCache(invalid) = %+v, want code 1", resp)
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	_, _, _, ctx := newTestServer(t)
+	config.LatestConfig.Admin.Token = "secret-token"
+	resp, _ := (&adminServer{}).GetConfig(ctx, &pb.GetConfigRequest{})
+	var cfg config.Config
+	if err := json.Unmarshal([]byte(resp.Config), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Admin.Token != "<redacted>" || resp.Digest != config.Digest(*config.LatestConfig) {
+		t.Fatalf("GetConfig() = %+v", resp)
+	}
+}
+
+func TestAdminQueryAudit(t *testing.T) {
+	_, _, gw, ctx := newTestServer(t)
+	admin := &adminServer{}
+
+	resp, _ := admin.QueryAudit(ctx, &pb.QueryAuditRequest{Query: &pb.QueryOptions{
+		Filters: []*pb.QueryFilter{{Field: "error", Op: "eq", Value: "x"}},
+	}})
+	if resp.Result.Code != 2 {
+		t.Fatalf("QueryAudit(unknown field) = %+v", resp)
+	}
+	resp, _ = admin.QueryAudit(ctx, &pb.QueryAuditRequest{Query: &pb.QueryOptions{
+		Filters: []*pb.QueryFilter{{Field: "action", Op: "eq", Value: "del"}},
+		Sort:    "event_time",
+	}})
+	if resp.Result.Code != 0 || len(resp.Entries) != 0 || resp.NextCursor != "" {
+		t.Fatalf("QueryAudit() = %+v", resp)
+	}
+	statements := gw.Statements()
+	if want := "SELECT id, UNIX_TIMESTAMP(event_time), action, uid, session_prefix, caller, identity, code, error FROM session_audit WHERE action = ? ORDER BY UNIX_TIMESTAMP(event_time) ASC, id ASC LIMIT 101"; len(statements) == 0 || statements[len(statements)-1] != want {
+		t.Fatalf("statements = %v, want %q", statements, want)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	newTestServer(t)
+	config.LatestConfig.Admin.Token = "secret-token"
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+	call := func(srv any, auth string) error {
+		ctx := context.Background()
+		if auth != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", auth))
+		}
+		_, err := adminAuthInterceptor(ctx, nil, &grpc.UnaryServerInfo{Server: srv}, handler)
+		return err
+	}
+
+	if err := call(&adminServer{}, "Bearer secret-token"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	for _, auth := range []string{"", "Bearer wrong", "secret-token"} {
+		if err := call(&adminServer{}, auth); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("authorization %q: err = %v, want Unauthenticated", auth, err)
+		}
+	}
+	// 共用端口时会话服务的请求不检查令牌
+	if err := call(&server{}, ""); err != nil {
+		t.Fatalf("session service request rejected: %v", err)
+	}
+}
+
+func TestAdminCleanerStatus(t *testing.T) {
+	_, store, _, ctx := newTestServer(t)
+	admin := &adminServer{}
+	if resp, _ := admin.CleanerStatus(ctx, &pb.CleanerStatusRequest{}); resp.Result.Code != 1 {
+		t.Fatalf("CleanerStatus() without cleaner = %+v", resp)
+	}
+
+	for i := range 3 {
+		store.Save(ctx, fmt.Sprintf("expired-%d", i), 42, -time.Minute, cache.SessionMeta{})
+	}
+	sc := autoclean.NewSessionCleaner()
+	sc.Start()
+	t.Cleanup(sc.Stop)
+	resp, _ := admin.CleanerStatus(ctx, &pb.CleanerStatusRequest{})
+	if resp.Result.Code != 0 || resp.Backlog != 3 || resp.Runs != 0 || resp.LastSuccess != 0 {
+		t.Fatalf("CleanerStatus() = %+v", resp)
+	}
+}
@@ -0,0 +1,161 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/cache"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"context"
+	"errors"
+	"maps"
+)
+
+// codeInvalidAttr 属性名不合法、属性值过长或属性数已达上限时 SetAttr 返回的状态码
+const codeInvalidAttr = 9
+
+// checkAttrSession 检查属性操作的会话：前缀、受众、格式、是否有效以及用户是否被冻结，通过时返回 nil
+// 与 Get 相同经过缓存确认会话有效，已删除或已过期的会话的属性不可读写
+func checkAttrSession(ctx context.Context, method string, sessionID string) *pb.Result {
+	if foreignSession(method, sessionID) {
+		return foreignSessionResult()
+	}
+	if wrongAudience(method, sessionID) {
+		return wrongAudienceResult()
+	}
+	if !cache.ValidSessionID(sessionID) {
+		return &pb.Result{
+			Code: 1,
+			Msg:  "Session not found",
+		}
+	}
+	uid, err := withStoredKey(ctx, sessionID, func(key string) (int32, error) {
+		return cache.GetUserIDBySession(ctx, key)
+	}, sessionMissing)
+	if errors.Is(err, gateway.ErrCircuitOpen) {
+		return &pb.Result{
+			Code: 6,
+			Msg:  "Backend circuit open",
+		}
+	}
+	if errors.Is(err, cache.ErrBackendUnavailable) {
+		return &pb.Result{
+			Code: 5,
+			Msg:  "Backend unavailable",
+		}
+	}
+	if err != nil {
+		return &pb.Result{
+			Code: 1,
+			Msg:  "Session not found",
+		}
+	}
+	if frozenUID(method, uid) {
+		return frozenResult()
+	}
+	return nil
+}
+
+// attrResult 将属性读写的错误转为响应结果
+func attrResult(err error) *pb.Result {
+	switch {
+	case err == nil:
+		return &pb.Result{
+			Code: 0,
+			Msg:  "",
+		}
+	case errors.Is(err, cache.ErrSessionNotFound):
+		// 会话在检查之后被删除或过期
+		return &pb.Result{
+			Code: 1,
+			Msg:  "Session not found",
+		}
+	case errors.Is(err, cache.ErrTooManyAttrs):
+		return &pb.Result{
+			Code: codeInvalidAttr,
+			Msg:  "Too many attributes",
+		}
+	default:
+		logger.Error("session attribute operation failed", "error", err)
+		return &pb.Result{
+			Code: 2,
+			Msg:  "Database error",
+		}
+	}
+}
+
+// SetAttr 设置会话属性，属性随会话删除或过期
+func (s *server) SetAttr(ctx context.Context, in *pb.SetAttrRequest) (*pb.SetAttrResponse, error) {
+	if !cache.ValidAttrKey(in.Key) {
+		return &pb.SetAttrResponse{
+			Result: &pb.Result{
+				Code: codeInvalidAttr,
+				Msg:  "Invalid attribute key",
+			},
+		}, nil
+	}
+	if len(in.Value) > config.LatestConfig.Session.MaxAttrBytes {
+		return &pb.SetAttrResponse{
+			Result: &pb.Result{
+				Code: codeInvalidAttr,
+				Msg:  "Attribute value too large",
+			},
+		}, nil
+	}
+	if result := checkAttrSession(ctx, "SetAttr", in.Session); result != nil {
+		return &pb.SetAttrResponse{
+			Result: result,
+		}, nil
+	}
+	return &pb.SetAttrResponse{
+		Result: attrResult(cache.SetSessionAttr(ctx, cache.StoredID(in.Session), in.Key, in.Value)),
+	}, nil
+}
+
+// GetAttr 获取会话属性，keys 为空时返回全部属性，不存在的属性不出现在结果中
+func (s *server) GetAttr(ctx context.Context, in *pb.GetAttrRequest) (*pb.GetAttrResponse, error) {
+	if result := checkAttrSession(ctx, "GetAttr", in.Session); result != nil {
+		return &pb.GetAttrResponse{
+			Result: result,
+		}, nil
+	}
+	attrs, err := cache.GetSessionAttrs(ctx, cache.StoredID(in.Session))
+	if err != nil {
+		return &pb.GetAttrResponse{
+			Result: attrResult(err),
+		}, nil
+	}
+
+	out := make(map[string]string, len(attrs))
+	if len(in.Keys) == 0 {
+		maps.Copy(out, attrs)
+	}
+	for _, k := range in.Keys {
+		if v, ok := attrs[k]; ok {
+			out[k] = v
+		}
+	}
+	return &pb.GetAttrResponse{
+		Result: attrResult(nil),
+		Attrs:  out,
+	}, nil
+}
+
+// DelAttr 删除会话属性，属性不存在时同样返回成功
+func (s *server) DelAttr(ctx context.Context, in *pb.DelAttrRequest) (*pb.DelAttrResponse, error) {
+	if !cache.ValidAttrKey(in.Key) {
+		return &pb.DelAttrResponse{
+			Result: &pb.Result{
+				Code: codeInvalidAttr,
+				Msg:  "Invalid attribute key",
+			},
+		}, nil
+	}
+	if result := checkAttrSession(ctx, "DelAttr", in.Session); result != nil {
+		return &pb.DelAttrResponse{
+			Result: result,
+		}, nil
+	}
+	return &pb.DelAttrResponse{
+		Result: attrResult(cache.DelSessionAttr(ctx, cache.StoredID(in.Session), in.Key)),
+	}, nil
+}
@@ -0,0 +1,55 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/config"
+	"strings"
+	"testing"
+)
+
+func TestSessionAttrs(t *testing.T) {
+	s, _, _, ctx := newTestServer(t)
+	config.LatestConfig.Session.MaxAttrs = 2
+	set, err := s.Set(ctx, &pb.SetRequest{Uid: 42})
+	if err != nil || set.Result.Code != 0 {
+		t.Fatalf("Set() = %+v, %v", set, err)
+	}
+
+	for _, kv := range [][2]string{{"chat.group", "1"}, {"chat.draft", "hi"}, {"chat.group", "2"}} {
+		if resp, _ := s.SetAttr(ctx, &pb.SetAttrRequest{Session: set.Session, Key: kv[0], Value: kv[1]}); resp.Result.Code != 0 {
+			t.Fatalf("SetAttr(%s) = %+v", kv[0], resp)
+		}
+	}
+	// 缓存在本实例修改属性时失效
+	get, _ := s.GetAttr(ctx, &pb.GetAttrRequest{Session: set.Session})
+	if get.Result.Code != 0 || len(get.Attrs) != 2 || get.Attrs["chat.group"] != "2" {
+		t.Fatalf("GetAttr() = %+v", get)
+	}
+
+	for name, req := range map[string]*pb.SetAttrRequest{
+		"over max_attrs": {Session: set.Session, Key: "third", Value: "x"},
+		"invalid key":    {Session: set.Session, Key: `a"b`, Value: "x"},
+		"value too long": {Session: set.Session, Key: "chat.group", Value: strings.Repeat("x", config.LatestConfig.Session.MaxAttrBytes+1)},
+	} {
+		if resp, _ := s.SetAttr(ctx, req); resp.Result.Code != codeInvalidAttr {
+			t.Errorf("SetAttr(%s) = %+v, want code %d", name, resp, codeInvalidAttr)
+		}
+	}
+
+	if resp, _ := s.DelAttr(ctx, &pb.DelAttrRequest{Session: set.Session, Key: "chat.draft"}); resp.Result.Code != 0 {
+		t.Fatalf("DelAttr() = %+v", resp)
+	}
+	get, _ = s.GetAttr(ctx, &pb.GetAttrRequest{Session: set.Session, Keys: []string{"chat.draft", "chat.group"}})
+	if len(get.Attrs) != 1 || get.Attrs["chat.group"] != "2" {
+		t.Fatalf("GetAttr(keys) after DelAttr = %+v", get)
+	}
+
+	// 会话删除后属性不可读写
+	s.Del(ctx, &pb.DelRequest{Session: set.Session})
+	if get, _ := s.GetAttr(ctx, &pb.GetAttrRequest{Session: set.Session}); get.Result.Code != 1 {
+		t.Fatalf("GetAttr() after Del = %+v, want code 1", get)
+	}
+	if resp, _ := s.SetAttr(ctx, &pb.SetAttrRequest{Session: set.Session, Key: "k", Value: "v"}); resp.Result.Code != 1 {
+		t.Fatalf("SetAttr() after Del = %+v, want code 1", resp)
+	}
+}
@@ -0,0 +1,33 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/cache"
+	"StealthIMSession/metrics"
+	"sync"
+)
+
+var wrongAudienceMetrics sync.Map // method -> *metrics.Counter
+
+// wrongAudience 检查会话ID的受众标记，不属于本环境时计数并返回 true
+// 在查询缓存前拒绝，即使数据库中恰好存在该会话也不会被接受
+func wrongAudience(method string, sessionID string) bool {
+	if cache.AudienceMatches(sessionID) {
+		return false
+	}
+	counter, ok := wrongAudienceMetrics.Load(method)
+	if !ok {
+		counter, _ = wrongAudienceMetrics.LoadOrStore(method,
+			metrics.NewCounter("stealthim_session_wrong_audience_total", "Requests rejected because the session ID belongs to another audience", "method", method))
+	}
+	counter.(*metrics.Counter).Inc()
+	return true
+}
+
+// wrongAudienceResult 受众不匹配时的响应结果，与前缀不被接受使用相同的状态码
+func wrongAudienceResult() *pb.Result {
+	return &pb.Result{
+		Code: codeForeignSession,
+		Msg:  "Wrong session audience",
+	}
+}
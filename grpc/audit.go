@@ -0,0 +1,54 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/audit"
+	"StealthIMSession/config"
+	"StealthIMSession/logging"
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// auditedMethods 记录审计的方法与对应的审计动作
+var auditedMethods = map[string]string{
+	pb.StealthIMSession_Set_FullMethodName:           audit.Set,
+	pb.StealthIMSession_Del_FullMethodName:           audit.Del,
+	pb.StealthIMSession_DelAllByUID_FullMethodName:   audit.DelAllByUID,
+	pb.StealthIMSession_PurgeUserData_FullMethodName: audit.Purge,
+	pb.StealthIMSession_Reload_FullMethodName:        audit.Reload,
+	pb.StealthIMSession_Get_FullMethodName:           audit.Get,
+}
+
+// auditInterceptor 在调用结束后记录审计，包括未通过服务鉴权的调用；Get 只在 audit.failed_get 时记录失败的调用
+func auditInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	action, ok := auditedMethods[info.FullMethod]
+	if !ok || !audit.Enabled() || (action == audit.Get && !config.LatestConfig.Audit.FailedGet) {
+		return handler(ctx, req)
+	}
+	resp, err := handler(ctx, req)
+	rec := audit.Record{Action: action, Caller: callerAddr(ctx), Code: -1}
+	if sans := clientSANs(ctx); len(sans) > 0 {
+		rec.Identity = sans[0]
+	}
+	if r, ok := req.(interface{ GetUid() int32 }); ok {
+		rec.UID = r.GetUid()
+	}
+	// Set 的会话ID在响应中
+	if r, ok := req.(interface{ GetSession() string }); ok && r.GetSession() != "" {
+		rec.SessionPrefix = logging.Session(r.GetSession()).Value.String()
+	} else if r, ok := resp.(interface{ GetSession() string }); ok && r.GetSession() != "" {
+		rec.SessionPrefix = logging.Session(r.GetSession()).Value.String()
+	}
+	if err != nil {
+		rec.Error = status.Code(err).String()
+	} else if r, ok := resp.(interface{ GetResult() *pb.Result }); ok && r.GetResult() != nil {
+		rec.Code = r.GetResult().Code
+	}
+	if action == audit.Get && rec.Code == 0 {
+		return resp, err
+	}
+	audit.Log(rec)
+	return resp, err
+}
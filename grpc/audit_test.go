@@ -0,0 +1,79 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/audit"
+	"StealthIMSession/config"
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditInterceptor(t *testing.T) {
+	s, _, _, ctx := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	config.LatestConfig.Audit = config.AuditConfig{Sink: config.AuditFile, File: path, Buffer: 16}
+	if err := audit.Start(config.LatestConfig.Audit); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { audit.Stop(context.Background()) })
+
+	set := func(ctx context.Context) (*pb.SetResponse, error) {
+		resp, err := invoke(ctx, s, pb.StealthIMSession_Set_FullMethodName, &pb.SetRequest{Uid: 42}, func(ctx context.Context, req any) (any, error) {
+			return s.Set(ctx, req.(*pb.SetRequest))
+		})
+		r, _ := resp.(*pb.SetResponse)
+		return r, err
+	}
+	get := func(session string) {
+		invoke(ctx, s, pb.StealthIMSession_Get_FullMethodName, &pb.GetRequest{Session: session}, func(ctx context.Context, req any) (any, error) {
+			return s.Get(ctx, req.(*pb.GetRequest))
+		})
+	}
+
+	created, err := set(peerWithSANs(ctx, "user.stealthim.internal"))
+	if err != nil || created.Result.Code != 0 {
+		t.Fatalf("Set() = %+v, %v", created, err)
+	}
+	get(created.Session) // 成功的 Get 不记录
+	get("0000000000000000000000000000dead")
+	config.LatestConfig.Audit.FailedGet = true
+	get("0000000000000000000000000000beef")
+	// 未通过服务鉴权的调用同样记录
+	config.LatestConfig.GRPCProxy.ServiceTokens = []string{"service-token"}
+	set(ctx)
+	if err := audit.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []audit.Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d records, want 3: %+v", len(got), got)
+	}
+	if r := got[0]; r.Action != audit.Set || r.UID != 42 || r.Code != 0 || r.Identity != "user.stealthim.internal" ||
+		r.SessionPrefix == "" || created.Session[:len(r.SessionPrefix)] != r.SessionPrefix {
+		t.Errorf("Set record = %+v", r)
+	}
+	if r := got[1]; r.Action != audit.Get || r.Code != 1 || r.SessionPrefix != "00000000" {
+		t.Errorf("failed Get record = %+v", r)
+	}
+	if r := got[2]; r.Action != audit.Set || r.Code != -1 || r.Error != "Unauthenticated" || r.SessionPrefix != "" {
+		t.Errorf("rejected Set record = %+v", r)
+	}
+}
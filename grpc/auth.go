@@ -0,0 +1,91 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/config"
+	"StealthIMSession/metrics"
+	"context"
+	"crypto/subtle"
+	"path"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// 服务鉴权：Set、Del 等受保护方法只允许其他 StealthIM 服务调用，
+// 调用方需携带 grpc.service_tokens 中的令牌，或使用 SAN 在 grpc.allowed_client_sans 中的客户端证书
+// Get 等其他方法不受影响；两项都未配置时不检查，与旧版本行为一致
+
+// serviceTokenKey 携带服务令牌的 metadata 键，HTTP/JSON 接口为同名请求头
+const serviceTokenKey = "x-service-token"
+
+var metricAuthRejected = metrics.NewCounter("stealthim_session_auth_rejected_total", "Calls to protected methods rejected for missing or invalid service credentials")
+
+// alwaysProtected 不可恢复地删除数据的方法，不论 protected_methods 如何配置都需要服务鉴权，
+// service_tokens 与 allowed_client_sans 都未配置时一律拒绝
+var alwaysProtected = []string{"PurgeUserData"}
+
+// protectedMethod 方法是否需要服务鉴权，每次请求读取当前配置
+func protectedMethod(fullMethod string) bool {
+	service, method := path.Split(fullMethod)
+	if service != "/"+pb.StealthIMSession_ServiceDesc.ServiceName+"/" {
+		return false
+	}
+	if slices.Contains(alwaysProtected, method) {
+		return true
+	}
+	cfg := config.LatestConfig.GRPCProxy
+	if len(cfg.ServiceTokens) == 0 && len(cfg.AllowedClientSANs) == 0 {
+		return false
+	}
+	return slices.Contains(cfg.ProtectedMethods, method)
+}
+
+// serviceAuthInterceptor 拒绝未携带有效服务令牌或客户端证书的调用
+func serviceAuthInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if trustedCaller(ctx) {
+		return handler(ctx, req)
+	}
+	metricAuthRejected.Inc()
+	logger.Warn("rejected call to protected method", "method", path.Base(info.FullMethod), "caller", callerAddr(ctx))
+	return nil, status.Error(codes.Unauthenticated, "missing or invalid service credentials")
+}
+
+// trustedCaller 调用方是否携带有效的服务令牌，或提供了 SAN 在允许列表中的客户端证书
+func trustedCaller(ctx context.Context) bool {
+	cfg := config.LatestConfig.GRPCProxy
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, got := range md.Get(serviceTokenKey) {
+		for _, token := range cfg.ServiceTokens {
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+				return true
+			}
+		}
+	}
+	return slices.ContainsFunc(clientSANs(ctx), func(san string) bool {
+		return slices.Contains(cfg.AllowedClientSANs, san)
+	})
+}
+
+// clientSANs 返回经过 client_ca 校验的客户端证书中的 DNS 与 URI SAN，未使用 TLS 或客户端未提供证书时为空
+func clientSANs(ctx context.Context) []string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := info.State.VerifiedChains[0][0]
+	sans := slices.Clone(cert.DNSNames)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
@@ -0,0 +1,94 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/config"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestServiceAuth(t *testing.T) {
+	s, _, _, ctx := newTestServer(t)
+	set := func(ctx context.Context) error {
+		_, err := invoke(ctx, s, pb.StealthIMSession_Set_FullMethodName, &pb.SetRequest{Uid: 42}, func(ctx context.Context, req any) (any, error) {
+			return s.Set(ctx, req.(*pb.SetRequest))
+		})
+		return err
+	}
+	withToken := func(token string) context.Context {
+		return metadata.NewIncomingContext(ctx, metadata.Pairs(serviceTokenKey, token))
+	}
+
+	// 未配置令牌与 SAN 时不检查
+	if err := set(ctx); err != nil {
+		t.Fatalf("Set() without service auth configured: %v", err)
+	}
+
+	cfg := &config.LatestConfig.GRPCProxy
+	cfg.ServiceTokens = []string{"old-service-token", "new-service-token"}
+	cfg.AllowedClientSANs = []string{"spiffe://stealthim/gateway", "user.stealthim.internal"}
+	for name, ctx := range map[string]context.Context{
+		"no credentials": ctx,
+		"wrong token":    withToken("bad-service-token"),
+		"other SAN":      peerWithSANs(ctx, "evil.example.com"),
+	} {
+		if err := set(ctx); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Set(%s): err = %v, want Unauthenticated", name, err)
+		}
+	}
+	for name, ctx := range map[string]context.Context{
+		"current token":  withToken("new-service-token"),
+		"previous token": withToken("old-service-token"),
+		"DNS SAN":        peerWithSANs(ctx, "user.stealthim.internal"),
+	} {
+		if err := set(ctx); err != nil {
+			t.Errorf("Set(%s): %v", name, err)
+		}
+	}
+
+	// PurgeUserData 即使不在 protected_methods 中也需要鉴权
+	purge := func(ctx context.Context) error {
+		_, err := invoke(ctx, s, pb.StealthIMSession_PurgeUserData_FullMethodName, &pb.PurgeUserDataRequest{Uid: 42}, func(ctx context.Context, req any) (any, error) {
+			return s.PurgeUserData(ctx, req.(*pb.PurgeUserDataRequest))
+		})
+		return err
+	}
+	cfg.ProtectedMethods = []string{"Set"}
+	if err := purge(ctx); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("PurgeUserData(no credentials): err = %v, want Unauthenticated", err)
+	}
+	if err := purge(withToken("new-service-token")); err != nil {
+		t.Errorf("PurgeUserData(current token): %v", err)
+	}
+
+	// 未受保护的方法不检查
+	_, err := invoke(ctx, s, pb.StealthIMSession_Get_FullMethodName, &pb.GetRequest{Session: "x"}, func(ctx context.Context, req any) (any, error) {
+		return s.Get(ctx, req.(*pb.GetRequest))
+	})
+	if err != nil {
+		t.Fatalf("Get() without credentials: %v", err)
+	}
+
+	// 未配置令牌与 SAN 时拒绝 PurgeUserData
+	cfg.ServiceTokens = nil
+	cfg.AllowedClientSANs = nil
+	if err := purge(withToken("new-service-token")); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("PurgeUserData() without service auth configured: err = %v, want Unauthenticated", err)
+	}
+}
+
+// peerWithSANs 模拟客户端提供了经过校验、带有指定 DNS SAN 的证书
+func peerWithSANs(ctx context.Context, sans ...string) context.Context {
+	cert := &x509.Certificate{DNSNames: sans}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{
+		State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+	}})
+}
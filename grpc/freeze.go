@@ -0,0 +1,35 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/cache"
+	"StealthIMSession/metrics"
+	"sync"
+)
+
+// codeFrozen 用户被冻结时 Get 与 Set 返回的状态码
+const codeFrozen = 7
+
+var frozenMetrics sync.Map // method -> *metrics.Counter
+
+// frozenUID 检查用户是否被冻结，冻结时计数并返回 true
+func frozenUID(method string, uid int32) bool {
+	if !cache.IsFrozen(uid) {
+		return false
+	}
+	counter, ok := frozenMetrics.Load(method)
+	if !ok {
+		counter, _ = frozenMetrics.LoadOrStore(method,
+			metrics.NewCounter("stealthim_session_frozen_rejections_total", "Requests rejected because the uid is frozen", "method", method))
+	}
+	counter.(*metrics.Counter).Inc()
+	return true
+}
+
+// frozenResult 用户被冻结时的响应结果
+func frozenResult() *pb.Result {
+	return &pb.Result{
+		Code: codeFrozen,
+		Msg:  "Account frozen",
+	}
+}
@@ -1,37 +1,145 @@
 package grpc
 
 import (
+	dbpb "StealthIMSession/StealthIM.DBGateway"
 	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/buildinfo"
+	"StealthIMSession/cache"
 	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
 	"context"
-	"log"
-	"net"
-	"strconv"
+	"fmt"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 )
 
 var cfg config.Config
 
+var logger = logging.For("grpc")
+
 type server struct {
 	pb.StealthIMSessionServer
+	store   cache.SessionStore            // 会话存储，为 nil 时使用默认存储
+	gateway dbpb.StealthIMDBGatewayClient // Redis 与其他 SQL 使用的客户端，为 nil 时按 [storage] 配置
+}
+
+// newServer 创建使用指定存储的服务，为 nil 的依赖使用默认实现
+func newServer(store cache.SessionStore, gw dbpb.StealthIMDBGatewayClient) *server {
+	return &server{store: store, gateway: gw}
+}
+
+// bind 将服务的存储注入请求上下文，之后的缓存与网关调用都使用这些存储
+func (s *server) bind(ctx context.Context) context.Context {
+	if s.store != nil {
+		ctx = cache.WithStore(ctx, s.store)
+	}
+	if s.gateway != nil {
+		ctx = gateway.WithClient(ctx, s.gateway)
+	}
+	return ctx
+}
+
+// unaryInterceptors GRPC 与 HTTP/JSON 接口共用的拦截器，按顺序执行，最后执行按方法附加的拦截器
+var unaryInterceptors = []grpc.UnaryServerInterceptor{storageInterceptor, tracingInterceptor, metricsInterceptor, rateLimitInterceptor, auditInterceptor, methodInterceptor}
+
+// methodInterceptors 返回方法（完整方法名）附加的拦截器，每次请求按当前配置计算
+func methodInterceptors(fullMethod string) []grpc.UnaryServerInterceptor {
+	var chain []grpc.UnaryServerInterceptor
+	if protectedMethod(fullMethod) {
+		chain = append(chain, serviceAuthInterceptor)
+	}
+	// 鉴权之后再计数，未通过鉴权的请求不消耗用户的配额
+	if fullMethod == pb.StealthIMSession_Set_FullMethodName && config.LatestConfig.RateLimit.SetPerUID > 0 {
+		chain = append(chain, setUIDRateInterceptor)
+	}
+	return chain
+}
+
+// methodInterceptor 执行当前方法附加的拦截器，调用次数、耗时与拒绝都由之前的拦截器记录
+func methodInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return chainUnary(methodInterceptors(info.FullMethod), info, handler)(ctx, req)
+}
+
+// chainUnary 按顺序将拦截器包装在 handler 外，第一个拦截器最先执行
+func chainUnary(interceptors []grpc.UnaryServerInterceptor, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) grpc.UnaryHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req any) (any, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler
+}
+
+// storageInterceptor 为每个 RPC 注入服务的存储
+func storageInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s, ok := info.Server.(*server); ok {
+		ctx = s.bind(ctx)
+	}
+	return handler(ctx, req)
 }
 
+// startedAt 进程启动时间，用于计算 Ping 返回的运行时长
+var startedAt = time.Now()
+
+// Ping 返回构建版本、运行时长与当前配置的摘要，用于确认实例运行的版本与配置
 func (s *server) Ping(ctx context.Context, in *pb.PingRequest) (*pb.Pong, error) {
-	return &pb.Pong{}, nil
+	return &pb.Pong{
+		Version:       buildinfo.Version,
+		Commit:        buildinfo.Commit,
+		BuildDate:     buildinfo.BuildDate,
+		UptimeSeconds: int64(time.Since(startedAt) / time.Second),
+		ConfigDigest:  config.Digest(*config.LatestConfig),
+	}, nil
 }
 
-// Start 启动 GRPC 服务
-func Start(rCfg config.Config) {
+// Start 监听 [grpc] 中的全部地址并在后台启动 GRPC 服务，监听或 TLS 配置失败时返回错误
+func Start(rCfg config.Config) error {
 	cfg = rCfg
-	lis, err := net.Listen("tcp", rCfg.GRPCProxy.Host+":"+strconv.Itoa(rCfg.GRPCProxy.Port))
+	limit := newConnLimit(rCfg.GRPCProxy.MaxConnections)
+	var lns []*listener
+	for _, addr := range rCfg.GRPCProxy.Addrs() {
+		lis, err := listen(addr)
+		if err != nil {
+			closeListeners(lns)
+			return err
+		}
+		lns = append(lns, &listener{addr: addr, lis: limit.wrap(lis), done: make(chan struct{})})
+	}
+	// 管理服务与会话服务共用端口
+	sharedAdmin := rCfg.Admin.Enable && rCfg.Admin.Port == 0
+	interceptors := unaryInterceptors
+	if sharedAdmin {
+		interceptors = adminInterceptors()
+	}
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors...)}
+	opts = append(opts, keepaliveOptions(rCfg.GRPCProxy)...)
+	opts = append(opts, limitOptions(rCfg.GRPCProxy)...)
+	creds, err := tlsOption(rCfg.GRPCProxy)
 	if err != nil {
-		log.Fatalf("[GRPC]Failed to listen: %v", err)
+		closeListeners(lns)
+		return fmt.Errorf("set up TLS: %w", err)
+	}
+	if creds != nil {
+		opts = append(opts, creds)
+	}
+	s := grpc.NewServer(opts...)
+	pb.RegisterStealthIMSessionServer(s, newServer(nil, nil))
+	if sharedAdmin {
+		pb.RegisterStealthIMSessionAdminServer(s, &adminServer{})
+	}
+	registerHealth(s)
+	if rCfg.GRPCProxy.Reflection {
+		reflection.Register(s)
 	}
-	s := grpc.NewServer()
-	pb.RegisterStealthIMSessionServer(s, &server{})
-	log.Printf("[GRPC]Server listening at %v", lis.Addr())
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("[GRPC]Failed to serve: %v", err)
+	grpcServer.Store(s)
+	grpcListeners.Store(&lns)
+	for _, l := range lns {
+		logger.Info("server listening", "addr", l.lis.Addr().String(), "tls", creds != nil, "mtls", rCfg.GRPCProxy.RequireClientCert, "reflection", rCfg.GRPCProxy.Reflection, "admin", sharedAdmin)
+		go l.serve(s)
 	}
+	return nil
 }
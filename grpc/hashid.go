@@ -0,0 +1,34 @@
+package grpc
+
+import (
+	"StealthIMSession/cache"
+	"StealthIMSession/gateway"
+	"context"
+	"errors"
+)
+
+// storedKey 请求中的会话（带命名空间的键）在存储与缓存中的键，见 cache.StoredID
+func storedKey(key string) string {
+	return cache.StoredID(key)
+}
+
+// withStoredKey 以会话在存储中的键执行 op
+// 启用 hash_ids 后迁移完成前，op 的结果表明会话不存在（missing）时，将该会话的明文行改为哈希形式，
+// 改写了会话行时重试一次，未迁移的会话仍能查询；查询到的会话不需要额外的 UPDATE
+func withStoredKey[T any](ctx context.Context, key string, op func(stored string) (T, error), missing func(T, error) bool) (T, error) {
+	res, err := op(storedKey(key))
+	if !missing(res, err) || ctx.Err() != nil || !cache.PlainIDsRemain() || !cache.AdoptPlainID(ctx, key) {
+		return res, err
+	}
+	return op(storedKey(key))
+}
+
+// sessionMissing 查询会话失败且不是后端不可用
+func sessionMissing(_ int32, err error) bool {
+	return err != nil && !errors.Is(err, gateway.ErrCircuitOpen) && !errors.Is(err, cache.ErrBackendUnavailable)
+}
+
+// deleteMissing 删除会话时会话不存在
+func deleteMissing(existed bool, err error) bool {
+	return err == nil && !existed
+}
@@ -0,0 +1,241 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/config"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// maxHTTPBody HTTP/JSON 请求体的最大字节数
+const maxHTTPBody = 64 << 10
+
+// httpServer 当前的 HTTP/JSON 服务，未启用时为 nil
+var httpServer atomic.Pointer[http.Server]
+
+// StartHTTP 监听地址并在后台启动 HTTP/JSON 接口，监听失败时返回错误
+func StartHTTP(rCfg config.Config) error {
+	lis, err := net.Listen("tcp", net.JoinHostPort(rCfg.HTTP.Host, strconv.Itoa(rCfg.HTTP.Port)))
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: newHTTPHandler(newServer(nil, nil)), ReadHeaderTimeout: 10 * time.Second}
+	httpServer.Store(srv)
+	logger.Info("http server listening", "addr", lis.Addr().String())
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to serve http", "error", err)
+		}
+	}()
+	return nil
+}
+
+// ShutdownHTTP 停止 HTTP/JSON 接口，等待进行中的请求完成或 ctx 结束
+func ShutdownHTTP(ctx context.Context) error {
+	if srv := httpServer.Load(); srv != nil {
+		return srv.Shutdown(ctx)
+	}
+	return nil
+}
+
+// newHTTPHandler 将 HTTP/JSON 请求映射到 s 的 Set、Get、Del
+// 响应体与 GRPC 响应相同，业务错误以 result.code 表示且 HTTP 状态码为 200
+func newHTTPHandler(s *server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /session", func(w http.ResponseWriter, r *http.Request) {
+		var body httpSetRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHTTPBody))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			httpError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		req := &pb.SetRequest{Uid: body.UID, TtlSeconds: body.TTLSeconds, PrimeCache: body.PrimeCache, Namespace: body.Namespace}
+		if body.Meta != nil {
+			req.Meta = &pb.SessionMeta{
+				Device:    body.Meta.Device,
+				ClientIp:  body.Meta.ClientIP,
+				UserAgent: body.Meta.UserAgent,
+				Platform:  body.Meta.Platform,
+				Gateway:   body.Meta.Gateway,
+			}
+		}
+		resp, err := invoke(httpContext(r), s, pb.StealthIMSession_Set_FullMethodName, req, func(ctx context.Context, req any) (any, error) {
+			return s.Set(ctx, req.(*pb.SetRequest))
+		})
+		if err != nil {
+			httpStatusError(w, err)
+			return
+		}
+		out := resp.(*pb.SetResponse)
+		writeJSON(w, httpSetResponse{
+			Result:          resultJSON(out.Result),
+			Session:         out.Session,
+			ExpiresAt:       out.ExpiresAt,
+			EvictedSessions: out.EvictedSessions,
+		})
+	})
+	mux.HandleFunc("GET /session/{id}", func(w http.ResponseWriter, r *http.Request) {
+		withMeta, _ := strconv.ParseBool(r.URL.Query().Get("with_meta"))
+		req := &pb.GetRequest{Session: r.PathValue("id"), WithMeta: withMeta, Namespace: r.URL.Query().Get("namespace")}
+		resp, err := invoke(httpContext(r), s, pb.StealthIMSession_Get_FullMethodName, req, func(ctx context.Context, req any) (any, error) {
+			return s.Get(ctx, req.(*pb.GetRequest))
+		})
+		if err != nil {
+			httpStatusError(w, err)
+			return
+		}
+		out := resp.(*pb.GetResponse)
+		body := httpGetResponse{Result: resultJSON(out.Result), UID: out.Uid}
+		if out.Meta != nil {
+			body.Meta = &httpMeta{
+				Device:    out.Meta.Device,
+				ClientIP:  out.Meta.ClientIp,
+				UserAgent: out.Meta.UserAgent,
+				Platform:  out.Meta.Platform,
+				Gateway:   out.Meta.Gateway,
+			}
+		}
+		writeJSON(w, body)
+	})
+	mux.HandleFunc("DELETE /session/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req := &pb.DelRequest{Session: r.PathValue("id"), Namespace: r.URL.Query().Get("namespace")}
+		resp, err := invoke(httpContext(r), s, pb.StealthIMSession_Del_FullMethodName, req, func(ctx context.Context, req any) (any, error) {
+			return s.Del(ctx, req.(*pb.DelRequest))
+		})
+		if err != nil {
+			httpStatusError(w, err)
+			return
+		}
+		writeJSON(w, httpDelResponse{Result: resultJSON(resp.(*pb.DelResponse).Result)})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !httpAuthorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httpError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// httpAuthorized 配置了 http.token 时检查请求携带的令牌，每次请求读取当前配置
+func httpAuthorized(r *http.Request) bool {
+	token := config.LatestConfig.HTTP.Token
+	if token == "" {
+		return true
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// httpContext 将调用方地址、追踪上下文与服务令牌转为 GRPC 的 peer 与 metadata，使会话历史、链路追踪与服务鉴权与 GRPC 请求一致
+func httpContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if addr, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: net.TCPAddrFromAddrPort(addr)})
+	}
+	md := metadata.MD{}
+	for _, key := range []string{"traceparent", "tracestate", serviceTokenKey} {
+		if v := r.Header.Values(key); len(v) > 0 {
+			md[key] = v
+		}
+	}
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+// invoke 经由与 GRPC 相同的拦截器调用处理函数，指标与访问日志按 GRPC 方法记录
+func invoke(ctx context.Context, s *server, fullMethod string, req any, handler grpc.UnaryHandler) (any, error) {
+	info := &grpc.UnaryServerInfo{Server: s, FullMethod: fullMethod}
+	return chainUnary(unaryInterceptors, info, handler)(ctx, req)
+}
+
+type httpMeta struct {
+	Device    string `json:"device,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Platform  string `json:"platform,omitempty"`
+	Gateway   string `json:"gateway,omitempty"`
+}
+
+type httpResult struct {
+	Code int32  `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+type httpSetRequest struct {
+	UID        int32     `json:"uid"`
+	TTLSeconds int64     `json:"ttl_seconds"`
+	PrimeCache bool      `json:"prime_cache"`
+	Meta       *httpMeta `json:"meta"`
+	Namespace  string    `json:"namespace"`
+}
+
+type httpSetResponse struct {
+	Result          httpResult `json:"result"`
+	Session         string     `json:"session,omitempty"`
+	ExpiresAt       int64      `json:"expires_at,omitempty"`
+	EvictedSessions []string   `json:"evicted_sessions,omitempty"`
+}
+
+type httpGetResponse struct {
+	Result httpResult `json:"result"`
+	UID    int32      `json:"uid,omitempty"`
+	Meta   *httpMeta  `json:"meta,omitempty"`
+}
+
+type httpDelResponse struct {
+	Result httpResult `json:"result"`
+}
+
+func resultJSON(r *pb.Result) httpResult {
+	if r == nil {
+		return httpResult{}
+	}
+	return httpResult{Code: r.Code, Msg: r.Msg}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// httpError 以 {"error": msg} 返回请求本身的错误
+func httpError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// httpStatusError 将处理函数返回的 GRPC 状态转为 HTTP 状态码
+func httpStatusError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch status.Code(err) {
+	case codes.Canceled:
+		code = 499 // 调用方已断开，响应不会被收到
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		code = http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		code = http.StatusTooManyRequests
+	}
+	httpError(w, code, status.Convert(err).Message())
+}
@@ -0,0 +1,78 @@
+package grpc
+
+import (
+	"StealthIMSession/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// doJSON 发送请求并解码 JSON 响应
+func doJSON(t *testing.T, h http.Handler, method string, target string, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, target, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestHTTPSession(t *testing.T) {
+	s, store, _, _ := newTestServer(t)
+	h := newHTTPHandler(s)
+
+	var set httpSetResponse
+	if code := doJSON(t, h, "POST", "/session", `{"uid": 42, "meta": {"platform": "cli"}}`, &set); code != 200 || set.Result.Code != 0 || set.Session == "" {
+		t.Fatalf("POST /session = %d %+v", code, set)
+	}
+	if store.Len() != 1 {
+		t.Fatalf("store has %d sessions, want 1", store.Len())
+	}
+
+	var get httpGetResponse
+	if code := doJSON(t, h, "GET", "/session/"+set.Session+"?with_meta=true", "", &get); code != 200 || get.Result.Code != 0 || get.UID != 42 {
+		t.Fatalf("GET /session = %d %+v", code, get)
+	}
+
+	var del httpDelResponse
+	if code := doJSON(t, h, "DELETE", "/session/"+set.Session, "", &del); code != 200 || del.Result.Code != 0 {
+		t.Fatalf("DELETE /session = %d %+v", code, del)
+	}
+	// 业务错误以 result.code 返回
+	if code := doJSON(t, h, "GET", "/session/"+set.Session, "", &get); code != 200 || get.Result.Code != 1 {
+		t.Fatalf("GET deleted session = %d %+v", code, get)
+	}
+
+	if code := doJSON(t, h, "POST", "/session", `{"uid": "42"}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("POST with invalid body = %d, want 400", code)
+	}
+	if code := doJSON(t, h, "PUT", "/session/"+set.Session, "", nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT /session = %d, want 405", code)
+	}
+}
+
+func TestHTTPToken(t *testing.T) {
+	s, _, _, _ := newTestServer(t)
+	h := newHTTPHandler(s)
+
+	// 未配置令牌时不检查
+	if code := doJSON(t, h, "GET", "/session/missing", "", nil); code != 200 {
+		t.Fatalf("GET without token configured = %d, want 200", code)
+	}
+	// 令牌不匹配时拒绝，修改配置后立即生效
+	config.LatestConfig.HTTP.Token = "other"
+	if code := doJSON(t, h, "GET", "/session/missing", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("GET with wrong token = %d, want 401", code)
+	}
+	config.LatestConfig.HTTP.Token = "secret"
+	if code := doJSON(t, h, "GET", "/session/missing", "", nil); code != 200 {
+		t.Fatalf("GET with token = %d, want 200", code)
+	}
+}
@@ -0,0 +1,108 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/scheduler"
+	"context"
+	"time"
+)
+
+// ListJobs 列出后台任务及其状态
+func (s *server) ListJobs(ctx context.Context, in *pb.ListJobsRequest) (*pb.ListJobsResponse, error) {
+	statuses := scheduler.List()
+	list := make([]*pb.JobStatus, 0, len(statuses))
+	for _, st := range statuses {
+		list = append(list, &pb.JobStatus{
+			Name:      st.Name,
+			Paused:    st.Paused,
+			Running:   st.Running,
+			LastRun:   unixOrZero(st.LastRun),
+			LastError: st.LastError,
+			NextRun:   unixOrZero(st.NextRun),
+			Runs:      st.Runs,
+			Failures:  st.Failures,
+		})
+	}
+	return &pb.ListJobsResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Jobs: list,
+	}, nil
+}
+
+// TriggerJob 立即执行一次后台任务
+func (s *server) TriggerJob(ctx context.Context, in *pb.TriggerJobRequest) (*pb.TriggerJobResponse, error) {
+	logger.Info("trigger job", "job", in.Name, "caller", callerAddr(ctx))
+	if err := scheduler.Trigger(in.Name); err != nil {
+		return &pb.TriggerJobResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Job not found",
+			},
+		}, nil
+	}
+	return &pb.TriggerJobResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+	}, nil
+}
+
+// PauseJob 暂停或恢复后台任务的定时执行，重启后恢复
+func (s *server) PauseJob(ctx context.Context, in *pb.PauseJobRequest) (*pb.PauseJobResponse, error) {
+	logger.Info("pause job", "job", in.Name, "paused", in.Paused, "caller", callerAddr(ctx))
+	if err := scheduler.SetPaused(in.Name, in.Paused); err != nil {
+		return &pb.PauseJobResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Job not found",
+			},
+		}, nil
+	}
+	return &pb.PauseJobResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+	}, nil
+}
+
+// GetJobHistory 查询后台任务最近的执行记录，最新的在前
+func (s *server) GetJobHistory(ctx context.Context, in *pb.GetJobHistoryRequest) (*pb.GetJobHistoryResponse, error) {
+	runs, err := scheduler.History(in.Name)
+	if err != nil {
+		return &pb.GetJobHistoryResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Job not found",
+			},
+		}, nil
+	}
+	list := make([]*pb.JobRun, 0, len(runs))
+	for _, r := range runs {
+		list = append(list, &pb.JobRun{
+			Start:      r.Start.Unix(),
+			DurationMs: r.Duration.Milliseconds(),
+			Error:      r.Error,
+			Rows:       r.Rows,
+		})
+	}
+	return &pb.GetJobHistoryResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Runs: list,
+	}, nil
+}
+
+// unixOrZero 转换为 Unix 秒，零值时间返回 0
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,116 @@
+package grpc
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/metrics"
+	"context"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/stats"
+)
+
+// 连接关闭原因，作为 stealthim_session_grpc_connections_closed_total 的 reason 标签
+const (
+	closeMaxAge = "max_age" // 达到 max_connection_age
+	closeIdle   = "idle"    // 超过 max_connection_idle 没有请求
+	closeOther  = "other"   // 客户端关闭、网络错误或 ping 过于频繁被拒绝
+)
+
+var metricConnections = metrics.NewGauge("stealthim_session_grpc_connections", "Open gRPC connections")
+
+// keepaliveOptions 根据配置生成服务端 keepalive 参数与强制策略
+func keepaliveOptions(cfg config.GRPCProxyConfig) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             time.Duration(cfg.KeepaliveMinTime) * time.Second,
+			PermitWithoutStream: cfg.KeepalivePermitWithoutStream,
+		}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:                  time.Duration(cfg.KeepaliveTime) * time.Second,
+			Timeout:               time.Duration(cfg.KeepaliveTimeout) * time.Second,
+			MaxConnectionIdle:     secondsOrInfinity(cfg.MaxConnectionIdle),
+			MaxConnectionAge:      secondsOrInfinity(cfg.MaxConnectionAge),
+			MaxConnectionAgeGrace: secondsOrInfinity(cfg.MaxConnectionAgeGrace),
+		}),
+		grpc.StatsHandler(&connStats{
+			maxIdle: time.Duration(cfg.MaxConnectionIdle) * time.Second,
+			maxAge:  time.Duration(cfg.MaxConnectionAge) * time.Second,
+		}),
+	}
+}
+
+// secondsOrInfinity 将秒数转换为时长，0 表示不限制
+func secondsOrInfinity(seconds int) time.Duration {
+	if seconds <= 0 {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// connState 单个连接的状态
+type connState struct {
+	opened     time.Time
+	lastActive atomic.Int64 // 最近一次请求结束的时间（UnixNano）
+	streams    atomic.Int32 // 进行中的请求数
+}
+
+type connStateKey struct{}
+
+// connStats 统计连接数，并在连接关闭时推断是否由 keepalive 策略关闭
+// gRPC 不暴露关闭原因，按连接存活时间与空闲时间判断
+type connStats struct {
+	maxIdle time.Duration
+	maxAge  time.Duration
+}
+
+func (h *connStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	st := &connState{opened: time.Now()}
+	st.lastActive.Store(st.opened.UnixNano())
+	return context.WithValue(ctx, connStateKey{}, st)
+}
+
+func (h *connStats) HandleConn(ctx context.Context, s stats.ConnStats) {
+	st, ok := ctx.Value(connStateKey{}).(*connState)
+	if !ok {
+		return
+	}
+	switch s.(type) {
+	case *stats.ConnBegin:
+		metricConnections.Add(1)
+	case *stats.ConnEnd:
+		metricConnections.Add(-1)
+		metrics.NewCounter("stealthim_session_grpc_connections_closed_total", "gRPC connections closed", "reason", h.closeReason(st, time.Now())).Inc()
+	}
+}
+
+// closeReason 推断连接关闭原因
+func (h *connStats) closeReason(st *connState, now time.Time) string {
+	if h.maxAge > 0 && now.Sub(st.opened) >= h.maxAge {
+		return closeMaxAge
+	}
+	if h.maxIdle > 0 && st.streams.Load() == 0 && now.Sub(time.Unix(0, st.lastActive.Load())) >= h.maxIdle {
+		return closeIdle
+	}
+	return closeOther
+}
+
+func (h *connStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *connStats) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	st, ok := ctx.Value(connStateKey{}).(*connState)
+	if !ok {
+		return
+	}
+	switch s.(type) {
+	case *stats.Begin:
+		st.streams.Add(1)
+	case *stats.End:
+		st.streams.Add(-1)
+		st.lastActive.Store(time.Now().UnixNano())
+	}
+}
@@ -0,0 +1,83 @@
+package grpc
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/metrics"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+var metricConnectionsRejected = metrics.NewCounter("stealthim_session_grpc_connections_rejected_total", "gRPC connections closed on accept because max_connections was reached")
+
+// limitOptions 根据配置生成并发流数与消息大小的限制，0 表示使用 gRPC 的默认值
+func limitOptions(cfg config.GRPCProxyConfig) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if cfg.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(cfg.MaxConcurrentStreams)))
+	}
+	if cfg.MaxRecvMsgMB > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgMB<<20))
+	}
+	if cfg.MaxSendMsgMB > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.MaxSendMsgMB<<20))
+	}
+	return opts
+}
+
+// connLimit 全部监听地址共享的连接数上限，为 nil 时不限制
+type connLimit chan struct{}
+
+// newConnLimit 创建最多 max 个连接的上限，max 为 0 时不限制
+func newConnLimit(max int) connLimit {
+	if max <= 0 {
+		return nil
+	}
+	return make(connLimit, max)
+}
+
+// wrap 使 lis 上接受的连接计入上限
+func (l connLimit) wrap(lis net.Listener) net.Listener {
+	if l == nil {
+		return lis
+	}
+	return &limitListener{Listener: lis, slots: l}
+}
+
+// limitListener 同时打开的连接达到上限后，新接受的连接立即关闭，客户端随即连接其他副本
+// 与阻塞 Accept 不同，超出的连接不会在内核队列中等待到超时
+type limitListener struct {
+	net.Listener
+	slots connLimit
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case l.slots <- struct{}{}:
+			return &limitConn{Conn: conn, release: func() { <-l.slots }}, nil
+		default:
+			metricConnectionsRejected.Inc()
+			logger.Debug("connection rejected, max_connections reached", "remote", conn.RemoteAddr().String())
+			conn.Close()
+		}
+	}
+}
+
+// limitConn 关闭时归还连接数
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,72 @@
+package grpc
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimitConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := newConnLimit(2).wrap(ln)
+	defer lis.Close()
+
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	// closedByServer 判断服务端是否关闭了连接
+	closedByServer := func(conn net.Conn) bool {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		_, err := conn.Read(make([]byte, 1))
+		return err == io.EOF
+	}
+
+	dial()
+	dial()
+	first := <-accepted
+	<-accepted
+
+	// 达到上限后新连接立即关闭
+	if !closedByServer(dial()) {
+		t.Fatal("connection over max_connections was not closed")
+	}
+
+	// 关闭一个连接后（重复关闭只归还一次）可以建立新连接
+	first.Close()
+	first.Close()
+	conn := dial()
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("connection not accepted after a slot was released")
+	}
+	if closedByServer(conn) {
+		t.Fatal("connection within max_connections was closed")
+	}
+	if !closedByServer(dial()) {
+		t.Fatal("released slot was counted twice")
+	}
+
+	if newConnLimit(0).wrap(ln) != ln {
+		t.Fatal("max_connections = 0 should not wrap the listener")
+	}
+}
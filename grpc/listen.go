@@ -0,0 +1,57 @@
+package grpc
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/logging"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// listener 会话服务的一个监听地址，各自在独立的 goroutine 中接受连接
+type listener struct {
+	addr string // 配置中的地址
+	lis  net.Listener
+	done chan struct{} // Serve 返回后关闭
+}
+
+// grpcListeners 正在使用的监听地址，Start 前为 nil
+var grpcListeners atomic.Pointer[[]*listener]
+
+// listen 监听 host:port 或 unix:路径
+// Unix 域套接字文件已存在时，若无法连接（上次异常退出遗留）则删除后重新创建，仍有进程监听时返回错误
+func listen(addr string) (net.Listener, error) {
+	network, address := config.SplitListenAddr(addr)
+	if network == "unix" {
+		if conn, err := net.Dial("unix", address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("listen %s: socket is in use", addr)
+		}
+		if fi, err := os.Lstat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+	}
+	lis, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return lis, nil
+}
+
+// serve 在监听地址上运行服务，Shutdown 后 Serve 返回 nil
+func (l *listener) serve(s *grpc.Server) {
+	defer close(l.done)
+	if err := s.Serve(l.lis); err != nil {
+		logging.Fatal(logger, "failed to serve", "addr", l.addr, "error", err)
+	}
+}
+
+// closeListeners 关闭尚未开始服务的监听地址
+func closeListeners(lns []*listener) {
+	for _, l := range lns {
+		l.lis.Close()
+	}
+}
@@ -0,0 +1,35 @@
+package grpc
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.sock")
+	addr := "unix:" + path
+
+	lis, err := listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 仍有进程监听时不删除套接字文件
+	if _, err := listen(addr); err == nil {
+		t.Fatal("listen() on a socket in use succeeded")
+	}
+
+	// 异常退出遗留的套接字文件被替换
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	lis.Close()
+	lis, err = listen(addr)
+	if err != nil {
+		t.Fatalf("listen() over a stale socket = %v", err)
+	}
+	defer lis.Close()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
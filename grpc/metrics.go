@@ -0,0 +1,117 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/buildinfo"
+	"StealthIMSession/config"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"StealthIMSession/obfuscate"
+	"StealthIMSession/tracing"
+	"context"
+	"log/slog"
+	"path"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// methodMetrics 单个 RPC 方法的指标
+type methodMetrics struct {
+	calls   *metrics.Counter
+	errors  *metrics.Counter
+	latency *metrics.Histogram
+}
+
+var methodMetricsMap sync.Map // method -> *methodMetrics
+
+func getMethodMetrics(fullMethod string) *methodMetrics {
+	if m, ok := methodMetricsMap.Load(fullMethod); ok {
+		return m.(*methodMetrics)
+	}
+	method := path.Base(fullMethod)
+	m, _ := methodMetricsMap.LoadOrStore(fullMethod, &methodMetrics{
+		calls:   metrics.NewCounter("stealthim_session_grpc_requests_total", "gRPC requests handled", "method", method),
+		errors:  metrics.NewCounter("stealthim_session_grpc_errors_total", "gRPC requests that returned a transport error", "method", method),
+		latency: metrics.NewHistogram("stealthim_session_grpc_latency_seconds", "gRPC handler latency", nil, "method", method),
+	})
+	return m.(*methodMetrics)
+}
+
+// metricsInterceptor 记录每个 RPC 的调用次数与耗时
+func metricsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	// 调用方已取消或超时时响应不会被收到，按对应的状态码记录，避免被当作正常的业务结果（如 Get 的会话不存在）
+	if err == nil && ctx.Err() != nil {
+		resp, err = nil, status.FromContextError(ctx.Err()).Err()
+	}
+	m := getMethodMetrics(info.FullMethod)
+	m.calls.Inc()
+	if err != nil {
+		m.errors.Inc()
+	}
+	m.latency.ObserveSince(start)
+	accessLog(ctx, info.FullMethod, req, resp, err, time.Since(start))
+	return resp, err
+}
+
+// accessLog 记录一次 RPC 调用，grpc.log 开启时为 info 级别，否则为 debug 级别
+// 会话ID只记录前缀
+func accessLog(ctx context.Context, method string, req any, resp any, err error, latency time.Duration) {
+	lvl := slog.LevelDebug
+	if config.LatestConfig.GRPCProxy.Log {
+		lvl = slog.LevelInfo
+	}
+	if !logger.Enabled(ctx, lvl) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", path.Base(method)),
+		slog.Duration("latency", latency),
+	}
+	if id := tracing.TraceID(ctx); id != "" {
+		attrs = append(attrs, slog.String("trace_id", id))
+	}
+	if r, ok := req.(interface{ GetSession() string }); ok && r.GetSession() != "" {
+		attrs = append(attrs, logging.Session(r.GetSession()))
+	}
+	if r, ok := req.(interface{ GetUid() int32 }); ok && r.GetUid() != 0 {
+		attrs = append(attrs, slog.String("uid", obfuscate.UID(r.GetUid())))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	} else if r, ok := resp.(interface{ GetResult() *pb.Result }); ok && r.GetResult() != nil {
+		attrs = append(attrs, slog.Int("code", int(r.GetResult().Code)))
+	}
+	logger.LogAttrs(ctx, lvl, "rpc", attrs...)
+}
+
+// Stats 获取服务内部指标
+func (s *server) Stats(ctx context.Context, in *pb.StatsRequest) (*pb.StatsResponse, error) {
+	samples := metrics.Snapshot()
+	list := make([]*pb.Metric, 0, len(samples))
+	for _, sample := range samples {
+		m := &pb.Metric{
+			Name:   sample.Name,
+			Labels: sample.Labels,
+			Value:  sample.Value,
+		}
+		if sample.Histogram != nil {
+			m.Sum = sample.Histogram.Sum
+		}
+		list = append(list, m)
+	}
+	return &pb.StatsResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Metrics:   list,
+		Version:   buildinfo.Version,
+		Commit:    buildinfo.Commit,
+		BuildDate: buildinfo.BuildDate,
+	}, nil
+}
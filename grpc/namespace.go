@@ -0,0 +1,14 @@
+package grpc
+
+import pb "StealthIMSession/StealthIM.Session"
+
+// codeInvalidNamespace 命名空间格式不合法时 Set、Get、Del 返回的状态码
+const codeInvalidNamespace = 10
+
+// invalidNamespaceResult 命名空间不合法时的响应结果
+func invalidNamespaceResult() *pb.Result {
+	return &pb.Result{
+		Code: codeInvalidNamespace,
+		Msg:  "Invalid namespace",
+	}
+}
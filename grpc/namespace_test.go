@@ -0,0 +1,37 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"testing"
+)
+
+func TestNamespaceIsolation(t *testing.T) {
+	s, _, _, ctx := newTestServer(t)
+	set, err := s.Set(ctx, &pb.SetRequest{Uid: 42, Namespace: "a"})
+	if err != nil || set.Result.Code != 0 {
+		t.Fatalf("Set(namespace a) = %+v, %v", set, err)
+	}
+
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session, Namespace: "a"}); get.Result.Code != 0 || get.Uid != 42 {
+		t.Fatalf("Get(namespace a) = %+v", get)
+	}
+	for _, ns := range []string{"", "b"} {
+		if get, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session, Namespace: ns}); get.Result.Code != 1 {
+			t.Errorf("Get(namespace %q) = %+v, want code 1", ns, get)
+		}
+	}
+
+	if resp, _ := s.Set(ctx, &pb.SetRequest{Uid: 42, Namespace: "A:b"}); resp.Result.Code != codeInvalidNamespace {
+		t.Errorf("Set(invalid namespace) = %+v, want code %d", resp, codeInvalidNamespace)
+	}
+	if resp, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session, Namespace: "A:b"}); resp.Result.Code != codeInvalidNamespace {
+		t.Errorf("Get(invalid namespace) = %+v, want code %d", resp, codeInvalidNamespace)
+	}
+
+	if del, _ := s.Del(ctx, &pb.DelRequest{Session: set.Session, Namespace: "a"}); del.Result.Code != 0 {
+		t.Fatalf("Del(namespace a) = %+v", del)
+	}
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session, Namespace: "a"}); get.Result.Code != 1 {
+		t.Fatalf("Get(namespace a) after Del = %+v, want code 1", get)
+	}
+}
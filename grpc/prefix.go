@@ -0,0 +1,43 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/config"
+	"StealthIMSession/metrics"
+	"strings"
+	"sync"
+)
+
+// codeForeignSession 会话ID前缀不被接受时各接口返回的状态码
+const codeForeignSession = 4
+
+var foreignSessionMetrics sync.Map // method -> *metrics.Counter
+
+// foreignSession 检查会话ID前缀，配置了 accepted_prefixes 且前缀不在其中时返回 true
+// 用于在查询缓存前直接拒绝指向错误环境的客户端
+func foreignSession(method string, sessionID string) bool {
+	prefixes := config.LatestConfig.Session.AcceptedPrefixes
+	if len(prefixes) == 0 {
+		return false
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(sessionID, prefix) {
+			return false
+		}
+	}
+	counter, ok := foreignSessionMetrics.Load(method)
+	if !ok {
+		counter, _ = foreignSessionMetrics.LoadOrStore(method,
+			metrics.NewCounter("stealthim_session_foreign_sessions_total", "Requests rejected because the session ID prefix is not accepted", "method", method))
+	}
+	counter.(*metrics.Counter).Inc()
+	return true
+}
+
+// foreignSessionResult 前缀不被接受时的响应结果
+func foreignSessionResult() *pb.Result {
+	return &pb.Result{
+		Code: codeForeignSession,
+		Msg:  "Unknown session prefix",
+	}
+}
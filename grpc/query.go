@@ -0,0 +1,28 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/query"
+)
+
+// queryFromPB 将请求中的查询选项转换为 query.Request，未提供时返回零值
+func queryFromPB(opts *pb.QueryOptions) query.Request {
+	if opts == nil {
+		return query.Request{}
+	}
+	req := query.Request{
+		Filters: make([]query.Filter, 0, len(opts.Filters)),
+		Sort:    opts.Sort,
+		Desc:    opts.Desc,
+		Cursor:  opts.Cursor,
+		Limit:   int(opts.Limit),
+	}
+	for _, f := range opts.Filters {
+		req.Filters = append(req.Filters, query.Filter{
+			Field: f.Field,
+			Op:    query.Op(f.Op),
+			Value: f.Value,
+		})
+	}
+	return req
+}
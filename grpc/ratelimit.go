@@ -0,0 +1,81 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/config"
+	"StealthIMSession/metrics"
+	"StealthIMSession/obfuscate"
+	"StealthIMSession/ratelimit"
+	"context"
+	"path"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 限流：本实例的全局与每个调用方的请求速率，以及每个 uid 的 Set 速率
+// 多实例部署时各实例分别计数，部署整体的上限为单实例上限乘以实例数
+
+var (
+	globalLimiter ratelimit.Bucket
+	callerLimiter ratelimit.Keyed[string]
+	setUIDLimiter ratelimit.Keyed[int32]
+)
+
+var (
+	metricRateLimitedGlobal = metrics.NewCounter("stealthim_session_rate_limited_total", "Requests rejected by the rate limiter", "scope", "global")
+	metricRateLimitedCaller = metrics.NewCounter("stealthim_session_rate_limited_total", "Requests rejected by the rate limiter", "scope", "caller")
+	metricRateLimitedUID    = metrics.NewCounter("stealthim_session_rate_limited_total", "Requests rejected by the rate limiter", "scope", "uid")
+)
+
+// burstOr 容量为 0 时等于速率
+func burstOr(burst int, rate int) int {
+	if burst > 0 {
+		return burst
+	}
+	return rate
+}
+
+// rateLimited 超出限流时返回的错误
+func rateLimited(scope string) error {
+	return status.Error(codes.ResourceExhausted, "rate limit exceeded ("+scope+")")
+}
+
+// rateLimitInterceptor 按 ratelimit.global_qps 与 caller_qps 限制会话服务的请求，管理服务不受限制
+func rateLimitInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if _, ok := info.Server.(*server); !ok {
+		return handler(ctx, req)
+	}
+	cfg := config.LatestConfig.RateLimit
+	now := time.Now()
+	if !globalLimiter.Allow(now, float64(cfg.GlobalQPS), burstOr(cfg.GlobalBurst, cfg.GlobalQPS)) {
+		metricRateLimitedGlobal.Inc()
+		return nil, rateLimited("global")
+	}
+	if cfg.CallerQPS > 0 {
+		caller := callerAddr(ctx)
+		if !callerLimiter.Allow(caller, now, float64(cfg.CallerQPS), burstOr(cfg.CallerBurst, cfg.CallerQPS)) {
+			metricRateLimitedCaller.Inc()
+			logger.Debug("caller rate limited", "method", path.Base(info.FullMethod), "caller", caller)
+			return nil, rateLimited("caller")
+		}
+	}
+	return handler(ctx, req)
+}
+
+// setUIDRateInterceptor 按 ratelimit.set_per_uid 限制每个 uid 每分钟的 Set 次数
+func setUIDRateInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	in, ok := req.(*pb.SetRequest)
+	if !ok {
+		return handler(ctx, req)
+	}
+	cfg := config.LatestConfig.RateLimit
+	if !setUIDLimiter.Allow(in.Uid, time.Now(), float64(cfg.SetPerUID)/60, burstOr(cfg.SetPerUIDBurst, cfg.SetPerUID)) {
+		metricRateLimitedUID.Inc()
+		logger.Warn("uid rate limited on Set", "uid", obfuscate.UID(in.Uid), "caller", callerAddr(ctx))
+		return nil, rateLimited("uid")
+	}
+	return handler(ctx, req)
+}
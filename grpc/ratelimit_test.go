@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/config"
+	"StealthIMSession/ratelimit"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimit(t *testing.T) {
+	s, _, _, ctx := newTestServer(t)
+	reset := func() {
+		globalLimiter = ratelimit.Bucket{}
+		callerLimiter = ratelimit.Keyed[string]{}
+		setUIDLimiter = ratelimit.Keyed[int32]{}
+	}
+	reset()
+	t.Cleanup(reset)
+	set := func(uid int32) error {
+		_, err := invoke(ctx, s, pb.StealthIMSession_Set_FullMethodName, &pb.SetRequest{Uid: uid}, func(ctx context.Context, req any) (any, error) {
+			return s.Set(ctx, req.(*pb.SetRequest))
+		})
+		return err
+	}
+
+	config.LatestConfig.RateLimit.SetPerUID = 2
+	for i := 0; i < 2; i++ {
+		if err := set(42); err != nil {
+			t.Fatalf("Set() %d within limit: %v", i, err)
+		}
+	}
+	if err := set(42); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Set() over per-uid limit: err = %v, want ResourceExhausted", err)
+	}
+	if err := set(43); err != nil {
+		t.Fatalf("Set() for another uid: %v", err)
+	}
+
+	config.LatestConfig.RateLimit.GlobalQPS = 1
+	if err := set(44); err != nil {
+		t.Fatalf("Set() within global limit: %v", err)
+	}
+	if err := set(45); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Set() over global limit: err = %v, want ResourceExhausted", err)
+	}
+	// 管理服务不受限制
+	admin := &adminServer{}
+	_, err := chainUnary(unaryInterceptors, &grpc.UnaryServerInfo{Server: admin}, func(ctx context.Context, req any) (any, error) {
+		return admin.CacheStats(ctx, req.(*pb.CacheStatsRequest))
+	})(ctx, &pb.CacheStatsRequest{})
+	if err != nil {
+		t.Fatalf("CacheStats() under global limit: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/cache"
+	"StealthIMSession/config"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+// codeRefreshDisabled 未启用刷新令牌时 Set（with_refresh）与 Refresh 返回的状态码
+const codeRefreshDisabled = 8
+
+var (
+	metricRefreshOK       = metrics.NewCounter("stealthim_session_refreshes_total", "Refresh calls", "result", "ok")
+	metricRefreshRejected = metrics.NewCounter("stealthim_session_refreshes_total", "Refresh calls", "result", "rejected")
+	metricRefreshFailed   = metrics.NewCounter("stealthim_session_refreshes_total", "Refresh calls", "result", "failed")
+)
+
+// refreshDisabledResult 未启用刷新令牌时的响应结果
+func refreshDisabledResult() *pb.Result {
+	return &pb.Result{
+		Code: codeRefreshDisabled,
+		Msg:  "Refresh tokens disabled",
+	}
+}
+
+// issueRefreshToken 生成并保存与会话绑定的刷新令牌，返回令牌与过期时间（Unix 秒）
+func issueRefreshToken(ctx context.Context, uid int32, sessionID string) (string, int64, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", 0, err
+	}
+	token := hex.EncodeToString(b)
+	expiresAt, err := cache.SaveRefreshToken(ctx, token, uid, sessionID)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, expiresAt.Unix(), nil
+}
+
+// Refresh 使用刷新令牌换取新的会话与刷新令牌
+// 刷新令牌只能使用一次，使用后其绑定的原会话同时删除
+func (s *server) Refresh(ctx context.Context, in *pb.RefreshRequest) (*pb.RefreshResponse, error) {
+	if !config.LatestConfig.Refresh.Enable {
+		return &pb.RefreshResponse{
+			Result: refreshDisabledResult(),
+		}, nil
+	}
+	if !cache.ValidRefreshToken(in.RefreshToken) {
+		metricRefreshRejected.Inc()
+		return &pb.RefreshResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Refresh token not found",
+			},
+		}, nil
+	}
+
+	uid, oldSession, err := cache.ConsumeRefreshToken(ctx, in.RefreshToken)
+	if errors.Is(err, cache.ErrRefreshNotFound) {
+		metricRefreshRejected.Inc()
+		return &pb.RefreshResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Refresh token not found",
+			},
+		}, nil
+	}
+	if err != nil {
+		metricRefreshFailed.Inc()
+		logger.Error("consume refresh token failed", "error", err)
+		return &pb.RefreshResponse{
+			Result: &pb.Result{
+				Code: 2,
+				Msg:  "Failed to refresh session",
+			},
+		}, nil
+	}
+	// 冻结的用户不删除原会话，与冻结不删除会话一致；刷新令牌已使用，解冻后需重新登录
+	if frozenUID("Refresh", uid) {
+		return &pb.RefreshResponse{
+			Result: frozenResult(),
+		}, nil
+	}
+
+	// 原会话可能尚未过期，换取新会话后即失效
+	_, err = withStoredKey(ctx, oldSession, func(key string) (bool, error) {
+		return cache.DeleteSession(ctx, key, callerAddr(ctx))
+	}, deleteMissing)
+	oldSession = storedKey(oldSession)
+	if err != nil {
+		logger.Warn("delete refreshed session failed", logging.Session(oldSession), "error", err)
+	}
+
+	// 新会话与原会话在同一命名空间
+	ns, _ := cache.SplitNamespace(oldSession)
+	set, err := s.Set(ctx, &pb.SetRequest{Uid: uid, Meta: in.Meta, WithRefresh: true, Namespace: ns})
+	if err != nil {
+		return nil, err
+	}
+	if set.Result.Code == 0 {
+		metricRefreshOK.Inc()
+	} else {
+		metricRefreshFailed.Inc()
+	}
+	return &pb.RefreshResponse{
+		Result:           set.Result,
+		Session:          set.Session,
+		ExpiresAt:        set.ExpiresAt,
+		RefreshToken:     set.RefreshToken,
+		RefreshExpiresAt: set.RefreshExpiresAt,
+	}, nil
+}
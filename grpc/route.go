@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/cache"
+	"context"
+)
+
+// GetRouteHints 获取用户有效会话的路由提示（最后活跃时间、接入节点与设备），供消息服务选择推送设备
+func (s *server) GetRouteHints(ctx context.Context, in *pb.GetRouteHintsRequest) (*pb.GetRouteHintsResponse, error) {
+	hints, err := cache.GetRouteHints(ctx, []int32{in.Uid})
+	if err != nil {
+		return &pb.GetRouteHintsResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to get route hints",
+			},
+		}, nil
+	}
+
+	return &pb.GetRouteHintsResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Hints: routeHintsToPB(hints[in.Uid]),
+	}, nil
+}
+
+// GetRouteHintsBulk 批量获取多个用户的路由提示，用于群消息扇出
+// 没有有效会话的用户不出现在结果中
+func (s *server) GetRouteHintsBulk(ctx context.Context, in *pb.GetRouteHintsBulkRequest) (*pb.GetRouteHintsBulkResponse, error) {
+	if len(in.Uids) > cache.MaxRouteUIDs {
+		return &pb.GetRouteHintsBulkResponse{
+			Result: &pb.Result{
+				Code: 2,
+				Msg:  "Too many uids",
+			},
+		}, nil
+	}
+	hints, err := cache.GetRouteHints(ctx, in.Uids)
+	if err != nil {
+		return &pb.GetRouteHintsBulkResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to get route hints",
+			},
+		}, nil
+	}
+
+	// 按请求顺序输出，重复的 uid 只输出一次
+	users := make([]*pb.UserRouteHints, 0, len(hints))
+	for _, uid := range in.Uids {
+		list, ok := hints[uid]
+		if !ok {
+			continue
+		}
+		users = append(users, &pb.UserRouteHints{
+			Uid:   uid,
+			Hints: routeHintsToPB(list),
+		})
+		delete(hints, uid)
+	}
+
+	return &pb.GetRouteHintsBulkResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Users: users,
+	}, nil
+}
+
+// routeHintsToPB 转换路由提示用于响应
+func routeHintsToPB(hints []cache.RouteHint) []*pb.RouteHint {
+	list := make([]*pb.RouteHint, 0, len(hints))
+	for _, hint := range hints {
+		list = append(list, &pb.RouteHint{
+			Session:    hint.SessionID,
+			LastActive: hint.LastActive.Unix(),
+			Meta:       metaToPB(hint.Meta),
+		})
+	}
+	return list
+}
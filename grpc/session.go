@@ -5,14 +5,18 @@ import (
 	"StealthIMSession/autoclean"
 	"StealthIMSession/cache"
 	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"StealthIMSession/query"
 	"context"
-	"crypto/rand"
-	"encoding/hex"
-	"log"
+	"errors"
 	"net"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
 )
 
 var (
@@ -20,15 +24,38 @@ var (
 	sessionLock     sync.Mutex
 	sessionListener net.Listener
 	sessionCleaner  *autoclean.SessionCleaner
+
+	metricReloadsOK       = metrics.NewCounter("stealthim_session_config_reloads_total", "Configuration reloads", "result", "ok")
+	metricReloadsRejected = metrics.NewCounter("stealthim_session_config_reloads_total", "Configuration reloads", "result", "rejected")
 )
 
 // Set 设置新的会话
 func (s *server) Set(ctx context.Context, in *pb.SetRequest) (*pb.SetResponse, error) {
-	if config.LatestConfig.GRPCProxy.Log {
-		log.Println("[GRPC] Call Set")
+	if frozenUID("Set", in.Uid) {
+		return &pb.SetResponse{
+			Result: frozenResult(),
+		}, nil
+	}
+
+	if !cache.ValidNamespace(in.Namespace) {
+		return &pb.SetResponse{
+			Result: invalidNamespaceResult(),
+		}, nil
+	}
+	if in.WithRefresh && !config.LatestConfig.Refresh.Enable {
+		return &pb.SetResponse{
+			Result: refreshDisabledResult(),
+		}, nil
+	}
+
+	// 负数视为未设置，使用全局有效期；带刷新令牌的会话默认使用 refresh.access_ttl
+	ttl := time.Duration(max(in.TtlSeconds, 0)) * time.Second
+	if in.WithRefresh && ttl == 0 {
+		ttl = time.Duration(config.LatestConfig.Refresh.AccessTTL) * time.Second
 	}
+
 	// 生成随机会话ID
-	sessionID, err := generateSessionID()
+	sessionID, err := generateSessionID(in.Namespace, in.Uid, ttl)
 	if err != nil {
 		return &pb.SetResponse{
 			Result: &pb.Result{
@@ -38,8 +65,39 @@ func (s *server) Set(ctx context.Context, in *pb.SetRequest) (*pb.SetResponse, e
 		}, nil
 	}
 
+	// 存储与缓存中的键，带有命名空间，启用 hash_ids 时为会话ID的哈希
+	key := cache.StoredID(cache.NamespacedID(in.Namespace, sessionID))
+
+	// 会话数达到上限时删除最早的会话
+	evicted, err := cache.EvictForNewSession(ctx, in.Namespace, in.Uid, callerAddr(ctx))
+	if err != nil {
+		logger.Error("evict sessions over per-user limit failed", "error", err)
+		return &pb.SetResponse{
+			Result: &pb.Result{
+				Code: 2,
+				Msg:  "Failed to save session",
+			},
+		}, nil
+	}
+
+	// 先保存刷新令牌：会话保存失败时，刷新令牌没有返回给调用方，过期后由清理任务删除
+	var refreshToken string
+	var refreshExpiresAt int64
+	if in.WithRefresh {
+		refreshToken, refreshExpiresAt, err = issueRefreshToken(ctx, in.Uid, key)
+		if err != nil {
+			logger.Error("save refresh token failed", "error", err)
+			return &pb.SetResponse{
+				Result: &pb.Result{
+					Code: 2,
+					Msg:  "Failed to save session",
+				},
+			}, nil
+		}
+	}
+
 	// 保存会话到数据库
-	err = cache.SaveSession(sessionID, in.Uid)
+	expiresAt, err := cache.SaveSession(ctx, key, in.Uid, ttl, metaFromPB(in.Meta), callerAddr(ctx))
 	if err != nil {
 		return &pb.SetResponse{
 			Result: &pb.Result{
@@ -49,21 +107,83 @@ func (s *server) Set(ctx context.Context, in *pb.SetRequest) (*pb.SetResponse, e
 		}, nil
 	}
 
+	// 读写一致：返回前预热缓存
+	if in.PrimeCache {
+		if err := cache.PrimeSession(ctx, key, in.Uid, ttl); err != nil {
+			logger.Warn("prime session cache failed", logging.Session(sessionID), "error", err)
+			return &pb.SetResponse{
+				Result: &pb.Result{
+					Code: 3,
+					Msg:  "Session saved but cache priming failed",
+				},
+				Session:          sessionID,
+				ExpiresAt:        expiresAt.Unix(),
+				EvictedSessions:  evicted,
+				RefreshToken:     refreshToken,
+				RefreshExpiresAt: refreshExpiresAt,
+			}, nil
+		}
+	}
+
 	return &pb.SetResponse{
 		Result: &pb.Result{
 			Code: 0,
 			Msg:  "",
 		},
-		Session: sessionID,
+		Session:          sessionID,
+		ExpiresAt:        expiresAt.Unix(),
+		EvictedSessions:  evicted,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
 	}, nil
 }
 
 // Get 获取会话信息
 func (s *server) Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error) {
-	if config.LatestConfig.GRPCProxy.Log {
-		log.Println("[GRPC] Call Get")
+	if foreignSession("Get", in.Session) {
+		return &pb.GetResponse{
+			Result: foreignSessionResult(),
+		}, nil
+	}
+	if wrongAudience("Get", in.Session) {
+		return &pb.GetResponse{
+			Result: wrongAudienceResult(),
+		}, nil
+	}
+	if !cache.ValidSessionID(in.Session) {
+		return &pb.GetResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Session not found",
+			},
+		}, nil
+	}
+	if !cache.ValidNamespace(in.Namespace) {
+		return &pb.GetResponse{
+			Result: invalidNamespaceResult(),
+		}, nil
+	}
+	plain := cache.NamespacedID(in.Namespace, in.Session)
+	key := storedKey(plain)
+	uid, err := withStoredKey(ctx, plain, func(key string) (int32, error) {
+		return cache.GetUserIDBySession(ctx, key)
+	}, sessionMissing)
+	if errors.Is(err, gateway.ErrCircuitOpen) {
+		return &pb.GetResponse{
+			Result: &pb.Result{
+				Code: 6,
+				Msg:  "Backend circuit open",
+			},
+		}, nil
+	}
+	if errors.Is(err, cache.ErrBackendUnavailable) {
+		return &pb.GetResponse{
+			Result: &pb.Result{
+				Code: 5,
+				Msg:  "Backend unavailable",
+			},
+		}, nil
 	}
-	uid, err := cache.GetUserIDBySession(in.Session)
 	if err != nil {
 		return &pb.GetResponse{
 			Result: &pb.Result{
@@ -72,22 +192,151 @@ func (s *server) Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, e
 			},
 		}, nil
 	}
+	if frozenUID("Get", uid) {
+		return &pb.GetResponse{
+			Result: frozenResult(),
+		}, nil
+	}
+
+	if config.LatestConfig.Session.Sliding {
+		cache.TouchSession(ctx, key)
+	} else if cache.IdleTimeout() > 0 {
+		cache.MarkActive(ctx, key)
+	}
 
-	return &pb.GetResponse{
+	resp := &pb.GetResponse{
 		Result: &pb.Result{
 			Code: 0,
 			Msg:  "",
 		},
 		Uid: uid,
+	}
+	if in.WithMeta {
+		meta, err := cache.GetSessionMeta(ctx, key)
+		if err == nil {
+			resp.Meta = metaToPB(meta)
+		}
+	}
+	return resp, nil
+}
+
+// Renew 延长会话有效期
+func (s *server) Renew(ctx context.Context, in *pb.RenewRequest) (*pb.RenewResponse, error) {
+	if foreignSession("Renew", in.Session) {
+		return &pb.RenewResponse{
+			Result: foreignSessionResult(),
+		}, nil
+	}
+	if wrongAudience("Renew", in.Session) {
+		return &pb.RenewResponse{
+			Result: wrongAudienceResult(),
+		}, nil
+	}
+	if !cache.ValidSessionID(in.Session) {
+		return &pb.RenewResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Session not found",
+			},
+		}, nil
+	}
+	expiresAt, err := withStoredKey(ctx, in.Session, func(key string) (time.Time, error) {
+		return cache.RenewSession(ctx, key, callerAddr(ctx))
+	}, func(_ time.Time, err error) bool { return err != nil })
+	if err != nil {
+		return &pb.RenewResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Session not found",
+			},
+		}, nil
+	}
+
+	return &pb.RenewResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		ExpiresAt: expiresAt.Unix(),
+	}, nil
+}
+
+// ListSessionsByUID 获取用户所有有效会话
+func (s *server) ListSessionsByUID(ctx context.Context, in *pb.ListSessionsByUIDRequest) (*pb.ListSessionsByUIDResponse, error) {
+	// 未提供查询选项时返回完整列表（可命中列表缓存），否则分页查询
+	var sessions []cache.SessionInfo
+	var next string
+	var err error
+	if in.Query == nil {
+		sessions, err = cache.ListSessionsByUID(ctx, in.Uid)
+	} else {
+		sessions, next, err = cache.ListSessionsPage(ctx, in.Uid, queryFromPB(in.Query))
+	}
+	if errors.Is(err, query.ErrInvalid) {
+		return &pb.ListSessionsByUIDResponse{
+			Result: &pb.Result{
+				Code: 2,
+				Msg:  err.Error(),
+			},
+		}, nil
+	}
+	if err != nil {
+		return &pb.ListSessionsByUIDResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to list sessions",
+			},
+		}, nil
+	}
+
+	list := make([]*pb.SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		list = append(list, &pb.SessionInfo{
+			Session:   session.SessionID,
+			CreatedAt: session.CreatedAt.Unix(),
+			Meta:      metaToPB(session.Meta),
+		})
+	}
+
+	return &pb.ListSessionsByUIDResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Sessions:   list,
+		NextCursor: next,
 	}, nil
 }
 
 // Del 删除会话
+// 状态码：0 已删除，2 会话不存在或已被删除（重复提交），1 删除失败（缓存未修改，可重试）
 func (s *server) Del(ctx context.Context, in *pb.DelRequest) (*pb.DelResponse, error) {
-	if config.LatestConfig.GRPCProxy.Log {
-		log.Println("[GRPC] Call Del")
+	if foreignSession("Del", in.Session) {
+		return &pb.DelResponse{
+			Result: foreignSessionResult(),
+		}, nil
+	}
+	if wrongAudience("Del", in.Session) {
+		return &pb.DelResponse{
+			Result: wrongAudienceResult(),
+		}, nil
+	}
+	if !cache.ValidSessionID(in.Session) {
+		return &pb.DelResponse{
+			Result: &pb.Result{
+				Code: 2,
+				Msg:  "Session already deleted",
+			},
+		}, nil
+	}
+	if !cache.ValidNamespace(in.Namespace) {
+		return &pb.DelResponse{
+			Result: invalidNamespaceResult(),
+		}, nil
 	}
-	err := cache.DeleteSession(in.Session)
+	existed, err := withStoredKey(ctx, cache.NamespacedID(in.Namespace, in.Session), func(key string) (bool, error) {
+		return cache.DeleteSession(ctx, key, callerAddr(ctx))
+	}, deleteMissing)
 	if err != nil {
 		return &pb.DelResponse{
 			Result: &pb.Result{
@@ -96,6 +345,14 @@ func (s *server) Del(ctx context.Context, in *pb.DelRequest) (*pb.DelResponse, e
 			},
 		}, nil
 	}
+	if !existed {
+		return &pb.DelResponse{
+			Result: &pb.Result{
+				Code: 2,
+				Msg:  "Session already deleted",
+			},
+		}, nil
+	}
 
 	return &pb.DelResponse{
 		Result: &pb.Result{
@@ -105,9 +362,51 @@ func (s *server) Del(ctx context.Context, in *pb.DelRequest) (*pb.DelResponse, e
 	}, nil
 }
 
+// CountByUID 获取用户有效会话数
+func (s *server) CountByUID(ctx context.Context, in *pb.CountByUIDRequest) (*pb.CountByUIDResponse, error) {
+	count, err := cache.CountSessionsByUID(ctx, in.Uid)
+	if err != nil {
+		return &pb.CountByUIDResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to count sessions",
+			},
+		}, nil
+	}
+
+	return &pb.CountByUIDResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Count: count,
+	}, nil
+}
+
+// DelAllByUID 删除用户的所有会话
+func (s *server) DelAllByUID(ctx context.Context, in *pb.DelAllByUIDRequest) (*pb.DelAllByUIDResponse, error) {
+	count, err := cache.DeleteSessionsByUID(ctx, in.Uid, callerAddr(ctx))
+	if err != nil {
+		return &pb.DelAllByUIDResponse{
+			Result: &pb.Result{
+				Code: 1,
+				Msg:  "Failed to delete sessions",
+			},
+		}, nil
+	}
+
+	return &pb.DelAllByUIDResponse{
+		Result: &pb.Result{
+			Code: 0,
+			Msg:  "",
+		},
+		Deleted: int32(count),
+	}, nil
+}
+
 // Reload 重新加载配置和服务
 func (s *server) Reload(ctx context.Context, in *pb.ReloadRequest) (*pb.ReloadResponse, error) {
-	log.Println("[Session] Received reload request")
+	logger.Info("reload requested", "caller", callerAddr(ctx))
 
 	// 异步执行重载，避免阻塞GRPC调用
 	go ReloadSessionService()
@@ -120,14 +419,59 @@ func (s *server) Reload(ctx context.Context, in *pb.ReloadRequest) (*pb.ReloadRe
 	}, nil
 }
 
-// generateSessionID 生成随机会话ID
-func generateSessionID() (string, error) {
-	b := make([]byte, 16)
-	_, err := rand.Read(b)
+// generateSessionID 生成命名空间 ns 中的随机会话ID，格式见 cache.NewSessionIDBody
+// 配置了 signing_key 时附带 uid 与过期时间的签名，过期时间在保存会话前计算，不晚于存储中的过期时间
+func generateSessionID(ns string, uid int32, ttl time.Duration) (string, error) {
+	body, err := cache.NewSessionIDBody()
 	if err != nil {
 		return "", err
 	}
-	return hex.EncodeToString(b), nil
+	return cache.TagSessionID(cache.SignSessionID(ns, body, uid, time.Now().Add(cache.SessionTTL(ttl)))), nil
+}
+
+// metaFromPB 转换请求中的会话元数据
+func metaFromPB(meta *pb.SessionMeta) cache.SessionMeta {
+	if meta == nil {
+		return cache.SessionMeta{}
+	}
+	return cache.SessionMeta{
+		Device:    meta.Device,
+		ClientIP:  meta.ClientIp,
+		UserAgent: meta.UserAgent,
+		Platform:  meta.Platform,
+		Gateway:   meta.Gateway,
+	}
+}
+
+// metaToPB 转换会话元数据用于响应
+func metaToPB(meta cache.SessionMeta) *pb.SessionMeta {
+	return &pb.SessionMeta{
+		Device:    meta.Device,
+		ClientIp:  meta.ClientIP,
+		UserAgent: meta.UserAgent,
+		Platform:  meta.Platform,
+		Gateway:   meta.Gateway,
+	}
+}
+
+// callerAddr 获取调用方地址（不含端口）
+func callerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// SetSessionCleaner 设置重载配置时更新的会话清理器，nil 表示清理器已禁用
+func SetSessionCleaner(sc *autoclean.SessionCleaner) {
+	sessionLock.Lock()
+	defer sessionLock.Unlock()
+	sessionCleaner = sc
 }
 
 // ReloadSessionService 重新加载会话服务
@@ -135,34 +479,36 @@ func ReloadSessionService() {
 	sessionLock.Lock()
 	defer sessionLock.Unlock()
 
-	log.Println("[Config] Reloading config...")
+	logger.Info("reloading config")
 
 	// 记录重载前的配置
 	oldExpireHours := config.LatestConfig.Session.ExpireHours
 	oldCleanInterval := config.LatestConfig.Session.CleanInterval
+	oldCleanCron := config.LatestConfig.Session.CleanCron
+	oldCleanBatch := config.LatestConfig.Session.CleanBatch
+	oldCleanPause := config.LatestConfig.Session.CleanPause
 
-	// 重新加载配置
-	config.ReloadConf()
+	// 重新加载配置，配置不合法时保留当前配置，不做任何变更
+	if err := config.ReloadConf(); err != nil {
+		metricReloadsRejected.Inc()
+		logger.Warn("reload rejected", "error", err)
+		return
+	}
+	metricReloadsOK.Inc()
+	cache.ApplyBypassConfig()
+	cache.ReconfigureMemoryCache()
 
 	// 检查清理相关配置是否变化
 	configChanged := oldExpireHours != config.LatestConfig.Session.ExpireHours ||
-		oldCleanInterval != config.LatestConfig.Session.CleanInterval
-
-	// 只有当清理相关配置变化时才重建清理器
-	if configChanged {
-		log.Println("[Session] Rebuilding cleaner...")
-
-		// 停止当前清理器
-		if sessionCleaner != nil {
-			sessionCleaner.Stop()
-		}
-
-		// 重新创建清理器
-		sessionCleaner = autoclean.NewSessionCleaner()
-		sessionCleaner.Start()
+		oldCleanInterval != config.LatestConfig.Session.CleanInterval ||
+		oldCleanCron != config.LatestConfig.Session.CleanCron ||
+		oldCleanBatch != config.LatestConfig.Session.CleanBatch ||
+		oldCleanPause != config.LatestConfig.Session.CleanPause
 
-		log.Println("[Session] Cleaner rebuilt")
+	// 只有当清理相关配置变化时才更新清理器，禁用清理器时不启动
+	if configChanged && sessionCleaner != nil {
+		sessionCleaner.Reload()
 	}
 
-	log.Println("[Config] Reload completed")
+	logger.Info("reload completed")
 }
@@ -0,0 +1,263 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/cache"
+	"StealthIMSession/config"
+	"StealthIMSession/memstore"
+	"StealthIMSession/scheduler"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// newTestServer 创建使用内存存储的服务，配置使用默认值并清空内存缓存，返回注入了存储的上下文
+func newTestServer(t *testing.T) (*server, *memstore.Store, *memstore.Gateway, context.Context) {
+	saved := config.LatestConfig
+	cfg := config.Default()
+	config.LatestConfig = &cfg
+	cache.ResetMemoryCache()
+	t.Cleanup(func() {
+		// 先停止缓存注册的后台任务，它们会读取配置
+		scheduler.RemoveAll()
+		config.LatestConfig = saved
+	})
+
+	store, gw := memstore.NewStore(), memstore.NewGateway()
+	s := newServer(store, gw)
+	return s, store, gw, s.bind(context.Background())
+}
+
+func TestSetGetDel(t *testing.T) {
+	s, store, _, ctx := newTestServer(t)
+
+	set, err := s.Set(ctx, &pb.SetRequest{Uid: 42})
+	if err != nil || set.Result.Code != 0 || set.Session == "" {
+		t.Fatalf("Set() = %+v, %v", set, err)
+	}
+	if store.Len() != 1 {
+		t.Fatalf("store has %d sessions, want 1", store.Len())
+	}
+
+	get, err := s.Get(ctx, &pb.GetRequest{Session: set.Session})
+	if err != nil || get.Result.Code != 0 || get.Uid != 42 {
+		t.Fatalf("Get() = %+v, %v", get, err)
+	}
+	// 内存缓存清空后从 Redis 命中，不再查询存储
+	cache.ResetMemoryCache()
+	if _, err := store.Delete(ctx, set.Session); err != nil {
+		t.Fatal(err)
+	}
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session}); get.Result.Code != 0 || get.Uid != 42 {
+		t.Fatalf("Get() from redis = %+v", get)
+	}
+	store.Save(ctx, set.Session, 42, time.Hour, cache.SessionMeta{})
+
+	del, err := s.Del(ctx, &pb.DelRequest{Session: set.Session})
+	if err != nil || del.Result.Code != 0 {
+		t.Fatalf("Del() = %+v, %v", del, err)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("store has %d sessions after Del, want 0", store.Len())
+	}
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session}); get.Result.Code != 1 {
+		t.Fatalf("Get() after Del = %+v, want code 1", get)
+	}
+}
+
+func TestNegativeCaching(t *testing.T) {
+	s, store, _, ctx := newTestServer(t)
+	sessionID, err := generateSessionID("", 7, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: sessionID}); get.Result.Code != 1 {
+		t.Fatalf("Get(unknown) = %+v, want code 1", get)
+	}
+	// 之后写入存储的会话在无效标记过期前仍视为不存在：先命中内存，再命中 Redis
+	store.Save(ctx, sessionID, 7, time.Hour, cache.SessionMeta{})
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: sessionID}); get.Result.Code != 1 {
+		t.Fatalf("Get() with memory marker = %+v, want code 1", get)
+	}
+	cache.ResetMemoryCache()
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: sessionID}); get.Result.Code != 1 {
+		t.Fatalf("Get() with redis marker = %+v, want code 1", get)
+	}
+
+	// 没有无效标记的实例从存储读取
+	cache.ResetMemoryCache()
+	fresh := newServer(store, memstore.NewGateway())
+	if get, _ := fresh.Get(fresh.bind(context.Background()), &pb.GetRequest{Session: sessionID}); get.Result.Code != 0 || get.Uid != 7 {
+		t.Fatalf("Get() without markers = %+v, want uid 7", get)
+	}
+}
+
+func TestSignedSession(t *testing.T) {
+	s, store, _, ctx := newTestServer(t)
+	config.LatestConfig.Session.SigningKey = strings.Repeat("k", 32)
+
+	set, err := s.Set(ctx, &pb.SetRequest{Uid: 42, TtlSeconds: 60})
+	if err != nil || set.Result.Code != 0 || strings.Count(set.Session, ".") != 3 {
+		t.Fatalf("Set() = %+v, %v", set, err)
+	}
+	// 签名会话ID在 Redis 中没有无效标记时不查询存储
+	cache.ResetMemoryCache()
+	if _, err := store.Delete(ctx, set.Session); err != nil {
+		t.Fatal(err)
+	}
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session}); get.Result.Code != 0 || get.Uid != 42 {
+		t.Fatalf("Get(signed) = %+v", get)
+	}
+	store.Save(ctx, set.Session, 42, time.Minute, cache.SessionMeta{})
+	if del, _ := s.Del(ctx, &pb.DelRequest{Session: set.Session}); del.Result.Code != 0 {
+		t.Fatalf("Del() = %+v", del)
+	}
+	cache.ResetMemoryCache()
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session}); get.Result.Code != 1 {
+		t.Fatalf("Get() after Del = %+v, want code 1", get)
+	}
+}
+
+func TestHashedSessionIDs(t *testing.T) {
+	s, store, gw, ctx := newTestServer(t)
+	cache.SetHashIDs(true)
+	t.Cleanup(func() { cache.SetHashIDs(false) })
+
+	set, err := s.Set(ctx, &pb.SetRequest{Uid: 42, Namespace: "app"})
+	if err != nil || set.Result.Code != 0 {
+		t.Fatalf("Set() = %+v, %v", set, err)
+	}
+	// 存储与 Redis 中只有哈希形式的键
+	key := cache.StoredID(cache.NamespacedID("app", set.Session))
+	if !strings.HasPrefix(key, "app:#") || strings.Contains(key, set.Session) {
+		t.Fatalf("stored key = %q", key)
+	}
+	if _, _, err := store.Get(ctx, key); err != nil {
+		t.Fatalf("store.Get(hashed) = %v", err)
+	}
+	if _, _, err := store.Get(ctx, cache.NamespacedID("app", set.Session)); err == nil {
+		t.Fatal("plain session ID stored")
+	}
+
+	adopted := func() bool {
+		return slices.ContainsFunc(gw.Statements(), func(sql string) bool { return strings.HasPrefix(sql, "UPDATE session_db SET session_id = ?") })
+	}
+	cache.ResetMemoryCache()
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: set.Session, Namespace: "app"}); get.Result.Code != 0 || get.Uid != 42 {
+		t.Fatalf("Get() = %+v", get)
+	}
+	// 以哈希形式查询到的会话不改写明文行
+	if adopted() {
+		t.Fatalf("plain session ID adopted for a hashed session, statements = %v", gw.Statements())
+	}
+	// 查询不到时才尝试将启用 hash_ids 前的明文行改写为哈希形式
+	if get, _ := s.Get(ctx, &pb.GetRequest{Session: strings.Repeat("a", len(set.Session)), Namespace: "app"}); get.Result.Code != 1 {
+		t.Fatalf("Get(unknown) = %+v", get)
+	}
+	if !adopted() {
+		t.Fatalf("plain session ID not adopted, statements = %v", gw.Statements())
+	}
+	if del, _ := s.Del(ctx, &pb.DelRequest{Session: set.Session, Namespace: "app"}); del.Result.Code != 0 {
+		t.Fatalf("Del() = %+v", del)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("store has %d sessions after Del", store.Len())
+	}
+}
+
+func TestCountByUID(t *testing.T) {
+	s, store, _, ctx := newTestServer(t)
+
+	for range 3 {
+		if set, _ := s.Set(ctx, &pb.SetRequest{Uid: 7}); set.Result.Code != 0 {
+			t.Fatalf("Set() = %+v", set)
+		}
+	}
+	store.Save(ctx, "expired", 7, -time.Minute, cache.SessionMeta{})
+	s.Set(ctx, &pb.SetRequest{Uid: 8})
+
+	if count, err := s.CountByUID(ctx, &pb.CountByUIDRequest{Uid: 7}); err != nil || count.Result.Code != 0 || count.Count != 3 {
+		t.Fatalf("CountByUID(7) = %+v, %v", count, err)
+	}
+	if count, _ := s.CountByUID(ctx, &pb.CountByUIDRequest{Uid: 9}); count.Result.Code != 0 || count.Count != 0 {
+		t.Fatalf("CountByUID(9) = %+v", count)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	s, store, _, ctx := newTestServer(t)
+
+	set, _ := s.Set(ctx, &pb.SetRequest{Uid: 7})
+	if set.Result.Code != 0 {
+		t.Fatalf("Set() = %+v", set)
+	}
+	// 续期经由注入的存储，按创建时的有效期延长
+	lifetime := time.Duration(config.LatestConfig.Session.ExpireHours) * time.Hour
+	before := time.Now()
+	renew, err := s.Renew(ctx, &pb.RenewRequest{Session: set.Session})
+	if err != nil || renew.Result.Code != 0 {
+		t.Fatalf("Renew() = %+v, %v", renew, err)
+	}
+	if got := time.Unix(renew.ExpiresAt, 0); got.Before(before.Add(lifetime).Truncate(time.Second)) || got.After(time.Now().Add(lifetime)) {
+		t.Fatalf("Renew() expires at %v, want about %v", got, before.Add(lifetime))
+	}
+
+	if _, err := store.Delete(ctx, set.Session); err != nil {
+		t.Fatal(err)
+	}
+	if renew, _ := s.Renew(ctx, &pb.RenewRequest{Session: set.Session}); renew.Result.Code != 1 {
+		t.Fatalf("Renew() after delete = %+v, want code 1", renew)
+	}
+}
+
+func TestStorageInterceptor(t *testing.T) {
+	s, store, _, _ := newTestServer(t)
+	store.Save(context.Background(), "session-1", 9, time.Hour, cache.SessionMeta{})
+
+	// 经由拦截器调用时使用服务的存储
+	resp, err := storageInterceptor(context.Background(), &pb.ListSessionsByUIDRequest{Uid: 9},
+		&grpc.UnaryServerInfo{Server: s, FullMethod: "/StealthIMSession/ListSessionsByUID"},
+		func(ctx context.Context, req any) (any, error) {
+			return s.ListSessionsByUID(ctx, req.(*pb.ListSessionsByUIDRequest))
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := resp.(*pb.ListSessionsByUIDResponse)
+	if list.Result.Code != 0 || len(list.Sessions) != 1 || list.Sessions[0].Session != "session-1" {
+		t.Fatalf("ListSessionsByUID() = %+v", list)
+	}
+}
+
+func TestPing(t *testing.T) {
+	s, _, _, ctx := newTestServer(t)
+	pong, err := s.Ping(ctx, &pb.PingRequest{})
+	if err != nil || pong.Version == "" || pong.ConfigDigest != config.Digest(*config.LatestConfig) || pong.UptimeSeconds < 0 {
+		t.Fatalf("Ping() = %+v, %v", pong, err)
+	}
+}
+
+func TestRefreshDisabled(t *testing.T) {
+	s, store, _, ctx := newTestServer(t)
+	if set, _ := s.Set(ctx, &pb.SetRequest{Uid: 42, WithRefresh: true}); set.Result.Code != codeRefreshDisabled || store.Len() != 0 {
+		t.Fatalf("Set(with_refresh) = %+v, want code %d without a session", set, codeRefreshDisabled)
+	}
+	if resp, _ := s.Refresh(ctx, &pb.RefreshRequest{RefreshToken: strings.Repeat("ab", 32)}); resp.Result.Code != codeRefreshDisabled {
+		t.Fatalf("Refresh() = %+v, want code %d", resp, codeRefreshDisabled)
+	}
+
+	// 启用后 Set 同时签发刷新令牌，会话默认使用 access_ttl
+	config.LatestConfig.Refresh.Enable = true
+	set, err := s.Set(ctx, &pb.SetRequest{Uid: 42, WithRefresh: true})
+	if err != nil || set.Result.Code != 0 || len(set.RefreshToken) != 64 || set.ExpiresAt > time.Now().Unix()+int64(config.LatestConfig.Refresh.AccessTTL) {
+		t.Fatalf("Set(with_refresh) = %+v, %v", set, err)
+	}
+	if resp, _ := s.Refresh(ctx, &pb.RefreshRequest{RefreshToken: "not-a-token"}); resp.Result.Code != 1 {
+		t.Fatalf("Refresh(malformed) = %+v, want code 1", resp)
+	}
+}
@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/events"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthServer 标准 gRPC 健康检查服务，关闭时先切换为 NOT_SERVING
+var healthServer = health.NewServer()
+
+// grpcServer 正在运行的服务，Start 前为 nil
+var grpcServer atomic.Pointer[grpc.Server]
+
+// backendsDown 启动时后端尚未就绪，见 SetReady
+var backendsDown atomic.Bool
+
+// registerHealth 注册健康检查服务，整体与 StealthIMSession 服务均为 SERVING，后端未就绪时为 NOT_SERVING
+func registerHealth(s *grpc.Server) {
+	setHealth(!backendsDown.Load())
+	healthpb.RegisterHealthServer(s, healthServer)
+}
+
+// SetReady 设置后端是否就绪，未就绪时健康状态为 NOT_SERVING，负载均衡不会将请求转发到本实例
+// 可在 Start 之前调用；Shutdown 之后不再改变健康状态
+func SetReady(ready bool) {
+	backendsDown.Store(!ready)
+	setHealth(ready)
+}
+
+func setHealth(serving bool) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if !serving {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	healthServer.SetServingStatus("", status)
+	healthServer.SetServingStatus(pb.StealthIMSession_ServiceDesc.ServiceName, status)
+}
+
+// Shutdown 优雅关闭服务
+// 先将健康状态标记为 NOT_SERVING 并等待 drain，让负载均衡与客户端迁移到其他副本；
+// 然后发送 GOAWAY 并等待进行中的请求完成，超过 grace 后强制关闭
+func Shutdown(drain time.Duration, grace time.Duration) {
+	healthServer.Shutdown()
+	s := grpcServer.Load()
+	if s == nil {
+		return
+	}
+	logger.Info("draining before shutdown", "drain", drain)
+	time.Sleep(drain)
+
+	// Watch 流不会自行结束，先关闭订阅让订阅方重连到其他副本
+	events.CloseAll()
+	logger.Info("sending GOAWAY, waiting for in-flight requests", "grace", grace)
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logger.Info("server stopped")
+	case <-time.After(grace):
+		logger.Warn("grace period expired, closing remaining connections")
+		s.Stop()
+	}
+	waitListeners()
+}
+
+// waitListeners 等待每个监听地址上的 Serve 返回，Unix 域套接字文件随监听关闭而删除
+func waitListeners() {
+	lns := grpcListeners.Load()
+	if lns == nil {
+		return
+	}
+	for _, l := range *lns {
+		<-l.done
+		logger.Info("listener stopped", "addr", l.addr)
+	}
+}
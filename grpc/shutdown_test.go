@@ -0,0 +1,31 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestSetReady(t *testing.T) {
+	t.Cleanup(func() { SetReady(true) })
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Status
+	}
+
+	// 后端未就绪时以 NOT_SERVING 注册，就绪后切换为 SERVING
+	SetReady(false)
+	registerHealth(grpc.NewServer())
+	if got := check(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("status before ready = %v", got)
+	}
+	SetReady(true)
+	if got := check(); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("status after ready = %v", got)
+	}
+}
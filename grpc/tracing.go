@@ -0,0 +1,34 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/tracing"
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// tracingInterceptor 为每个 RPC 创建服务端 span，调用方通过 metadata 传入 traceparent 时作为其子 span
+// 网关调用与缓存查询的 span 挂在该 span 下
+func tracingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	name := strings.TrimPrefix(info.FullMethod, "/")
+	service, method, _ := strings.Cut(name, "/")
+	ctx, span := tracing.Start(tracing.Extract(ctx), name, trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", method),
+		))
+	defer func() {
+		span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(status.Code(err))))
+		if r, ok := resp.(interface{ GetResult() *pb.Result }); ok && r.GetResult() != nil {
+			span.SetAttributes(attribute.Int("stealthim.result_code", int(r.GetResult().Code)))
+		}
+		tracing.End(span, err)
+	}()
+	return handler(ctx, req)
+}
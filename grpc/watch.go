@@ -0,0 +1,43 @@
+package grpc
+
+import (
+	pb "StealthIMSession/StealthIM.Session"
+	"StealthIMSession/events"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Watch 订阅会话生命周期事件，uids 为空时订阅所有用户
+// 订阅方处理过慢时以 RESOURCE_EXHAUSTED 结束，服务关闭时以 UNAVAILABLE 结束，订阅方应重新订阅并用 Get 核对本地状态
+func (s *server) Watch(in *pb.WatchRequest, stream pb.StealthIMSession_WatchServer) error {
+	if !events.Enabled() {
+		return status.Error(codes.FailedPrecondition, "session events are disabled")
+	}
+	logger.Info("watch started", "uids", len(in.Uids), "caller", callerAddr(stream.Context()))
+	sub := events.Subscribe(in.Uids)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-sub.C:
+			if !ok {
+				if sub.Lagged() {
+					return status.Error(codes.ResourceExhausted, "subscriber fell behind, resubscribe")
+				}
+				return status.Error(codes.Unavailable, "server shutting down")
+			}
+			err := stream.Send(&pb.SessionEvent{
+				Type:    ev.Type,
+				Session: ev.SessionID,
+				Uid:     ev.UID,
+				Time:    ev.Time,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package lifecycle 按依赖顺序启动与停止各子系统
+// 启动时被依赖的组件先启动，关闭时按相反顺序停止，每个组件的启动与停止都有独立的超时
+package lifecycle
+
+import (
+	"StealthIMSession/logging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var logger = logging.For("lifecycle")
+
+// ErrTimeout 组件启动或停止超时
+var ErrTimeout = errors.New("timed out")
+
+// Component 受管理的子系统
+type Component struct {
+	Name    string
+	Deps    []string                        // 依赖的组件，先于本组件启动、后于本组件停止
+	Start   func(ctx context.Context) error // 启动组件，可为 nil
+	Stop    func(ctx context.Context) error // 停止组件并写入剩余数据，可为 nil
+	Timeout time.Duration                   // 启动与停止各自的超时，不大于 0 时不限制
+}
+
+// StopResult 单个组件的停止结果
+type StopResult struct {
+	Name       string `json:"name"`
+	DurationMs int64  `json:"duration_ms"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Report 关闭报告，按停止顺序列出各组件的结果
+type Report struct {
+	DurationMs int64        `json:"duration_ms"`
+	Components []StopResult `json:"components"`
+}
+
+// OK 所有组件均在超时内停止且没有错误
+func (r Report) OK() bool {
+	for _, c := range r.Components {
+		if c.TimedOut || c.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Manager 组件管理器
+type Manager struct {
+	mu         sync.Mutex
+	components []Component
+	started    []Component // 已启动的组件，按启动顺序
+}
+
+// New 创建组件管理器
+func New() *Manager {
+	return &Manager{}
+}
+
+// Add 注册组件，须在 Start 之前调用
+func (m *Manager) Add(c Component) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, c)
+}
+
+// order 按依赖关系排序，无依赖关系的组件保持注册顺序
+func (m *Manager) order() ([]Component, error) {
+	byName := make(map[string]int, len(m.components))
+	for i, c := range m.components {
+		if _, ok := byName[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate component %q", c.Name)
+		}
+		byName[c.Name] = i
+	}
+	for _, c := range m.components {
+		for _, d := range c.Deps {
+			if _, ok := byName[d]; !ok {
+				return nil, fmt.Errorf("component %q depends on unknown component %q", c.Name, d)
+			}
+		}
+	}
+
+	// 0 未访问，1 访问中，2 已排序
+	state := make([]int, len(m.components))
+	sorted := make([]Component, 0, len(m.components))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("dependency cycle at component %q", m.components[i].Name)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, d := range m.components[i].Deps {
+			if err := visit(byName[d]); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		sorted = append(sorted, m.components[i])
+		return nil
+	}
+	for i := range m.components {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// Start 按依赖顺序启动所有组件
+// 某个组件启动失败时，按相反顺序停止已启动的组件并返回错误
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	sorted, err := m.order()
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, c := range sorted {
+		if c.Start != nil {
+			start := time.Now()
+			if err := run(ctx, c.Timeout, c.Start); err != nil {
+				logger.Error("component failed to start", "component", c.Name, "error", err)
+				m.Stop()
+				return fmt.Errorf("start %s: %w", c.Name, err)
+			}
+			logger.Debug("component started", "component", c.Name, "duration", time.Since(start))
+		}
+		m.mu.Lock()
+		m.started = append(m.started, c)
+		m.mu.Unlock()
+	}
+	logger.Info("all components started", "count", len(sorted))
+	return nil
+}
+
+// Stop 按启动的相反顺序停止已启动的组件并输出关闭报告
+// 组件停止超时或失败时记录在报告中，继续停止其余组件；重复调用时只停止尚未停止的组件
+func (m *Manager) Stop() Report {
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.mu.Unlock()
+
+	begin := time.Now()
+	report := Report{Components: make([]StopResult, 0, len(started))}
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		if c.Stop == nil {
+			continue
+		}
+		start := time.Now()
+		err := run(context.Background(), c.Timeout, c.Stop)
+		r := StopResult{Name: c.Name, DurationMs: time.Since(start).Milliseconds()}
+		switch {
+		case errors.Is(err, ErrTimeout):
+			r.TimedOut = true
+			logger.Warn("component stop timed out", "component", c.Name, "timeout", c.Timeout)
+		case err != nil:
+			r.Error = err.Error()
+			logger.Warn("component failed to stop", "component", c.Name, "error", err)
+		default:
+			logger.Debug("component stopped", "component", c.Name, "duration", time.Since(start))
+		}
+		report.Components = append(report.Components, r)
+	}
+	report.DurationMs = time.Since(begin).Milliseconds()
+
+	data, _ := json.Marshal(report)
+	if report.OK() {
+		logger.Info("shutdown report", "report", string(data))
+	} else {
+		logger.Warn("shutdown report", "report", string(data))
+	}
+	return report
+}
+
+// run 在超时内执行 fn，超时后不再等待 fn 返回
+func run(parent context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout <= 0 {
+		return fn(parent)
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if parent.Err() != nil {
+			return parent.Err()
+		}
+		return ErrTimeout
+	}
+}
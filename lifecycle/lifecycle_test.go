@@ -0,0 +1,124 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recorder 记录组件的启动与停止顺序
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) component(name string, deps ...string) Component {
+	return Component{
+		Name: name,
+		Deps: deps,
+		Start: func(context.Context) error {
+			r.events = append(r.events, "start "+name)
+			return nil
+		},
+		Stop: func(context.Context) error {
+			r.events = append(r.events, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestStartStopOrder(t *testing.T) {
+	r := &recorder{}
+	m := New()
+	m.Add(r.component("grpc", "cache", "gateway"))
+	m.Add(r.component("cache", "gateway"))
+	m.Add(r.component("metrics"))
+	m.Add(r.component("gateway"))
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	report := m.Stop()
+
+	want := []string{
+		"start gateway", "start cache", "start grpc", "start metrics",
+		"stop metrics", "stop grpc", "stop cache", "stop gateway",
+	}
+	if !slices.Equal(r.events, want) {
+		t.Fatalf("events = %v, want %v", r.events, want)
+	}
+	if !report.OK() || len(report.Components) != 4 || report.Components[0].Name != "metrics" {
+		t.Fatalf("report = %+v", report)
+	}
+	// 重复调用不再停止组件
+	if again := m.Stop(); len(again.Components) != 0 {
+		t.Fatalf("second Stop() = %+v", again)
+	}
+}
+
+func TestStartFailureStopsStarted(t *testing.T) {
+	r := &recorder{}
+	m := New()
+	m.Add(r.component("gateway"))
+	broken := r.component("cache", "gateway")
+	broken.Start = func(context.Context) error { return errors.New("boom") }
+	m.Add(broken)
+	m.Add(r.component("grpc", "cache"))
+
+	if err := m.Start(context.Background()); err == nil {
+		t.Fatal("Start() succeeded with a failing component")
+	}
+	want := []string{"start gateway", "stop gateway"}
+	if !slices.Equal(r.events, want) {
+		t.Fatalf("events = %v, want %v", r.events, want)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	r := &recorder{}
+	m := New()
+	m.Add(r.component("gateway"))
+	m.Add(Component{
+		Name:    "stuck",
+		Deps:    []string{"gateway"},
+		Stop:    func(context.Context) error { select {} },
+		Timeout: 10 * time.Millisecond,
+	})
+	failing := r.component("counters")
+	failing.Stop = func(context.Context) error { return errors.New("flush failed") }
+	m.Add(failing)
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	report := m.Stop()
+	if report.OK() || len(report.Components) != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+	if c := report.Components[0]; c.Name != "counters" || c.Error != "flush failed" {
+		t.Fatalf("counters result = %+v", c)
+	}
+	if c := report.Components[1]; c.Name != "stuck" || !c.TimedOut {
+		t.Fatalf("stuck result = %+v", c)
+	}
+	// 超时后继续停止其余组件
+	if c := report.Components[2]; c.Name != "gateway" || c.TimedOut || c.Error != "" {
+		t.Fatalf("gateway result = %+v", c)
+	}
+}
+
+func TestInvalidDependencies(t *testing.T) {
+	for name, components := range map[string][]Component{
+		"unknown":   {{Name: "a", Deps: []string{"missing"}}},
+		"cycle":     {{Name: "a", Deps: []string{"b"}}, {Name: "b", Deps: []string{"a"}}},
+		"duplicate": {{Name: "a"}, {Name: "a"}},
+	} {
+		m := New()
+		for _, c := range components {
+			m.Add(c)
+		}
+		if err := m.Start(context.Background()); err == nil {
+			t.Errorf("%s: Start() succeeded", name)
+		}
+	}
+}
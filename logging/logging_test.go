@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"testing"
+)
+
+func TestInitSwitchesExistingLoggers(t *testing.T) {
+	defer initTo(new(bytes.Buffer), "info", "text")
+
+	l := For("test")
+	var buf bytes.Buffer
+	if err := initTo(&buf, "info", "json"); err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("dropped")
+	l.Warn("kept", Session("0123456789abcdef"))
+	log.Print("from stdlib")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal(lines[0], &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["msg"] != "kept" || rec["module"] != "test" || rec["session_prefix"] != "01234567" {
+		t.Fatalf("record = %v", rec)
+	}
+	if err := json.Unmarshal(lines[1], &rec); err != nil || rec["msg"] != "from stdlib" {
+		t.Fatalf("stdlib record = %s (%v)", lines[1], err)
+	}
+}
+
+func TestInitRejectsUnknownSettings(t *testing.T) {
+	if err := initTo(new(bytes.Buffer), "verbose", "text"); err == nil {
+		t.Fatal("unknown level accepted")
+	}
+	if err := initTo(new(bytes.Buffer), "info", "xml"); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
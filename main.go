@@ -1,45 +1,326 @@
 package main
 
 import (
+	"StealthIMSession/audit"
 	"StealthIMSession/autoclean"
+	"StealthIMSession/buildinfo"
+	"StealthIMSession/bus"
 	"StealthIMSession/cache"
 	"StealthIMSession/config"
+	"StealthIMSession/counters"
+	"StealthIMSession/events"
 	"StealthIMSession/gateway"
 	"StealthIMSession/grpc"
-	"log"
+	"StealthIMSession/lifecycle"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"StealthIMSession/obfuscate"
+	"StealthIMSession/publisher"
+	"StealthIMSession/scheduler"
+	"StealthIMSession/startup"
+	"StealthIMSession/tracing"
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+var logger = logging.For("main")
+
 func main() {
+	// 子命令：config check
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "check" {
+		os.Exit(config.RunCheck(os.Args[3:]))
+	}
+	// 子命令：backfill
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		os.Exit(autoclean.RunBackfill(os.Args[2:]))
+	}
+
 	cfg := config.ReadConf()
-	log.Printf("Start server [%v]\n", config.Version)
-	log.Printf("+ GRPC\n")
-	log.Printf("    Host: %s\n", cfg.GRPCProxy.Host)
-	log.Printf("    Port: %d\n", cfg.GRPCProxy.Port)
-	log.Printf("+ DBGateway\n")
-	log.Printf("    Host: %s\n", cfg.DBGateway.Host)
-	log.Printf("    Port: %d\n", cfg.DBGateway.Port)
-	log.Printf("    ConnNum: %d\n", cfg.DBGateway.ConnNum)
-	log.Printf("+ Cache\n")
-	log.Printf("    MemMaxsize: %d\n", cfg.Cache.MemMaxsize)
-	log.Printf("    MemTimeout: %d\n", cfg.Cache.MemTimeout)
-	log.Printf("    MemCleantime: %d\n", cfg.Cache.MemCleantime)
-
-	// 初始化会话缓存
-	cache.InitSessionCache()
-
-	// 启动 DBGateway
-	go gateway.InitConns()
-
-	// 启动会话清理器
-	disableCleaner := os.Getenv("STIMSESSION_DISABLE_CLEANER")
-	if disableCleaner != "" {
-		log.Println("Session cleaner is disabled")
-	} else {
-		sessionCleaner := autoclean.NewSessionCleaner()
-		sessionCleaner.Start()
+	disableCleaner := os.Getenv("STIMSESSION_DISABLE_CLEANER") != ""
+	report := startup.New(cfg, map[string]bool{
+		"journal":           cfg.Journal.Enable,
+		"journal_anonymize": cfg.Journal.Enable && cfg.Journal.AnonymizeDays > 0,
+		"metrics":           cfg.Metrics.Enable,
+		"session_count":     cfg.Metrics.SessionCountInterval > 0,
+		"get_coalescing":    cfg.Cache.CoalesceWindow > 0,
+		"cleaner":           !disableCleaner,
+		"uid_obfuscation":   cfg.Privacy.UIDHMACKey != "",
+		"grpc_tls":          cfg.GRPCProxy.TLSCert != "",
+		"grpc_mtls":         cfg.GRPCProxy.RequireClientCert,
+		"invalidation_bus":  cfg.Invalidation.Enable,
+		"tracing":           cfg.Tracing.Enable,
+		"events":            cfg.Events.Enable,
+		"config_watch":      cfg.Reload.Watch,
+		"direct_mysql":      cfg.Storage.MySQL == config.StorageDirect,
+		"direct_redis":      cfg.Storage.Redis == config.StorageDirect,
+		"http":              cfg.HTTP.Enable,
+		"refresh_tokens":    cfg.Refresh.Enable,
+		"admin":             cfg.Admin.Enable,
+		"write_behind":      cfg.Session.WriteBehind,
+		"known_filter":      cfg.Cache.KnownFilter,
+		"cache_warmup":      cfg.Cache.Warmup > 0,
+		"wait_backends":     cfg.Startup.WaitBackends > 0,
+		"audit":             cfg.Audit.Sink != "",
+		"publisher":         cfg.Publisher.Kind != "",
+		"hashed_ids":        cfg.Session.HashIDs,
+	})
+	logger.Info("starting server", "build", buildinfo.String())
+	metrics.NewGauge("stealthim_session_build_info", "Build metadata of the running binary",
+		"version", buildinfo.Version, "commit", buildinfo.Commit, "build_date", buildinfo.BuildDate).Set(1)
+
+	drain := time.Duration(cfg.GRPCProxy.DrainDelay) * time.Second
+	grace := time.Duration(cfg.GRPCProxy.ShutdownGrace) * time.Second
+
+	// 各子系统按依赖顺序启动，关闭时按相反顺序停止：
+	// 先停止 GRPC 服务与后台任务，再写入累计计数，最后关闭连接、指标服务与链路追踪
+	m := lifecycle.New()
+	shutdownTracing := func(context.Context) error { return nil }
+	m.Add(lifecycle.Component{
+		Name: "tracing",
+		Start: func(context.Context) (err error) {
+			shutdownTracing, err = tracing.Init(cfg.Tracing)
+			return err
+		},
+		// 导出剩余的 span
+		Stop:    func(ctx context.Context) error { return shutdownTracing(ctx) },
+		Timeout: 5 * time.Second,
+	})
+	if cfg.Metrics.Enable {
+		m.Add(lifecycle.Component{
+			Name:    "metrics",
+			Start:   func(context.Context) error { return metrics.Serve(cfg.Metrics.Host, cfg.Metrics.Port) },
+			Stop:    metrics.Shutdown,
+			Timeout: 2 * time.Second,
+		})
+	}
+	m.Add(lifecycle.Component{
+		Name: "gateway",
+		// 按 [storage] 配置直连 MySQL、Redis 或经由 DBGateway
+		Start:   func(context.Context) error { return gateway.Start(cfg.Storage) },
+		Stop:    gateway.Close,
+		Timeout: 2 * time.Second,
+	})
+	m.Add(lifecycle.Component{
+		Name: "cache",
+		Deps: []string{"gateway"},
+		Start: func(context.Context) error {
+			// 初始化会话缓存，执行会话库结构变更并初始化 uid 别名表
+			cache.InitSessionCache()
+			cache.InitSchema()
+			obfuscate.InitAliasTable()
+			return nil
+		},
+	})
+	m.Add(lifecycle.Component{
+		Name: "write_behind",
+		Deps: []string{"cache", "bus"},
+		Start: func(context.Context) error {
+			cache.StartWriteBehind()
+			return nil
+		},
+		// 写完尚未写入 MySQL 的会话，需在 GRPC 与 HTTP 服务停止之后
+		Stop:    cache.StopWriteBehind,
+		Timeout: 10 * time.Second,
+	})
+	m.Add(lifecycle.Component{
+		Name: "readiness",
+		Deps: []string{"gateway"},
+		// 等待后端就绪后再启动 GRPC 服务，避免最初的请求因连接尚未建立而失败
+		// 超时后照常启动（健康状态为 NOT_SERVING，后端就绪后切换为 SERVING），require_backends 时退出
+		Start: func(ctx context.Context) error {
+			if cfg.Startup.WaitBackends <= 0 {
+				return nil
+			}
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Startup.WaitBackends)*time.Second)
+			defer cancel()
+			err := gateway.WaitReady(ctx)
+			if err == nil {
+				logger.Info("backends ready", "waited", time.Since(start))
+				return nil
+			}
+			if cfg.Startup.RequireBackends {
+				return err
+			}
+			logger.Warn("starting before backends are ready, health check reports NOT_SERVING", "error", err)
+			grpc.SetReady(false)
+			go func() {
+				if gateway.WaitReady(context.Background()) == nil {
+					logger.Info("backends ready", "waited", time.Since(start))
+					grpc.SetReady(true)
+				}
+			}()
+			return nil
+		},
+	})
+	m.Add(lifecycle.Component{
+		Name: "warmup",
+		Deps: []string{"cache", "readiness"},
+		// 在 GRPC 服务接受请求前预热内存缓存，失败时照常启动
+		Start: func(ctx context.Context) error {
+			if cfg.Cache.Warmup <= 0 {
+				return nil
+			}
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Cache.WarmupTimeout)*time.Second)
+			defer cancel()
+			if _, err := cache.WarmUp(ctx); err != nil {
+				logger.Warn("cache warm-up incomplete", "error", err)
+			}
+			return nil
+		},
+	})
+	m.Add(lifecycle.Component{
+		Name: "counters",
+		Deps: []string{"gateway"},
+		Start: func(context.Context) error {
+			counters.Start()
+			return nil
+		},
+		// 写入本实例剩余的累计计数
+		Stop: func(ctx context.Context) error {
+			if cfg.Metrics.CounterFlushInterval <= 0 {
+				return nil
+			}
+			return counters.Flush(ctx)
+		},
+		Timeout: 5 * time.Second,
+	})
+	m.Add(lifecycle.Component{
+		Name:  "audit",
+		Deps:  []string{"gateway"},
+		Start: func(context.Context) error { return audit.Start(cfg.Audit) },
+		// 写完队列中剩余的审计记录，需在 GRPC 与 HTTP 服务停止之后
+		Stop:    audit.Stop,
+		Timeout: 5 * time.Second,
+	})
+	m.Add(lifecycle.Component{
+		Name:  "publisher",
+		Start: func(context.Context) error { return publisher.Start(cfg.Publisher) },
+		// 发布剩余的事件，仍未发布的写入 spool 文件；需在 GRPC 服务与后台任务停止之后
+		Stop:    publisher.Stop,
+		Timeout: 10 * time.Second,
+	})
+	m.Add(lifecycle.Component{
+		Name: "bus",
+		Deps: []string{"cache"},
+		Start: func(context.Context) error {
+			// 启动失效消息的发布协程，订阅其他实例的缓存失效消息
+			bus.Start(cfg.Invalidation)
+			bus.Subscribe(cache.PurgeLocal)
+			if cfg.Events.Enable {
+				bus.SubscribeEvents(events.Receive)
+			}
+			return nil
+		},
+		// 发送队列中剩余的失效消息，需在 GRPC 服务、写入队列与后台任务停止之后
+		Stop:    bus.Stop,
+		Timeout: 5 * time.Second,
+	})
+	m.Add(lifecycle.Component{
+		Name: "scheduler",
+		Deps: []string{"cache", "counters", "publisher", "bus"},
+		Start: func(context.Context) error {
+			// 启动会话清理器
+			if disableCleaner {
+				logger.Info("session cleaner is disabled")
+			} else {
+				sc := autoclean.NewSessionCleaner()
+				sc.Start()
+				grpc.SetSessionCleaner(sc)
+			}
+			// 启动会话历史脱敏任务与会话数统计任务
+			autoclean.NewJournalAnonymizer().Start()
+			autoclean.NewSessionCounter().Start()
+			return nil
+		},
+		// 停止全部后台任务，中止正在执行的清理
+		Stop: func(context.Context) error {
+			scheduler.RemoveAll()
+			return nil
+		},
+		Timeout: 5 * time.Second,
+	})
+	m.Add(lifecycle.Component{
+		Name:  "grpc",
+		Deps:  []string{"cache", "counters", "bus", "write_behind", "readiness", "warmup", "audit", "publisher"},
+		Start: func(context.Context) error { return grpc.Start(cfg) },
+		// 先排空再关闭 GRPC 服务
+		Stop: func(context.Context) error {
+			grpc.Shutdown(drain, grace)
+			return nil
+		},
+		Timeout: drain + grace + 5*time.Second,
+	})
+	if cfg.HTTP.Enable {
+		m.Add(lifecycle.Component{
+			Name:  "http",
+			Deps:  []string{"cache", "counters", "bus", "write_behind", "readiness", "warmup", "audit", "publisher"},
+			Start: func(context.Context) error { return grpc.StartHTTP(cfg) },
+			// 等待进行中的请求完成
+			Stop:    grpc.ShutdownHTTP,
+			Timeout: grace + 5*time.Second,
+		})
+	}
+	if cfg.Admin.Enable && cfg.Admin.Port != 0 {
+		m.Add(lifecycle.Component{
+			Name:  "admin",
+			Deps:  []string{"cache", "bus", "publisher"},
+			Start: func(context.Context) error { return grpc.StartAdmin(cfg) },
+			// 等待进行中的请求完成
+			Stop:    grpc.ShutdownAdmin,
+			Timeout: grace + 5*time.Second,
+		})
 	}
+	hup := make(chan os.Signal, 1)
+	stopWatch := func() {}
+	m.Add(lifecycle.Component{
+		Name: "reload",
+		Deps: []string{"scheduler", "grpc"},
+		Start: func(context.Context) error {
+			// 收到 SIGHUP 时重载配置，与 Reload 相同
+			signal.Notify(hup, syscall.SIGHUP)
+			go func() {
+				for range hup {
+					logger.Info("reload requested", "signal", "SIGHUP")
+					grpc.ReloadSessionService()
+				}
+			}()
+			// 监视配置文件，修改后自动重载
+			if cfg.Reload.Watch {
+				stop, err := config.Watch(time.Duration(cfg.Reload.Debounce)*time.Millisecond, grpc.ReloadSessionService)
+				if err != nil {
+					logger.Warn("failed to watch config file, use Reload or SIGHUP instead", "error", err)
+				} else {
+					stopWatch = stop
+				}
+			}
+			return nil
+		},
+		// 关闭期间不再重载
+		Stop: func(context.Context) error {
+			signal.Stop(hup)
+			close(hup)
+			stopWatch()
+			return nil
+		},
+		Timeout: 2 * time.Second,
+	})
+	if err := m.Start(context.Background()); err != nil {
+		logging.Fatal(logger, "failed to start", "error", err)
+	}
+
+	// 检查后端连通性并输出启动报告
+	go func() {
+		report.CheckBackends(10 * time.Second)
+		report.Emit(cfg.Startup.ReportFile)
+	}()
 
-	// 启动 GRPC 服务
-	grpc.Start(cfg)
+	// 收到 SIGINT/SIGTERM 时按依赖顺序关闭
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	logger.Info("shutting down", "signal", (<-sig).String())
+	m.Stop()
 }
@@ -0,0 +1,136 @@
+package memstore
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Gateway 内存中的 DBGateway，实现 DBGateway 的客户端接口，并发安全
+// Redis 读写保存在内存中并按 Ttl 过期；SQL 语句全部成功且不返回行，只记录语句
+// 会话本身的读写由 Store 负责，其余 SQL（会话历史、冻结、计数等）在测试中视为空表
+type Gateway struct {
+	mu         sync.Mutex
+	redis      map[string]redisValue
+	statements []string
+}
+
+type redisValue struct {
+	value   []byte
+	expires time.Time // 零值表示不过期
+}
+
+// NewGateway 创建空的 DBGateway
+func NewGateway() *Gateway {
+	return &Gateway{redis: make(map[string]redisValue)}
+}
+
+// Redis 返回 Redis 中未过期的值
+func (g *Gateway) Redis(key string) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v, ok := g.load(key)
+	return string(v), ok
+}
+
+// Statements 返回执行过的 SQL 语句
+func (g *Gateway) Statements() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.statements...)
+}
+
+// load 读取未过期的值，已过期的值被删除，调用方需持有锁
+func (g *Gateway) load(key string) ([]byte, bool) {
+	v, ok := g.redis[key]
+	if ok && !v.expires.IsZero() && !time.Now().Before(v.expires) {
+		delete(g.redis, key)
+		return nil, false
+	}
+	return v.value, ok
+}
+
+func (g *Gateway) store(key string, value []byte, ttl int32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v := redisValue{value: value}
+	if ttl > 0 {
+		v.expires = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+	g.redis[key] = v
+}
+
+func (g *Gateway) Ping(ctx context.Context, in *pb.PingRequest, opts ...grpc.CallOption) (*pb.Pong, error) {
+	return &pb.Pong{}, nil
+}
+
+func (g *Gateway) Mysql(ctx context.Context, in *pb.SqlRequest, opts ...grpc.CallOption) (*pb.SqlResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.statements = append(g.statements, in.Sql)
+	return &pb.SqlResponse{Result: &pb.Result{}}, nil
+}
+
+func (g *Gateway) RedisGet(ctx context.Context, in *pb.RedisGetStringRequest, opts ...grpc.CallOption) (*pb.RedisGetStringResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v, _ := g.load(in.Key)
+	return &pb.RedisGetStringResponse{Result: &pb.Result{}, Value: string(v)}, nil
+}
+
+func (g *Gateway) RedisBGet(ctx context.Context, in *pb.RedisGetBytesRequest, opts ...grpc.CallOption) (*pb.RedisGetBytesResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v, _ := g.load(in.Key)
+	return &pb.RedisGetBytesResponse{Result: &pb.Result{}, Value: v}, nil
+}
+
+func (g *Gateway) RedisSet(ctx context.Context, in *pb.RedisSetStringRequest, opts ...grpc.CallOption) (*pb.RedisSetResponse, error) {
+	g.store(in.Key, []byte(in.Value), in.Ttl)
+	return &pb.RedisSetResponse{Result: &pb.Result{}}, nil
+}
+
+func (g *Gateway) RedisBSet(ctx context.Context, in *pb.RedisSetBytesRequest, opts ...grpc.CallOption) (*pb.RedisSetResponse, error) {
+	g.store(in.Key, append([]byte(nil), in.Value...), in.Ttl)
+	return &pb.RedisSetResponse{Result: &pb.Result{}}, nil
+}
+
+func (g *Gateway) RedisDel(ctx context.Context, in *pb.RedisDelRequest, opts ...grpc.CallOption) (*pb.RedisDelResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.redis, in.Key)
+	return &pb.RedisDelResponse{Result: &pb.Result{}}, nil
+}
+
+// RedisMGet 批量读取，实现 gateway.RedisBatcher
+func (g *Gateway) RedisMGet(ctx context.Context, keys []string) ([]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		v, _ := g.load(key)
+		values[i] = string(v)
+	}
+	return values, nil
+}
+
+// RedisMDel 批量删除，实现 gateway.RedisBatcher
+func (g *Gateway) RedisMDel(ctx context.Context, keys []string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range keys {
+		delete(g.redis, key)
+	}
+	return nil
+}
+
+// RedisMSet 批量写入，实现 gateway.RedisBatcher
+func (g *Gateway) RedisMSet(ctx context.Context, reqs []*pb.RedisSetStringRequest) error {
+	for _, req := range reqs {
+		g.store(req.Key, []byte(req.Value), req.Ttl)
+	}
+	return nil
+}
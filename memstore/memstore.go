@@ -0,0 +1,225 @@
+// Package memstore 会话存储与 DBGateway 的内存实现
+// 用于在没有 MySQL、Redis 与 DBGateway 时测试 GRPC 接口与后台任务，通过 cache.WithStore 与 gateway.WithClient 注入
+package memstore
+
+import (
+	"StealthIMSession/cache"
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store 内存中的会话存储，实现 cache.SessionStore，并发安全
+type Store struct {
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+type session struct {
+	uid      int32
+	created  time.Time
+	expires  time.Time
+	lifetime time.Duration // 创建时的有效期，Renew 按该长度延长
+	meta     cache.SessionMeta
+	attrs    map[string]string
+}
+
+// NewStore 创建空的会话存储
+func NewStore() *Store {
+	return &Store{sessions: make(map[string]session)}
+}
+
+// Len 返回存储中的会话数（含已过期未清理的会话）
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func (s *Store) Get(ctx context.Context, sessionID string) (int32, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return 0, 0, cache.ErrSessionNotFound
+	}
+	return sess.uid, time.Until(sess.expires), nil
+}
+
+// Save 写入会话，ttl 不大于 0 时会话已过期（用于构造待清理的会话）
+func (s *Store) Save(ctx context.Context, sessionID string, uid int32, ttl time.Duration, meta cache.SessionMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sessions[sessionID] = session{uid: uid, created: now, expires: now.Add(ttl), lifetime: ttl, meta: meta}
+	return nil
+}
+
+// SaveBatch 写入多个会话，已存在的会话保持不变
+func (s *Store) SaveBatch(ctx context.Context, sessions []cache.NewSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, n := range sessions {
+		if _, ok := s.sessions[n.SessionID]; ok {
+			continue
+		}
+		s.sessions[n.SessionID] = session{uid: n.UID, created: now, expires: now.Add(n.TTL), lifetime: n.Lifetime, meta: n.Meta}
+	}
+	return nil
+}
+
+// Renew 不检查空闲超时：Get 同样不按空闲时间判断失效
+func (s *Store) Renew(ctx context.Context, sessionID string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.live(sessionID)
+	if !ok {
+		return time.Time{}, cache.ErrSessionNotFound
+	}
+	now := time.Now()
+	sess.expires = now.Add(sess.lifetime)
+	s.sessions[sessionID] = sess
+	return sess.expires, nil
+}
+
+// MarkActive 内存存储不按空闲时间判断失效，不需要记录活跃时间
+func (s *Store) MarkActive(ctx context.Context, sessionID string) error {
+	return nil
+}
+
+func (s *Store) Delete(ctx context.Context, sessionID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.sessions[sessionID]
+	delete(s.sessions, sessionID)
+	return ok, nil
+}
+
+// DeleteExpired 按会话ID顺序删除至多 limit 个过期会话
+func (s *Store) DeleteExpired(ctx context.Context, limit int) ([]cache.ExpiredSession, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var expired []cache.ExpiredSession
+	for id, sess := range s.sessions {
+		if !sess.expires.After(now) {
+			expired = append(expired, cache.ExpiredSession{SessionID: id, UID: sess.uid})
+		}
+	}
+	slices.SortFunc(expired, func(a, b cache.ExpiredSession) int { return strings.Compare(a.SessionID, b.SessionID) })
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	for _, e := range expired {
+		delete(s.sessions, e.SessionID)
+	}
+	return expired, int64(len(expired)), nil
+}
+
+func (s *Store) CountExpired(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var count int64
+	for _, sess := range s.sessions {
+		if !sess.expires.After(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) ListByUID(ctx context.Context, uid int32) ([]cache.SessionInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var list []cache.SessionInfo
+	for id, sess := range s.sessions {
+		if sess.uid == uid && sess.expires.After(now) {
+			list = append(list, cache.SessionInfo{SessionID: id, CreatedAt: sess.created, Meta: sess.meta})
+		}
+	}
+	slices.SortFunc(list, func(a, b cache.SessionInfo) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return list, nil
+}
+
+func (s *Store) CountByAge(ctx context.Context, maxDays int) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	byAge := make([]int64, maxDays+1)
+	for _, sess := range s.sessions {
+		if sess.expires.After(now) {
+			byAge[min(int(now.Sub(sess.created)/(24*time.Hour)), maxDays)]++
+		}
+	}
+	return byAge, nil
+}
+
+func (s *Store) CountByUID(ctx context.Context, uid int32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var count int64
+	for _, sess := range s.sessions {
+		if sess.uid == uid && sess.expires.After(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// live 返回未过期的会话，调用方需持有锁
+func (s *Store) live(sessionID string) (session, bool) {
+	sess, ok := s.sessions[sessionID]
+	if !ok || !sess.expires.After(time.Now()) {
+		return session{}, false
+	}
+	return sess, true
+}
+
+func (s *Store) Attrs(ctx context.Context, sessionID string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.live(sessionID)
+	if !ok {
+		return nil, cache.ErrSessionNotFound
+	}
+	return maps.Clone(sess.attrs), nil
+}
+
+func (s *Store) SetAttr(ctx context.Context, sessionID string, key string, value string, maxAttrs int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.live(sessionID)
+	if !ok {
+		return cache.ErrSessionNotFound
+	}
+	if _, exists := sess.attrs[key]; !exists && len(sess.attrs) >= maxAttrs {
+		return cache.ErrTooManyAttrs
+	}
+	// 复制后写回，已返回给调用方的 map 不受影响
+	attrs := maps.Clone(sess.attrs)
+	if attrs == nil {
+		attrs = make(map[string]string)
+	}
+	attrs[key] = value
+	sess.attrs = attrs
+	s.sessions[sessionID] = sess
+	return nil
+}
+
+func (s *Store) DelAttr(ctx context.Context, sessionID string, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[sessionID]; ok {
+		sess.attrs = maps.Clone(sess.attrs)
+		delete(sess.attrs, key)
+		s.sessions[sessionID] = sess
+	}
+	return nil
+}
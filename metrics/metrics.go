@@ -0,0 +1,251 @@
+package metrics
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 指标类型
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// histShards 直方图分片数，降低高并发下的原子操作竞争
+const histShards = 16
+
+// DefaultBuckets 默认延迟分桶（秒）
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Counter 单调递增计数器
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc 计数加一
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add 计数增加 n
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+// Value 当前计数
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+// Gauge 可增可减的瞬时值
+type Gauge struct {
+	v atomic.Int64
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(v int64) {
+	g.v.Store(v)
+}
+
+// Add 增加 n（可为负数）
+func (g *Gauge) Add(n int64) {
+	g.v.Add(n)
+}
+
+// Value 当前值
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+type histShard struct {
+	counts []atomic.Uint64
+	sum    atomic.Uint64 // float64 bits
+	_      [32]byte      // 避免相邻分片伪共享
+}
+
+// Histogram 分片直方图
+type Histogram struct {
+	buckets []float64
+	shards  [histShards]histShard
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	h := &Histogram{buckets: buckets}
+	for i := range h.shards {
+		h.shards[i].counts = make([]atomic.Uint64, len(buckets)+1)
+	}
+	return h
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	shard := &h.shards[rand.IntN(histShards)]
+	idx := sort.SearchFloat64s(h.buckets, v)
+	shard.counts[idx].Add(1)
+	for {
+		old := shard.sum.Load()
+		if shard.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// ObserveSince 记录从 start 到现在经过的秒数
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// HistogramSnapshot 直方图快照
+type HistogramSnapshot struct {
+	Buckets []float64 // 分桶上界
+	Counts  []uint64  // 累计计数，最后一项为 +Inf
+	Count   uint64
+	Sum     float64
+}
+
+// Snapshot 合并所有分片
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	snap := HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  make([]uint64, len(h.buckets)+1),
+	}
+	for i := range h.shards {
+		shard := &h.shards[i]
+		for j := range shard.counts {
+			snap.Counts[j] += shard.counts[j].Load()
+		}
+		snap.Sum += math.Float64frombits(shard.sum.Load())
+	}
+	var cumulative uint64
+	for j := range snap.Counts {
+		cumulative += snap.Counts[j]
+		snap.Counts[j] = cumulative
+	}
+	snap.Count = cumulative
+	return snap
+}
+
+// metric 已注册的指标
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	labels string // 已格式化的标签，如 method="Get"
+	value  any
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]*metric)
+)
+
+// formatLabels 将键值对格式化为 Prometheus 标签
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		parts = append(parts, labels[i]+"=\""+labels[i+1]+"\"")
+	}
+	return strings.Join(parts, ",")
+}
+
+// register 注册指标，同名同标签的指标只注册一次
+func register(name string, help string, kind string, labels []string, create func() any) any {
+	formatted := formatLabels(labels)
+	key := name + "{" + formatted + "}"
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if m, ok := registry[key]; ok {
+		return m.value
+	}
+	m := &metric{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: formatted,
+		value:  create(),
+	}
+	registry[key] = m
+	return m.value
+}
+
+// NewCounter 注册计数器，labels 为键值对
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return register(name, help, TypeCounter, labels, func() any { return &Counter{} }).(*Counter)
+}
+
+// NewGauge 注册瞬时值，labels 为键值对
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return register(name, help, TypeGauge, labels, func() any { return &Gauge{} }).(*Gauge)
+}
+
+// NewGaugeFunc 注册在采集时调用 fn 取值的瞬时值
+// fn 会在持有注册表读锁时调用，应当廉价且不阻塞
+func NewGaugeFunc(name string, help string, fn func() int64, labels ...string) {
+	register(name, help, TypeGauge, labels, func() any { return gaugeFunc(fn) })
+}
+
+type gaugeFunc func() int64
+
+// NewHistogram 注册直方图，buckets 为空时使用 DefaultBuckets
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return register(name, help, TypeHistogram, labels, func() any { return newHistogram(buckets) }).(*Histogram)
+}
+
+// Sample 指标快照
+type Sample struct {
+	Name      string
+	Help      string
+	Type      string
+	Labels    string
+	Value     float64            // 计数器与瞬时值
+	Histogram *HistogramSnapshot // 仅直方图
+}
+
+// Snapshot 获取所有指标的快照，按名称和标签排序
+func Snapshot() []Sample {
+	registryLock.RLock()
+	samples := make([]Sample, 0, len(registry))
+	for _, m := range registry {
+		s := Sample{
+			Name:   m.name,
+			Help:   m.help,
+			Type:   m.kind,
+			Labels: m.labels,
+		}
+		switch v := m.value.(type) {
+		case *Counter:
+			s.Value = float64(v.Value())
+		case *Gauge:
+			s.Value = float64(v.Value())
+		case gaugeFunc:
+			s.Value = float64(v())
+		case *Histogram:
+			snap := v.Snapshot()
+			s.Histogram = &snap
+			s.Value = float64(snap.Count)
+		}
+		samples = append(samples, s)
+	}
+	registryLock.RUnlock()
+
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].Name != samples[j].Name {
+			return samples[i].Name < samples[j].Name
+		}
+		return samples[i].Labels < samples[j].Labels
+	})
+	return samples
+}
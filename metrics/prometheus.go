@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"StealthIMSession/logging"
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+var logger = logging.For("metrics")
+
+// WritePrometheus 以 Prometheus 文本格式输出所有指标
+func WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	lastName := ""
+	for _, s := range Snapshot() {
+		if s.Name != lastName {
+			bw.WriteString("# HELP " + s.Name + " " + s.Help + "\n")
+			bw.WriteString("# TYPE " + s.Name + " " + s.Type + "\n")
+			lastName = s.Name
+		}
+		if s.Histogram == nil {
+			bw.WriteString(s.Name + braces(s.Labels) + " " + formatFloat(s.Value) + "\n")
+			continue
+		}
+		h := s.Histogram
+		for i, upper := range h.Buckets {
+			bw.WriteString(s.Name + "_bucket" + braces(joinLabels(s.Labels, "le=\""+formatFloat(upper)+"\"")) + " " + strconv.FormatUint(h.Counts[i], 10) + "\n")
+		}
+		bw.WriteString(s.Name + "_bucket" + braces(joinLabels(s.Labels, "le=\"+Inf\"")) + " " + strconv.FormatUint(h.Count, 10) + "\n")
+		bw.WriteString(s.Name + "_sum" + braces(s.Labels) + " " + formatFloat(h.Sum) + "\n")
+		bw.WriteString(s.Name + "_count" + braces(s.Labels) + " " + strconv.FormatUint(h.Count, 10) + "\n")
+	}
+	return bw.Flush()
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func joinLabels(labels string, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// server 正在运行的指标服务，Serve 前为 nil
+var server atomic.Pointer[http.Server]
+
+// Serve 监听地址并在后台提供 Prometheus 指标 HTTP 服务，监听失败时返回错误
+func Serve(host string, port int) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WritePrometheus(w)
+	})
+	lis, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: mux}
+	server.Store(srv)
+	logger.Info("server listening", "addr", lis.Addr().String())
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to serve", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown 停止指标服务，等待正在进行的抓取完成或 ctx 结束
+func Shutdown(ctx context.Context) error {
+	srv := server.Load()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
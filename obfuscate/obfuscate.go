@@ -0,0 +1,158 @@
+package obfuscate
+
+import (
+	pb "StealthIMSession/StealthIM.DBGateway"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// aliasLen 别名长度（十六进制字符数）
+const aliasLen = 16
+
+// maxRemembered 已写入别名表的 uid 在内存中最多记录的数量
+const maxRemembered = 100000
+
+// aliasSchema uid 别名表结构
+const aliasSchema = `CREATE TABLE IF NOT EXISTS uid_alias_db (
+	alias CHAR(16) NOT NULL PRIMARY KEY,
+	uid INT NOT NULL
+)`
+
+var logger = logging.For("obfuscate")
+
+var (
+	rememberLock sync.Mutex
+	remembered   = make(map[int32]struct{})
+)
+
+// Enabled 是否启用 uid 混淆
+func Enabled() bool {
+	return config.LatestConfig.Privacy.UIDHMACKey != ""
+}
+
+// alias 计算 uid 的 HMAC 别名
+func alias(key string, uid int32) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strconv.FormatInt(int64(uid), 10)))
+	return hex.EncodeToString(mac.Sum(nil))[:aliasLen]
+}
+
+// validAlias 检查别名格式：aliasLen 个小写十六进制字符
+func validAlias(a string) bool {
+	if len(a) != aliasLen {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if !('0' <= a[i] && a[i] <= '9' || 'a' <= a[i] && a[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyAlias 校验别名是否为 uid 在 key 下的 HMAC 别名（常量时间比较）
+func verifyAlias(key string, a string, uid int32) bool {
+	return hmac.Equal([]byte(alias(key, uid)), []byte(a))
+}
+
+// UID 返回用于日志、指标标签与对外事件的 uid 表示
+// 未配置密钥时原样返回 uid
+func UID(uid int32) string {
+	key := config.LatestConfig.Privacy.UIDHMACKey
+	if key == "" {
+		return strconv.FormatInt(int64(uid), 10)
+	}
+	a := alias(key, uid)
+	remember(a, uid)
+	return a
+}
+
+// remember 将别名写入别名表供反查，每个 uid 在进程内只写入一次
+func remember(a string, uid int32) {
+	rememberLock.Lock()
+	if _, ok := remembered[uid]; ok {
+		rememberLock.Unlock()
+		return
+	}
+	if len(remembered) >= maxRemembered {
+		remembered = make(map[int32]struct{})
+	}
+	remembered[uid] = struct{}{}
+	rememberLock.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, true,
+			"INSERT IGNORE INTO uid_alias_db (alias, uid) VALUES (?, ?)", a, uid)
+		if err != nil {
+			logger.Warn("failed to record uid alias", "error", err)
+			rememberLock.Lock()
+			delete(remembered, uid)
+			rememberLock.Unlock()
+		}
+	}()
+}
+
+// InitAliasTable 初始化 uid 别名表
+// DBGateway 连接是异步建立的，因此在后台重试直到成功
+func InitAliasTable() {
+	if !Enabled() {
+		return
+	}
+	go func() {
+		for {
+			_, err := gateway.ExecSQL(context.Background(), &pb.SqlRequest{
+				Sql:    aliasSchema,
+				Db:     pb.SqlDatabases_Session,
+				Commit: true,
+			})
+			if err == nil {
+				logger.Info("uid alias table ready")
+				return
+			}
+			logger.Warn("init alias table failed, retrying", "error", err)
+			time.Sleep(5 * time.Second)
+		}
+	}()
+}
+
+// ErrNotFound 别名不存在
+var ErrNotFound = errors.New("alias not found")
+
+// Resolve 根据别名反查 uid
+func Resolve(ctx context.Context, a string) (int32, error) {
+	if !Enabled() {
+		return 0, errors.New("uid obfuscation is disabled")
+	}
+	if !validAlias(a) {
+		return 0, ErrNotFound
+	}
+	sqlResp, err := gateway.ExecSQLParams(ctx, pb.SqlDatabases_Session, false,
+		"SELECT uid FROM uid_alias_db WHERE alias = ? LIMIT 1", a)
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	if sqlResp == nil || len(sqlResp.Data) == 0 || len(sqlResp.Data[0].Result) == 0 {
+		return 0, ErrNotFound
+	}
+	uid, ok := gateway.ScanInt64(sqlResp.Data[0].Result[0])
+	if !ok {
+		return 0, ErrNotFound
+	}
+	// 防止别名表被篡改：重新计算校验
+	if !verifyAlias(config.LatestConfig.Privacy.UIDHMACKey, a, int32(uid)) {
+		return 0, ErrNotFound
+	}
+	return int32(uid), nil
+}
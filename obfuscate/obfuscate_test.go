@@ -0,0 +1,27 @@
+package obfuscate
+
+import (
+	"testing"
+)
+
+func FuzzVerifyAlias(f *testing.F) {
+	f.Add("secret", int32(10086), "5d41402abc4b2a76")
+	f.Add("", int32(0), "")
+	f.Add("k", int32(-1), "ZZZZZZZZZZZZZZZZ")
+	f.Add("secret", int32(2147483647), "5d41402abc4b2a7\x00")
+	f.Fuzz(func(t *testing.T, key string, uid int32, a string) {
+		want := alias(key, uid)
+		if !validAlias(want) {
+			t.Fatalf("alias(%q, %d) = %q is not a valid alias", key, uid, want)
+		}
+		if !verifyAlias(key, want, uid) {
+			t.Fatalf("verifyAlias rejects its own alias %q", want)
+		}
+		if verifyAlias(key, a, uid) != (a == want) {
+			t.Fatalf("verifyAlias(%q, %q, %d) accepted a forged alias", key, a, uid)
+		}
+		if verifyAlias(key, a, uid) && !validAlias(a) {
+			t.Fatalf("verifyAlias accepted malformed alias %q", a)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// kafkaREST 经由 Kafka REST Proxy（v2 API）发布，主题名与 NATS 相同，以 uid 作为消息键保证同一用户的事件有序
+type kafkaREST struct {
+	base   string
+	prefix string
+	client *http.Client
+}
+
+func newKafkaREST(base string, prefix string) *kafkaREST {
+	return &kafkaREST{base: strings.TrimRight(base, "/"), prefix: prefix, client: &http.Client{}}
+}
+
+// kafkaRecord REST Proxy 请求中的一条消息
+type kafkaRecord struct {
+	Key   string  `json:"key"`
+	Value message `json:"value"`
+}
+
+// kafkaResponse REST Proxy 对每条消息的结果
+type kafkaResponse struct {
+	Offsets []struct {
+		Error *string `json:"error"`
+	} `json:"offsets"`
+}
+
+// publish 按主题分组发布，任一主题失败时整批重试（已成功的事件会重复，由订阅方按 id 去重）
+func (k *kafkaREST) publish(ctx context.Context, msgs []message) error {
+	var topics []string
+	byTopic := make(map[string][]kafkaRecord)
+	for _, m := range msgs {
+		topic := subject(k.prefix, m.Event)
+		if _, ok := byTopic[topic]; !ok {
+			topics = append(topics, topic)
+		}
+		byTopic[topic] = append(byTopic[topic], kafkaRecord{Key: strconv.Itoa(int(m.UID)), Value: m})
+	}
+	for _, topic := range topics {
+		if err := k.produce(ctx, topic, byTopic[topic]); err != nil {
+			return fmt.Errorf("topic %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+func (k *kafkaREST) produce(ctx context.Context, topic string, records []kafkaRecord) error {
+	body, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.base+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("REST proxy returned %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var result kafkaResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("decode REST proxy response: %w", err)
+	}
+	for _, o := range result.Offsets {
+		if o.Error != nil {
+			return fmt.Errorf("REST proxy rejected record: %s", *o.Error)
+		}
+	}
+	return nil
+}
+
+func (k *kafkaREST) close() {
+	k.client.CloseIdleConnections()
+}
@@ -0,0 +1,138 @@
+package publisher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// natsConn 最小的 NATS 发布客户端（文本协议，不支持 TLS）
+// 每批事件之后发送 PING，收到 PONG 即表示服务器已处理之前的全部 PUB
+type natsConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	prefix string
+}
+
+// natsConnect CONNECT 命令的参数
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+// dialNATS 连接 nats://[user:pass@|token@]host:port 并完成握手
+func dialNATS(rawURL string, prefix string, timeout time.Duration) (*natsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS url %q", rawURL)
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &natsConn{conn: conn, r: bufio.NewReader(conn), prefix: prefix}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := c.handshake(u); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// handshake 读取 INFO，发送 CONNECT 并等待 PONG
+func (c *natsConn) handshake(u *url.URL) error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected NATS greeting %q", line)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if json.Unmarshal([]byte(line[len("INFO "):]), &info) == nil && info.TLSRequired {
+		return errors.New("NATS server requires TLS, which is not supported")
+	}
+	opts := natsConnect{Name: "stealthim-session"}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			opts.User, opts.Pass = u.User.Username(), pass
+		} else {
+			opts.Token = u.User.Username()
+		}
+	}
+	payload, _ := json.Marshal(opts)
+	if _, err := c.conn.Write([]byte("CONNECT " + string(payload) + "\r\nPING\r\n")); err != nil {
+		return err
+	}
+	return c.waitPong()
+}
+
+// publish 发布一批事件并等待服务器确认
+func (c *natsConn) publish(ctx context.Context, msgs []message) error {
+	var b strings.Builder
+	for _, m := range msgs {
+		payload, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		b.WriteString("PUB " + subject(c.prefix, m.Event) + " " + strconv.Itoa(len(payload)) + "\r\n")
+		b.Write(payload)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("PING\r\n")
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+		defer c.conn.SetDeadline(time.Time{})
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	return c.waitPong()
+}
+
+// waitPong 读取服务器消息直到 PONG，回复服务器的 PING，-ERR 返回错误
+func (c *natsConn) waitPong() error {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := c.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK 与 INFO 忽略
+	}
+}
+
+func (c *natsConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *natsConn) close() {
+	c.conn.Close()
+}
@@ -0,0 +1,297 @@
+// Package publisher 将会话生命周期事件发布到外部消息总线（NATS 或经由 REST Proxy 的 Kafka），
+// 供推送、在线状态等服务订阅，不必轮询。发布至少一次：发布失败的事件留在本地缓冲中按退避间隔重试，
+// 关闭时仍未发布的事件写入 spool 文件，下次启动时重新发布；订阅方按事件 id 去重
+package publisher
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/events"
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var logger = logging.For("publisher")
+
+var (
+	metricPublished = metrics.NewCounter("stealthim_session_publisher_published_total", "Session events published to the message bus")
+	metricDropped   = metrics.NewCounter("stealthim_session_publisher_dropped_total", "Session events dropped because the publish buffer was full")
+	metricErrors    = metrics.NewCounter("stealthim_session_publisher_errors_total", "Failed attempts to publish a batch of session events")
+	metricSpooled   = metrics.NewCounter("stealthim_session_publisher_spooled_total", "Unpublished session events written to the spool file on shutdown")
+)
+
+// message 一条待发布的事件，id 用于订阅方去重
+type message struct {
+	ID string `json:"id"`
+	events.Event
+}
+
+// subject 事件发布的主题：<前缀>.<事件类型>，如 session.created
+func subject(prefix string, ev events.Event) string {
+	return prefix + "." + ev.Type
+}
+
+// transport 一种消息总线的连接
+type transport interface {
+	// publish 发布一批事件，返回 nil 表示全部被消息总线确认
+	publish(ctx context.Context, msgs []message) error
+	close()
+}
+
+// publisher 发布缓冲与后台发布协程
+type publisher struct {
+	cfg  config.PublisherConfig
+	dial func() (transport, error)
+
+	mu      sync.Mutex
+	pending []message     // 等待发布的事件，只有后台协程从头部移除
+	notify  chan struct{} // 有新事件时通知后台协程
+
+	draining chan struct{} // Stop 时关闭：发布完剩余事件后退出
+	quit     chan struct{} // Stop 超时时关闭：立即退出
+	done     chan struct{} // 后台协程退出后关闭
+}
+
+// current 正在运行的发布器，Start 之前与 Stop 之后为 nil
+var current atomic.Pointer[publisher]
+
+func init() {
+	events.OnEmit(func(ev events.Event) {
+		if p := current.Load(); p != nil {
+			p.enqueue(ev)
+		}
+	})
+	metrics.NewGaugeFunc("stealthim_session_publisher_pending", "Session events waiting to be published", func() int64 {
+		if p := current.Load(); p != nil {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			return int64(len(p.pending))
+		}
+		return 0
+	})
+}
+
+// Start 按 [publisher] 配置在后台发布会话事件，并重新发布 spool 文件中上次关闭时未发布的事件
+// 未配置 kind 时不做任何事；消息总线不可用不会阻止启动
+func Start(cfg config.PublisherConfig) error {
+	var dial func() (transport, error)
+	switch cfg.Kind {
+	case "":
+		return nil
+	case config.PublisherNATS:
+		dial = func() (transport, error) { return dialNATS(cfg.URL, cfg.SubjectPrefix, timeout(cfg)) }
+	case config.PublisherKafkaREST:
+		dial = func() (transport, error) { return newKafkaREST(cfg.URL, cfg.SubjectPrefix), nil }
+	default:
+		return fmt.Errorf("unknown publisher kind %q", cfg.Kind)
+	}
+	p := &publisher{
+		cfg:      cfg,
+		dial:     dial,
+		notify:   make(chan struct{}, 1),
+		draining: make(chan struct{}),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	spooled, err := p.loadSpool()
+	if err != nil {
+		return err
+	}
+	current.Store(p)
+	go p.run()
+	logger.Info("publishing session events", "kind", cfg.Kind, "respooled", spooled)
+	return nil
+}
+
+// Stop 停止接收事件，在 ctx 结束前尽量发布剩余事件，仍未发布的写入 spool 文件（未配置时丢弃）
+func Stop(ctx context.Context) error {
+	p := current.Swap(nil)
+	if p == nil {
+		return nil
+	}
+	close(p.draining)
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		close(p.quit)
+		<-p.done
+	}
+	return p.saveSpool()
+}
+
+// timeout 单次发布的超时时间
+func timeout(cfg config.PublisherConfig) time.Duration {
+	return time.Duration(cfg.Timeout) * time.Millisecond
+}
+
+// enqueue 将事件加入发布缓冲，缓冲满时丢弃并计数，不阻塞产生事件的请求
+func (p *publisher) enqueue(ev events.Event) {
+	id, err := newID()
+	if err != nil {
+		metricDropped.Inc()
+		return
+	}
+	p.mu.Lock()
+	if len(p.pending) >= p.cfg.Buffer {
+		p.mu.Unlock()
+		metricDropped.Inc()
+		return
+	}
+	p.pending = append(p.pending, message{ID: id, Event: ev})
+	p.mu.Unlock()
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// peek 返回缓冲头部最多 n 个事件，不移除
+func (p *publisher) peek(n int) []message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]message(nil), p.pending[:min(n, len(p.pending))]...)
+}
+
+// remove 移除缓冲头部已发布的 n 个事件
+func (p *publisher) remove(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending[:0], p.pending[n:]...)
+}
+
+// run 按顺序分批发布缓冲中的事件，失败时重连并按退避间隔重试同一批，直到 Stop
+func (p *publisher) run() {
+	defer close(p.done)
+	var conn transport
+	defer func() {
+		if conn != nil {
+			conn.close()
+		}
+	}()
+	var backoff time.Duration
+	for {
+		batch := p.peek(p.cfg.Batch)
+		if len(batch) == 0 {
+			select {
+			case <-p.notify:
+				continue
+			case <-p.draining:
+				return
+			case <-p.quit:
+				return
+			}
+		}
+		err := p.send(&conn, batch)
+		if err == nil {
+			p.remove(len(batch))
+			metricPublished.Add(uint64(len(batch)))
+			backoff = 0
+			continue
+		}
+		metricErrors.Inc()
+		backoff = min(max(backoff*2, time.Duration(p.cfg.RetryBackoff)*time.Millisecond), time.Duration(p.cfg.RetryMaxBackoff)*time.Millisecond)
+		logger.Warn("publish failed, retrying", "events", len(batch), "retry_in", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// send 发布一批事件，需要时建立连接，失败时关闭连接以便重连
+func (p *publisher) send(conn *transport, batch []message) error {
+	if *conn == nil {
+		c, err := p.dial()
+		if err != nil {
+			return fmt.Errorf("connect: %w", err)
+		}
+		*conn = c
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout(p.cfg))
+	defer cancel()
+	if err := (*conn).publish(ctx, batch); err != nil {
+		(*conn).close()
+		*conn = nil
+		return err
+	}
+	return nil
+}
+
+// loadSpool 读取上次关闭时未发布的事件加入缓冲，然后删除 spool 文件，返回读取的数量
+func (p *publisher) loadSpool() (int, error) {
+	if p.cfg.Spool == "" {
+		return 0, nil
+	}
+	f, err := os.Open(p.cfg.Spool)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("open publisher spool: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var m message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil || m.ID == "" {
+			logger.Warn("skipping invalid spooled event", "error", err)
+			continue
+		}
+		p.pending = append(p.pending, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("read publisher spool: %w", err)
+	}
+	return len(p.pending), os.Remove(p.cfg.Spool)
+}
+
+// saveSpool 将仍未发布的事件写入 spool 文件，未配置时丢弃并记录日志
+func (p *publisher) saveSpool() error {
+	p.mu.Lock()
+	left := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if len(left) == 0 {
+		return nil
+	}
+	if p.cfg.Spool == "" {
+		metricDropped.Add(uint64(len(left)))
+		logger.Warn("discarding unpublished session events, set publisher.spool to keep them", "events", len(left))
+		return nil
+	}
+	var buf []byte
+	for _, m := range left {
+		line, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if err := os.WriteFile(p.cfg.Spool, buf, 0o600); err != nil {
+		metricDropped.Add(uint64(len(left)))
+		return fmt.Errorf("write publisher spool: %w", err)
+	}
+	metricSpooled.Add(uint64(len(left)))
+	logger.Info("spooled unpublished session events", "events", len(left), "path", p.cfg.Spool)
+	return nil
+}
+
+// newID 生成事件 id
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
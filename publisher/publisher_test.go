@@ -0,0 +1,247 @@
+package publisher
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/events"
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATS 只实现发布所需命令的 NATS 服务器，记录收到的主题与消息
+type fakeNATS struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	subjects []string
+	msgs     []message
+	connects []string
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNATS{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	conn.Write([]byte(`INFO {"server_id":"fake","max_payload":1048576}` + "\r\n"))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			s.mu.Lock()
+			s.connects = append(s.connects, line[len("CONNECT "):])
+			s.mu.Unlock()
+		case line == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "PUB "):
+			fields := strings.Fields(line)
+			n, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			var m message
+			json.Unmarshal(payload[:n], &m)
+			s.mu.Lock()
+			s.subjects = append(s.subjects, fields[1])
+			s.msgs = append(s.msgs, m)
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *fakeNATS) received() ([]string, []message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.subjects...), append([]message(nil), s.msgs...)
+}
+
+// testConfig 返回使用默认值的发布配置
+func testConfig(kind string, url string) config.PublisherConfig {
+	cfg := config.Default().Publisher
+	cfg.Kind, cfg.URL = kind, url
+	cfg.RetryBackoff, cfg.RetryMaxBackoff = 10, 50
+	cfg.Timeout = 1000
+	return cfg
+}
+
+// waitFor 等待 cond 成立
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPublishNATS(t *testing.T) {
+	srv := newFakeNATS(t)
+	if err := Start(testConfig(config.PublisherNATS, "nats://svc:secret@"+srv.ln.Addr().String())); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Stop(context.Background()) })
+
+	events.Emit(events.Event{Type: events.Created, SessionID: "s1", UID: 42})
+	events.Emit(events.Event{Type: events.Deleted, SessionID: "s1", UID: 42})
+	events.Emit(events.Event{Type: events.Expired, SessionID: "s2", UID: 7})
+	waitFor(t, func() bool { _, msgs := srv.received(); return len(msgs) == 3 })
+
+	subjects, msgs := srv.received()
+	if strings.Join(subjects, " ") != "session.created session.deleted session.expired" {
+		t.Fatalf("subjects = %v", subjects)
+	}
+	if msgs[0].ID == "" || msgs[0].ID == msgs[1].ID || msgs[0].SessionID != "s1" || msgs[0].UID != 42 || msgs[0].Time == 0 {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	srv.mu.Lock()
+	connect := srv.connects[0]
+	srv.mu.Unlock()
+	if !strings.Contains(connect, `"user":"svc"`) || !strings.Contains(connect, `"pass":"secret"`) {
+		t.Fatalf("CONNECT = %s", connect)
+	}
+}
+
+func TestPublishRetriesUntilAvailable(t *testing.T) {
+	// 先占用端口再释放，发布器启动时连接失败
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	if err := Start(testConfig(config.PublisherNATS, "nats://"+addr)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Stop(context.Background()) })
+	events.Emit(events.Event{Type: events.Created, SessionID: "s1", UID: 42})
+	time.Sleep(50 * time.Millisecond)
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("port reused: %v", err)
+	}
+	srv := &fakeNATS{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	waitFor(t, func() bool { _, msgs := srv.received(); return len(msgs) == 1 })
+}
+
+func TestSpool(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "events.spool")
+	cfg := testConfig(config.PublisherNATS, "nats://127.0.0.1:1")
+	cfg.Spool = spool
+	if err := Start(cfg); err != nil {
+		t.Fatal(err)
+	}
+	events.Emit(events.Event{Type: events.Created, SessionID: "s1", UID: 42})
+	events.Emit(events.Event{Type: events.Revoked, UID: 42})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(spool)
+	if err != nil || strings.Count(string(data), "\n") != 2 {
+		t.Fatalf("spool = %q, %v", data, err)
+	}
+
+	// 下次启动时重新发布
+	srv := newFakeNATS(t)
+	cfg.URL = "nats://" + srv.ln.Addr().String()
+	if err := Start(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Stop(context.Background()) })
+	waitFor(t, func() bool { _, msgs := srv.received(); return len(msgs) == 2 })
+	if subjects, _ := srv.received(); subjects[1] != "session.revoked" {
+		t.Fatalf("subjects = %v", subjects)
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Fatalf("spool not removed after loading: %v", err)
+	}
+}
+
+func TestPublishKafkaREST(t *testing.T) {
+	var mu sync.Mutex
+	got := make(map[string][]kafkaRecord)
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		var body struct {
+			Records []kafkaRecord `json:"records"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		defer mu.Unlock()
+		// 第一次请求返回单条消息的错误，整批重试
+		if fail {
+			fail = false
+			w.Write([]byte(`{"offsets":[{"partition":null,"offset":null,"error_code":50003,"error":"timeout"}]}`))
+			return
+		}
+		topic := strings.TrimPrefix(r.URL.Path, "/topics/")
+		got[topic] = append(got[topic], body.Records...)
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1,"error_code":null,"error":null}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	if err := Start(testConfig(config.PublisherKafkaREST, srv.URL)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Stop(context.Background()) })
+	events.Emit(events.Event{Type: events.Created, SessionID: "s1", UID: 42})
+	waitFor(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(got["session.created"]) == 1 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if r := got["session.created"][0]; r.Key != "42" || r.Value.SessionID != "s1" || r.Value.ID == "" {
+		t.Fatalf("record = %+v", r)
+	}
+}
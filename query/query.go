@@ -0,0 +1,238 @@
+// Package query 列表查询的字段过滤、排序与游标分页，返回多条记录的查询接口（会话列表、会话历史与审计记录）
+// 各自定义 Schema 声明允许的字段，由 Build 校验请求并生成 SQL 片段
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind 字段类型，决定过滤值与游标值的解析方式
+type Kind int
+
+const (
+	String Kind = iota // 字符串
+	Int                // 整数
+	Time               // 时间，以 Unix 秒表示
+)
+
+// Op 过滤运算符
+type Op string
+
+const (
+	Eq     Op = "eq"     // 等于
+	Ne     Op = "ne"     // 不等于
+	Lt     Op = "lt"     // 小于
+	Le     Op = "le"     // 小于等于
+	Gt     Op = "gt"     // 大于
+	Ge     Op = "ge"     // 大于等于
+	Prefix Op = "prefix" // 前缀匹配，仅用于字符串
+)
+
+// opSQL 运算符对应的 SQL 比较符
+var opSQL = map[Op]string{
+	Eq: "=",
+	Ne: "<>",
+	Lt: "<",
+	Le: "<=",
+	Gt: ">",
+	Ge: ">=",
+}
+
+// ErrInvalid 查询参数不合法
+var ErrInvalid = errors.New("invalid query")
+
+// Field 可查询的字段
+type Field struct {
+	Column   string // SQL 表达式，Time 类型需为 Unix 秒
+	Kind     Kind
+	Sortable bool // 是否允许排序
+}
+
+// Schema 一类列表查询允许的字段与分页规则
+type Schema struct {
+	Fields       map[string]Field
+	Key          string // 唯一字段名，排序值相同时作为游标的第二排序键
+	DefaultSort  string // 默认排序字段名
+	DefaultDesc  bool   // 默认是否倒序
+	DefaultLimit int    // 默认每页数量
+	MaxLimit     int    // 每页数量上限
+}
+
+// Filter 单个字段过滤条件，值统一以字符串传入
+type Filter struct {
+	Field string
+	Op    Op
+	Value string
+}
+
+// Request 列表查询请求
+type Request struct {
+	Filters []Filter
+	Sort    string // 排序字段名，为空时使用 Schema.DefaultSort
+	Desc    bool   // 仅在 Sort 非空时生效
+	Cursor  string // 上一页返回的游标，为空表示第一页
+	Limit   int    // 每页数量，不大于 0 时使用 Schema.DefaultLimit
+}
+
+// Plan 由 Schema 校验后生成的 SQL 片段
+type Plan struct {
+	Where   string // 不含 WHERE 关键字，多个条件以 AND 连接，无条件时为空
+	Args    []any  // Where 中占位符对应的参数
+	OrderBy string // 不含 ORDER BY 关键字
+	Sort    string // 实际使用的排序字段名，生成游标时据此取排序值
+	Limit   int    // 每页数量，查询时应多取一条用于判断是否有下一页
+}
+
+// cursor 游标内容：上一页最后一项的排序值与唯一键
+type cursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+}
+
+// Build 校验请求并生成 SQL 片段
+func (s Schema) Build(req Request) (Plan, error) {
+	var plan Plan
+	var conds []string
+
+	for _, f := range req.Filters {
+		field, ok := s.Fields[f.Field]
+		if !ok {
+			return Plan{}, fmt.Errorf("%w: unknown field %q", ErrInvalid, f.Field)
+		}
+		if f.Op == Prefix {
+			if field.Kind != String {
+				return Plan{}, fmt.Errorf("%w: prefix on non-string field %q", ErrInvalid, f.Field)
+			}
+			conds = append(conds, field.Column+" LIKE ?")
+			plan.Args = append(plan.Args, escapeLike(f.Value)+"%")
+			continue
+		}
+		cmp, ok := opSQL[f.Op]
+		if !ok {
+			return Plan{}, fmt.Errorf("%w: unknown op %q", ErrInvalid, f.Op)
+		}
+		value, err := parseValue(field.Kind, f.Value)
+		if err != nil {
+			return Plan{}, fmt.Errorf("%w: field %q: %v", ErrInvalid, f.Field, err)
+		}
+		conds = append(conds, field.Column+" "+cmp+" ?")
+		plan.Args = append(plan.Args, value)
+	}
+
+	sortName, desc := req.Sort, req.Desc
+	if sortName == "" {
+		sortName, desc = s.DefaultSort, s.DefaultDesc
+	}
+	sortField, ok := s.Fields[sortName]
+	if !ok || !sortField.Sortable {
+		return Plan{}, fmt.Errorf("%w: field %q is not sortable", ErrInvalid, sortName)
+	}
+	keyField := s.Fields[s.Key]
+	plan.Sort = sortName
+
+	dir, cmp := "ASC", ">"
+	if desc {
+		dir, cmp = "DESC", "<"
+	}
+	if sortName == s.Key {
+		plan.OrderBy = keyField.Column + " " + dir
+	} else {
+		plan.OrderBy = sortField.Column + " " + dir + ", " + keyField.Column + " " + dir
+	}
+
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return Plan{}, fmt.Errorf("%w: bad cursor", ErrInvalid)
+		}
+		sortValue, err := parseValue(sortField.Kind, c.Sort)
+		if err != nil {
+			return Plan{}, fmt.Errorf("%w: bad cursor", ErrInvalid)
+		}
+		if sortName == s.Key {
+			conds = append(conds, keyField.Column+" "+cmp+" ?")
+			plan.Args = append(plan.Args, sortValue)
+		} else {
+			keyValue, err := parseValue(keyField.Kind, c.Key)
+			if err != nil {
+				return Plan{}, fmt.Errorf("%w: bad cursor", ErrInvalid)
+			}
+			conds = append(conds, "("+sortField.Column+" "+cmp+" ? OR ("+sortField.Column+" = ? AND "+keyField.Column+" "+cmp+" ?))")
+			plan.Args = append(plan.Args, sortValue, sortValue, keyValue)
+		}
+	}
+
+	plan.Where = strings.Join(conds, " AND ")
+
+	plan.Limit = req.Limit
+	if plan.Limit <= 0 {
+		plan.Limit = s.DefaultLimit
+	}
+	if s.MaxLimit > 0 && plan.Limit > s.MaxLimit {
+		plan.Limit = s.MaxLimit
+	}
+	return plan, nil
+}
+
+// SQL 拼接完整的查询语句，base 为不含 WHERE 的 SELECT 语句，where 为调用方自身的条件
+// 返回的语句多取一条记录，配合 Page 判断是否有下一页
+func (p Plan) SQL(base string, where string, args ...any) (string, []any) {
+	conds := make([]string, 0, 2)
+	if where != "" {
+		conds = append(conds, where)
+	}
+	if p.Where != "" {
+		conds = append(conds, p.Where)
+	}
+	sql := base
+	if len(conds) > 0 {
+		sql += " WHERE " + strings.Join(conds, " AND ")
+	}
+	sql += " ORDER BY " + p.OrderBy + " LIMIT " + strconv.Itoa(p.Limit+1)
+	return sql, append(append([]any{}, args...), p.Args...)
+}
+
+// Page 截取本页结果并生成下一页游标
+// n 为实际取到的记录数，last 返回第 i 条记录的排序值与唯一键（均为字符串形式）
+func (p Plan) Page(n int, last func(i int) (sort string, key string)) (size int, next string) {
+	if n <= p.Limit {
+		return n, ""
+	}
+	sort, key := last(p.Limit - 1)
+	return p.Limit, encodeCursor(cursor{Sort: sort, Key: key})
+}
+
+// parseValue 按字段类型解析字符串值
+func parseValue(kind Kind, v string) (any, error) {
+	switch kind {
+	case Int, Time:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return v, nil
+	}
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
@@ -0,0 +1,251 @@
+package query
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var fuzzSchema = Schema{
+	Fields: map[string]Field{
+		"id":         {Column: "id", Kind: Int, Sortable: true},
+		"created_at": {Column: "UNIX_TIMESTAMP(created_at)", Kind: Time, Sortable: true},
+		"device":     {Column: "device", Kind: String},
+	},
+	Key:          "id",
+	DefaultSort:  "created_at",
+	DefaultDesc:  true,
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+func FuzzBuild(f *testing.F) {
+	f.Add("device", "prefix", "iPhone%_", "", "", false, 0)
+	f.Add("created_at", "ge", "1760000000", "created_at", encodeCursor(cursor{Sort: "1760000000", Key: "42"}), true, 500)
+	f.Add("id", "lt", "x", "id", "not base64!", false, -1)
+	f.Add("device", "eq", "' OR 1=1 --", "device", "eyJzIjoiMSJ9", false, 10)
+	f.Fuzz(func(t *testing.T, field string, op string, value string, sort string, cur string, desc bool, limit int) {
+		plan, err := fuzzSchema.Build(Request{
+			Filters: []Filter{{Field: field, Op: Op(op), Value: value}},
+			Sort:    sort,
+			Desc:    desc,
+			Cursor:  cur,
+			Limit:   limit,
+		})
+		if err != nil {
+			if !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Build error %v does not wrap ErrInvalid", err)
+			}
+			return
+		}
+		// 用户输入只能出现在参数中，占位符数量与参数一致
+		if n := strings.Count(plan.Where, "?"); n != len(plan.Args) {
+			t.Fatalf("Where %q has %d placeholders, %d args", plan.Where, n, len(plan.Args))
+		}
+		if plan.Limit < 1 || plan.Limit > fuzzSchema.MaxLimit {
+			t.Fatalf("Limit = %d", plan.Limit)
+		}
+	})
+}
+
+func TestBuild(t *testing.T) {
+	cur := encodeCursor(cursor{Sort: "1760000000", Key: "42"})
+	tests := []struct {
+		name    string
+		req     Request
+		where   string
+		args    []any
+		orderBy string
+		limit   int
+		invalid bool
+	}{
+		{
+			name:    "defaults",
+			orderBy: "UNIX_TIMESTAMP(created_at) DESC, id DESC",
+			limit:   20,
+		},
+		{
+			name:    "filters",
+			req:     Request{Filters: []Filter{{"id", Ge, "7"}, {"device", Prefix, "a_b%"}}, Limit: 5},
+			where:   "id >= ? AND device LIKE ?",
+			args:    []any{int64(7), `a\_b\%%`},
+			orderBy: "UNIX_TIMESTAMP(created_at) DESC, id DESC",
+			limit:   5,
+		},
+		{
+			name:    "sort by key ascending with cursor",
+			req:     Request{Sort: "id", Cursor: encodeCursor(cursor{Sort: "42", Key: "42"})},
+			where:   "id > ?",
+			args:    []any{int64(42)},
+			orderBy: "id ASC",
+			limit:   20,
+		},
+		{
+			name:    "sort by key descending with cursor",
+			req:     Request{Sort: "id", Desc: true, Cursor: encodeCursor(cursor{Sort: "42", Key: "42"})},
+			where:   "id < ?",
+			args:    []any{int64(42)},
+			orderBy: "id DESC",
+			limit:   20,
+		},
+		{
+			name:    "sort by time ascending with cursor",
+			req:     Request{Sort: "created_at", Cursor: cur},
+			where:   "(UNIX_TIMESTAMP(created_at) > ? OR (UNIX_TIMESTAMP(created_at) = ? AND id > ?))",
+			args:    []any{int64(1760000000), int64(1760000000), int64(42)},
+			orderBy: "UNIX_TIMESTAMP(created_at) ASC, id ASC",
+			limit:   20,
+		},
+		{
+			name:    "sort by time descending with cursor",
+			req:     Request{Sort: "created_at", Desc: true, Cursor: cur},
+			where:   "(UNIX_TIMESTAMP(created_at) < ? OR (UNIX_TIMESTAMP(created_at) = ? AND id < ?))",
+			args:    []any{int64(1760000000), int64(1760000000), int64(42)},
+			orderBy: "UNIX_TIMESTAMP(created_at) DESC, id DESC",
+			limit:   20,
+		},
+		{name: "limit capped", req: Request{Limit: 500}, orderBy: "UNIX_TIMESTAMP(created_at) DESC, id DESC", limit: 100},
+		{name: "unknown field", req: Request{Filters: []Filter{{"secret", Eq, "x"}}}, invalid: true},
+		{name: "unknown op", req: Request{Filters: []Filter{{"id", "like", "1"}}}, invalid: true},
+		{name: "prefix on int", req: Request{Filters: []Filter{{"id", Prefix, "1"}}}, invalid: true},
+		{name: "bad int value", req: Request{Filters: []Filter{{"id", Eq, "x"}}}, invalid: true},
+		{name: "unsortable field", req: Request{Sort: "device"}, invalid: true},
+		{name: "bad cursor", req: Request{Cursor: "not base64!"}, invalid: true},
+		{name: "bad cursor value", req: Request{Cursor: encodeCursor(cursor{Sort: "x", Key: "42"})}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := fuzzSchema.Build(tt.req)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalid) {
+					t.Fatalf("Build() error = %v, want ErrInvalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan.Where != tt.where || !reflect.DeepEqual(plan.Args, tt.args) {
+				t.Fatalf("Where = %q %v, want %q %v", plan.Where, plan.Args, tt.where, tt.args)
+			}
+			if plan.OrderBy != tt.orderBy || plan.Limit != tt.limit {
+				t.Fatalf("OrderBy = %q, Limit = %d, want %q, %d", plan.OrderBy, plan.Limit, tt.orderBy, tt.limit)
+			}
+		})
+	}
+}
+
+func TestPlanSQL(t *testing.T) {
+	plan, err := fuzzSchema.Build(Request{Filters: []Filter{{"device", Eq, "ios"}}, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args := plan.SQL("SELECT id FROM t", "uid = ?", 7)
+	if want := "SELECT id FROM t WHERE uid = ? AND device = ? ORDER BY UNIX_TIMESTAMP(created_at) DESC, id DESC LIMIT 11"; sql != want {
+		t.Fatalf("SQL() = %q, want %q", sql, want)
+	}
+	if !reflect.DeepEqual(args, []any{7, "ios"}) {
+		t.Fatalf("args = %v", args)
+	}
+}
+
+func TestPage(t *testing.T) {
+	plan := Plan{Limit: 2}
+	last := func(i int) (string, string) { return strconv.Itoa(i * 10), strconv.Itoa(i) }
+	if size, next := plan.Page(2, last); size != 2 || next != "" {
+		t.Fatalf("Page(2) = %d, %q, want last page", size, next)
+	}
+	size, next := plan.Page(3, last)
+	if size != 2 || next == "" {
+		t.Fatalf("Page(3) = %d, %q", size, next)
+	}
+	if c, err := decodeCursor(next); err != nil || c != (cursor{Sort: "10", Key: "1"}) {
+		t.Fatalf("cursor = %+v, %v", c, err)
+	}
+}
+
+// row 分页测试中的一条记录，created 有重复以覆盖排序值相同时按唯一键翻页
+type row struct {
+	id      int64
+	created int64
+}
+
+// match 记录是否满足 plan 中的游标条件，模拟数据库执行 plan.SQL 生成的查询
+func (r row) match(plan Plan, desc bool) bool {
+	if len(plan.Args) == 0 {
+		return true
+	}
+	before := func(a, b int64) bool {
+		if desc {
+			return a < b
+		}
+		return a > b
+	}
+	if plan.Sort == "id" {
+		return before(r.id, plan.Args[0].(int64))
+	}
+	sort, key := plan.Args[0].(int64), plan.Args[2].(int64)
+	return before(r.created, sort) || (r.created == sort && before(r.id, key))
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	var rows []row
+	for id := int64(1); id <= 23; id++ {
+		rows = append(rows, row{id: id, created: 1760000000 + id/4})
+	}
+	for _, sortName := range []string{"id", "created_at"} {
+		for _, desc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s desc=%v", sortName, desc), func(t *testing.T) {
+				want := slices.Clone(rows)
+				slices.SortFunc(want, func(a, b row) int {
+					c := cmp.Compare(a.created, b.created)
+					if sortName == "id" || c == 0 {
+						c = cmp.Compare(a.id, b.id)
+					}
+					if desc {
+						c = -c
+					}
+					return c
+				})
+
+				var got []row
+				cur := ""
+				for pages := 0; ; pages++ {
+					if pages > len(rows) {
+						t.Fatal("pagination does not terminate")
+					}
+					plan, err := fuzzSchema.Build(Request{Sort: sortName, Desc: desc, Cursor: cur, Limit: 5})
+					if err != nil {
+						t.Fatal(err)
+					}
+					var result []row
+					for _, r := range want {
+						if r.match(plan, desc) && len(result) < plan.Limit+1 {
+							result = append(result, r)
+						}
+					}
+					size, next := plan.Page(len(result), func(i int) (string, string) {
+						id := strconv.FormatInt(result[i].id, 10)
+						if sortName == "created_at" {
+							return strconv.FormatInt(result[i].created, 10), id
+						}
+						return id, id
+					})
+					got = append(got, result[:size]...)
+					if next == "" {
+						break
+					}
+					cur = next
+				}
+				if !slices.Equal(got, want) {
+					t.Fatalf("pages = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
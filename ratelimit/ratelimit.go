@@ -0,0 +1,114 @@
+// Package ratelimit 令牌桶限流
+// 速率与容量在每次调用时传入，修改配置后立即生效，无需重建限流器
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket 令牌桶状态
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take 按经过的时间补充令牌后尝试取出一个，rate 为每秒补充的令牌数，burst 为容量
+func (b *bucket) take(now time.Time, rate float64, burst int) bool {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed*rate, float64(burst))
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full 按经过的时间补充后令牌桶是否已满，已满的桶与新建的桶等价
+func (b *bucket) full(now time.Time, rate float64, burst int) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst)
+}
+
+// Bucket 单个令牌桶，零值可用
+type Bucket struct {
+	mu sync.Mutex
+	b  bucket
+}
+
+// Allow 取出一个令牌，rate 不大于 0 时不限制；burst 小于 1 时按 1 计
+func (l *Bucket) Allow(now time.Time, rate float64, burst int) bool {
+	if rate <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.take(now, rate, max(burst, 1))
+}
+
+// maxKeys 按键限流表的键数上限，达到上限后新键加入前先淘汰一个键
+const maxKeys = 4096
+
+// evictSample 淘汰时抽查的键数
+const evictSample = 8
+
+// Keyed 按键（调用方、uid 等）分别限流的令牌桶，零值可用
+// 键数不超过 maxKeys，大量不同的键（如伪造的来源地址）不会使内存无限增长
+type Keyed[K comparable] struct {
+	mu      sync.Mutex
+	buckets map[K]*bucket
+}
+
+// Allow 取出键对应令牌桶中的一个令牌，rate 不大于 0 时不限制；burst 小于 1 时按 1 计
+func (l *Keyed[K]) Allow(key K, now time.Time, rate float64, burst int) bool {
+	if rate <= 0 {
+		return true
+	}
+	burst = max(burst, 1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[K]*bucket)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxKeys {
+			l.evict(now, rate, burst)
+		}
+		b = &bucket{}
+		l.buckets[key] = b
+	}
+	return b.take(now, rate, burst)
+}
+
+// evict 从随机抽查的 evictSample 个键中淘汰一个，开销与键数无关
+// 优先淘汰已满的令牌桶（与新建的桶等价，淘汰不影响限流），否则淘汰其中最久未使用的，该键再次出现时重新获得 burst 个令牌
+func (l *Keyed[K]) evict(now time.Time, rate float64, burst int) {
+	var victim K
+	var oldest time.Time
+	n := 0
+	// map 的遍历从随机位置开始
+	for k, b := range l.buckets {
+		if b.full(now, rate, burst) {
+			delete(l.buckets, k)
+			return
+		}
+		if n == 0 || b.last.Before(oldest) {
+			victim, oldest = k, b.last
+		}
+		if n++; n == evictSample {
+			break
+		}
+	}
+	delete(l.buckets, victim)
+}
+
+// Len 返回当前记录的键数量
+func (l *Keyed[K]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
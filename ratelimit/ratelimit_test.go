@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	var b Bucket
+	now := time.Unix(1760000000, 0)
+	for i := 0; i < 3; i++ {
+		if !b.Allow(now, 1, 3) {
+			t.Fatalf("request %d within burst rejected", i)
+		}
+	}
+	if b.Allow(now, 1, 3) {
+		t.Fatal("request over burst allowed")
+	}
+	// 每秒补充 1 个
+	if !b.Allow(now.Add(time.Second), 1, 3) || b.Allow(now.Add(time.Second), 1, 3) {
+		t.Fatal("refill after 1s not exactly one token")
+	}
+	if !b.Allow(now, 0, 0) {
+		t.Fatal("rate 0 should not limit")
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	var l Keyed[int32]
+	now := time.Unix(1760000000, 0)
+	if !l.Allow(1, now, 1, 1) || l.Allow(1, now, 1, 1) {
+		t.Fatal("burst 1 not enforced")
+	}
+	// 其他键不受影响
+	if !l.Allow(2, now, 1, 1) {
+		t.Fatal("separate key limited")
+	}
+
+	// 达到 maxKeys 后新键加入前淘汰一个键，键数不再增长
+	for i := int32(0); i < maxKeys; i++ {
+		l.Allow(100+i, now, 1, 1)
+	}
+	if n := l.Len(); n != maxKeys {
+		t.Fatalf("Len() = %d, want %d", n, maxKeys)
+	}
+	later := now.Add(100 * time.Millisecond)
+	if !l.Allow(-1, later, 1, 1) || l.Allow(-1, later, 1, 1) {
+		t.Fatal("new key after eviction not limited")
+	}
+	if n := l.Len(); n != maxKeys {
+		t.Fatalf("Len() after eviction = %d, want %d", n, maxKeys)
+	}
+	// 淘汰抽查的键中最久未使用的，刚使用过的 -1 保留，仍然受限
+	l.Allow(-2, later, 1, 1)
+	if l.Allow(-1, later, 1, 1) {
+		t.Fatal("recently used key evicted")
+	}
+}
+
+func BenchmarkKeyedNewKeys(b *testing.B) {
+	var l Keyed[int32]
+	now := time.Unix(1760000000, 0)
+	for i := 0; i < b.N; i++ {
+		l.Allow(int32(i), now, 1, 1)
+	}
+}
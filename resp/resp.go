@@ -0,0 +1,122 @@
+// Package resp 最小的 Redis RESP 客户端，供事件总线与直连 Redis 存储使用
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error Redis 返回的错误回复，连接仍然可用
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Conn 一个 Redis 连接，不是并发安全的
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Dial 连接 Redis，password 不为空时执行 AUTH
+func Dial(addr string, password string, timeout time.Duration) (*Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{conn: conn, r: bufio.NewReader(conn)}
+	if password != "" {
+		conn.SetDeadline(time.Now().Add(timeout))
+		if _, err := c.Do("AUTH", password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("auth: %v", err)
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return c, nil
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// SetDeadline 设置读写截止时间，零值表示不超时
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// Send 以 RESP 数组格式发送命令
+func (c *Conn) Send(args ...string) error {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	_, err := c.conn.Write([]byte(b.String()))
+	return err
+}
+
+// Do 发送命令并读取一个回复
+func (c *Conn) Do(args ...string) (any, error) {
+	if err := c.Send(args...); err != nil {
+		return nil, err
+	}
+	return c.Read()
+}
+
+// Read 读取一个回复：简单字符串与批量字符串返回 string，整数返回 int64，数组返回 []any，错误回复返回 Error
+func (c *Conn) Read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.Read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
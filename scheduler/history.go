@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"StealthIMSession/config"
+	"StealthIMSession/metrics"
+	"context"
+	"time"
+)
+
+// Run 一次任务执行的记录
+type Run struct {
+	Start    time.Time
+	Duration time.Duration
+	Error    string // 执行错误，成功时为空
+	Rows     int64  // 影响的行数或条目数，任务未报告时为 0
+}
+
+// 告警原因，同时作为 stealthim_session_cleaner_alerts_total 的 reason 标签
+const (
+	alertFailing = "failing" // 连续失败达到 failure_alert 次
+	alertOverrun = "overrun" // 单次执行时间超过任务间隔
+)
+
+// rowsKey 上下文中影响行数的键
+type rowsKey struct{}
+
+// ReportRows 在任务执行中报告本次影响的行数，多次调用时累加
+// 不在调度器中执行时（如直接调用任务函数）不做任何事
+func ReportRows(ctx context.Context, n int64) {
+	if rows, ok := ctx.Value(rowsKey{}).(*int64); ok {
+		*rows += n
+	}
+}
+
+// History 返回任务最近的执行记录，最新的在前
+func History(name string) ([]Run, error) {
+	e := get(name)
+	if e == nil {
+		return nil, ErrNotFound
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	runs := make([]Run, len(e.history))
+	for i, r := range e.history {
+		runs[len(runs)-1-i] = r
+	}
+	return runs, nil
+}
+
+// record 保存执行记录并检查是否需要告警，调用方持有 e.mu
+func (e *entry) record(r Run) {
+	size := max(config.LatestConfig.Scheduler.History, 1)
+	e.history = append(e.history, r)
+	if len(e.history) > size {
+		e.history = append(e.history[:0], e.history[len(e.history)-size:]...)
+	}
+
+	if r.Error != "" {
+		e.failures++
+	} else {
+		e.failures = 0
+	}
+	e.failing.Set(int64(e.failures))
+
+	// 连续失败只在达到阈值时告警一次，恢复成功后重新计数
+	if threshold := config.LatestConfig.Scheduler.FailureAlert; threshold > 0 && e.failures == threshold {
+		e.alert(alertFailing, "failures", e.failures, "error", r.Error)
+	}
+	if every := e.job.Every(); every > 0 && r.Duration > every {
+		e.alert(alertOverrun, "duration", r.Duration.Round(time.Millisecond), "interval", every)
+	}
+}
+
+// alert 记录告警日志并计入指标，args 为附加的日志字段
+func (e *entry) alert(reason string, args ...any) {
+	metrics.NewCounter("stealthim_session_cleaner_alerts_total", "Background job alerts", "job", e.job.Name, "reason", reason).Inc()
+	logger.Error("job alert", append([]any{"job", e.job.Name, "reason", reason}, args...)...)
+}
@@ -0,0 +1,309 @@
+// Package scheduler 后台定时任务调度
+// 清理、脱敏、统计与缓存维护等任务统一在此注册，按名称暂停、立即执行与查看状态
+package scheduler
+
+import (
+	"StealthIMSession/logging"
+	"StealthIMSession/metrics"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotFound 任务不存在
+var ErrNotFound = errors.New("job not found")
+
+var logger = logging.For("scheduler")
+
+// Job 定时任务
+type Job struct {
+	Name   string
+	Every  func() time.Duration        // 执行间隔，每次调度时调用，可随配置变化；不大于 0 时暂不执行
+	Jitter float64                     // 间隔的随机抖动比例，如 0.1 表示 ±10%
+	Delay  time.Duration               // 首次执行前的等待时间
+	Run    func(context.Context) error // 任务本体，同一任务不会并发执行
+}
+
+// Status 任务状态
+type Status struct {
+	Name      string
+	Paused    bool
+	Running   bool
+	LastRun   time.Time // 最近一次开始执行的时间，零值表示未执行过
+	LastError string    // 最近一次执行的错误，成功时为空
+	LastOK    time.Time // 最近一次成功执行的结束时间，零值表示没有成功过
+	NextRun   time.Time // 下一次计划执行的时间
+	Runs      uint64
+	Failures  uint64
+	Failing   int    // 连续失败次数
+	Rows      uint64 // 累计影响的行数，见 ReportRows
+}
+
+// entry 已注册的任务
+type entry struct {
+	job     Job
+	paused  atomic.Bool
+	running atomic.Bool
+	trigger chan struct{}
+	resched chan struct{} // 按当前间隔重新计算等待时间，见 Reschedule
+	stop    chan struct{}
+	done    chan struct{}
+	ctx     context.Context // 任务执行的上下文，停止任务时取消，中止正在执行的查询
+	cancel  context.CancelFunc
+
+	mu        sync.Mutex
+	lastRun   time.Time
+	lastError string
+	lastOK    time.Time
+	nextRun   time.Time
+	history   []Run // 最近的执行记录，最新的在后
+	failures  int   // 连续失败次数
+
+	runs     *metrics.Counter
+	errors   *metrics.Counter
+	rows     *metrics.Counter
+	lastOKTS *metrics.Gauge
+	duration *metrics.Histogram
+	failing  *metrics.Gauge
+}
+
+var (
+	lock sync.Mutex
+	jobs = make(map[string]*entry)
+)
+
+// Add 注册并启动任务，同名任务已存在时先停止旧任务
+func Add(job Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &entry{
+		job:      job,
+		ctx:      ctx,
+		cancel:   cancel,
+		trigger:  make(chan struct{}, 1),
+		resched:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		runs:     metrics.NewCounter("stealthim_session_cleaner_runs_total", "Background job runs", "job", job.Name),
+		errors:   metrics.NewCounter("stealthim_session_cleaner_errors_total", "Background job runs that failed", "job", job.Name),
+		rows:     metrics.NewCounter("stealthim_session_cleaner_rows_total", "Rows affected by background job runs", "job", job.Name),
+		lastOKTS: metrics.NewGauge("stealthim_session_cleaner_last_success_timestamp", "Unix time of the last successful run", "job", job.Name),
+		duration: metrics.NewHistogram("stealthim_session_cleaner_duration_seconds", "Background job run duration", nil, "job", job.Name),
+		failing:  metrics.NewGauge("stealthim_session_cleaner_consecutive_failures", "Consecutive failed runs", "job", job.Name),
+	}
+
+	lock.Lock()
+	old := jobs[job.Name]
+	jobs[job.Name] = e
+	lock.Unlock()
+
+	if old != nil {
+		old.halt()
+	}
+	go e.loop()
+	logger.Debug("job scheduled", "job", job.Name)
+}
+
+// Remove 停止并移除任务，取消正在执行的一次并等待其结束
+func Remove(name string) {
+	lock.Lock()
+	e := jobs[name]
+	delete(jobs, name)
+	lock.Unlock()
+
+	if e != nil {
+		e.halt()
+		logger.Debug("job removed", "job", name)
+	}
+}
+
+// RemoveAll 停止并移除全部任务，取消正在执行的任务并等待其结束
+func RemoveAll() {
+	lock.Lock()
+	all := jobs
+	jobs = make(map[string]*entry)
+	lock.Unlock()
+
+	for _, e := range all {
+		e.halt()
+	}
+	logger.Debug("all jobs removed", "count", len(all))
+}
+
+// Trigger 立即执行一次任务（暂停的任务也会执行），任务正在执行时合并为一次
+func Trigger(name string) error {
+	e := get(name)
+	if e == nil {
+		return ErrNotFound
+	}
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Reschedule 按任务当前的间隔重新计算下一次执行时间，从现在起计时，不立即执行
+// 用于配置重载后间隔立即生效，否则要等到按旧间隔计划的下一次执行之后；任务正在执行时在其结束后生效
+func Reschedule(name string) error {
+	e := get(name)
+	if e == nil {
+		return ErrNotFound
+	}
+	select {
+	case e.resched <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetPaused 暂停或恢复任务的定时执行
+func SetPaused(name string, paused bool) error {
+	e := get(name)
+	if e == nil {
+		return ErrNotFound
+	}
+	if e.paused.Swap(paused) != paused {
+		logger.Info("job paused", "job", name, "paused", paused)
+	}
+	return nil
+}
+
+// List 返回所有任务的状态，按名称排序
+func List() []Status {
+	lock.Lock()
+	list := make([]Status, 0, len(jobs))
+	for _, e := range jobs {
+		list = append(list, e.status())
+	}
+	lock.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Lookup 返回任务的状态
+func Lookup(name string) (Status, error) {
+	e := get(name)
+	if e == nil {
+		return Status{}, ErrNotFound
+	}
+	return e.status(), nil
+}
+
+func get(name string) *entry {
+	lock.Lock()
+	defer lock.Unlock()
+	return jobs[name]
+}
+
+// halt 停止任务循环，取消正在执行的一次并等待其退出
+func (e *entry) halt() {
+	e.cancel()
+	close(e.stop)
+	<-e.done
+}
+
+func (e *entry) status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return Status{
+		Name:      e.job.Name,
+		Paused:    e.paused.Load(),
+		Running:   e.running.Load(),
+		LastRun:   e.lastRun,
+		LastError: e.lastError,
+		LastOK:    e.lastOK,
+		NextRun:   e.nextRun,
+		Runs:      e.runs.Value(),
+		Failures:  e.errors.Value(),
+		Failing:   e.failures,
+		Rows:      e.rows.Value(),
+	}
+}
+
+// next 计算下一次等待时间，间隔不大于 0 时每分钟重新检查
+func (e *entry) next() (time.Duration, bool) {
+	every := e.job.Every()
+	if every <= 0 {
+		return time.Minute, false
+	}
+	if e.job.Jitter > 0 {
+		every += time.Duration((rand.Float64()*2 - 1) * e.job.Jitter * float64(every))
+	}
+	return max(every, time.Millisecond), true
+}
+
+// loop 任务调度循环
+func (e *entry) loop() {
+	defer close(e.done)
+
+	wait, enabled := e.job.Delay, true
+	for {
+		// nextRun 仅用于展示，实际等待由按单调时钟计时的定时器决定，不受系统时间跳变影响
+		e.mu.Lock()
+		e.nextRun = time.Now().Add(wait)
+		e.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		triggered := false
+		select {
+		case <-timer.C:
+		case <-e.trigger:
+			timer.Stop()
+			triggered = true
+		case <-e.resched:
+			timer.Stop()
+			wait, enabled = e.next()
+			continue
+		case <-e.stop:
+			timer.Stop()
+			return
+		}
+
+		if triggered || (enabled && !e.paused.Load()) {
+			e.run()
+		}
+		wait, enabled = e.next()
+	}
+}
+
+// run 执行一次任务并记录结果
+func (e *entry) run() {
+	start := time.Now()
+	e.running.Store(true)
+	e.mu.Lock()
+	e.lastRun = start
+	e.mu.Unlock()
+
+	var rows int64
+	err := e.job.Run(context.WithValue(e.ctx, rowsKey{}, &rows))
+
+	e.running.Store(false)
+	e.runs.Inc()
+	e.duration.ObserveSince(start)
+	// 失败前已完成的部分同样计入
+	if rows > 0 {
+		e.rows.Add(uint64(rows))
+	}
+	r := Run{Start: start, Duration: time.Since(start), Rows: rows}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	e.mu.Lock()
+	e.lastError = r.Error
+	if err == nil {
+		e.lastOK = start.Add(r.Duration)
+	}
+	e.record(r)
+	e.mu.Unlock()
+	if err != nil {
+		e.errors.Inc()
+		logger.Warn("job failed", "job", e.job.Name, "error", err)
+		return
+	}
+	e.lastOKTS.Set(time.Now().Unix())
+}
@@ -0,0 +1,164 @@
+package scheduler
+
+import (
+	"StealthIMSession/config"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTriggerPausedJob(t *testing.T) {
+	ran := make(chan struct{}, 10)
+	Add(Job{
+		Name:  "test_trigger",
+		Every: func() time.Duration { return time.Millisecond },
+		Delay: time.Hour,
+		Run: func(context.Context) error {
+			ran <- struct{}{}
+			return errors.New("boom")
+		},
+	})
+	defer Remove("test_trigger")
+
+	if err := SetPaused("test_trigger", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := Trigger("test_trigger"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("triggered job did not run")
+	}
+
+	// 暂停后不再按间隔执行
+	select {
+	case <-ran:
+		t.Fatal("paused job ran on schedule")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	list := List()
+	if len(list) != 1 || list[0].Runs != 1 || list[0].Failures != 1 || list[0].LastError != "boom" || !list[0].Paused {
+		t.Fatalf("List() = %+v", list)
+	}
+	if err := Trigger("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Trigger(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestHistoryAndFailureStreak(t *testing.T) {
+	config.LatestConfig.Scheduler.History = 2
+	config.LatestConfig.Scheduler.FailureAlert = 2
+
+	done := make(chan struct{}, 10)
+	calls := 0
+	Add(Job{
+		Name:  "test_history",
+		Every: func() time.Duration { return time.Hour },
+		Delay: time.Hour,
+		Run: func(ctx context.Context) error {
+			defer func() { done <- struct{}{} }()
+			calls++
+			ReportRows(ctx, int64(calls))
+			if calls > 1 {
+				return errors.New("boom")
+			}
+			return nil
+		},
+	})
+	defer Remove("test_history")
+
+	for i := 0; i < 3; i++ {
+		Trigger("test_history")
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("triggered job did not run")
+		}
+	}
+
+	// 只保留最近 2 条，最新的在前；记录在任务函数返回后写入
+	var runs []Run
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if runs, _ = History("test_history"); len(runs) == 2 && runs[0].Rows == 3 {
+			break
+		}
+	}
+	if len(runs) != 2 || runs[0].Rows != 3 || runs[1].Rows != 2 || runs[0].Error != "boom" {
+		t.Fatalf("History() = %+v", runs)
+	}
+	if st := List(); len(st) != 1 || st[0].Failing != 2 {
+		t.Fatalf("List() = %+v", st)
+	}
+	if _, err := History("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("History(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRemoveCancelsRunningJob(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	Add(Job{
+		Name:  "test_cancel",
+		Every: func() time.Duration { return time.Hour },
+		Delay: time.Hour,
+		Run: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			close(cancelled)
+			return ctx.Err()
+		},
+	})
+	Trigger("test_cancel")
+	<-started
+
+	removed := make(chan struct{})
+	go func() {
+		Remove("test_cancel")
+		close(removed)
+	}()
+	select {
+	case <-removed:
+	case <-time.After(time.Second):
+		t.Fatal("Remove() did not return while the job was running")
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("running job was not cancelled")
+	}
+}
+
+func TestReschedule(t *testing.T) {
+	var every atomic.Int64
+	every.Store(int64(time.Hour))
+	ran := make(chan struct{}, 10)
+	Add(Job{
+		Name:  "test_reschedule",
+		Every: func() time.Duration { return time.Duration(every.Load()) },
+		Delay: time.Hour,
+		Run: func(context.Context) error {
+			ran <- struct{}{}
+			return nil
+		},
+	})
+	defer Remove("test_reschedule")
+
+	// 缩短间隔后无需等待按旧间隔计划的执行
+	every.Store(int64(10 * time.Millisecond))
+	if err := Reschedule("test_reschedule"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("rescheduled job did not run with the new interval")
+	}
+	if err := Reschedule("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Reschedule(missing) = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,96 @@
+package startup
+
+import (
+	"StealthIMSession/buildinfo"
+	"StealthIMSession/config"
+	"StealthIMSession/gateway"
+	"StealthIMSession/logging"
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+var logger = logging.For("startup")
+
+// BackendStatus 后端连通性检查结果
+type BackendStatus struct {
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// Report 启动报告
+type Report struct {
+	Service    string          `json:"service"`
+	Version    string          `json:"version"`
+	Commit     string          `json:"commit"`
+	BuildDate  string          `json:"build_date"`
+	StartedAt  time.Time       `json:"started_at"`
+	PID        int             `json:"pid"`
+	ConfigPath string          `json:"config_path"`
+	Config     config.Config   `json:"config"`
+	Digest     string          `json:"config_digest"`
+	Features   map[string]bool `json:"features"`
+	Backends   []BackendStatus `json:"backends"`
+}
+
+// New 根据当前配置生成启动报告（不含后端检查结果），敏感字段被隐去
+func New(cfg config.Config, features map[string]bool) *Report {
+	return &Report{
+		Service:    "StealthIMSession",
+		Version:    buildinfo.Version,
+		Commit:     buildinfo.Commit,
+		BuildDate:  buildinfo.BuildDate,
+		StartedAt:  time.Now(),
+		PID:        os.Getpid(),
+		ConfigPath: config.Path(),
+		Config:     config.Redacted(cfg),
+		Digest:     config.Digest(cfg),
+		Features:   features,
+	}
+}
+
+// CheckBackends 检查正在使用的后端的连通性，DBGateway 连接为异步建立，最多等待 wait
+func (r *Report) CheckBackends(wait time.Duration) {
+	deadline := time.Now().Add(wait)
+	for _, b := range gateway.Backends() {
+		status := BackendStatus{Name: b.Name, Addr: b.Addr}
+		for {
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			err := b.Ping(ctx)
+			cancel()
+			status.LatencyMs = time.Since(start).Milliseconds()
+			if err == nil {
+				status.OK = true
+				status.Error = ""
+				break
+			}
+			status.Error = err.Error()
+			if time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+		r.Backends = append(r.Backends, status)
+	}
+}
+
+// Emit 以 JSON 格式输出报告到日志，path 不为空时同时写入文件
+func (r *Report) Emit(path string) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		logger.Error("failed to encode startup report", "error", err)
+		return
+	}
+	logger.Info("startup report", "report", string(data))
+	if path == "" {
+		return
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logger.Warn("failed to write startup report", "path", path, "error", err)
+	}
+}
@@ -68,7 +68,7 @@ async def measure_operation(client: SessionClient, operation: str, *args, **kwar
         elif operation == "del":
             session_id = args[0] if args else kwargs.get("session_id", "")
             result = await client.delete_session(session_id)
-            success = result == 0
+            success = result in (0, 2)
         else:
             raise ValueError(f"未知操作: {operation}")
 
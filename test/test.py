@@ -33,8 +33,8 @@ GET_SESSION_CASES = [
 DELETE_SESSION_CASES = [
     # (session_id, 预期状态码)
     pytest.param("valid_session", 0, id="delete_valid_session"),
-    pytest.param("invalid_session", 0, id="delete_invalid_session"),
-    pytest.param("", 0, id="delete_empty_session"),  # 服务返回0
+    pytest.param("invalid_session", 2, id="delete_invalid_session"),  # 不存在的会话返回2
+    pytest.param("", 2, id="delete_empty_session"),
 ]
 
 # 多轮会话测试场景 - 根据实际行为调整预期值
@@ -156,6 +156,17 @@ async def test_delete_session(client: SessionClient, session_id: str, expected_c
     assert result == expected_code, f"删除会话应返回状态码 {expected_code}，但得到 {result}"
 
 
+@pytest.mark.asyncio
+async def test_delete_session_twice(client: SessionClient):
+    """测试重复删除会话"""
+    code, session_id = await client.set_session(606)
+    assert code == 0, "设置会话失败，无法继续测试"
+
+    assert await client.delete_session(session_id) == 0, "首次删除应返回状态码 0"
+    assert await client.delete_session(session_id) == 2, "重复删除应返回状态码 2"
+    assert (await client.get_session(session_id))[0] == 1, "已删除的会话不应再可用"
+
+
 @pytest.mark.asyncio
 @pytest.mark.parametrize("scenario_name, uid, operations", SESSION_LIFECYCLE_SCENARIOS)
 async def test_session_lifecycle_scenarios(client: SessionClient, scenario_name: str, uid: int, operations: List):
@@ -241,6 +252,141 @@ async def test_session_lifecycle_scenarios(client: SessionClient, scenario_name:
             assert False, f"未知的操作类型: {operation}"
 
 
+@pytest.mark.asyncio
+async def test_list_sessions(client: SessionClient):
+    """测试获取用户会话列表"""
+    uid = 303
+    first = await client.set_session(uid)
+    second = await client.set_session(uid)
+    assert first[0] == 0 and second[0] == 0, "设置会话失败，无法继续测试会话列表"
+
+    code, sessions = await client.list_sessions(uid)
+    assert code == 0, f"获取会话列表应返回状态码 0，但得到 {code}"
+    assert first[1] in sessions and second[1] in sessions, "会话列表应包含新建的会话"
+
+    assert await client.delete_session(first[1]) == 0, "删除会话失败"
+    code, sessions = await client.list_sessions(uid)
+    assert code == 0, f"获取会话列表应返回状态码 0，但得到 {code}"
+    assert first[1] not in sessions, "已删除的会话不应出现在列表中"
+    assert second[1] in sessions, "未删除的会话应保留在列表中"
+
+
+@pytest.mark.asyncio
+async def test_list_sessions_paged(client: SessionClient):
+    """测试分页与过滤获取用户会话列表"""
+    uid = 313
+    created = []
+    for i in range(5):
+        code, session_id = await client.set_session(uid)
+        assert code == 0, "设置会话失败，无法继续测试分页"
+        created.append(session_id)
+
+    # 逐页读取，直到没有下一页
+    seen = []
+    cursor = ""
+    while True:
+        code, sessions, cursor = await client.list_sessions_page(
+            uid, {"sort": "session_id", "limit": 2, "cursor": cursor})
+        assert code == 0, f"分页获取会话应返回状态码 0，但得到 {code}"
+        assert len(sessions) <= 2, "每页数量不应超过 limit"
+        seen.extend(sessions)
+        if not cursor:
+            break
+    assert seen == sorted(seen), "按 session_id 排序的结果应有序"
+    assert len(seen) == len(set(seen)), "分页结果不应重复"
+    assert set(created) <= set(seen), "分页结果应包含所有新建的会话"
+
+    # 前缀过滤
+    prefix = created[0][:8]
+    code, sessions, _ = await client.list_sessions_page(
+        uid, {"filters": [{"field": "session_id", "op": "prefix", "value": prefix}]})
+    assert code == 0 and created[0] in sessions, "前缀过滤应包含匹配的会话"
+    assert all(s.startswith(prefix) for s in sessions), "前缀过滤结果应全部匹配"
+
+    # 未知字段
+    code, _, _ = await client.list_sessions_page(
+        uid, {"filters": [{"field": "uid", "op": "eq", "value": "1"}]})
+    assert code == 2, f"非法查询应返回状态码 2，但得到 {code}"
+
+
+@pytest.mark.asyncio
+async def test_delete_all_sessions(client: SessionClient):
+    """测试删除用户所有会话"""
+    uid = 404
+    first = await client.set_session(uid)
+    second = await client.set_session(uid)
+    assert first[0] == 0 and second[0] == 0, "设置会话失败，无法继续测试"
+
+    # 先读取一次，确保会话进入缓存
+    assert (await client.get_session(first[1]))[0] == 0, "获取会话失败"
+
+    code, deleted = await client.delete_all_sessions(uid)
+    assert code == 0, f"删除用户所有会话应返回状态码 0，但得到 {code}"
+    assert deleted >= 2, f"应至少删除 2 个会话，但删除了 {deleted}"
+
+    assert (await client.get_session(first[1]))[0] == 1, "已删除的会话不应再可用"
+    assert (await client.get_session(second[1]))[0] == 1, "已删除的会话不应再可用"
+
+
+@pytest.mark.asyncio
+async def test_route_hints(client: SessionClient):
+    """测试批量获取路由提示"""
+    first = await client.set_session(808)
+    second = await client.set_session(809)
+    assert first[0] == 0 and second[0] == 0, "设置会话失败，无法继续测试"
+
+    code, hints = await client.get_route_hints([808, 809, 999999998])
+    assert code == 0, f"获取路由提示应返回状态码 0，但得到 {code}"
+    assert first[1] in hints.get(808, []), "路由提示应包含用户的会话"
+    assert second[1] in hints.get(809, []), "路由提示应包含用户的会话"
+    assert 999999998 not in hints, "没有会话的用户不应出现在结果中"
+
+
+@pytest.mark.asyncio
+async def test_session_custom_ttl(client: SessionClient):
+    """测试会话独立有效期"""
+    code, session_id = await client.set_session(505, ttl_seconds=2)
+    assert code == 0, "设置会话失败，无法继续测试"
+    assert (await client.get_session(session_id))[0] == 0, "有效期内应能获取会话"
+
+    await asyncio.sleep(3)
+    assert (await client.get_session(session_id))[0] == 1, "过期会话不应再可用"
+
+
+@pytest.mark.asyncio
+async def test_renew_session(client: SessionClient):
+    """测试延长会话有效期"""
+    code, session_id = await client.set_session(707, ttl_seconds=3)
+    assert code == 0, "设置会话失败，无法继续测试"
+
+    await asyncio.sleep(2)
+    code, expires_at = await client.renew_session(session_id)
+    assert code == 0, f"延长会话应返回状态码 0，但得到 {code}"
+    assert expires_at > 0, "延长会话应返回新的过期时间"
+
+    # 初始有效期已过，但续期后仍有效
+    await asyncio.sleep(2)
+    assert (await client.get_session(session_id))[0] == 0, "续期后的会话应仍可用"
+
+    assert (await client.renew_session("invalid_session"))[0] == 1, "无效会话不应能续期"
+
+
+@pytest.mark.asyncio
+async def test_set_prime_cache(client: SessionClient):
+    """测试 Set 的读写一致选项"""
+    code, session_id = await client.set_session(606, prime_cache=True)
+    assert code == 0, f"设置会话应返回状态码 0，但得到 {code}"
+
+    # 另一个客户端（可能连到其他副本）立即读取也应命中
+    other = SessionClient()
+    await other.connect()
+    try:
+        result = await other.get_session(session_id)
+    finally:
+        await other.disconnect()
+    assert result == (0, 606), f"预热后应立即获取到会话，但得到 {result}"
+
+
 @pytest.mark.asyncio
 async def test_reload_service(client: SessionClient):
     """测试服务重载功能"""
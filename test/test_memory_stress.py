@@ -69,7 +69,7 @@ async def delete_session(client: SessionClient, session_id: str) -> bool:
     """删除会话"""
     try:
         result = await client.delete_session(session_id)
-        return result == 0
+        return result in (0, 2)  # 2: 会话已被其他客户端删除
     except Exception as e:
         logger.error(f"删除会话失败: {e}")
         return False
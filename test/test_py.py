@@ -64,11 +64,13 @@ class SessionClient:
             logger.error(f"Ping失败: {e}")
             return False
 
-    async def set_session(self, uid: int) -> Tuple[int, str]:
+    async def set_session(self, uid: int, ttl_seconds: int = 0, prime_cache: bool = False) -> Tuple[int, str]:
         """设置会话
 
         Args:
             uid: 用户ID
+            ttl_seconds: 会话有效期（秒），0 表示使用服务默认有效期
+            prime_cache: 返回前是否预热缓存（读写一致）
 
         Returns:
             Tuple[int, str]: (状态码, 会话ID)
@@ -77,7 +79,8 @@ class SessionClient:
 
             async with self.channel as channel:
                 stub = session_grpc.StealthIMSessionStub(channel)
-                request = session_pb2.SetRequest(uid=uid)
+                request = session_pb2.SetRequest(
+                    uid=uid, ttl_seconds=ttl_seconds, prime_cache=prime_cache)
                 response = await stub.Set(request)
 
             code = response.result.code
@@ -164,6 +167,154 @@ class SessionClient:
             logger.error(f"删除会话时发生异常: {e}")
             return -1
 
+    async def renew_session(self, session_id: str) -> Tuple[int, int]:
+        """延长会话有效期
+
+        Args:
+            session_id: 会话ID
+
+        Returns:
+            Tuple[int, int]: (状态码, 新的过期时间戳)
+        """
+        try:
+            async with self.channel as channel:
+                stub = session_grpc.StealthIMSessionStub(channel)
+                request = session_pb2.RenewRequest(session=session_id)
+                response = await stub.Renew(request)
+
+            code = response.result.code
+
+            if code == 0:
+                logger.info(f"延长会话成功: 会话ID={session_id}, 过期时间={response.expires_at}")
+            else:
+                logger.warning(
+                    f"延长会话失败: 会话ID={session_id}, 状态码={code}, 信息={response.result.msg}")
+
+            return (code, response.expires_at)
+        except GRPCError as e:
+            logger.error(f"延长会话时发生gRPC错误: {e}")
+            return (e.status, 0)
+        except Exception as e:
+            logger.error(f"延长会话时发生异常: {e}")
+            return (-1, 0)
+
+    async def list_sessions(self, uid: int) -> Tuple[int, List[str]]:
+        """获取用户所有会话
+
+        Args:
+            uid: 用户ID
+
+        Returns:
+            Tuple[int, List[str]]: (状态码, 会话ID列表)
+        """
+        code, sessions, _ = await self.list_sessions_page(uid, None)
+        return (code, sessions)
+
+    async def list_sessions_page(self, uid: int, query: Optional[Dict[str, Any]] = None) -> Tuple[int, List[str], str]:
+        """分页获取用户会话
+
+        Args:
+            uid: 用户ID
+            query: 查询选项（filters/sort/desc/cursor/limit），None 表示获取完整列表
+
+        Returns:
+            Tuple[int, List[str], str]: (状态码, 会话ID列表, 下一页游标)
+        """
+        try:
+            async with self.channel as channel:
+                stub = session_grpc.StealthIMSessionStub(channel)
+                request = session_pb2.ListSessionsByUIDRequest(uid=uid)
+                if query is not None:
+                    request.query.CopyFrom(session_pb2.QueryOptions(
+                        filters=[session_pb2.QueryFilter(**f)
+                                 for f in query.get("filters", [])],
+                        sort=query.get("sort", ""),
+                        desc=query.get("desc", False),
+                        cursor=query.get("cursor", ""),
+                        limit=query.get("limit", 0),
+                    ))
+                response = await stub.ListSessionsByUID(request)
+
+            code = response.result.code
+            sessions = [s.session for s in response.sessions]
+
+            if code == 0:
+                logger.info(f"获取会话列表成功: UID={uid}, 数量={len(sessions)}")
+            else:
+                logger.warning(
+                    f"获取会话列表失败: UID={uid}, 状态码={code}, 信息={response.result.msg}")
+
+            return (code, sessions, response.next_cursor)
+        except GRPCError as e:
+            logger.error(f"获取会话列表时发生gRPC错误: {e}")
+            return (e.status, [], "")
+        except Exception as e:
+            logger.error(f"获取会话列表时发生异常: {e}")
+            return (-1, [], "")
+
+    async def get_route_hints(self, uids: List[int]) -> Tuple[int, Dict[int, List[str]]]:
+        """批量获取用户会话的路由提示
+
+        Args:
+            uids: 用户ID列表
+
+        Returns:
+            Tuple[int, Dict[int, List[str]]]: (状态码, uid 到会话ID列表的映射)
+        """
+        try:
+            async with self.channel as channel:
+                stub = session_grpc.StealthIMSessionStub(channel)
+                request = session_pb2.GetRouteHintsBulkRequest(uids=uids)
+                response = await stub.GetRouteHintsBulk(request)
+
+            code = response.result.code
+            hints = {u.uid: [h.session for h in u.hints] for u in response.users}
+
+            if code == 0:
+                logger.info(f"获取路由提示成功: 用户数={len(hints)}")
+            else:
+                logger.warning(
+                    f"获取路由提示失败: 状态码={code}, 信息={response.result.msg}")
+
+            return (code, hints)
+        except GRPCError as e:
+            logger.error(f"获取路由提示时发生gRPC错误: {e}")
+            return (e.status, {})
+        except Exception as e:
+            logger.error(f"获取路由提示时发生异常: {e}")
+            return (-1, {})
+
+    async def delete_all_sessions(self, uid: int) -> Tuple[int, int]:
+        """删除用户所有会话
+
+        Args:
+            uid: 用户ID
+
+        Returns:
+            Tuple[int, int]: (状态码, 删除数量)
+        """
+        try:
+            async with self.channel as channel:
+                stub = session_grpc.StealthIMSessionStub(channel)
+                request = session_pb2.DelAllByUIDRequest(uid=uid)
+                response = await stub.DelAllByUID(request)
+
+            code = response.result.code
+
+            if code == 0:
+                logger.info(f"删除用户所有会话成功: UID={uid}, 数量={response.deleted}")
+            else:
+                logger.warning(
+                    f"删除用户所有会话失败: UID={uid}, 状态码={code}, 信息={response.result.msg}")
+
+            return (code, response.deleted)
+        except GRPCError as e:
+            logger.error(f"删除用户所有会话时发生gRPC错误: {e}")
+            return (e.status, 0)
+        except Exception as e:
+            logger.error(f"删除用户所有会话时发生异常: {e}")
+            return (-1, 0)
+
     async def reload_service(self) -> int:
         """重新加载服务配置
 